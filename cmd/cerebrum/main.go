@@ -0,0 +1,201 @@
+// Package main is the cerebrum command line interface
+//
+// Usage:
+//
+//	cerebrum [-config path] migrate up [n]      apply all or the next n pending migrations
+//	cerebrum [-config path] migrate down [n]    revert the last or the last n migrations
+//	cerebrum [-config path] migrate status      list migrations and whether they are applied
+//	cerebrum migrate create <name>              generate a new, empty migration file
+//	cerebrum [-config path] keys reencrypt      seal users again with the active key
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/johncoleman83/cerebrum/pkg/api/migrations"
+	"github.com/johncoleman83/cerebrum/pkg/api/store"
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
+	"github.com/johncoleman83/cerebrum/pkg/utl/keyring"
+	"github.com/johncoleman83/cerebrum/pkg/utl/migrate"
+	"github.com/johncoleman83/cerebrum/pkg/utl/support"
+)
+
+const usage = `usage: cerebrum [-config path] migrate up|down|status [n]
+       cerebrum migrate create <name>
+       cerebrum [-config path] keys reencrypt`
+
+// reencryptBatch is the number of users sealed again per transaction
+const reencryptBatch = 100
+
+// migrationsDir returns the path of the migrations package source directory
+func migrationsDir() string {
+	_, b, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(b), "..", "..", "pkg", "api", "migrations")
+}
+
+// main cerebrum cli
+func main() {
+	cfgPath, err := support.ExtractPathFromFlags()
+	if err != nil {
+		log.Fatal(err)
+	}
+	args := flag.Args()
+	if len(args) < 2 {
+		log.Fatal(usage)
+	}
+	switch {
+	case args[0] == "migrate":
+		err = runMigrate(cfgPath, args[1], args[2:])
+	case args[0] == "keys" && args[1] == "reencrypt" && len(args) == 2:
+		err = runReencrypt(cfgPath)
+	default:
+		err = errors.New(usage)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// openDB loads the config and connects to its database
+func openDB(cfgPath string) (*config.Configuration, *gorm.DB, error) {
+	cfg, err := config.LoadConfigFrom(cfgPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg == nil {
+		return nil, nil, fmt.Errorf("unknown error loading yaml file")
+	}
+	cfg.DB.LogLevel = datastore.LogSilent
+	db, err := datastore.NewGormDb(cfg.DB)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, db, nil
+}
+
+// runReencrypt seals every user whose personal data was sealed with a retired
+// key, or was never sealed, with the active key of the config. It is run
+// after a key rotation and once after upgrading a plaintext database, the
+// retired key must be kept in the config until it completed.
+func runReencrypt(cfgPath string) error {
+	cfg, db, err := openDB(cfgPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	kr, err := keyring.New(cfg.Encryption)
+	if err != nil {
+		return err
+	}
+	udb := store.NewUserDBClient(kr)
+	tx := datastore.NewTransactor(db)
+	ctx := context.Background()
+
+	total := 0
+	for after := uint(0); ; {
+		var last uint
+		var count int
+		err := tx.Transaction(ctx, func(tx *gorm.DB) (err error) {
+			last, count, err = udb.Reencrypt(ctx, tx, after, reencryptBatch)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		total += count
+		if last == 0 {
+			break
+		}
+		after = last
+	}
+	fmt.Printf("sealed %d users with the active key\n", total)
+	return nil
+}
+
+// runMigrate executes a single migrate subcommand
+func runMigrate(cfgPath, cmd string, args []string) error {
+	if cmd == "create" {
+		if len(args) != 1 {
+			return errors.New(usage)
+		}
+		path, err := migrate.Create(migrationsDir(), args[0], time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created %s\n", path)
+		return nil
+	}
+
+	if cmd != "up" && cmd != "down" && cmd != "status" {
+		return errors.New(usage)
+	}
+	steps := 0
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return fmt.Errorf("step count must be a positive integer, got %q", args[0])
+		}
+		steps = n
+	}
+
+	cfg, db, err := openDB(cfgPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	// the keys are only required by migrations backfilling encrypted data,
+	// which report ErrNoCipher without them
+	mdb := db
+	if kr, err := keyring.New(cfg.Encryption); err == nil {
+		mdb = migrations.WithCipher(db, kr)
+	}
+	m, err := migrations.New(mdb)
+	if err != nil {
+		return err
+	}
+
+	switch cmd {
+	case "up":
+		done, err := m.Up(steps)
+		for _, mg := range done {
+			fmt.Printf("applied  %d_%s\n", mg.Version, mg.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Println("schema is up to date")
+		}
+		return err
+	case "down":
+		done, err := m.Down(steps)
+		for _, mg := range done {
+			fmt.Printf("reverted %d_%s\n", mg.Version, mg.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Println("no migrations to revert")
+		}
+		return err
+	case "status":
+		status, err := m.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range status {
+			state := "pending"
+			if s.AppliedAt != nil {
+				state = "applied " + s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%d_%s\t%s\n", s.Version, s.Name, state)
+		}
+	}
+	return nil
+}
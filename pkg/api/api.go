@@ -1,7 +1,10 @@
 package api
 
 import (
+	"context"
 	"crypto/sha1"
+	"log"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	"github.com/labstack/echo"
@@ -9,70 +12,241 @@ import (
 	// cerebrum/pkg/api
 	"github.com/johncoleman83/cerebrum/pkg/api/auth"
 	al "github.com/johncoleman83/cerebrum/pkg/api/auth/logging"
+	am "github.com/johncoleman83/cerebrum/pkg/api/auth/metrics"
+	atr "github.com/johncoleman83/cerebrum/pkg/api/auth/tracing"
 	at "github.com/johncoleman83/cerebrum/pkg/api/auth/transport"
+	"github.com/johncoleman83/cerebrum/pkg/api/migrations"
 	"github.com/johncoleman83/cerebrum/pkg/api/password"
 	pl "github.com/johncoleman83/cerebrum/pkg/api/password/logging"
+	pm "github.com/johncoleman83/cerebrum/pkg/api/password/metrics"
+	ptr "github.com/johncoleman83/cerebrum/pkg/api/password/tracing"
 	pt "github.com/johncoleman83/cerebrum/pkg/api/password/transport"
+	"github.com/johncoleman83/cerebrum/pkg/api/store"
 	"github.com/johncoleman83/cerebrum/pkg/api/user"
 	ul "github.com/johncoleman83/cerebrum/pkg/api/user/logging"
+	um "github.com/johncoleman83/cerebrum/pkg/api/user/metrics"
+	utr "github.com/johncoleman83/cerebrum/pkg/api/user/tracing"
 	ut "github.com/johncoleman83/cerebrum/pkg/api/user/transport"
 
 	// cerebrum/pkg/utl
+	"github.com/johncoleman83/cerebrum/pkg/utl/cache"
 	"github.com/johncoleman83/cerebrum/pkg/utl/config"
 	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
+	"github.com/johncoleman83/cerebrum/pkg/utl/eventbus"
+	"github.com/johncoleman83/cerebrum/pkg/utl/idempotency"
+	"github.com/johncoleman83/cerebrum/pkg/utl/keyring"
+	"github.com/johncoleman83/cerebrum/pkg/utl/metrics"
 	jwtService "github.com/johncoleman83/cerebrum/pkg/utl/middleware/jsonwebtoken"
+	"github.com/johncoleman83/cerebrum/pkg/utl/ratelimit"
 	rbacService "github.com/johncoleman83/cerebrum/pkg/utl/rbac"
 	"github.com/johncoleman83/cerebrum/pkg/utl/secure"
 	"github.com/johncoleman83/cerebrum/pkg/utl/server"
+	"github.com/johncoleman83/cerebrum/pkg/utl/tracing"
 	"github.com/johncoleman83/cerebrum/pkg/utl/zlog"
 )
 
 // newServices initializes new services for API
-func newServices(cfg *config.Configuration) (rbac *rbacService.Service, jwt *jwtService.Service, sec *secure.Service, log *zlog.Log, e *echo.Echo) {
+func newServices(cfg *config.Configuration, log *zlog.Log, health *server.Health) (rbac *rbacService.Service, jwt *jwtService.Service, sec *secure.Service, e *echo.Echo) {
 	sec = secure.New(cfg.App.MinPasswordStr, sha1.New())
 	rbac = rbacService.New()
 	jwt = jwtService.New(cfg.JWT.Secret, cfg.JWT.SigningAlgorithm, cfg.JWT.Duration)
-	log = zlog.New()
-	e = server.New()
+	e = server.New(health)
+	// after the request id middleware of server.New
+	e.Pre(log.AccessLog())
 
-	return rbac, jwt, sec, log, e
+	return rbac, jwt, sec, e
+}
+
+// newProbes returns the probes of the server, which is ready once the db
+// and the cache, if any, are reachable
+func newProbes(db *gorm.DB, c cache.Cache, cfg *config.Server) *server.Probes {
+	p := server.NewProbes(time.Duration(cfg.ProbeTimeout) * time.Millisecond)
+	p.Register("database", server.CheckerFunc(db.DB().PingContext), 0)
+	if m, ok := c.(*cache.Metered); ok {
+		p.Register("cache", server.CheckerFunc(func(ctx context.Context) error {
+			// reads the unmetered cache so that probes do not count as misses
+			_, _, err := m.Cache.Get(ctx, "readyz")
+			return err
+		}), 0)
+	}
+	return p
 }
 
 // initializeControllers initializes new HTTP services for each controller
-func initializeControllers(db *gorm.DB, rbac *rbacService.Service, jwt *jwtService.Service, sec *secure.Service, log *zlog.Log, e *echo.Echo) {
-	at.NewHTTP(al.New(auth.Initialize(db, jwt, sec, rbac), log), e, jwt.MWFunc())
+func initializeControllers(db *gorm.DB, udb *store.CachedUserDBClient, rbac *rbacService.Service, jwt *jwtService.Service, sec *secure.Service, log *zlog.Log, m *metrics.Metrics, tr *tracing.Tracing, rl *ratelimit.Limiter, idem *idempotency.Keys, evt *eventbus.Outbox, e *echo.Echo) {
+	at.NewHTTP(atr.New(al.New(am.New(auth.Initialize(db, udb, jwt, sec, rbac, evt), m), log), tr.Tracer()), e, jwt.MWFunc())
 
 	v1 := e.Group("/v1")
-	v1.Use(jwt.MWFunc())
+	v1.Use(jwt.MWFunc(), rl.Middleware("v1"), idem.Middleware())
 
-	ut.NewHTTP(ul.New(user.Initialize(db, rbac, sec), log), v1)
-	pt.NewHTTP(pl.New(password.Initialize(db, rbac, sec), log), v1)
+	ut.NewHTTP(utr.New(ul.New(um.New(user.Initialize(db, udb, rbac, sec, evt), m), log), tr.Tracer()), v1)
+	pt.NewHTTP(ptr.New(pl.New(pm.New(password.Initialize(db, udb, rbac, sec, evt), m), log), tr.Tracer()), v1)
+}
+
+// newMetrics returns the metrics of the api, including the statistics of
+// the db pools and of the cache, if any
+func newMetrics(db *gorm.DB, c cache.Cache) (*metrics.Metrics, error) {
+	m := metrics.New()
+	if err := m.Register(metrics.NewDBCollector(func() datastore.Stats { return datastore.StatsOf(db) })); err != nil {
+		return nil, err
+	}
+	if mc, ok := c.(*cache.Metered); ok {
+		if err := m.Register(metrics.NewCacheCollector(mc.Stats)); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// startDispatcher starts fanning out outbox events to the broker's subscribers
+// in the background, it stops once the returned cancel func is called
+func startDispatcher(db *gorm.DB, broker eventbus.Broker, cfg *config.Configuration) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	go eventbus.NewDispatcher(db, broker, cfg.Events).Run(ctx)
+	return cancel
+}
+
+// startReplicaChecks starts checking the health of the read replicas of db
+// in the background, the returned cancel func stops it and closes the
+// connection pools of the replicas
+func startReplicaChecks(db *gorm.DB) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := datastore.ReplicasOf(db)
+	if r == nil {
+		return cancel
+	}
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+		if err := r.Close(); err != nil {
+			log.Printf("closing replicas: %v", err)
+		}
+	}
+}
+
+// startPurger starts purging expired soft deleted users in the background,
+// it stops once the returned cancel func is called
+func startPurger(db *gorm.DB, kr *keyring.Keyring, evt *eventbus.Outbox, cfg *config.Configuration) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	go user.NewPurger(db, kr, evt, cfg.Trash).Run(ctx)
+	return cancel
+}
+
+// startKeyPurger starts purging expired idempotency keys in the background,
+// it stops once the returned cancel func is called
+func startKeyPurger(idem *idempotency.Keys) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	go idem.Run(ctx)
+	return cancel
+}
+
+// checkSchema returns an error if the db has pending migrations
+func checkSchema(db *gorm.DB) error {
+	m, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+	return m.EnsureCurrent()
 }
 
 // startServer starts HTTP server with correct config & initialized services
-func startServer(e *echo.Echo, cfg *config.Configuration) {
+func startServer(e *echo.Echo, probes *server.Probes, cfg *config.Configuration) {
 	server.Start(e, &server.Config{
 		Port:                cfg.Server.Port,
 		ReadTimeoutSeconds:  cfg.Server.ReadTimeout,
 		WriteTimeoutSeconds: cfg.Server.WriteTimeout,
 		Debug:               cfg.Server.Debug,
+		Probes:              probes,
+		DrainSeconds:        cfg.Server.ShutdownDrain,
 	})
 }
 
 // Start starts the API service
 func Start(cfg *config.Configuration) error {
-	db, err := datastore.NewMySQLGormDb(cfg.DB)
+	db, err := datastore.NewGormDb(cfg.DB)
 	if err != nil {
 		return err
 	}
+	if err := checkSchema(db); err != nil {
+		return err
+	}
+	kr, err := keyring.New(cfg.Encryption)
+	if err != nil {
+		return err
+	}
+
+	c, ttl, err := cache.New(cfg.Cache)
+	if err != nil {
+		return err
+	}
+	udb := store.NewCachedUserDBClient(kr, c, ttl)
+
+	tr, err := tracing.New(cfg.Tracing)
+	if err != nil {
+		return err
+	}
+	defer tr.Shutdown()
+	if tr.Enabled() {
+		datastore.SetTracer(db, tr.Tracer())
+	}
+
+	stopReplicaChecks := startReplicaChecks(db)
+	defer stopReplicaChecks()
 
-	rbac, jwt, sec, log, e := newServices(cfg)
+	m, err := newMetrics(db, c)
+	if err != nil {
+		return err
+	}
+
+	rl, err := ratelimit.New(cfg.RateLimit)
+	if err != nil {
+		return err
+	}
+
+	log, err := zlog.New(cfg.Logging)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
 
-	initializeControllers(db, rbac, jwt, sec, log, e)
+	health := &server.Health{
+		Token: cfg.Server.HealthToken,
+		Reports: map[string]func() interface{}{
+			"database": func() interface{} { return datastore.StatsOf(db) },
+		},
+	}
+	rbac, jwt, sec, e := newServices(cfg, log, health)
+	e.Use(tr.Middleware(), m.Middleware(), server.ReadYourWrites(datastore.ReplicasOf(db).MaxLag()),
+		rl.Middleware("login", "/login"), rl.Middleware("refresh", "/refresh/:token"))
+	// the metrics expose the db pools as the health reports do
+	e.GET("/metrics", m.Handler(), health.Authorize)
+	probes := newProbes(db, c, cfg.Server)
+	e.GET("/livez", probes.Live)
+	e.GET("/readyz", probes.Ready)
+
+	evt := eventbus.NewOutbox()
+	idem := idempotency.New(db, kr, cfg.Idempotency)
+	initializeControllers(db, udb, rbac, jwt, sec, log, m, tr, rl, idem, evt, e)
+
+	broker := eventbus.NewInMemoryBroker()
+	udb.Subscribe(broker)
+	stopDispatcher := startDispatcher(db, broker, cfg)
+	defer stopDispatcher()
+
+	stopPurger := startPurger(db, kr, evt, cfg)
+	defer stopPurger()
+
+	stopKeyPurger := startKeyPurger(idem)
+	defer stopKeyPurger()
 
 	e.Static("/swaggerui", cfg.App.SwaggerUIPath)
 
-	startServer(e, cfg)
+	startServer(e, probes, cfg)
 
 	return nil
 }
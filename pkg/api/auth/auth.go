@@ -1,22 +1,28 @@
 package auth
 
 import (
+	"context"
 	"net/http"
+	"time"
 
-	"github.com/labstack/echo"
+	"github.com/jinzhu/gorm"
 
 	"github.com/johncoleman83/cerebrum/pkg/utl/models"
 )
 
 // Custom errors
 var (
-	ErrInvalidCredentials = echo.NewHTTPError(http.StatusUnauthorized, "Username or password is not authorized")
+	ErrInvalidCredentials = models.NewError(http.StatusUnauthorized, "invalid_credentials", "Username or password is not authorized")
 )
 
-// Authenticate tries to authenticate the user provided by username and password
-func (a *Auth) Authenticate(c echo.Context, user, pass string) (*models.AuthToken, error) {
+// Authenticate tries to authenticate the user provided by username and
+// password. The password is checked before the transaction is opened so that
+// hashing does not hold a connection, the login is only recorded if the
+// password was not changed in the meantime. Logging in does not version the
+// user, so that it does not fail the concurrent updates of the user.
+func (a *Auth) Authenticate(ctx context.Context, user, pass string) (*models.AuthToken, error) {
 	// TODO: This query does not need to include roles, fix that
-	u, err := a.udb.FindByUsername(a.db, user)
+	u, err := a.udb.FindByUsername(ctx, a.db, user)
 	if err != nil {
 		return nil, err
 	}
@@ -32,16 +38,31 @@ func (a *Auth) Authenticate(c echo.Context, user, pass string) (*models.AuthToke
 
 	u.UpdateLastLogin(a.sec.Token(token))
 
-	if err := a.udb.Update(a.db, u); err != nil {
+	err = a.tx.Transaction(ctx, func(tx *gorm.DB) error {
+		if err := a.udb.RecordLogin(ctx, tx, u); err != nil {
+			return err
+		}
+		return a.evt.Publish(ctx, tx, models.EventUserLoggedIn, u.ID, loggedInEvent{
+			UserID:     u.ID,
+			LoggedInAt: u.LastLogin,
+		})
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return &models.AuthToken{Token: token, Expires: expire, RefreshToken: u.Token}, nil
 }
 
+// loggedInEvent is the payload of the user logged in domain event
+type loggedInEvent struct {
+	UserID     uint      `json:"user_id"`
+	LoggedInAt time.Time `json:"logged_in_at"`
+}
+
 // Refresh refreshes jwt token and puts new claims inside
-func (a *Auth) Refresh(c echo.Context, token string) (*models.RefreshToken, error) {
-	user, err := a.udb.FindByToken(a.db, token)
+func (a *Auth) Refresh(ctx context.Context, token string) (*models.RefreshToken, error) {
+	user, err := a.udb.FindByToken(ctx, a.db, token)
 	if err != nil {
 		return nil, err
 	}
@@ -53,7 +74,10 @@ func (a *Auth) Refresh(c echo.Context, token string) (*models.RefreshToken, erro
 }
 
 // Me returns info about currently logged user
-func (a *Auth) Me(c echo.Context) (*models.User, error) {
-	au := a.rbac.User(c)
-	return a.udb.View(a.db, au.ID)
+func (a *Auth) Me(ctx context.Context) (*models.User, error) {
+	au := a.rbac.User(ctx)
+	if au == nil {
+		return nil, models.ErrUnauthorized
+	}
+	return a.udb.View(ctx, a.db, au.ID)
 }
@@ -1,11 +1,11 @@
 package auth_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
 	"github.com/jinzhu/gorm"
-	"github.com/labstack/echo"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/johncoleman83/cerebrum/pkg/api/auth"
@@ -33,7 +33,7 @@ func TestAuthenticate(t *testing.T) {
 			args:        args{user: "juzernejm"},
 			expectedErr: true,
 			udb: &mockstore.UserDBClient{
-				FindByUsernameFn: func(db *gorm.DB, user string) (*models.User, error) {
+				FindByUsernameFn: func(ctx context.Context, db *gorm.DB, user string) (*models.User, error) {
 					return nil, models.ErrGeneric
 				},
 			},
@@ -43,7 +43,7 @@ func TestAuthenticate(t *testing.T) {
 			args:        args{user: "juzernejm", pass: "notHashedPassword"},
 			expectedErr: true,
 			udb: &mockstore.UserDBClient{
-				FindByUsernameFn: func(db *gorm.DB, user string) (*models.User, error) {
+				FindByUsernameFn: func(ctx context.Context, db *gorm.DB, user string) (*models.User, error) {
 					return &models.User{
 						Username: user,
 					}, nil
@@ -60,7 +60,7 @@ func TestAuthenticate(t *testing.T) {
 			args:        args{user: "juzernejm", pass: "pass"},
 			expectedErr: true,
 			udb: &mockstore.UserDBClient{
-				FindByUsernameFn: func(db *gorm.DB, user string) (*models.User, error) {
+				FindByUsernameFn: func(ctx context.Context, db *gorm.DB, user string) (*models.User, error) {
 					return &models.User{
 						Username: user,
 						Password: "pass",
@@ -83,13 +83,13 @@ func TestAuthenticate(t *testing.T) {
 			args:        args{user: "juzernejm", pass: "pass"},
 			expectedErr: true,
 			udb: &mockstore.UserDBClient{
-				FindByUsernameFn: func(db *gorm.DB, user string) (*models.User, error) {
+				FindByUsernameFn: func(ctx context.Context, db *gorm.DB, user string) (*models.User, error) {
 					return &models.User{
 						Username: user,
 						Password: "pass",
 					}, nil
 				},
-				UpdateFn: func(db *gorm.DB, u *models.User) error {
+				RecordLoginFn: func(ctx context.Context, db *gorm.DB, u *models.User) error {
 					return models.ErrGeneric
 				},
 			},
@@ -111,13 +111,13 @@ func TestAuthenticate(t *testing.T) {
 			name: "Success",
 			args: args{user: "juzernejm", pass: "pass"},
 			udb: &mockstore.UserDBClient{
-				FindByUsernameFn: func(db *gorm.DB, user string) (*models.User, error) {
+				FindByUsernameFn: func(ctx context.Context, db *gorm.DB, user string) (*models.User, error) {
 					return &models.User{
 						Username: user,
 						Password: "password",
 					}, nil
 				},
-				UpdateFn: func(db *gorm.DB, u *models.User) error {
+				RecordLoginFn: func(ctx context.Context, db *gorm.DB, u *models.User) error {
 					return nil
 				},
 			},
@@ -143,8 +143,8 @@ func TestAuthenticate(t *testing.T) {
 	}
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			s := auth.New(nil, tt.udb, tt.jwt, tt.sec, nil)
-			token, err := s.Authenticate(nil, tt.args.user, tt.args.pass)
+			s := auth.New(nil, mock.NoopTransactor(), tt.udb, tt.jwt, tt.sec, nil, mock.NoopPublisher())
+			token, err := s.Authenticate(context.Background(), tt.args.user, tt.args.pass)
 			if tt.expectedData != nil {
 				tt.expectedData.RefreshToken = token.RefreshToken
 				assert.Equal(t, tt.expectedData, token)
@@ -153,9 +153,46 @@ func TestAuthenticate(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthenticateHashesOutsideTransaction(t *testing.T) {
+	inTx := false
+	tx := &mock.Transactor{
+		TransactionFn: func(ctx context.Context, fn func(*gorm.DB) error) error {
+			inTx = true
+			defer func() { inTx = false }()
+			return fn(nil)
+		},
+	}
+	udb := &mockstore.UserDBClient{
+		FindByUsernameFn: func(ctx context.Context, db *gorm.DB, user string) (*models.User, error) {
+			return &models.User{Username: user, Password: "hash"}, nil
+		},
+		RecordLoginFn: func(ctx context.Context, db *gorm.DB, u *models.User) error {
+			assert.True(t, inTx, "the login should be recorded in a transaction")
+			return nil
+		},
+	}
+	sec := &mock.Secure{
+		HashMatchesPasswordFn: func(string, string) bool {
+			assert.False(t, inTx, "passwords should not be hashed in a transaction")
+			return true
+		},
+		TokenFn: func(string) string {
+			return "refreshtoken"
+		},
+	}
+	jwt := &mock.JWT{
+		GenerateTokenFn: func(u *models.User) (string, string, error) {
+			return "token", mock.TestTime(2000).Format(time.RFC3339), nil
+		},
+	}
+	s := auth.New(nil, tx, udb, jwt, sec, nil, mock.NoopPublisher())
+	_, err := s.Authenticate(context.Background(), "juzernejm", "pass")
+	assert.Nil(t, err)
+}
+
 func TestRefresh(t *testing.T) {
 	type args struct {
-		c     echo.Context
 		token string
 	}
 	cases := []struct {
@@ -171,7 +208,7 @@ func TestRefresh(t *testing.T) {
 			args:        args{token: "refreshtoken"},
 			expectedErr: true,
 			udb: &mockstore.UserDBClient{
-				FindByTokenFn: func(db *gorm.DB, token string) (*models.User, error) {
+				FindByTokenFn: func(ctx context.Context, db *gorm.DB, token string) (*models.User, error) {
 					return nil, models.ErrGeneric
 				},
 			},
@@ -181,7 +218,7 @@ func TestRefresh(t *testing.T) {
 			args:        args{token: "refreshtoken"},
 			expectedErr: true,
 			udb: &mockstore.UserDBClient{
-				FindByTokenFn: func(db *gorm.DB, token string) (*models.User, error) {
+				FindByTokenFn: func(ctx context.Context, db *gorm.DB, token string) (*models.User, error) {
 					return &models.User{
 						Username: "username",
 						Password: "password",
@@ -199,7 +236,7 @@ func TestRefresh(t *testing.T) {
 			name: "Success",
 			args: args{token: "refreshtoken"},
 			udb: &mockstore.UserDBClient{
-				FindByTokenFn: func(db *gorm.DB, token string) (*models.User, error) {
+				FindByTokenFn: func(ctx context.Context, db *gorm.DB, token string) (*models.User, error) {
 					return &models.User{
 						Username: "username",
 						Password: "password",
@@ -220,8 +257,8 @@ func TestRefresh(t *testing.T) {
 	}
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			s := auth.New(nil, tt.udb, tt.jwt, nil, nil)
-			token, err := s.Refresh(tt.args.c, tt.args.token)
+			s := auth.New(nil, mock.NoopTransactor(), tt.udb, tt.jwt, nil, nil, mock.NoopPublisher())
+			token, err := s.Refresh(context.Background(), tt.args.token)
 			assert.Equal(t, tt.expectedData, token)
 			assert.Equal(t, tt.expectedErr, err != nil)
 		})
@@ -239,12 +276,12 @@ func TestMe(t *testing.T) {
 		{
 			name: "Success",
 			rbac: &mock.RBAC{
-				UserFn: func(echo.Context) *models.AuthUser {
+				UserFn: func(context.Context) *models.AuthUser {
 					return &models.AuthUser{ID: 9}
 				},
 			},
 			udb: &mockstore.UserDBClient{
-				ViewFn: func(db *gorm.DB, id uint) (*models.User, error) {
+				ViewFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
 					return &models.User{
 						Base: models.Base{
 							ID:        id,
@@ -275,8 +312,8 @@ func TestMe(t *testing.T) {
 	}
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			s := auth.New(nil, tt.udb, nil, nil, tt.rbac)
-			user, err := s.Me(nil)
+			s := auth.New(nil, mock.NoopTransactor(), tt.udb, nil, nil, tt.rbac, mock.NoopPublisher())
+			user, err := s.Me(context.Background())
 			assert.Equal(t, tt.expectedData, user)
 			assert.Equal(t, tt.expectedErr, err != nil)
 		})
@@ -284,7 +321,7 @@ func TestMe(t *testing.T) {
 }
 
 func TestInitialize(t *testing.T) {
-	a := auth.Initialize(nil, nil, nil, nil)
+	a := auth.Initialize(nil, nil, nil, nil, nil, nil)
 	if a == nil {
 		t.Error("auth service not initialized")
 	}
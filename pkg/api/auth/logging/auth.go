@@ -1,10 +1,9 @@
 package auth
 
 import (
+	"context"
 	"time"
 
-	"github.com/labstack/echo"
-
 	"github.com/johncoleman83/cerebrum/pkg/api/auth"
 	"github.com/johncoleman83/cerebrum/pkg/utl/models"
 )
@@ -27,10 +26,10 @@ func New(svc auth.Service, logger models.Logger) *LogService {
 }
 
 // Authenticate logging
-func (ls *LogService) Authenticate(c echo.Context, user, password string) (resp *models.AuthToken, err error) {
+func (ls *LogService) Authenticate(ctx context.Context, user, password string) (resp *models.AuthToken, err error) {
 	defer func(begin time.Time) {
 		ls.logger.Log(
-			c,
+			ctx,
 			packageName, "Authenticate request", err,
 			map[string]interface{}{
 				"req":  user,
@@ -38,14 +37,14 @@ func (ls *LogService) Authenticate(c echo.Context, user, password string) (resp
 			},
 		)
 	}(time.Now())
-	return ls.Service.Authenticate(c, user, password)
+	return ls.Service.Authenticate(ctx, user, password)
 }
 
 // Refresh logging
-func (ls *LogService) Refresh(c echo.Context, req string) (resp *models.RefreshToken, err error) {
+func (ls *LogService) Refresh(ctx context.Context, req string) (resp *models.RefreshToken, err error) {
 	defer func(begin time.Time) {
 		ls.logger.Log(
-			c,
+			ctx,
 			packageName, "Refresh request", err,
 			map[string]interface{}{
 				"req":  req,
@@ -54,14 +53,14 @@ func (ls *LogService) Refresh(c echo.Context, req string) (resp *models.RefreshT
 			},
 		)
 	}(time.Now())
-	return ls.Service.Refresh(c, req)
+	return ls.Service.Refresh(ctx, req)
 }
 
 // Me logging
-func (ls *LogService) Me(c echo.Context) (resp *models.User, err error) {
+func (ls *LogService) Me(ctx context.Context) (resp *models.User, err error) {
 	defer func(begin time.Time) {
 		ls.logger.Log(
-			c,
+			ctx,
 			packageName, "Me request", err,
 			map[string]interface{}{
 				"resp": resp,
@@ -69,5 +68,5 @@ func (ls *LogService) Me(c echo.Context) (resp *models.User, err error) {
 			},
 		)
 	}(time.Now())
-	return ls.Service.Me(c)
+	return ls.Service.Me(ctx)
 }
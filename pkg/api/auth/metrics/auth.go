@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/johncoleman83/cerebrum/pkg/api/auth"
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+// packageName is the name of the package
+const packageName = "auth"
+
+// MetricService represents auth metrics service
+type MetricService struct {
+	auth.Service
+	recorder models.Recorder
+}
+
+// New creates new auth metrics service
+func New(svc auth.Service, recorder models.Recorder) *MetricService {
+	return &MetricService{
+		Service:  svc,
+		recorder: recorder,
+	}
+}
+
+// Authenticate metrics, every call counts as a login attempt
+func (ms *MetricService) Authenticate(ctx context.Context, user, password string) (resp *models.AuthToken, err error) {
+	defer func(begin time.Time) {
+		ms.recorder.ObserveCall(packageName, "Authenticate", time.Since(begin), err)
+		ms.recorder.CountLogin(err)
+	}(time.Now())
+	return ms.Service.Authenticate(ctx, user, password)
+}
+
+// Refresh metrics, every call counts as a token refresh
+func (ms *MetricService) Refresh(ctx context.Context, req string) (resp *models.RefreshToken, err error) {
+	defer func(begin time.Time) {
+		ms.recorder.ObserveCall(packageName, "Refresh", time.Since(begin), err)
+		ms.recorder.CountRefresh(err)
+	}(time.Now())
+	return ms.Service.Refresh(ctx, req)
+}
+
+// Me metrics
+func (ms *MetricService) Me(ctx context.Context) (resp *models.User, err error) {
+	defer func(begin time.Time) {
+		ms.recorder.ObserveCall(packageName, "Me", time.Since(begin), err)
+	}(time.Now())
+	return ms.Service.Me(ctx)
+}
@@ -1,26 +1,27 @@
 package auth
 
 import (
+	"context"
+
 	"github.com/jinzhu/gorm"
-	"github.com/labstack/echo"
 
-	"github.com/johncoleman83/cerebrum/pkg/api/store"
+	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
 	"github.com/johncoleman83/cerebrum/pkg/utl/models"
 )
 
 // Service represents auth service interface
 type Service interface {
-	Authenticate(echo.Context, string, string) (*models.AuthToken, error)
-	Refresh(echo.Context, string) (*models.RefreshToken, error)
-	Me(echo.Context) (*models.User, error)
+	Authenticate(context.Context, string, string) (*models.AuthToken, error)
+	Refresh(context.Context, string) (*models.RefreshToken, error)
+	Me(context.Context) (*models.User, error)
 }
 
 // UserDBClientInterface represents user repository interface
 type UserDBClientInterface interface {
-	View(*gorm.DB, uint) (*models.User, error)
-	FindByUsername(*gorm.DB, string) (*models.User, error)
-	FindByToken(*gorm.DB, string) (*models.User, error)
-	Update(*gorm.DB, *models.User) error
+	View(context.Context, *gorm.DB, uint) (*models.User, error)
+	FindByUsername(context.Context, *gorm.DB, string) (*models.User, error)
+	FindByToken(context.Context, *gorm.DB, string) (*models.User, error)
+	RecordLogin(context.Context, *gorm.DB, *models.User) error
 }
 
 // TokenGenerator represents token generator (jwt) interface
@@ -34,32 +35,46 @@ type Securer interface {
 	Token(string) string
 }
 
+// Transactor represents the interface for running work in a single db transaction
+type Transactor interface {
+	Transaction(context.Context, func(*gorm.DB) error) error
+}
+
+// Publisher represents the domain event outbox interface
+type Publisher interface {
+	Publish(context.Context, *gorm.DB, string, uint, interface{}) error
+}
+
 // RBAC represents role-based-access-control interface
 type RBAC interface {
-	User(echo.Context) *models.AuthUser
+	User(context.Context) *models.AuthUser
 }
 
 // Auth represents auth application service
 type Auth struct {
 	db   *gorm.DB
+	tx   Transactor
 	udb  UserDBClientInterface
 	tg   TokenGenerator
 	sec  Securer
 	rbac RBAC
+	evt  Publisher
 }
 
 // New creates new iam service
-func New(db *gorm.DB, udb UserDBClientInterface, j TokenGenerator, sec Securer, rbac RBAC) *Auth {
+func New(db *gorm.DB, tx Transactor, udb UserDBClientInterface, j TokenGenerator, sec Securer, rbac RBAC, evt Publisher) *Auth {
 	return &Auth{
 		db:   db,
+		tx:   tx,
 		udb:  udb,
 		tg:   j,
 		sec:  sec,
 		rbac: rbac,
+		evt:  evt,
 	}
 }
 
 // Initialize initializes auth application service
-func Initialize(db *gorm.DB, j TokenGenerator, sec Securer, rbac RBAC) *Auth {
-	return New(db, store.NewUserDBClient(), j, sec, rbac)
+func Initialize(db *gorm.DB, udb UserDBClientInterface, j TokenGenerator, sec Securer, rbac RBAC, evt Publisher) *Auth {
+	return New(db, datastore.NewTransactor(db), udb, j, sec, rbac, evt)
 }
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/api/trace"
+
+	"github.com/johncoleman83/cerebrum/pkg/api/auth"
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+	"github.com/johncoleman83/cerebrum/pkg/utl/tracing"
+)
+
+// packageName is the name of the package
+const packageName = "auth"
+
+// TraceService represents auth tracing service
+type TraceService struct {
+	auth.Service
+	tracer trace.Tracer
+}
+
+// New creates new auth tracing service
+func New(svc auth.Service, tracer trace.Tracer) *TraceService {
+	return &TraceService{
+		Service: svc,
+		tracer:  tracer,
+	}
+}
+
+// Authenticate tracing
+func (ts *TraceService) Authenticate(ctx context.Context, user, password string) (resp *models.AuthToken, err error) {
+	ctx, span := ts.tracer.Start(ctx, packageName+".Authenticate")
+	defer func() { tracing.End(span, err) }()
+	return ts.Service.Authenticate(ctx, user, password)
+}
+
+// Refresh tracing
+func (ts *TraceService) Refresh(ctx context.Context, req string) (resp *models.RefreshToken, err error) {
+	ctx, span := ts.tracer.Start(ctx, packageName+".Refresh")
+	defer func() { tracing.End(span, err) }()
+	return ts.Service.Refresh(ctx, req)
+}
+
+// Me tracing
+func (ts *TraceService) Me(ctx context.Context) (resp *models.User, err error) {
+	ctx, span := ts.tracer.Start(ctx, packageName+".Me")
+	defer func() { tracing.End(span, err) }()
+	return ts.Service.Me(ctx)
+}
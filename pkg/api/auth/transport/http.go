@@ -39,13 +39,14 @@ type credentials struct {
 //  401: errMsg
 // 	403: err
 //  404: errMsg
+//  429: errMsg
 //  500: err
 func (h *HTTP) login(c echo.Context) error {
 	cred := new(credentials)
 	if err := c.Bind(cred); err != nil {
 		return err
 	}
-	r, err := h.svc.Authenticate(c, cred.Username, cred.Password)
+	r, err := h.svc.Authenticate(c.Request().Context(), cred.Username, cred.Password)
 	if err != nil {
 		return err
 	}
@@ -70,10 +71,12 @@ func (h *HTTP) login(c echo.Context) error {
 //     "$ref": "#/responses/errMsg"
 //   "401":
 //     "$ref": "#/responses/err"
+//   "429":
+//     "$ref": "#/responses/errMsg"
 //   "500":
 //     "$ref": "#/responses/err"
 func (h *HTTP) refresh(c echo.Context) error {
-	r, err := h.svc.Refresh(c, c.Param("token"))
+	r, err := h.svc.Refresh(c.Request().Context(), c.Param("token"))
 	if err != nil {
 		return err
 	}
@@ -88,7 +91,7 @@ func (h *HTTP) refresh(c echo.Context) error {
 //  200: userResp
 //  500: err
 func (h *HTTP) me(c echo.Context) error {
-	user, err := h.svc.Me(c)
+	user, err := h.svc.Me(c.Request().Context())
 	if err != nil {
 		return err
 	}
@@ -2,6 +2,7 @@ package transport_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -9,7 +10,6 @@ import (
 	"time"
 
 	"github.com/jinzhu/gorm"
-	"github.com/labstack/echo"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/johncoleman83/cerebrum/pkg/api/auth"
@@ -41,7 +41,7 @@ func TestLogin(t *testing.T) {
 			req:            `{"username":"juzernejm","password":"hunter123"}`,
 			expectedStatus: http.StatusInternalServerError,
 			udb: &mockstore.UserDBClient{
-				FindByUsernameFn: func(*gorm.DB, string) (*models.User, error) {
+				FindByUsernameFn: func(context.Context, *gorm.DB, string) (*models.User, error) {
 					return nil, models.ErrGeneric
 				},
 			},
@@ -51,12 +51,12 @@ func TestLogin(t *testing.T) {
 			req:            `{"username":"juzernejm","password":"hunter123"}`,
 			expectedStatus: http.StatusOK,
 			udb: &mockstore.UserDBClient{
-				FindByUsernameFn: func(*gorm.DB, string) (*models.User, error) {
+				FindByUsernameFn: func(context.Context, *gorm.DB, string) (*models.User, error) {
 					return &models.User{
 						Password: "hunter123",
 					}, nil
 				},
-				UpdateFn: func(db *gorm.DB, u *models.User) error {
+				RecordLoginFn: func(ctx context.Context, db *gorm.DB, u *models.User) error {
 					return nil
 				},
 			},
@@ -79,8 +79,8 @@ func TestLogin(t *testing.T) {
 
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			r := server.New()
-			transport.NewHTTP(auth.New(nil, tt.udb, tt.jwt, tt.sec, nil), r, nil)
+			r := server.New(nil)
+			transport.NewHTTP(auth.New(nil, mock.NoopTransactor(), tt.udb, tt.jwt, tt.sec, nil, mock.NoopPublisher()), r, nil)
 			ts := httptest.NewServer(r)
 			defer ts.Close()
 			path := ts.URL + "/login"
@@ -116,7 +116,7 @@ func TestRefresh(t *testing.T) {
 			req:            "refreshtoken",
 			expectedStatus: http.StatusInternalServerError,
 			udb: &mockstore.UserDBClient{
-				FindByTokenFn: func(*gorm.DB, string) (*models.User, error) {
+				FindByTokenFn: func(context.Context, *gorm.DB, string) (*models.User, error) {
 					return nil, models.ErrGeneric
 				},
 			},
@@ -126,7 +126,7 @@ func TestRefresh(t *testing.T) {
 			req:            "refreshtoken",
 			expectedStatus: http.StatusOK,
 			udb: &mockstore.UserDBClient{
-				FindByTokenFn: func(*gorm.DB, string) (*models.User, error) {
+				FindByTokenFn: func(context.Context, *gorm.DB, string) (*models.User, error) {
 					return &models.User{
 						Username: "bugsbunny",
 					}, nil
@@ -143,8 +143,8 @@ func TestRefresh(t *testing.T) {
 
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			r := server.New()
-			transport.NewHTTP(auth.New(nil, tt.udb, tt.jwt, nil, nil), r, nil)
+			r := server.New(nil)
+			transport.NewHTTP(auth.New(nil, mock.NoopTransactor(), tt.udb, tt.jwt, nil, nil, mock.NoopPublisher()), r, nil)
 			ts := httptest.NewServer(r)
 			defer ts.Close()
 			path := ts.URL + "/refresh/" + tt.req
@@ -178,12 +178,12 @@ func TestMe(t *testing.T) {
 			name:           "Fail on user view",
 			expectedStatus: http.StatusInternalServerError,
 			udb: &mockstore.UserDBClient{
-				ViewFn: func(*gorm.DB, uint) (*models.User, error) {
+				ViewFn: func(context.Context, *gorm.DB, uint) (*models.User, error) {
 					return nil, models.ErrGeneric
 				},
 			},
 			rbac: &mock.RBAC{
-				UserFn: func(echo.Context) *models.AuthUser {
+				UserFn: func(context.Context) *models.AuthUser {
 					return &models.AuthUser{ID: 1}
 				},
 			},
@@ -193,7 +193,7 @@ func TestMe(t *testing.T) {
 			name:           "Success",
 			expectedStatus: http.StatusOK,
 			udb: &mockstore.UserDBClient{
-				ViewFn: func(db *gorm.DB, id uint) (*models.User, error) {
+				ViewFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
 					return &models.User{
 						Base: models.Base{
 							ID: id,
@@ -207,7 +207,7 @@ func TestMe(t *testing.T) {
 				},
 			},
 			rbac: &mock.RBAC{
-				UserFn: func(echo.Context) *models.AuthUser {
+				UserFn: func(context.Context) *models.AuthUser {
 					return &models.AuthUser{ID: 1}
 				},
 			},
@@ -230,8 +230,8 @@ func TestMe(t *testing.T) {
 
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			r := server.New()
-			transport.NewHTTP(auth.New(nil, tt.udb, nil, nil, tt.rbac), r, jwtMW.MWFunc())
+			r := server.New(nil)
+			transport.NewHTTP(auth.New(nil, mock.NoopTransactor(), tt.udb, nil, nil, tt.rbac, mock.NoopPublisher()), r, jwtMW.MWFunc())
 			ts := httptest.NewServer(r)
 			defer ts.Close()
 			path := ts.URL + "/me"
@@ -0,0 +1,74 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/migrate"
+)
+
+func init() {
+	register(migrate.Migration{
+		Version: 20261019090000,
+		Name:    "create_initial_schema",
+		Up: func(db *gorm.DB) error {
+			type account struct {
+				ID        uint `gorm:"primary_key"`
+				CreatedAt time.Time
+				UpdatedAt time.Time
+				DeletedAt *time.Time `sql:"index"`
+				Name      string
+				OwnerID   uint
+			}
+			type team struct {
+				ID          uint `gorm:"primary_key"`
+				CreatedAt   time.Time
+				UpdatedAt   time.Time
+				DeletedAt   *time.Time `sql:"index"`
+				Name        string
+				Description string
+				AccountID   uint
+			}
+			type role struct {
+				ID          uint
+				AccessLevel uint
+				Name        string
+			}
+			type user struct {
+				ID                 uint `gorm:"primary_key"`
+				CreatedAt          time.Time
+				UpdatedAt          time.Time
+				DeletedAt          *time.Time `sql:"index"`
+				FirstName          string
+				LastName           string
+				Username           string
+				Password           string
+				Email              string
+				Mobile             string
+				Phone              string
+				Address            string
+				AccountID          uint
+				TeamID             uint
+				RoleID             uint
+				Token              string
+				LastLogin          time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+				LastPasswordChange time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+			}
+			type outboxEvent struct {
+				ID           uint   `gorm:"primary_key"`
+				Topic        string `gorm:"size:255;index"`
+				AggregateID  uint
+				Payload      string `gorm:"type:text"`
+				Attempts     int
+				LastError    string `gorm:"type:text"`
+				CreatedAt    time.Time
+				DispatchedAt *time.Time `sql:"index"`
+			}
+			return createTables(db, &account{}, &team{}, &role{}, &user{}, &outboxEvent{})
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists("outbox_events", "users", "roles", "teams", "accounts").Error
+		},
+	})
+}
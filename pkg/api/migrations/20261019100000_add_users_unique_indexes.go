@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/migrate"
+)
+
+func init() {
+	register(migrate.Migration{
+		Version: 20261019100000,
+		Name:    "add_users_unique_indexes",
+		Up: func(db *gorm.DB) error {
+			// mysql compares with the case-insensitive default collation, the
+			// other dialects need an index on the lower cased expression
+			username, email := "lower(username)", "lower(email)"
+			if db.Dialect().GetName() == "mysql" {
+				username, email = "username", "email"
+			}
+			if err := createUniqueIndex(db, "users", "ux_users_username", "("+username+")"); err != nil {
+				return err
+			}
+			return createUniqueIndex(db, "users", "ux_users_email", "("+email+")")
+		},
+		Down: func(db *gorm.DB) error {
+			if err := dropIndex(db, "users", "ux_users_email"); err != nil {
+				return err
+			}
+			return dropIndex(db, "users", "ux_users_username")
+		},
+	})
+}
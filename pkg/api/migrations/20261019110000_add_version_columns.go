@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/migrate"
+)
+
+func init() {
+	// versionedTables embed models.Base, their version column is incremented
+	// by every update for optimistic concurrency control
+	versionedTables := []string{"accounts", "teams", "users"}
+
+	register(migrate.Migration{
+		Version: 20261019110000,
+		Name:    "add_version_columns",
+		Up: func(db *gorm.DB) error {
+			for _, table := range versionedTables {
+				if err := addColumn(db, table, "version", "integer NOT NULL DEFAULT 1"); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(db *gorm.DB) error {
+			for _, table := range versionedTables {
+				if err := dropColumn(db, table, "version"); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
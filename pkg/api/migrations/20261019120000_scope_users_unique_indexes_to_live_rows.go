@@ -0,0 +1,62 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/migrate"
+)
+
+func init() {
+	register(migrate.Migration{
+		Version: 20261019120000,
+		Name:    "scope_users_unique_indexes_to_live_rows",
+		Up: func(db *gorm.DB) error {
+			if err := dropIndex(db, "users", "ux_users_email"); err != nil {
+				return err
+			}
+			if err := dropIndex(db, "users", "ux_users_username"); err != nil {
+				return err
+			}
+			if db.Dialect().GetName() == "mysql" {
+				// mysql has no partial indexes, the generated columns are null
+				// for deleted rows and nulls never collide in a unique index
+				if err := addColumn(db, "users", "live_username", "varchar(255) AS (IF(deleted_at IS NULL, username, NULL)) VIRTUAL"); err != nil {
+					return err
+				}
+				if err := addColumn(db, "users", "live_email", "varchar(255) AS (IF(deleted_at IS NULL, email, NULL)) VIRTUAL"); err != nil {
+					return err
+				}
+				if err := createUniqueIndex(db, "users", "ux_users_username", "(live_username)"); err != nil {
+					return err
+				}
+				return createUniqueIndex(db, "users", "ux_users_email", "(live_email)")
+			}
+			if err := createUniqueIndex(db, "users", "ux_users_username", "(lower(username)) WHERE deleted_at IS NULL"); err != nil {
+				return err
+			}
+			return createUniqueIndex(db, "users", "ux_users_email", "(lower(email)) WHERE deleted_at IS NULL")
+		},
+		Down: func(db *gorm.DB) error {
+			if err := dropIndex(db, "users", "ux_users_email"); err != nil {
+				return err
+			}
+			if err := dropIndex(db, "users", "ux_users_username"); err != nil {
+				return err
+			}
+			username, email := "lower(username)", "lower(email)"
+			if db.Dialect().GetName() == "mysql" {
+				if err := dropColumn(db, "users", "live_username"); err != nil {
+					return err
+				}
+				if err := dropColumn(db, "users", "live_email"); err != nil {
+					return err
+				}
+				username, email = "username", "email"
+			}
+			if err := createUniqueIndex(db, "users", "ux_users_username", "("+username+")"); err != nil {
+				return err
+			}
+			return createUniqueIndex(db, "users", "ux_users_email", "("+email+")")
+		},
+	})
+}
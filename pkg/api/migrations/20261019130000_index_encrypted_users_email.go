@@ -0,0 +1,116 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/migrate"
+)
+
+func init() {
+	// encryptedColumns of users hold sealed values which outgrow varchar(255)
+	encryptedColumns := []string{"email", "mobile", "phone", "address"}
+
+	register(migrate.Migration{
+		Version: 20261019130000,
+		Name:    "index_encrypted_users_email",
+		Up: func(db *gorm.DB) error {
+			// sealed emails are randomized, uniqueness moves to the blind
+			// index which is backfilled for the existing users so that they
+			// are found by email before the reencrypt command seals them
+			if err := dropIndex(db, "users", "ux_users_email"); err != nil {
+				return err
+			}
+			if err := addColumn(db, "users", "email_index", "varchar(64)"); err != nil {
+				return err
+			}
+			if err := backfillEmailIndex(db); err != nil {
+				return err
+			}
+			switch db.Dialect().GetName() {
+			case "mysql":
+				if err := dropColumn(db, "users", "live_email"); err != nil {
+					return err
+				}
+				for _, col := range encryptedColumns {
+					if err := db.Exec("ALTER TABLE users MODIFY " + col + " text").Error; err != nil {
+						return err
+					}
+				}
+				if err := addColumn(db, "users", "live_email_index", "varchar(64) AS (IF(deleted_at IS NULL, email_index, NULL)) VIRTUAL"); err != nil {
+					return err
+				}
+				return createUniqueIndex(db, "users", "ux_users_email_index", "(live_email_index)")
+			case "postgres":
+				for _, col := range encryptedColumns {
+					if err := db.Exec("ALTER TABLE users ALTER COLUMN " + col + " TYPE text").Error; err != nil {
+						return err
+					}
+				}
+			}
+			return createUniqueIndex(db, "users", "ux_users_email_index", "(email_index) WHERE deleted_at IS NULL")
+		},
+		Down: func(db *gorm.DB) error {
+			// sealed values are not decrypted, run it on plaintext data only
+			if err := dropIndex(db, "users", "ux_users_email_index"); err != nil {
+				return err
+			}
+			if db.Dialect().GetName() == "mysql" {
+				if err := dropColumn(db, "users", "live_email_index"); err != nil {
+					return err
+				}
+				if err := db.Exec("ALTER TABLE users MODIFY email varchar(255)").Error; err != nil {
+					return err
+				}
+				if err := addColumn(db, "users", "live_email", "varchar(255) AS (IF(deleted_at IS NULL, email, NULL)) VIRTUAL"); err != nil {
+					return err
+				}
+				if err := createUniqueIndex(db, "users", "ux_users_email", "(live_email)"); err != nil {
+					return err
+				}
+				return dropColumn(db, "users", "email_index")
+			}
+			if err := dropColumn(db, "users", "email_index"); err != nil {
+				return err
+			}
+			return createUniqueIndex(db, "users", "ux_users_email", "(lower(email)) WHERE deleted_at IS NULL")
+		},
+	})
+}
+
+// emailIndexBatch is the number of users whose blind index is backfilled per query
+const emailIndexBatch = 500
+
+// backfillEmailIndex sets the blind index of the emails of the users which
+// have none, emails may be plaintext or sealed
+func backfillEmailIndex(db *gorm.DB) error {
+	type user struct {
+		ID    uint
+		Email string
+	}
+	c, hasCipher := cipherOf(db)
+	for after := uint(0); ; {
+		var users []user
+		err := db.Table("users").Select("id, email").
+			Where("id > ? AND email_index IS NULL AND email <> ''", after).
+			Order("id").Limit(emailIndexBatch).Scan(&users).Error
+		if err != nil {
+			return err
+		}
+		if len(users) == 0 {
+			return nil
+		}
+		if !hasCipher {
+			return ErrNoCipher
+		}
+		for _, u := range users {
+			email, err := c.Decrypt(u.Email)
+			if err != nil {
+				return err
+			}
+			if err := db.Exec("UPDATE users SET email_index = ? WHERE id = ?", c.BlindIndex(email), u.ID).Error; err != nil {
+				return err
+			}
+		}
+		after = users[len(users)-1].ID
+	}
+}
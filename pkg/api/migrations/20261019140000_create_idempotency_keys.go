@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/migrate"
+)
+
+func init() {
+	register(migrate.Migration{
+		Version: 20261019140000,
+		Name:    "create_idempotency_keys",
+		Up: func(db *gorm.DB) error {
+			type idempotencyKey struct {
+				ID          uint   `gorm:"primary_key"`
+				UserID      uint   `gorm:"unique_index:ux_idempotency_keys_user_key"`
+				Key         string `gorm:"column:idempotency_key;size:255;unique_index:ux_idempotency_keys_user_key"`
+				RequestHash string `gorm:"size:64"`
+				Status      int
+				ContentType string    `gorm:"size:255"`
+				Body        string    `gorm:"type:text"`
+				CreatedAt   time.Time `sql:"index"`
+			}
+			return createTables(db, &idempotencyKey{})
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists("idempotency_keys").Error
+		},
+	})
+}
@@ -0,0 +1,20 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/migrate"
+)
+
+func init() {
+	register(migrate.Migration{
+		Version: 20261019150000,
+		Name:    "add_idempotency_keys_headers",
+		Up: func(db *gorm.DB) error {
+			return addColumn(db, "idempotency_keys", "headers", "text")
+		},
+		Down: func(db *gorm.DB) error {
+			return dropColumn(db, "idempotency_keys", "headers")
+		},
+	})
+}
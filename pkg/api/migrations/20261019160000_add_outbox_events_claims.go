@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/migrate"
+)
+
+func init() {
+	register(migrate.Migration{
+		Version: 20261019160000,
+		Name:    "add_outbox_events_claims",
+		Up: func(db *gorm.DB) error {
+			if err := addColumn(db, "outbox_events", "claimed_by", "varchar(32)"); err != nil {
+				return err
+			}
+			return addColumn(db, "outbox_events", "claimed_until", timestampType(db))
+		},
+		Down: func(db *gorm.DB) error {
+			if err := dropColumn(db, "outbox_events", "claimed_until"); err != nil {
+				return err
+			}
+			return dropColumn(db, "outbox_events", "claimed_by")
+		},
+	})
+}
+
+// timestampType returns the nullable column type gorm uses for *time.Time
+func timestampType(db *gorm.DB) string {
+	switch db.Dialect().GetName() {
+	case "mysql":
+		return "datetime NULL"
+	case "postgres":
+		return "timestamp with time zone"
+	default:
+		return "datetime"
+	}
+}
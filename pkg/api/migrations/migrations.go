@@ -0,0 +1,118 @@
+// Package migrations contains the versioned schema migrations of the api.
+//
+// Every migration lives in its own `<version>_<name>.go` file and registers
+// itself from init, new files are generated with `cerebrum migrate create`.
+// Migrations must not reference the models package since models evolve while
+// an applied migration never changes, table snapshots are declared inline.
+package migrations
+
+import (
+	"errors"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/migrate"
+)
+
+// cipherKey is the gorm setting holding the cipher of the migrations
+const cipherKey = "cerebrum:migrations:cipher"
+
+// ErrNoCipher is returned by the migrations which backfill data derived from
+// encrypted columns when the db was not given a cipher with WithCipher
+var ErrNoCipher = errors.New("migrations: the encryption keys of the config are required to backfill encrypted data")
+
+// Cipher opens sealed values and computes blind indexes
+type Cipher interface {
+	Decrypt(string) (string, error)
+	BlindIndex(string) string
+}
+
+var all []migrate.Migration
+
+// register adds a migration to the list of known migrations
+func register(m migrate.Migration) {
+	all = append(all, m)
+}
+
+// All returns every registered migration
+func All() []migrate.Migration {
+	list := make([]migrate.Migration, len(all))
+	copy(list, all)
+	return list
+}
+
+// New creates a migrator for all registered migrations
+func New(db *gorm.DB) (*migrate.Migrator, error) {
+	return migrate.New(db, all)
+}
+
+// WithCipher returns a copy of db whose migrations backfill the data derived
+// from encrypted columns with c
+func WithCipher(db *gorm.DB, c Cipher) *gorm.DB {
+	return db.Set(cipherKey, c)
+}
+
+// cipherOf returns the cipher db was given by WithCipher
+func cipherOf(db *gorm.DB) (Cipher, bool) {
+	v, ok := db.Get(cipherKey)
+	if !ok {
+		return nil, false
+	}
+	c, ok := v.(Cipher)
+	return c, ok
+}
+
+// createTables creates the tables of models which do not exist yet, so the
+// baseline adopts a schema created before migrations were introduced
+func createTables(db *gorm.DB, models ...interface{}) error {
+	for _, m := range models {
+		if db.HasTable(m) {
+			continue
+		}
+		if err := db.CreateTable(m).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createUniqueIndex creates the named unique index of table on the columns
+// or expressions of on, followed by the optional where clause, unless it
+// already exists
+func createUniqueIndex(db *gorm.DB, table, name, on string) error {
+	if db.Dialect().HasIndex(table, name) {
+		return nil
+	}
+	return db.Exec("CREATE UNIQUE INDEX " + name + " ON " + table + " " + on).Error
+}
+
+// dropIndex drops the named index of table with the syntax of the db
+// dialect, if it exists
+func dropIndex(db *gorm.DB, table, name string) error {
+	if !db.Dialect().HasIndex(table, name) {
+		return nil
+	}
+	if db.Dialect().GetName() == "mysql" {
+		return db.Exec("DROP INDEX " + name + " ON " + table).Error
+	}
+	return db.Exec("DROP INDEX " + name).Error
+}
+
+// addColumn adds column to table unless it already exists, definition is
+// the portable column type and constraints
+func addColumn(db *gorm.DB, table, column, definition string) error {
+	if db.Dialect().HasColumn(table, column) {
+		return nil
+	}
+	return db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition).Error
+}
+
+// dropColumn drops column of table if it exists. The bundled sqlite predates
+// ALTER TABLE DROP COLUMN, so on sqlite the column is kept and addColumn
+// reuses it.
+func dropColumn(db *gorm.DB, table, column string) error {
+	if db.Dialect().GetName() == "sqlite3" || !db.Dialect().HasColumn(table, column) {
+		return nil
+	}
+	return db.Exec("ALTER TABLE " + table + " DROP COLUMN " + column).Error
+}
@@ -0,0 +1,140 @@
+package migrations_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/api/migrations"
+	"github.com/johncoleman83/cerebrum/pkg/utl/mock/mockstore"
+)
+
+func TestMigrations(t *testing.T) {
+	db, err := mockstore.NewDataBaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := migrations.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, m.EnsureCurrent(), "the test db should be fully migrated")
+	for _, table := range []string{"accounts", "teams", "roles", "users", "outbox_events", "idempotency_keys"} {
+		assert.True(t, db.HasTable(table), "table %s should exist", table)
+	}
+
+	assert.Nil(t, m.Reset(), "every migration should be reversible")
+	for _, table := range []string{"accounts", "teams", "roles", "users", "outbox_events", "idempotency_keys"} {
+		assert.False(t, db.HasTable(table), "table %s should be dropped", table)
+	}
+
+	done, err := m.Up(0)
+	assert.Nil(t, err, "migrations should apply again after a reset")
+	assert.Len(t, done, len(migrations.All()))
+}
+
+func TestUpIsRerunnable(t *testing.T) {
+	db, err := mockstore.NewDataBaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := migrations.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	// a partially applied migration is applied again from its first step
+	for _, mig := range migrations.All() {
+		if _, err := m.Up(1); err != nil {
+			t.Fatal(err)
+		}
+		assert.Nil(t, mig.Up(db), "migration %d_%s should be re-runnable", mig.Version, mig.Name)
+	}
+	assert.Nil(t, m.EnsureCurrent())
+}
+
+func TestBackfillEmailIndex(t *testing.T) {
+	db, err := mockstore.NewDataBaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	kr, err := mockstore.NewKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := migrations.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	// up to the users email index, before email was encrypted
+	if _, err := m.Up(4); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("INSERT INTO users (username, email) VALUES ('jane', 'Jane@Mail.com'), ('nomail', '')").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Up(1)
+	assert.True(t, errors.Is(err, migrations.ErrNoCipher), "existing users should not be left without index, got %v", err)
+
+	m, err = migrations.New(migrations.WithCipher(db, kr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Up(0)
+	assert.Nil(t, err)
+	var rows []struct {
+		Username   string
+		EmailIndex *string
+	}
+	assert.Nil(t, db.Table("users").Select("username, email_index").Order("id").Scan(&rows).Error)
+	if assert.Len(t, rows, 2) {
+		if assert.NotNil(t, rows[0].EmailIndex) {
+			assert.Equal(t, kr.BlindIndex("jane@mail.com"), *rows[0].EmailIndex, "existing users should be indexed")
+		}
+		assert.Nil(t, rows[1].EmailIndex, "users without email should not be indexed")
+	}
+}
+
+func TestBaselineAdoptsExistingSchema(t *testing.T) {
+	db, err := mockstore.NewDataBaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := migrations.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	// a schema created before migrations were tracked
+	if _, err := m.Up(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("DELETE FROM schema_migrations").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("INSERT INTO users (username) VALUES ('legacy')").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Up(1)
+	assert.Nil(t, err, "the baseline should adopt existing tables")
+	pending, err := m.Pending()
+	assert.Nil(t, err)
+	assert.Len(t, pending, len(migrations.All())-1, "only the baseline should be marked applied")
+	count := 0
+	assert.Nil(t, db.Table("users").Count(&count).Error)
+	assert.Equal(t, 1, count, "existing rows should be kept")
+}
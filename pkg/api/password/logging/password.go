@@ -1,10 +1,9 @@
 package password
 
 import (
+	"context"
 	"time"
 
-	"github.com/labstack/echo"
-
 	"github.com/johncoleman83/cerebrum/pkg/api/password"
 	"github.com/johncoleman83/cerebrum/pkg/utl/models"
 )
@@ -27,10 +26,10 @@ func New(svc password.Service, logger models.Logger) *LogService {
 }
 
 // Change logging
-func (ls *LogService) Change(c echo.Context, id uint, oldPass, newPass string) (err error) {
+func (ls *LogService) Change(ctx context.Context, id uint, oldPass, newPass string) (err error) {
 	defer func(begin time.Time) {
 		ls.logger.Log(
-			c,
+			ctx,
 			packageName, "Change password request", err,
 			map[string]interface{}{
 				"req":  id,
@@ -38,5 +37,5 @@ func (ls *LogService) Change(c echo.Context, id uint, oldPass, newPass string) (
 			},
 		)
 	}(time.Now())
-	return ls.Service.Change(c, id, oldPass, newPass)
+	return ls.Service.Change(ctx, id, oldPass, newPass)
 }
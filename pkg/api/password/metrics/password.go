@@ -0,0 +1,34 @@
+package password
+
+import (
+	"context"
+	"time"
+
+	"github.com/johncoleman83/cerebrum/pkg/api/password"
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+// packageName is the name of the package
+const packageName = "password"
+
+// MetricService represents password metrics service
+type MetricService struct {
+	password.Service
+	recorder models.Recorder
+}
+
+// New creates new password metrics service
+func New(svc password.Service, recorder models.Recorder) *MetricService {
+	return &MetricService{
+		Service:  svc,
+		recorder: recorder,
+	}
+}
+
+// Change metrics
+func (ms *MetricService) Change(ctx context.Context, id uint, oldPass, newPass string) (err error) {
+	defer func(begin time.Time) {
+		ms.recorder.ObserveCall(packageName, "Change", time.Since(begin), err)
+	}(time.Now())
+	return ms.Service.Change(ctx, id, oldPass, newPass)
+}
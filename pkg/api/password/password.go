@@ -1,24 +1,30 @@
 package password
 
 import (
+	"context"
 	"net/http"
+	"time"
 
-	"github.com/labstack/echo"
+	"github.com/jinzhu/gorm"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
 )
 
 // Custom errors
 var (
-	ErrIncorrectPassword = echo.NewHTTPError(http.StatusBadRequest, "incorrect old password")
-	ErrInsecurePassword  = echo.NewHTTPError(http.StatusBadRequest, "insecure password")
+	ErrIncorrectPassword = models.NewError(http.StatusBadRequest, "incorrect_password", "incorrect old password")
+	ErrInsecurePassword  = models.NewError(http.StatusBadRequest, "insecure_password", "insecure password")
 )
 
-// Change changes user's password
-func (p *Password) Change(c echo.Context, userID uint, oldPass, newPass string) error {
-	if err := p.rbac.EnforceUser(c, userID); err != nil {
+// Change changes user's password. The passwords are checked and hashed
+// before the transaction writing the change is opened so that hashing does
+// not hold a connection, the change fails if the user was changed meanwhile.
+func (p *Password) Change(ctx context.Context, userID uint, oldPass, newPass string) error {
+	if err := p.rbac.EnforceUser(ctx, userID); err != nil {
 		return err
 	}
 
-	u, err := p.udb.View(p.db, userID)
+	u, err := p.udb.ViewCredentials(ctx, p.db, userID)
 	if err != nil {
 		return err
 	}
@@ -33,5 +39,19 @@ func (p *Password) Change(c echo.Context, userID uint, oldPass, newPass string)
 
 	u.ChangePassword(p.sec.Hash(newPass))
 
-	return p.udb.Update(p.db, u)
+	return p.tx.Transaction(ctx, func(tx *gorm.DB) error {
+		if err := p.udb.ChangePassword(ctx, tx, u); err != nil {
+			return err
+		}
+		return p.evt.Publish(ctx, tx, models.EventPasswordChanged, u.ID, changedEvent{
+			UserID:    u.ID,
+			ChangedAt: u.LastPasswordChange,
+		})
+	})
+}
+
+// changedEvent is the payload of the password changed domain event
+type changedEvent struct {
+	UserID    uint      `json:"user_id"`
+	ChangedAt time.Time `json:"changed_at"`
 }
@@ -1,10 +1,10 @@
 package password_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/jinzhu/gorm"
-	"github.com/labstack/echo"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/johncoleman83/cerebrum/pkg/api/password"
@@ -31,7 +31,7 @@ func TestChange(t *testing.T) {
 			name: "Fail on EnforceUser",
 			args: args{id: 1},
 			rbac: &mock.RBAC{
-				EnforceUserFn: func(c echo.Context, id uint) error {
+				EnforceUserFn: func(ctx context.Context, id uint) error {
 					return models.ErrGeneric
 				}},
 			expectedErr: true,
@@ -41,11 +41,11 @@ func TestChange(t *testing.T) {
 			args:        args{id: 1},
 			expectedErr: true,
 			rbac: &mock.RBAC{
-				EnforceUserFn: func(c echo.Context, id uint) error {
+				EnforceUserFn: func(ctx context.Context, id uint) error {
 					return nil
 				}},
 			udb: &mockstore.UserDBClient{
-				ViewFn: func(db *gorm.DB, id uint) (*models.User, error) {
+				ViewCredentialsFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
 					if id != 1 {
 						return nil, nil
 					}
@@ -57,12 +57,12 @@ func TestChange(t *testing.T) {
 			name: "Fail on PasswordMatch",
 			args: args{id: 1, oldpass: "hunter123"},
 			rbac: &mock.RBAC{
-				EnforceUserFn: func(c echo.Context, id uint) error {
+				EnforceUserFn: func(ctx context.Context, id uint) error {
 					return nil
 				}},
 			expectedErr: true,
 			udb: &mockstore.UserDBClient{
-				ViewFn: func(db *gorm.DB, id uint) (*models.User, error) {
+				ViewCredentialsFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
 					return &models.User{
 						Password: "HashedPassword",
 					}, nil
@@ -78,12 +78,12 @@ func TestChange(t *testing.T) {
 			name: "Fail on InsecurePassword",
 			args: args{id: 1, oldpass: "hunter123"},
 			rbac: &mock.RBAC{
-				EnforceUserFn: func(c echo.Context, id uint) error {
+				EnforceUserFn: func(ctx context.Context, id uint) error {
 					return nil
 				}},
 			expectedErr: true,
 			udb: &mockstore.UserDBClient{
-				ViewFn: func(db *gorm.DB, id uint) (*models.User, error) {
+				ViewCredentialsFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
 					return &models.User{
 						Password: "HashedPassword",
 					}, nil
@@ -102,16 +102,16 @@ func TestChange(t *testing.T) {
 			name: "Success",
 			args: args{id: 1, oldpass: "hunter123", newpass: "password"},
 			rbac: &mock.RBAC{
-				EnforceUserFn: func(c echo.Context, id uint) error {
+				EnforceUserFn: func(ctx context.Context, id uint) error {
 					return nil
 				}},
 			udb: &mockstore.UserDBClient{
-				ViewFn: func(db *gorm.DB, id uint) (*models.User, error) {
+				ViewCredentialsFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
 					return &models.User{
 						Password: "$2a$10$udRBroNGBeOYwSWCVzf6Lulg98uAoRCIi4t75VZg84xgw6EJbFNsG",
 					}, nil
 				},
-				UpdateFn: func(*gorm.DB, *models.User) error {
+				ChangePasswordFn: func(context.Context, *gorm.DB, *models.User) error {
 					return nil
 				},
 			},
@@ -130,16 +130,57 @@ func TestChange(t *testing.T) {
 	}
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			s := password.New(nil, tt.udb, tt.rbac, tt.sec)
-			err := s.Change(nil, tt.args.id, tt.args.oldpass, tt.args.newpass)
+			s := password.New(nil, mock.NoopTransactor(), tt.udb, tt.rbac, tt.sec, mock.NoopPublisher())
+			err := s.Change(context.Background(), tt.args.id, tt.args.oldpass, tt.args.newpass)
 			assert.Equal(t, tt.expectedErr, err != nil)
 			// Check whether password was changed
 		})
 	}
 }
 
+func TestChangeHashesOutsideTransaction(t *testing.T) {
+	inTx := false
+	tx := &mock.Transactor{
+		TransactionFn: func(ctx context.Context, fn func(*gorm.DB) error) error {
+			inTx = true
+			defer func() { inTx = false }()
+			return fn(nil)
+		},
+	}
+	udb := &mockstore.UserDBClient{
+		ViewCredentialsFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+			return &models.User{Base: models.Base{ID: id}, Password: "hash"}, nil
+		},
+		ChangePasswordFn: func(ctx context.Context, db *gorm.DB, u *models.User) error {
+			assert.True(t, inTx, "the change should be written in a transaction")
+			return nil
+		},
+	}
+	sec := &mock.Secure{
+		HashMatchesPasswordFn: func(string, string) bool {
+			assert.False(t, inTx, "passwords should not be checked in a transaction")
+			return true
+		},
+		PasswordFn: func(string, ...string) bool {
+			assert.False(t, inTx, "passwords should not be scored in a transaction")
+			return true
+		},
+		HashFn: func(string) string {
+			assert.False(t, inTx, "passwords should not be hashed in a transaction")
+			return "newhash"
+		},
+	}
+	rbac := &mock.RBAC{
+		EnforceUserFn: func(context.Context, uint) error {
+			return nil
+		},
+	}
+	s := password.New(nil, tx, udb, rbac, sec, mock.NoopPublisher())
+	assert.Nil(t, s.Change(context.Background(), 1, "oldpass", "newpass"))
+}
+
 func TestInitialize(t *testing.T) {
-	p := password.Initialize(nil, nil, nil)
+	p := password.Initialize(nil, nil, nil, nil, nil)
 	if p == nil {
 		t.Error("password service not initialized")
 	}
@@ -1,22 +1,23 @@
 package password
 
 import (
+	"context"
+
 	"github.com/jinzhu/gorm"
-	"github.com/labstack/echo"
 
-	"github.com/johncoleman83/cerebrum/pkg/api/store"
+	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
 	"github.com/johncoleman83/cerebrum/pkg/utl/models"
 )
 
 // Service represents password application interface
 type Service interface {
-	Change(echo.Context, uint, string, string) error
+	Change(context.Context, uint, string, string) error
 }
 
 // UserDBClientInterface represents user repository interface
 type UserDBClientInterface interface {
-	View(*gorm.DB, uint) (*models.User, error)
-	Update(*gorm.DB, *models.User) error
+	ViewCredentials(context.Context, *gorm.DB, uint) (*models.User, error)
+	ChangePassword(context.Context, *gorm.DB, *models.User) error
 }
 
 // Securer represents security interface
@@ -26,30 +27,44 @@ type Securer interface {
 	Password(string, ...string) bool
 }
 
+// Transactor represents the interface for running work in a single db transaction
+type Transactor interface {
+	Transaction(context.Context, func(*gorm.DB) error) error
+}
+
+// Publisher represents the domain event outbox interface
+type Publisher interface {
+	Publish(context.Context, *gorm.DB, string, uint, interface{}) error
+}
+
 // RBAC represents role-based-access-control interface
 type RBAC interface {
-	EnforceUser(echo.Context, uint) error
+	EnforceUser(context.Context, uint) error
 }
 
 // Password represents password application service
 type Password struct {
 	db   *gorm.DB
+	tx   Transactor
 	udb  UserDBClientInterface
 	rbac RBAC
 	sec  Securer
+	evt  Publisher
 }
 
 // New creates new password application service
-func New(db *gorm.DB, udb UserDBClientInterface, rbac RBAC, sec Securer) *Password {
+func New(db *gorm.DB, tx Transactor, udb UserDBClientInterface, rbac RBAC, sec Securer, evt Publisher) *Password {
 	return &Password{
 		db:   db,
+		tx:   tx,
 		udb:  udb,
 		rbac: rbac,
 		sec:  sec,
+		evt:  evt,
 	}
 }
 
 // Initialize initalizes password application service with defaults
-func Initialize(db *gorm.DB, rbac RBAC, sec Securer) *Password {
-	return New(db, store.NewUserDBClient(), rbac, sec)
+func Initialize(db *gorm.DB, udb UserDBClientInterface, rbac RBAC, sec Securer, evt Publisher) *Password {
+	return New(db, datastore.NewTransactor(db), udb, rbac, sec, evt)
 }
@@ -0,0 +1,34 @@
+package password
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/api/trace"
+
+	"github.com/johncoleman83/cerebrum/pkg/api/password"
+	"github.com/johncoleman83/cerebrum/pkg/utl/tracing"
+)
+
+// packageName is the name of the package
+const packageName = "password"
+
+// TraceService represents password tracing service
+type TraceService struct {
+	password.Service
+	tracer trace.Tracer
+}
+
+// New creates new password tracing service
+func New(svc password.Service, tracer trace.Tracer) *TraceService {
+	return &TraceService{
+		Service: svc,
+		tracer:  tracer,
+	}
+}
+
+// Change tracing
+func (ts *TraceService) Change(ctx context.Context, id uint, oldPass, newPass string) (err error) {
+	ctx, span := ts.tracer.Start(ctx, packageName+".Change")
+	defer func() { tracing.End(span, err) }()
+	return ts.Service.Change(ctx, id, oldPass, newPass)
+}
@@ -13,7 +13,7 @@ import (
 
 // Custom errors
 var (
-	ErrPasswordsNotMaching = echo.NewHTTPError(http.StatusBadRequest, "passwords do not match")
+	ErrPasswordsNotMaching = models.NewError(http.StatusBadRequest, "passwords_not_matching", "passwords do not match")
 )
 
 // HTTP represents password http transport service
@@ -80,7 +80,7 @@ func (h *HTTP) change(c echo.Context) error {
 		return ErrPasswordsNotMaching
 	}
 
-	if err := h.svc.Change(c, uint(id), p.OldPassword, p.NewPassword); err != nil {
+	if err := h.svc.Change(c.Request().Context(), uint(id), p.OldPassword, p.NewPassword); err != nil {
 		return err
 	}
 
@@ -2,6 +2,7 @@ package transport_test
 
 import (
 	"bytes"
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -15,7 +16,6 @@ import (
 	"github.com/johncoleman83/cerebrum/pkg/utl/server"
 
 	"github.com/jinzhu/gorm"
-	"github.com/labstack/echo"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -50,8 +50,8 @@ func TestChangePassword(t *testing.T) {
 			name: "Fail on RBAC",
 			req:  `{"new_password":"newpassw","old_password":"oldpassw", "new_password_confirm":"newpassw"}`,
 			rbac: &mock.RBAC{
-				EnforceUserFn: func(c echo.Context, id uint) error {
-					return echo.ErrForbidden
+				EnforceUserFn: func(ctx context.Context, id uint) error {
+					return models.ErrForbidden
 				},
 			},
 			id:             "1",
@@ -61,18 +61,18 @@ func TestChangePassword(t *testing.T) {
 			name: "Success",
 			req:  `{"new_password":"newpassw","old_password":"oldpassw", "new_password_confirm":"newpassw"}`,
 			rbac: &mock.RBAC{
-				EnforceUserFn: func(c echo.Context, id uint) error {
+				EnforceUserFn: func(ctx context.Context, id uint) error {
 					return nil
 				},
 			},
 			id: "1",
 			udb: &mockstore.UserDBClient{
-				ViewFn: func(db *gorm.DB, id uint) (*models.User, error) {
+				ViewCredentialsFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
 					return &models.User{
 						Password: "oldPassword",
 					}, nil
 				},
-				UpdateFn: func(db *gorm.DB, usr *models.User) error {
+				ChangePasswordFn: func(ctx context.Context, db *gorm.DB, usr *models.User) error {
 					return nil
 				},
 			},
@@ -95,9 +95,9 @@ func TestChangePassword(t *testing.T) {
 
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			r := server.New()
+			r := server.New(nil)
 			rg := r.Group("")
-			transport.NewHTTP(password.New(nil, tt.udb, tt.rbac, tt.sec), rg)
+			transport.NewHTTP(password.New(nil, mock.NoopTransactor(), tt.udb, tt.rbac, tt.sec, mock.NoopPublisher()), rg)
 			ts := httptest.NewServer(r)
 			defer ts.Close()
 			path := ts.URL + "/password/" + tt.id
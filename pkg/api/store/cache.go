@@ -0,0 +1,144 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/cache"
+	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
+	"github.com/johncoleman83/cerebrum/pkg/utl/eventbus"
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+// staleUserTopics are the topics of the events after which a cached user is stale
+var staleUserTopics = []string{
+	models.EventUserUpdated,
+	models.EventUserDeleted,
+	models.EventUserRestored,
+	models.EventUserPurged,
+	models.EventUserErased,
+	models.EventUserLoggedIn,
+	models.EventPasswordChanged,
+}
+
+// CachedUserDBClient is a UserDBClient which serves the users viewed outside
+// of transactions from a cache, reads of units of work always go to the db.
+// Users are cached with their personal data sealed. Missing users are read from the primary so
+// that the cache is not filled from lagging replicas. Users are invalidated
+// once their writes committed, and again once the events of writes are
+// dispatched, which covers the writes of other api instances.
+type CachedUserDBClient struct {
+	*UserDBClient
+	cache cache.Cache
+	ttl   time.Duration
+}
+
+// NewCachedUserDBClient returns a new user client caching users for ttl in
+// ch, a nil ch disables caching
+func NewCachedUserDBClient(c Cipher, ch cache.Cache, ttl time.Duration) *CachedUserDBClient {
+	return &CachedUserDBClient{UserDBClient: NewUserDBClient(c), cache: ch, ttl: ttl}
+}
+
+// userKey returns the cache key of the user with id
+func userKey(id uint) string {
+	return "user:" + strconv.FormatUint(uint64(id), 10)
+}
+
+// View returns single user by ID, from the cache outside of transactions.
+// Like the View of UserDBClient it never returns the password and token,
+// whether the cache is hit or not, see ViewCredentials.
+func (c *CachedUserDBClient) View(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+	if c.cache == nil || datastore.InTransaction(db) {
+		return c.UserDBClient.View(ctx, db, id)
+	}
+	// cache failures are not fatal, users are then read from the db
+	if data, ok, err := c.cache.Get(ctx, userKey(id)); err == nil && ok {
+		user := new(models.User)
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(user); err == nil {
+			if err := c.open(user); err == nil {
+				return user, nil
+			}
+		}
+	}
+	user, err := c.view(ctx, db, id, datastore.WithContext)
+	if err != nil {
+		return user, err
+	}
+	user.Password, user.Token = "", ""
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(user); err == nil {
+		_ = c.cache.Set(ctx, userKey(id), buf.Bytes(), c.ttl)
+	}
+	if err := c.open(user); err != nil {
+		return nil, wrapUserErr("user.view", err)
+	}
+	return user, nil
+}
+
+// Update updates user's info and invalidates its cached copy
+func (c *CachedUserDBClient) Update(ctx context.Context, db *gorm.DB, user *models.User) error {
+	defer c.invalidate(ctx, db, user.ID)
+	return c.UserDBClient.Update(ctx, db, user)
+}
+
+// UpdateUnscoped updates the info of a live or soft deleted user and
+// invalidates its cached copy
+func (c *CachedUserDBClient) UpdateUnscoped(ctx context.Context, db *gorm.DB, user *models.User) error {
+	defer c.invalidate(ctx, db, user.ID)
+	return c.UserDBClient.UpdateUnscoped(ctx, db, user)
+}
+
+// ChangePassword updates user's info and password and invalidates its cached copy
+func (c *CachedUserDBClient) ChangePassword(ctx context.Context, db *gorm.DB, user *models.User) error {
+	defer c.invalidate(ctx, db, user.ID)
+	return c.UserDBClient.ChangePassword(ctx, db, user)
+}
+
+// RecordLogin stores the login of a user and invalidates its cached copy
+func (c *CachedUserDBClient) RecordLogin(ctx context.Context, db *gorm.DB, user *models.User) error {
+	defer c.invalidate(ctx, db, user.ID)
+	return c.UserDBClient.RecordLogin(ctx, db, user)
+}
+
+// Delete sets deleted_at for a user and invalidates its cached copy
+func (c *CachedUserDBClient) Delete(ctx context.Context, db *gorm.DB, user *models.User) error {
+	defer c.invalidate(ctx, db, user.ID)
+	return c.UserDBClient.Delete(ctx, db, user)
+}
+
+// Restore clears deleted_at of a soft deleted user and invalidates its cached copy
+func (c *CachedUserDBClient) Restore(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+	defer c.invalidate(ctx, db, id)
+	return c.UserDBClient.Restore(ctx, db, id)
+}
+
+// invalidate removes the cached copy of a user once the write of db
+// committed, so that concurrent views do not cache the user as it was
+// before. Failures are left to the invalidation by events and to the expiry
+// of the entry.
+func (c *CachedUserDBClient) invalidate(ctx context.Context, db *gorm.DB, id uint) {
+	if c.cache == nil {
+		return
+	}
+	datastore.AfterCommit(db, func() {
+		_ = c.cache.Delete(ctx, userKey(id))
+	})
+}
+
+// Subscribe invalidates the cached copy of a user on every event after
+// which it is stale, failed invalidations are retried by the dispatcher
+func (c *CachedUserDBClient) Subscribe(b eventbus.Broker) {
+	if c.cache == nil {
+		return
+	}
+	for _, topic := range staleUserTopics {
+		b.Subscribe(topic, func(e eventbus.Event) error {
+			return c.cache.Delete(context.Background(), userKey(e.AggregateID))
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package store_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/api/store"
+	"github.com/johncoleman83/cerebrum/pkg/utl/cache"
+	"github.com/johncoleman83/cerebrum/pkg/utl/eventbus"
+	"github.com/johncoleman83/cerebrum/pkg/utl/mock/mockstore"
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+func TestCachedView(t *testing.T) {
+	db, err := mockstore.NewDataBaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := mockstore.InsertRowsFor(db, superAdmin); err != nil {
+		t.Fatal(err)
+	}
+	kr, err := mockstore.NewKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lru := cache.NewLRU(10)
+	udb := store.NewCachedUserDBClient(kr, lru, time.Minute)
+	ctx := context.Background()
+	usr, err := udb.Create(ctx, db, models.User{Username: "cached", FirstName: "Cached", Email: "cached@mail.com", Password: "hash", Token: "token", RoleID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rename := func(name string) {
+		if err := db.Model(&models.User{}).Where("id = ?", usr.ID).Update("first_name", name).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	user, err := udb.View(ctx, db, usr.ID)
+	assert.Nil(t, err)
+	if assert.NotNil(t, user) {
+		assert.Equal(t, "cached@mail.com", user.Email)
+		assert.Equal(t, superAdmin, user.Role)
+		assert.Empty(t, user.Password, "cached users should not have passwords")
+		assert.Empty(t, user.Token, "cached users should not have tokens")
+	}
+	data, ok, _ := lru.Get(ctx, "user:1")
+	assert.True(t, ok, "viewed users should be cached")
+	assert.False(t, strings.Contains(string(data), "cached@mail.com"), "cached users should be sealed")
+	assert.False(t, strings.Contains(string(data), "hash"), "cached users should not have passwords")
+
+	rename("Stale")
+	user, err = udb.View(ctx, db, usr.ID)
+	assert.Nil(t, err)
+	if assert.NotNil(t, user) {
+		assert.Equal(t, "Cached", user.FirstName, "cached users should be served from the cache")
+		assert.Equal(t, "cached@mail.com", user.Email, "cached users should be opened")
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		user, err := udb.View(ctx, tx, usr.ID)
+		assert.Nil(t, err)
+		if assert.NotNil(t, user) {
+			assert.Equal(t, "Stale", user.FirstName, "units of work should read from the db")
+			assert.Empty(t, user.Password, "viewed users should never have passwords")
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	creds, err := udb.ViewCredentials(ctx, db, usr.ID)
+	assert.Nil(t, err)
+	if assert.NotNil(t, creds) {
+		assert.Equal(t, "Stale", creds.FirstName, "credentials should not be read from the cache")
+		assert.Equal(t, "hash", creds.Password)
+		assert.Equal(t, "token", creds.Token)
+	}
+
+	user, _ = udb.View(ctx, db, usr.ID)
+	user.FirstName = "Updated"
+	assert.Nil(t, udb.Update(ctx, db, user))
+	_, ok, _ = lru.Get(ctx, "user:1")
+	assert.False(t, ok, "updated users should be invalidated")
+	user, err = udb.View(ctx, db, usr.ID)
+	assert.Nil(t, err)
+	if assert.NotNil(t, user) {
+		assert.Equal(t, "Updated", user.FirstName)
+	}
+	creds, _ = udb.ViewCredentials(ctx, db, usr.ID)
+	assert.Equal(t, "hash", creds.Password, "updates should not write the password")
+
+	broker := eventbus.NewInMemoryBroker()
+	udb.Subscribe(broker)
+	rename("Elsewhere")
+	assert.Nil(t, broker.Publish(eventbus.Event{Topic: models.EventUserLoggedIn, AggregateID: usr.ID}))
+	user, err = udb.View(ctx, db, usr.ID)
+	assert.Nil(t, err)
+	if assert.NotNil(t, user) {
+		assert.Equal(t, "Elsewhere", user.FirstName, "users should be invalidated by their events")
+	}
+
+	assert.Nil(t, udb.Delete(ctx, db, user))
+	_, err = udb.View(ctx, db, usr.ID)
+	assert.NotNil(t, err, "deleted users should not be served from the cache")
+}
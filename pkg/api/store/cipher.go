@@ -0,0 +1,66 @@
+package store
+
+import (
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+// Cipher represents the field encryption interface of the personal data
+// held in the user table
+type Cipher interface {
+	Encrypt(string) (string, error)
+	Decrypt(string) (string, error)
+	Stale(string) bool
+	BlindIndex(string) string
+}
+
+// sealedFields returns the personal data fields of user which are encrypted at rest
+func sealedFields(user *models.User) []*string {
+	return []*string{&user.Email, &user.Mobile, &user.Phone, &user.Address}
+}
+
+// seal encrypts the personal data of user in place and sets its email blind index
+func (u *UserDBClient) seal(user *models.User) error {
+	idx := u.cipher.BlindIndex(user.Email)
+	for _, f := range sealedFields(user) {
+		v, err := u.cipher.Encrypt(*f)
+		if err != nil {
+			return err
+		}
+		*f = v
+	}
+	user.EmailIndex = &idx
+	return nil
+}
+
+// open decrypts the personal data of user in place
+func (u *UserDBClient) open(user *models.User) error {
+	for _, f := range sealedFields(user) {
+		v, err := u.cipher.Decrypt(*f)
+		if err != nil {
+			return err
+		}
+		*f = v
+	}
+	return nil
+}
+
+// openAll decrypts the personal data of every user in place
+func (u *UserDBClient) openAll(users []models.User) error {
+	for i := range users {
+		if err := u.open(&users[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stale reports whether the opened user was sealed with a retired key, was
+// never sealed, or has an outdated blind index. sealed is the user as read.
+func (u *UserDBClient) stale(sealed, opened *models.User) bool {
+	for _, f := range sealedFields(sealed) {
+		if u.cipher.Stale(*f) {
+			return true
+		}
+	}
+	return sealed.EmailIndex == nil || *sealed.EmailIndex != u.cipher.BlindIndex(opened.Email)
+}
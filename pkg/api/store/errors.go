@@ -0,0 +1,115 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
+)
+
+// Kind classifies a store error independent of the underlying db driver
+type Kind string
+
+// Store error kinds
+const (
+	KindInternal    Kind = "internal"
+	KindNotFound    Kind = "not_found"
+	KindConflict    Kind = "conflict"
+	KindUnavailable Kind = "unavailable"
+	KindTimeout     Kind = "timeout"
+	KindCanceled    Kind = "canceled"
+)
+
+// Error is returned by every store operation which fails, it wraps the
+// underlying gorm or driver error which is never exposed to clients. Code
+// is the stable machine readable code of the error, its kind by default.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Op      string
+	Message string
+	Err     error
+}
+
+// Error returns the operation, the kind and the wrapped error
+func (e *Error) Error() string {
+	msg := e.Message
+	if e.Op != "" {
+		msg = e.Op + ": " + msg
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", msg, e.Err)
+	}
+	return msg
+}
+
+// Unwrap returns the wrapped gorm or driver error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is a store error of the same kind, so that
+// errors.Is(err, store.ErrNotFound) matches any not found error
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Kind == e.Kind && (t.Message == "" || t.Message == e.Message)
+}
+
+// ErrorKind returns the kind as a string for transports which do not import store
+func (e *Error) ErrorKind() string {
+	return string(e.Kind)
+}
+
+// ErrorCode returns the code, or the kind of errors without one
+func (e *Error) ErrorCode() string {
+	if e.Code != "" {
+		return e.Code
+	}
+	return string(e.Kind)
+}
+
+// PublicMessage returns the message which is safe to show to clients
+func (e *Error) PublicMessage() string {
+	return e.Message
+}
+
+// Sentinel errors to compare against with errors.Is
+var (
+	ErrNotFound    = &Error{Kind: KindNotFound}
+	ErrConflict    = &Error{Kind: KindConflict}
+	ErrUnavailable = &Error{Kind: KindUnavailable}
+	ErrTimeout     = &Error{Kind: KindTimeout}
+	ErrCanceled    = &Error{Kind: KindCanceled}
+	ErrInternal    = &Error{Kind: KindInternal}
+
+	ErrAlreadyExists  = &Error{Kind: KindConflict, Code: "already_exists", Message: "username or email already exists"}
+	ErrRecordNotFound = &Error{Kind: KindNotFound, Code: "user_not_found", Message: "user not found"}
+	ErrStaleVersion   = &Error{Kind: KindConflict, Code: "stale_version", Message: "user was modified by another request"}
+)
+
+// wrap classifies err returned by gorm for the input operation, notFound is
+// used when the record does not exist and conflict on duplicate keys
+func wrap(op string, err error, notFound, conflict *Error) error {
+	if err == nil {
+		return nil
+	}
+	e := &Error{Op: op, Err: err}
+	switch {
+	case gorm.IsRecordNotFoundError(err):
+		e.Kind, e.Code, e.Message = KindNotFound, notFound.Code, notFound.Message
+	case datastore.IsDuplicateKeyError(err):
+		e.Kind, e.Code, e.Message = KindConflict, conflict.Code, conflict.Message
+	case datastore.IsCanceledError(err):
+		e.Kind, e.Message = KindCanceled, "request was canceled"
+	case datastore.IsTimeoutError(err):
+		e.Kind, e.Message = KindTimeout, "database request timed out"
+	case datastore.IsUnavailableError(err):
+		e.Kind, e.Message = KindUnavailable, "database is unavailable"
+	case datastore.IsRetryableError(err):
+		e.Kind, e.Code, e.Message = KindConflict, "concurrent_request", "conflicting concurrent request, please retry"
+	default:
+		e.Kind, e.Message = KindInternal, "database error"
+	}
+	return e
+}
@@ -0,0 +1,57 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/api/store"
+	"github.com/johncoleman83/cerebrum/pkg/utl/mock/mockstore"
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+func TestError(t *testing.T) {
+	cause := errors.New("record not found")
+	err := &store.Error{Kind: store.KindNotFound, Op: "user.view", Message: "user not found", Err: cause}
+
+	assert.Equal(t, "user.view: user not found: record not found", err.Error())
+	assert.Equal(t, "not_found", err.ErrorKind())
+	assert.Equal(t, "not_found", err.ErrorCode(), "errors without a code should be coded by kind")
+	assert.Equal(t, "already_exists", store.ErrAlreadyExists.ErrorCode())
+	assert.Equal(t, "user not found", err.PublicMessage(), "the public message should not leak the cause")
+	assert.True(t, errors.Is(err, cause), "the gorm error should be wrapped")
+	assert.True(t, errors.Is(err, store.ErrNotFound), "any not found error should match the kind sentinel")
+	assert.True(t, errors.Is(err, store.ErrRecordNotFound))
+	assert.False(t, errors.Is(err, store.ErrConflict))
+	assert.False(t, errors.Is(err, store.ErrAlreadyExists))
+}
+
+func TestErrorKinds(t *testing.T) {
+	db, err := mockstore.NewDataBaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	udb := newUserDBClient(t)
+
+	_, err = udb.View(context.Background(), db, 404)
+	assert.True(t, errors.Is(err, store.ErrNotFound), "a missing user should be not found, got %v", err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = udb.View(ctx, db, 1)
+	assert.True(t, errors.Is(err, store.ErrCanceled), "a canceled request should abort the query, got %v", err)
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err = udb.View(ctx, db, 1)
+	assert.True(t, errors.Is(err, store.ErrTimeout), "an expired request should time out, got %v", err)
+
+	assert.Nil(t, db.Close())
+	_, err = udb.View(context.Background(), db, 1)
+	assert.True(t, errors.Is(err, store.ErrUnavailable), "a closed db should be unavailable, got %v", err)
+	_, _, err = udb.List(context.Background(), db, nil, nil, &models.Pagination{Limit: 10})
+	assert.True(t, errors.Is(err, store.ErrUnavailable), "list should not panic on db errors, got %v", err)
+}
@@ -0,0 +1,197 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+// errCursorValue is returned for cursor values which do not fit their column
+var errCursorValue = errors.New("cursor value does not match its column")
+
+// paginate runs q ordered by keys into rows, a pointer to a slice of models,
+// and returns where the rows stand among all results. The last key must be
+// unique and the key columns must not be null. Pages are read by offset, or
+// by seeking past the boundary row of a cursor, which stays fast for deep
+// pages and stable when rows are inserted or deleted meanwhile
+func paginate(q *gorm.DB, rows interface{}, keys []models.SortField, p *models.Pagination) (*models.Page, error) {
+	page := new(models.Page)
+	if p.Count {
+		var total int
+		if err := q.Model(rows).Count(&total).Error; err != nil {
+			return nil, err
+		}
+		page.Total = &total
+	}
+	columns := cursorColumns(keys)
+	before := p.Cursor != nil && p.Cursor.Before
+	if p.Cursor != nil {
+		args, err := cursorArgs(q, rows, columns, p.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Where(seekCondition(keys, before), args...)
+	} else {
+		q = q.Offset(p.Offset)
+	}
+	// rows before the cursor are read backwards from it and then reversed
+	for _, k := range keys {
+		q = q.Order(k.Column + direction(k.Desc != before))
+	}
+	// an extra row tells whether more rows follow the page
+	if err := q.Limit(p.Limit + 1).Find(rows).Error; err != nil {
+		return nil, err
+	}
+	v := reflect.ValueOf(rows).Elem()
+	more := v.Len() > p.Limit
+	if more {
+		v.Set(v.Slice(0, p.Limit))
+	}
+	if before {
+		swap := reflect.Swapper(v.Interface())
+		for i, j := 0, v.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+
+	hasNext, hasPrev := more, p.Cursor != nil || p.Offset > 0
+	if before {
+		hasNext, hasPrev = true, more
+	}
+	if hasNext {
+		page.Next = boundary(q, v, v.Len()-1, columns, false, p.Cursor)
+	}
+	if hasPrev {
+		page.Prev = boundary(q, v, 0, columns, true, p.Cursor)
+	}
+	return page, nil
+}
+
+// direction returns the sql order direction
+func direction(desc bool) string {
+	if desc {
+		return " desc"
+	}
+	return " asc"
+}
+
+// cursorColumns returns the columns of keys as stored in cursors, prefixed
+// with - when descending, so that cursors only apply to the same order
+func cursorColumns(keys []models.SortField) []string {
+	columns := make([]string, len(keys))
+	for i, k := range keys {
+		columns[i] = k.Column
+		if k.Desc {
+			columns[i] = "-" + k.Column
+		}
+	}
+	return columns
+}
+
+// seekCondition returns the condition selecting the rows after the boundary
+// row of a cursor in the order of keys, or before it, as a disjunction of
+// (k1 = ? AND ... AND kn > ?) which is portable unlike row comparisons and
+// supports mixed directions. Key columns are validated by their callers
+func seekCondition(keys []models.SortField, before bool) string {
+	ors := make([]string, len(keys))
+	for i, k := range keys {
+		ands := make([]string, 0, i+1)
+		for _, eq := range keys[:i] {
+			ands = append(ands, eq.Column+" = ?")
+		}
+		op := " > ?"
+		if k.Desc != before {
+			op = " < ?"
+		}
+		ands = append(ands, k.Column+op)
+		ors[i] = "(" + strings.Join(ands, " AND ") + ")"
+	}
+	return strings.Join(ors, " OR ")
+}
+
+// cursorArgs checks that c applies to columns and returns the arguments of
+// the seek condition, its values are converted to the types of the fields
+// of the model of rows
+func cursorArgs(q *gorm.DB, rows interface{}, columns []string, c *models.Cursor) ([]interface{}, error) {
+	if !reflect.DeepEqual(columns, c.Columns) {
+		return nil, models.ErrInvalidCursor
+	}
+	model := reflect.New(reflect.TypeOf(rows).Elem().Elem()).Interface()
+	scope := q.NewScope(model)
+	values := make([]interface{}, len(columns))
+	for i, col := range columns {
+		field, ok := scope.FieldByName(strings.TrimPrefix(col, "-"))
+		if !ok {
+			return nil, fmt.Errorf("unknown cursor column %q", col)
+		}
+		v, err := parseCursorValue(field.Field.Type(), c.Values[i])
+		if err != nil {
+			return nil, models.ErrInvalidCursor
+		}
+		values[i] = v
+	}
+	var args []interface{}
+	for i := range values {
+		args = append(args, values[:i+1]...)
+	}
+	return args, nil
+}
+
+// parseCursorValue parses a value formatted by formatCursorValue as typ
+func parseCursorValue(typ reflect.Type, s string) (interface{}, error) {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == reflect.TypeOf(time.Time{}) {
+		return time.Parse(time.RFC3339Nano, s)
+	}
+	switch typ.Kind() {
+	case reflect.String:
+		return s, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(s, 10, 64)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(s, 10, 64)
+	}
+	return nil, errCursorValue
+}
+
+// formatCursorValue formats the value of a key column for a cursor
+func formatCursorValue(v interface{}) string {
+	switch t := v.(type) {
+	case time.Time:
+		return t.Format(time.RFC3339Nano)
+	case *time.Time:
+		if t != nil {
+			return t.Format(time.RFC3339Nano)
+		}
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// boundary returns the cursor of the rows following the i-th row of page,
+// or preceding it. For an empty page the cursor of the request is turned
+// around, rows are left on the other side of it
+func boundary(q *gorm.DB, page reflect.Value, i int, columns []string, before bool, req *models.Cursor) *models.Cursor {
+	if page.Len() == 0 {
+		if req == nil {
+			return nil
+		}
+		return &models.Cursor{Columns: req.Columns, Values: req.Values, Before: before}
+	}
+	scope := q.NewScope(page.Index(i).Addr().Interface())
+	c := &models.Cursor{Columns: columns, Values: make([]string, len(columns)), Before: before}
+	for j, col := range columns {
+		field, _ := scope.FieldByName(strings.TrimPrefix(col, "-"))
+		c.Values[j] = formatCursorValue(field.Field.Interface())
+	}
+	return c
+}
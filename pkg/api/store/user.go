@@ -3,108 +3,508 @@
 package store
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
-	"log"
-	"net/http"
 	"strings"
+	"time"
 
 	"github.com/jinzhu/gorm"
-	"github.com/labstack/echo"
 
+	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
 	"github.com/johncoleman83/cerebrum/pkg/utl/models"
 )
 
-// Custom errors
-var (
-	ErrAlreadyExists  = echo.NewHTTPError(http.StatusBadRequest, "username or email already exists")
-	ErrRecordNotFound = echo.NewHTTPError(http.StatusNotFound, "user not found")
-)
+// wrapUserErr classifies a gorm error returned by a user operation
+func wrapUserErr(op string, err error) error {
+	return wrap(op, err, ErrRecordNotFound, ErrAlreadyExists)
+}
 
-// UserDBClient represents the client for user table
-type UserDBClient struct{}
+// UserDBClient represents the client for user table, the personal data of
+// users is encrypted at rest with its cipher and is handed out decrypted
+type UserDBClient struct {
+	cipher Cipher
+}
 
 // NewUserDBClient returns a new user client for db interface
-func NewUserDBClient() *UserDBClient {
-	return &UserDBClient{}
+func NewUserDBClient(c Cipher) *UserDBClient {
+	return &UserDBClient{cipher: c}
 }
 
-// Create creates a new user on database
-func (u *UserDBClient) Create(db *gorm.DB, user models.User) (*models.User, error) {
-	var checkUser = new(models.User)
-	if err := db.Where(
-		"lower(username) = ? or lower(email) = ?",
-		strings.ToLower(user.Username),
-		strings.ToLower(user.Email)).First(&checkUser).Error; err == nil {
-		return nil, ErrAlreadyExists
-	} else if !gorm.IsRecordNotFoundError(err) {
-		return nil, err
+// Create creates a new user on database, the unique indexes on username and
+// on the email blind index guarantee only one of concurrent duplicates succeeds
+func (u *UserDBClient) Create(ctx context.Context, db *gorm.DB, user models.User) (*models.User, error) {
+	db, cancel := datastore.WithContext(ctx, db, "user.create")
+	defer cancel()
+	if err := u.seal(&user); err != nil {
+		return nil, wrapUserErr("user.create", err)
 	}
 	if err := db.Create(&user).Error; err != nil {
-		return nil, err
+		return nil, wrapUserErr("user.create", err)
+	}
+	if err := u.open(&user); err != nil {
+		return nil, wrapUserErr("user.create", err)
 	}
 	return &user, nil
 }
 
-// View returns single user by ID
-func (u *UserDBClient) View(db *gorm.DB, id uint) (*models.User, error) {
-	var user = new(models.User)
-	if err := db.Set("gorm:auto_preload", true).Where("id = ?", id).First(&user).Error; gorm.IsRecordNotFoundError(err) {
-		return user, ErrRecordNotFound
-	} else if err != nil {
-		log.Panicln(fmt.Sprintf("db connection error %v", err))
+// View returns single user by ID without its password and token, see
+// ViewCredentials
+func (u *UserDBClient) View(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+	user, err := u.view(ctx, db, id, datastore.ReadContext)
+	if err != nil {
+		return user, err
+	}
+	user.Password, user.Token = "", ""
+	if err := u.open(user); err != nil {
+		return nil, wrapUserErr("user.view", err)
+	}
+	return user, nil
+}
+
+// ViewCredentials returns single user by ID with its password and token,
+// from the primary
+func (u *UserDBClient) ViewCredentials(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+	user, err := u.view(ctx, db, id, datastore.WithContext)
+	if err != nil {
 		return user, err
 	}
+	if err := u.open(user); err != nil {
+		return nil, wrapUserErr("user.view", err)
+	}
+	return user, nil
+}
+
+// ViewUnscoped returns single user by ID, live or soft deleted, from the primary
+func (u *UserDBClient) ViewUnscoped(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+	db, cancel := datastore.WithContext(ctx, db, "user.view")
+	defer cancel()
+	var user = new(models.User)
+	if err := db.Unscoped().Set("gorm:auto_preload", true).Where("id = ?", id).First(&user).Error; err != nil {
+		return user, wrapUserErr("user.view", err)
+	}
+	if err := u.open(user); err != nil {
+		return nil, wrapUserErr("user.view", err)
+	}
+	return user, nil
+}
+
+// view returns single user by ID as stored, with its personal data sealed,
+// bind binds db to ctx and chooses whether it is read from a replica
+func (u *UserDBClient) view(ctx context.Context, db *gorm.DB, id uint, bind func(context.Context, *gorm.DB, string) (*gorm.DB, context.CancelFunc)) (*models.User, error) {
+	db, cancel := bind(ctx, db, "user.view")
+	defer cancel()
+	var user = new(models.User)
+	if err := db.Set("gorm:auto_preload", true).Where("id = ?", id).First(&user).Error; err != nil {
+		return user, wrapUserErr("user.view", err)
+	}
 	return user, nil
 }
 
 // FindByUsername queries for single user by username
-func (u *UserDBClient) FindByUsername(db *gorm.DB, uname string) (*models.User, error) {
+func (u *UserDBClient) FindByUsername(ctx context.Context, db *gorm.DB, uname string) (*models.User, error) {
+	db, cancel := datastore.WithContext(ctx, db, "user.find_by_username")
+	defer cancel()
 	var user = new(models.User)
-	if err := db.Set("gorm:auto_preload", true).Where("username = ?", uname).First(&user).Error; gorm.IsRecordNotFoundError(err) {
-		return user, ErrRecordNotFound
-	} else if err != nil {
-		log.Panicln(fmt.Sprintf("db connection error %v", err))
-		return user, err
+	if err := db.Set("gorm:auto_preload", true).Where("username = ?", uname).First(&user).Error; err != nil {
+		return user, wrapUserErr("user.find_by_username", err)
+	}
+	if err := u.open(user); err != nil {
+		return nil, wrapUserErr("user.find_by_username", err)
 	}
 	return user, nil
 }
 
 // FindByToken queries for single user by token
-func (u *UserDBClient) FindByToken(db *gorm.DB, token string) (*models.User, error) {
+func (u *UserDBClient) FindByToken(ctx context.Context, db *gorm.DB, token string) (*models.User, error) {
+	db, cancel := datastore.WithContext(ctx, db, "user.find_by_token")
+	defer cancel()
 	var user = new(models.User)
-	if err := db.Set("gorm:auto_preload", true).Where("token = ?", token).First(&user).Error; gorm.IsRecordNotFoundError(err) {
-		return user, ErrRecordNotFound
-	} else if err != nil {
-		log.Panicln(fmt.Sprintf("db connection error %v", err))
-		return user, err
+	if err := db.Set("gorm:auto_preload", true).Where("token = ?", token).First(&user).Error; err != nil {
+		return user, wrapUserErr("user.find_by_token", err)
+	}
+	if err := u.open(user); err != nil {
+		return nil, wrapUserErr("user.find_by_token", err)
 	}
 	return user, nil
 }
 
-// List returns list of all users retrievable for the current user, depending on role
-func (u *UserDBClient) List(db *gorm.DB, qp *models.ListQuery, p *models.Pagination) ([]models.User, error) {
-	var users []models.User
-	// Inner Join users with Role
+// FindByEmail queries for single user by email through its blind index
+func (u *UserDBClient) FindByEmail(ctx context.Context, db *gorm.DB, email string) (*models.User, error) {
+	db, cancel := datastore.WithContext(ctx, db, "user.find_by_email")
+	defer cancel()
+	var user = new(models.User)
+	if err := db.Set("gorm:auto_preload", true).Where("email_index = ?", u.cipher.BlindIndex(email)).First(&user).Error; err != nil {
+		return user, wrapUserErr("user.find_by_email", err)
+	}
+	if err := u.open(user); err != nil {
+		return nil, wrapUserErr("user.find_by_email", err)
+	}
+	return user, nil
+}
+
+// List returns a page of the users retrievable for the current user,
+// depending on role, which match the filter, ordered by the filter sort and
+// then by id
+func (u *UserDBClient) List(ctx context.Context, db *gorm.DB, qp *models.ListQuery, f *models.UserFilter, p *models.Pagination) ([]models.User, *models.Page, error) {
+	db, cancel := datastore.ReadContext(ctx, db, "user.list")
+	defer cancel()
+	keys, err := sortKeys(f)
+	if err != nil {
+		return nil, nil, wrapUserErr("user.list", err)
+	}
+	users := []models.User{}
+	q := db.Set("gorm:auto_preload", true)
 	if qp != nil {
-		if err := db.Set("gorm:auto_preload", true).Offset(p.Offset).Limit(p.Limit).Where(qp.Query, qp.ID).Find(&users).Order("lastname asc").Error; err != nil {
-			log.Panicln(fmt.Sprintf("db connection error %v", err))
-			return users, err
-		}
-	} else {
-		if err := db.Set("gorm:auto_preload", true).Offset(p.Offset).Limit(p.Limit).Find(&users).Order("lastname asc").Error; err != nil {
-			log.Panicln(fmt.Sprintf("db connection error %v", err))
-			return users, err
+		q = q.Where(qp.Query, qp.ID)
+	}
+	page, err := paginate(u.filter(q, f), &users, keys, p)
+	if err == models.ErrInvalidCursor {
+		return nil, nil, err
+	}
+	if err != nil {
+		return nil, nil, wrapUserErr("user.list", err)
+	}
+	if err := u.openAll(users); err != nil {
+		return nil, nil, wrapUserErr("user.list", err)
+	}
+	return users, page, nil
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns with the ! escape
+// character, which unlike the backslash means the same in every dialect
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// filter adds the conditions of f to q
+func (u *UserDBClient) filter(q *gorm.DB, f *models.UserFilter) *gorm.DB {
+	if f == nil {
+		return q
+	}
+	if f.RoleID != 0 {
+		q = q.Where("role_id = ?", f.RoleID)
+	}
+	if f.TeamID != 0 {
+		q = q.Where("team_id = ?", f.TeamID)
+	}
+	if f.AccountID != 0 {
+		q = q.Where("account_id = ?", f.AccountID)
+	}
+	if f.CreatedAfter != nil {
+		q = q.Where("created_at >= ?", *f.CreatedAfter)
+	}
+	if f.CreatedBefore != nil {
+		q = q.Where("created_at < ?", *f.CreatedBefore)
+	}
+	if f.LastLoginAfter != nil {
+		q = q.Where("last_login >= ?", *f.LastLoginAfter)
+	}
+	if f.LastLoginBefore != nil {
+		q = q.Where("last_login < ?", *f.LastLoginBefore)
+	}
+	if f.Search != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(f.Search)) + "%"
+		q = q.Where("lower(first_name) LIKE ? ESCAPE '!' OR lower(last_name) LIKE ? ESCAPE '!' OR lower(username) LIKE ? ESCAPE '!' OR email_index = ?",
+			pattern, pattern, pattern, u.cipher.BlindIndex(f.Search))
+	}
+	return q
+}
+
+// sortKeys returns the order of f, users are always ordered by id last so
+// that pages are stable
+func sortKeys(f *models.UserFilter) ([]models.SortField, error) {
+	var keys []models.SortField
+	if f != nil {
+		for _, s := range f.Sort {
+			// columns cannot be bound as parameters, only known ones are used
+			if !models.UserSortColumns[s.Column] {
+				return nil, fmt.Errorf("unknown sort column %q", s.Column)
+			}
+			if s.Column != "id" {
+				keys = append(keys, s)
+			}
 		}
 	}
-	return users, nil
+	return append(keys, models.SortField{Column: "id"}), nil
+}
+
+// Update updates user's info unless the user was modified since it was read,
+// which is reported as ErrStaleVersion, the version of user is incremented.
+// The password and token are not written, see ChangePassword and RecordLogin.
+func (u *UserDBClient) Update(ctx context.Context, db *gorm.DB, user *models.User) error {
+	db, cancel := datastore.WithContext(ctx, db, "user.update")
+	defer cancel()
+	return u.update(db, user, "password", "token")
+}
+
+// UpdateUnscoped is Update for a user which may be soft deleted, it writes
+// the password and token too
+func (u *UserDBClient) UpdateUnscoped(ctx context.Context, db *gorm.DB, user *models.User) error {
+	db, cancel := datastore.WithContext(ctx, db, "user.update")
+	defer cancel()
+	return u.update(db.Unscoped(), user)
+}
+
+// ChangePassword is Update writing the password of user too
+func (u *UserDBClient) ChangePassword(ctx context.Context, db *gorm.DB, user *models.User) error {
+	db, cancel := datastore.WithContext(ctx, db, "user.change_password")
+	defer cancel()
+	return u.update(db, user, "token")
+}
+
+// update implements Update on the context bound db, the columns of omit are
+// not written
+func (u *UserDBClient) update(db *gorm.DB, user *models.User, omit ...string) error {
+	// user is sealed as a copy as it keeps being used decrypted by the caller
+	row := *user
+	if err := u.seal(&row); err != nil {
+		return wrapUserErr("user.update", err)
+	}
+	ok, err := saveVersioned(db, &row, &row.Base, omit...)
+	user.Version, user.UpdatedAt, user.EmailIndex = row.Version, row.UpdatedAt, row.EmailIndex
+	if err != nil || ok {
+		return wrapUserErr("user.update", err)
+	}
+	var count int
+	if err := db.Model(&models.User{}).Where("id = ?", user.ID).Count(&count).Error; err != nil {
+		return wrapUserErr("user.update", err)
+	}
+	if count == 0 {
+		return wrapUserErr("user.update", gorm.ErrRecordNotFound)
+	}
+	return &Error{Kind: KindConflict, Code: ErrStaleVersion.Code, Op: "user.update", Message: ErrStaleVersion.Message}
 }
 
-// Update updates user's info
-func (u *UserDBClient) Update(db *gorm.DB, user *models.User) error {
-	return db.Save(user).Error
+// RecordLogin stores the refresh token and last login of user without
+// versioning it, as logging in does not change the user. The login is only
+// recorded if the password of user is still the one it was authenticated
+// with, ErrStaleVersion is returned otherwise.
+func (u *UserDBClient) RecordLogin(ctx context.Context, db *gorm.DB, user *models.User) error {
+	db, cancel := datastore.WithContext(ctx, db, "user.record_login")
+	defer cancel()
+	res := db.Model(&models.User{}).Where("id = ? AND password = ?", user.ID, user.Password).UpdateColumns(map[string]interface{}{
+		"token":      user.Token,
+		"last_login": user.LastLogin,
+	})
+	if res.Error != nil {
+		return wrapUserErr("user.record_login", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return &Error{Kind: KindConflict, Code: ErrStaleVersion.Code, Op: "user.record_login", Message: ErrStaleVersion.Message}
+	}
+	return nil
 }
 
 // Delete sets deleted_at for a user
-func (u *UserDBClient) Delete(db *gorm.DB, user *models.User) error {
-	return db.Delete(user).Error
+func (u *UserDBClient) Delete(ctx context.Context, db *gorm.DB, user *models.User) error {
+	db, cancel := datastore.WithContext(ctx, db, "user.delete")
+	defer cancel()
+	return wrapUserErr("user.delete", db.Delete(user).Error)
+}
+
+// ListDeleted returns a page of the soft deleted users, most recently deleted first
+func (u *UserDBClient) ListDeleted(ctx context.Context, db *gorm.DB, p *models.Pagination) ([]models.User, *models.Page, error) {
+	db, cancel := datastore.ReadContext(ctx, db, "user.list_deleted")
+	defer cancel()
+	users := []models.User{}
+	q := db.Unscoped().Set("gorm:auto_preload", true).Where("deleted_at IS NOT NULL")
+	keys := []models.SortField{{Column: "deleted_at", Desc: true}, {Column: "id"}}
+	page, err := paginate(q, &users, keys, p)
+	if err == models.ErrInvalidCursor {
+		return nil, nil, err
+	}
+	if err != nil {
+		return nil, nil, wrapUserErr("user.list_deleted", err)
+	}
+	if err := u.openAll(users); err != nil {
+		return nil, nil, wrapUserErr("user.list_deleted", err)
+	}
+	return users, page, nil
+}
+
+// Restore clears deleted_at of a soft deleted user, ErrAlreadyExists is
+// returned if a live user took its username or email in the meantime
+func (u *UserDBClient) Restore(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+	db, cancel := datastore.WithContext(ctx, db, "user.restore")
+	defer cancel()
+	res := db.Unscoped().Model(&models.User{}).Where("id = ? AND deleted_at IS NOT NULL", id).Updates(map[string]interface{}{
+		"deleted_at": nil,
+		"version":    gorm.Expr("version + 1"),
+	})
+	if res.Error != nil {
+		return nil, wrapUserErr("user.restore", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return nil, wrapUserErr("user.restore", gorm.ErrRecordNotFound)
+	}
+	var user = new(models.User)
+	if err := db.Set("gorm:auto_preload", true).Where("id = ?", id).First(user).Error; err != nil {
+		return nil, wrapUserErr("user.restore", err)
+	}
+	if err := u.open(user); err != nil {
+		return nil, wrapUserErr("user.restore", err)
+	}
+	return user, nil
+}
+
+// PurgeDeleted permanently deletes up to limit users which were soft deleted
+// before the input time, oldest first, and returns them
+func (u *UserDBClient) PurgeDeleted(ctx context.Context, db *gorm.DB, before time.Time, limit int) ([]models.User, error) {
+	db, cancel := datastore.WithContext(ctx, db, "user.purge_deleted")
+	defer cancel()
+	var users []models.User
+	q := db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", before)
+	if err := q.Order("deleted_at").Limit(limit).Find(&users).Error; err != nil {
+		return nil, wrapUserErr("user.purge_deleted", err)
+	}
+	if len(users) == 0 {
+		return users, nil
+	}
+	ids := make([]uint, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	// deleted_at is checked again so that a concurrently restored user is kept
+	if err := db.Unscoped().Where("id IN (?) AND deleted_at IS NOT NULL", ids).Delete(&models.User{}).Error; err != nil {
+		return nil, wrapUserErr("user.purge_deleted", err)
+	}
+	if err := u.openAll(users); err != nil {
+		return nil, wrapUserErr("user.purge_deleted", err)
+	}
+	return users, nil
+}
+
+// Reencrypt seals again the personal data of up to limit users, live or
+// deleted, with id greater than after, if it was sealed with a retired key,
+// never sealed or has an outdated blind index. It returns the last id read,
+// 0 once every user was read, and the number of users sealed again. Users
+// are not versioned by this, re-encrypting does not change them.
+func (u *UserDBClient) Reencrypt(ctx context.Context, db *gorm.DB, after uint, limit int) (uint, int, error) {
+	db, cancel := datastore.WithContext(ctx, db, "user.reencrypt")
+	defer cancel()
+	var users []models.User
+	if err := db.Unscoped().Where("id > ?", after).Order("id").Limit(limit).Find(&users).Error; err != nil {
+		return 0, 0, wrapUserErr("user.reencrypt", err)
+	}
+	if len(users) == 0 {
+		return 0, 0, nil
+	}
+	count := 0
+	for _, sealed := range users {
+		ok, err := u.reencrypt(db, sealed)
+		if err != nil {
+			return 0, count, wrapUserErr("user.reencrypt", err)
+		}
+		if ok {
+			count++
+		}
+	}
+	return users[len(users)-1].ID, count, nil
+}
+
+// reencryptAttempts bounds the attempts to seal again a user which keeps
+// being updated concurrently
+const reencryptAttempts = 3
+
+// reencrypt seals again the personal data of sealed if it is stale and
+// reports whether it did. The row is only written if its version is still
+// that of sealed, so that concurrent updates are not overwritten by the data
+// read before them, the row is read again otherwise. A user which keeps
+// being updated is skipped, as updates seal it with the current key.
+func (u *UserDBClient) reencrypt(db *gorm.DB, sealed models.User) (bool, error) {
+	for attempt := 0; attempt < reencryptAttempts; attempt++ {
+		opened := sealed
+		if err := u.open(&opened); err != nil {
+			return false, err
+		}
+		if !u.stale(&sealed, &opened) {
+			return false, nil
+		}
+		if err := u.seal(&opened); err != nil {
+			return false, err
+		}
+		res := db.Unscoped().Model(&sealed).Where("version = ?", sealed.Version).UpdateColumns(map[string]interface{}{
+			"email":       opened.Email,
+			"mobile":      opened.Mobile,
+			"phone":       opened.Phone,
+			"address":     opened.Address,
+			"email_index": opened.EmailIndex,
+		})
+		if res.Error != nil {
+			return false, res.Error
+		}
+		if res.RowsAffected == 1 {
+			return true, nil
+		}
+		id := sealed.ID
+		sealed = models.User{}
+		if err := db.Unscoped().Where("id = ?", id).First(&sealed).Error; err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// piiFields are the json keys of the personal data of a user which may be
+// held in the payloads of its events
+var piiFields = []string{"first_name", "last_name", "username", "email", "mobile", "phone", "address"}
+
+// Events returns the domain events recorded for a user, oldest first
+func (u *UserDBClient) Events(ctx context.Context, db *gorm.DB, id uint) ([]models.OutboxEvent, error) {
+	db, cancel := datastore.ReadContext(ctx, db, "user.events")
+	defer cancel()
+	var events []models.OutboxEvent
+	q := db.Where("aggregate_id = ? AND topic IN (?)", id, models.UserEventTopics)
+	if err := q.Order("id").Find(&events).Error; err != nil {
+		return nil, wrapUserErr("user.events", err)
+	}
+	return events, nil
+}
+
+// RedactEvents overwrites the personal data held in the payloads of the
+// events of user with its current, anonymized, values. The events themselves
+// are kept as the audit history of the user.
+func (u *UserDBClient) RedactEvents(ctx context.Context, db *gorm.DB, user *models.User) error {
+	db, cancel := datastore.WithContext(ctx, db, "user.redact_events")
+	defer cancel()
+	var current map[string]interface{}
+	data, err := json.Marshal(user)
+	if err != nil {
+		return wrapUserErr("user.redact_events", err)
+	}
+	if err := json.Unmarshal(data, &current); err != nil {
+		return wrapUserErr("user.redact_events", err)
+	}
+	var events []models.OutboxEvent
+	if err := db.Where("aggregate_id = ? AND topic IN (?)", user.ID, models.UserEventTopics).Find(&events).Error; err != nil {
+		return wrapUserErr("user.redact_events", err)
+	}
+	for _, e := range events {
+		var payload map[string]interface{}
+		if err := json.Unmarshal([]byte(e.Payload), &payload); err != nil {
+			// only object payloads may carry named personal data
+			continue
+		}
+		redacted := false
+		for _, k := range piiFields {
+			if _, ok := payload[k]; !ok {
+				continue
+			}
+			if v, ok := current[k]; ok {
+				payload[k] = v
+			} else {
+				delete(payload, k)
+			}
+			redacted = true
+		}
+		if !redacted {
+			continue
+		}
+		if data, err = json.Marshal(payload); err != nil {
+			return wrapUserErr("user.redact_events", err)
+		}
+		if err := db.Model(&e).Update("payload", string(data)).Error; err != nil {
+			return wrapUserErr("user.redact_events", err)
+		}
+	}
+	return nil
 }
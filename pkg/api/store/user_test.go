@@ -1,15 +1,23 @@
 package store_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/jinzhu/gorm"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/johncoleman83/cerebrum/pkg/api/store"
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+	"github.com/johncoleman83/cerebrum/pkg/utl/keyring"
 	"github.com/johncoleman83/cerebrum/pkg/utl/mock/mockstore"
 	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+	"github.com/johncoleman83/cerebrum/pkg/utl/support"
 )
 
 var (
@@ -21,6 +29,33 @@ var (
 	}
 )
 
+// newUserDBClient returns a user client sealing users with the testing keyring
+func newUserDBClient(t *testing.T) *store.UserDBClient {
+	kr, err := mockstore.NewKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store.NewUserDBClient(kr)
+}
+
+// readUser reads the row of a user as is and decrypts its personal data
+func readUser(t *testing.T, db *gorm.DB, id uint) *models.User {
+	kr, err := mockstore.NewKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{}
+	if err := db.First(user, id).Error; err != nil {
+		t.Error(err)
+	}
+	for _, f := range []*string{&user.Email, &user.Mobile, &user.Phone, &user.Address} {
+		if *f, err = kr.Decrypt(*f); err != nil {
+			t.Error(err)
+		}
+	}
+	return user
+}
+
 func TestCreate(t *testing.T) {
 	cases := []struct {
 		name         string
@@ -40,7 +75,7 @@ func TestCreate(t *testing.T) {
 				AccountID: 1,
 				TeamID:    1,
 				Password:  "pass",
-				Base:      models.Base{ID: 1},
+				Base:      models.Base{ID: 1, Version: 1},
 			},
 		},
 		{
@@ -55,7 +90,7 @@ func TestCreate(t *testing.T) {
 				AccountID: 1,
 				TeamID:    1,
 				Password:  "pass",
-				Base:      models.Base{ID: 12},
+				Base:      models.Base{ID: 12, Version: 1},
 			},
 		},
 		{
@@ -70,7 +105,22 @@ func TestCreate(t *testing.T) {
 				AccountID: 1,
 				TeamID:    1,
 				Password:  "pass",
-				Base:      models.Base{ID: 13},
+				Base:      models.Base{ID: 13, Version: 1},
+			},
+		},
+		{
+			name:        "Fail on insert duplicate username and email with different case",
+			expectedErr: true,
+			req: models.User{
+				Email:     "AlreadyUsed@Mail.com",
+				FirstName: "Already",
+				LastName:  "Used",
+				Username:  "ALREADYUSED",
+				RoleID:    1,
+				AccountID: 1,
+				TeamID:    1,
+				Password:  "pass",
+				Base:      models.Base{ID: 14, Version: 1},
 			},
 		},
 		{
@@ -85,7 +135,7 @@ func TestCreate(t *testing.T) {
 				AccountID: 1,
 				TeamID:    1,
 				Password:  "pass",
-				Base:      models.Base{ID: 42},
+				Base:      models.Base{ID: 42, Version: 1},
 			},
 			expectedData: &models.User{
 				Email:     "successfullyNew@mail.com",
@@ -96,7 +146,7 @@ func TestCreate(t *testing.T) {
 				AccountID: 1,
 				TeamID:    1,
 				Password:  "pass",
-				Base:      models.Base{ID: 42},
+				Base:      models.Base{ID: 42, Version: 1},
 			},
 		},
 	}
@@ -110,18 +160,24 @@ func TestCreate(t *testing.T) {
 	duplicateUser := &models.User{
 		Email:    "alreadyused@mail.com",
 		Username: "alreadyused",
-		Base:     models.Base{ID: 1},
+		Base:     models.Base{ID: 1, Version: 1},
 	}
-	if err := mockstore.InsertRowsFor(db, superAdmin, duplicateUser); err != nil {
+	if err := mockstore.InsertRowsFor(db, superAdmin); err != nil {
 		t.Error(err)
 	}
 
-	udb := store.NewUserDBClient()
+	udb := newUserDBClient(t)
+	if _, err := udb.Create(context.Background(), db, *duplicateUser); err != nil {
+		t.Error(err)
+	}
 
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			resp, err := udb.Create(db, tt.req)
+			resp, err := udb.Create(context.Background(), db, tt.req)
 			assert.Equal(t, tt.expectedErr, err != nil)
+			if tt.expectedErr {
+				assert.True(t, errors.Is(err, store.ErrAlreadyExists), "duplicates should be reported as already existing")
+			}
 			if tt.expectedData != nil {
 				if resp == nil {
 					t.Error("Expected data, but received nil.")
@@ -131,12 +187,64 @@ func TestCreate(t *testing.T) {
 				tt.expectedData.UpdatedAt = resp.UpdatedAt
 				tt.expectedData.LastLogin = resp.LastLogin
 				tt.expectedData.LastPasswordChange = resp.LastPasswordChange
+				assert.NotNil(t, resp.EmailIndex, "the email blind index should be set")
+				tt.expectedData.EmailIndex = resp.EmailIndex
 				assert.Equal(t, tt.expectedData, resp)
 			}
 		})
 	}
 }
 
+func TestCreateConcurrent(t *testing.T) {
+	db, err := mockstore.NewDataBaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := mockstore.InsertRowsFor(db, superAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	udb := newUserDBClient(t)
+	const n = 10
+	var (
+		wg      sync.WaitGroup
+		errs    = make(chan error, n)
+		created = make(chan *models.User, n)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			user, err := udb.Create(context.Background(), db, models.User{
+				Email:     "Racer@mail.com",
+				Username:  "racer",
+				FirstName: fmt.Sprintf("Racer%d", i),
+				RoleID:    1,
+				AccountID: 1,
+				TeamID:    1,
+			})
+			if err != nil {
+				errs <- err
+				return
+			}
+			created <- user
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	close(created)
+
+	assert.Len(t, created, 1, "exactly one of the parallel creates should win")
+	assert.Len(t, errs, n-1)
+	for err := range errs {
+		assert.True(t, errors.Is(err, store.ErrAlreadyExists))
+	}
+	var count int
+	assert.Nil(t, db.Model(&models.User{}).Where("lower(username) = ?", "racer").Count(&count).Error)
+	assert.Equal(t, 1, count)
+}
+
 func TestView(t *testing.T) {
 	cases := []struct {
 		name         string
@@ -163,7 +271,7 @@ func TestView(t *testing.T) {
 				TeamID:    1,
 				Password:  "newPass",
 				Token:     "asdf",
-				Base:      models.Base{ID: 2},
+				Base:      models.Base{ID: 2, Version: 1},
 			},
 		},
 	}
@@ -178,14 +286,14 @@ func TestView(t *testing.T) {
 		t.Error(err)
 	}
 
-	udb := store.NewUserDBClient()
+	udb := newUserDBClient(t)
 
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			user, err := udb.View(db, tt.id)
+			user, err := udb.View(context.Background(), db, tt.id)
 			assert.Equal(t, tt.expectedErr, err != nil)
 			if tt.expectedErr == true {
-				assert.Equal(t, "code=404, message=user not found", err.Error(), "error should be `code=404, message=user not found`")
+				assert.True(t, errors.Is(err, store.ErrRecordNotFound), "error should be a user not found error")
 			}
 			if tt.expectedData != nil {
 				if user == nil {
@@ -196,7 +304,12 @@ func TestView(t *testing.T) {
 					tt.expectedData.LastLogin = user.LastLogin
 					tt.expectedData.LastPasswordChange = user.LastPasswordChange
 					tt.expectedData.Role = superAdmin
-					assert.Equal(t, tt.expectedData, user)
+					creds, err := udb.ViewCredentials(context.Background(), db, tt.id)
+					assert.Nil(t, err)
+					assert.Equal(t, tt.expectedData, creds)
+					expected := *tt.expectedData
+					expected.Password, expected.Token = "", ""
+					assert.Equal(t, &expected, user, "viewed users should not have credentials")
 				}
 			}
 		})
@@ -227,7 +340,7 @@ func TestFindByUsername(t *testing.T) {
 				AccountID: 1,
 				TeamID:    1,
 				Password:  "newPass",
-				Base:      models.Base{ID: 2},
+				Base:      models.Base{ID: 2, Version: 1},
 			},
 		},
 	}
@@ -242,11 +355,11 @@ func TestFindByUsername(t *testing.T) {
 		t.Error(err)
 	}
 
-	udb := store.NewUserDBClient()
+	udb := newUserDBClient(t)
 
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			user, err := udb.FindByUsername(db, tt.username)
+			user, err := udb.FindByUsername(context.Background(), db, tt.username)
 			assert.Equal(t, tt.expectedErr, err != nil)
 
 			if tt.expectedData != nil {
@@ -286,7 +399,7 @@ func TestFindByToken(t *testing.T) {
 				AccountID: 1,
 				TeamID:    1,
 				Password:  "hunter2",
-				Base:      models.Base{ID: 1},
+				Base:      models.Base{ID: 1, Version: 1},
 				Token:     "loginrefresh",
 			},
 		},
@@ -302,11 +415,11 @@ func TestFindByToken(t *testing.T) {
 		t.Error(err)
 	}
 
-	udb := store.NewUserDBClient()
+	udb := newUserDBClient(t)
 
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			user, err := udb.FindByToken(db, tt.token)
+			user, err := udb.FindByToken(context.Background(), db, tt.token)
 			assert.Equal(t, tt.expectedErr, err != nil)
 
 			if tt.expectedData != nil {
@@ -351,7 +464,7 @@ func TestList(t *testing.T) {
 					AccountID: 1,
 					TeamID:    1,
 					Password:  "newPass",
-					Base:      models.Base{ID: 1},
+					Base:      models.Base{ID: 1, Version: 1},
 				},
 				{
 					Email:     "amandacena@mail.com",
@@ -363,7 +476,7 @@ func TestList(t *testing.T) {
 					TeamID:    1,
 					Password:  "hunter2",
 					Token:     "loginrefresh",
-					Base:      models.Base{ID: 2},
+					Base:      models.Base{ID: 2, Version: 1},
 				},
 			},
 		},
@@ -389,7 +502,7 @@ func TestList(t *testing.T) {
 					TeamID:    1,
 					Password:  "hunter2",
 					Token:     "loginrefresh",
-					Base:      models.Base{ID: 2},
+					Base:      models.Base{ID: 2, Version: 1},
 				},
 			},
 		},
@@ -424,7 +537,7 @@ func TestList(t *testing.T) {
 					AccountID: 1,
 					TeamID:    1,
 					Password:  "newPass",
-					Base:      models.Base{ID: 1},
+					Base:      models.Base{ID: 1, Version: 1},
 				},
 				{
 					Email:     "amandacena@mail.com",
@@ -436,7 +549,7 @@ func TestList(t *testing.T) {
 					TeamID:    1,
 					Password:  "hunter2",
 					Token:     "loginrefresh",
-					Base:      models.Base{ID: 2},
+					Base:      models.Base{ID: 2, Version: 1},
 				},
 				{
 					Email:     "sarahsmith@mail.com",
@@ -448,7 +561,7 @@ func TestList(t *testing.T) {
 					TeamID:    3,
 					Password:  "hunter2",
 					Token:     "loginrefresh",
-					Base:      models.Base{ID: 3},
+					Base:      models.Base{ID: 3, Version: 1},
 				},
 			},
 		},
@@ -464,11 +577,11 @@ func TestList(t *testing.T) {
 		t.Error(err)
 	}
 
-	udb := store.NewUserDBClient()
+	udb := newUserDBClient(t)
 
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			users, err := udb.List(db, tt.qp, tt.pg)
+			users, _, err := udb.List(context.Background(), db, tt.qp, nil, tt.pg)
 			assert.Equal(t, tt.expectedErr, err != nil)
 			if tt.expectedData != nil {
 				for i, v := range users {
@@ -484,12 +597,179 @@ func TestList(t *testing.T) {
 	}
 }
 
+func TestListFilter(t *testing.T) {
+	db, err := mockstore.NewDataBaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := mockstore.InsertRowsFor(db, superAdmin); err != nil {
+		t.Fatal(err)
+	}
+	udb := newUserDBClient(t)
+	ctx := context.Background()
+
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	seeds := []struct {
+		user      models.User
+		createdAt time.Time
+		lastLogin time.Time
+	}{
+		{models.User{FirstName: "Jane", LastName: "Doe", Username: "jdoe", Email: "jane@mail.com", RoleID: 1, AccountID: 1, TeamID: 1}, day(1), day(10)},
+		{models.User{FirstName: "John", LastName: "Doe", Username: "john_doe", Email: "john@mail.com", RoleID: 1, AccountID: 1, TeamID: 2}, day(2), day(5)},
+		{models.User{FirstName: "Ann", LastName: "Smith", Username: "100%ann", Email: "ann@mail.com", RoleID: 1, AccountID: 2, TeamID: 3}, day(3), day(20)},
+	}
+	ids := make([]uint, len(seeds))
+	for i, s := range seeds {
+		created, err := udb.Create(ctx, db, s.user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = created.ID
+		if err := db.Model(&models.User{}).Where("id = ?", created.ID).
+			UpdateColumns(map[string]interface{}{"created_at": s.createdAt, "last_login": s.lastLogin}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	after, before := day(2), day(3)
+
+	cases := []struct {
+		name        string
+		qp          *models.ListQuery
+		filter      *models.UserFilter
+		expectedIDs []uint
+		expectedErr bool
+	}{
+		{name: "Filter by team", filter: &models.UserFilter{TeamID: 2}, expectedIDs: []uint{ids[1]}},
+		{name: "Filter by account", filter: &models.UserFilter{AccountID: 1}, expectedIDs: []uint{ids[0], ids[1]}},
+		{name: "Filter by role", filter: &models.UserFilter{RoleID: 2}, expectedIDs: []uint{}},
+		{name: "Created range excludes its end", filter: &models.UserFilter{CreatedAfter: &after, CreatedBefore: &before}, expectedIDs: []uint{ids[1]}},
+		{name: "Last login after", filter: &models.UserFilter{LastLoginAfter: &before, Sort: []models.SortField{{Column: "last_login"}}}, expectedIDs: []uint{ids[1], ids[0], ids[2]}},
+		{name: "Search names case insensitively", filter: &models.UserFilter{Search: "DOE"}, expectedIDs: []uint{ids[0], ids[1]}},
+		{name: "Search exact email", filter: &models.UserFilter{Search: "Ann@Mail.com"}, expectedIDs: []uint{ids[2]}},
+		{name: "Search does not match partial emails", filter: &models.UserFilter{Search: "mail.com"}, expectedIDs: []uint{}},
+		{name: "Search escapes wildcards", filter: &models.UserFilter{Search: "n_"}, expectedIDs: []uint{ids[1]}},
+		{name: "Search escapes percent", filter: &models.UserFilter{Search: "%"}, expectedIDs: []uint{ids[2]}},
+		{
+			name:        "Search keeps the role scope",
+			qp:          &models.ListQuery{ID: 2, Query: "account_id = ?"},
+			filter:      &models.UserFilter{Search: "doe"},
+			expectedIDs: []uint{},
+		},
+		{
+			name:        "Sort by multiple fields",
+			filter:      &models.UserFilter{Sort: []models.SortField{{Column: "last_name", Desc: true}, {Column: "first_name"}}},
+			expectedIDs: []uint{ids[2], ids[0], ids[1]},
+		},
+		{name: "Fail on unknown sort column", filter: &models.UserFilter{Sort: []models.SortField{{Column: "password"}}}, expectedErr: true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			users, _, err := udb.List(ctx, db, tt.qp, tt.filter, &models.Pagination{Limit: 100})
+			assert.Equal(t, tt.expectedErr, err != nil, "error: %v", err)
+			if tt.expectedErr {
+				return
+			}
+			got := []uint{}
+			for _, u := range users {
+				got = append(got, u.ID)
+			}
+			assert.Equal(t, tt.expectedIDs, got)
+		})
+	}
+}
+
+func TestListCursor(t *testing.T) {
+	db, err := mockstore.NewDataBaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := mockstore.InsertRowsFor(db, superAdmin); err != nil {
+		t.Fatal(err)
+	}
+	udb := newUserDBClient(t)
+	ctx := context.Background()
+
+	// last names tie so that pages have to be ordered by id as well
+	for i, last := range []string{"Doe", "Smith", "Doe", "Adams", "Doe"} {
+		if _, err := udb.Create(ctx, db, models.User{Username: fmt.Sprintf("user%d", i), LastName: last, Email: fmt.Sprintf("user%d@mail.com", i), RoleID: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f := &models.UserFilter{Sort: []models.SortField{{Column: "last_name", Desc: true}}}
+	expected := []uint{2, 1, 3, 5, 4}
+
+	ids := func(users []models.User) []uint {
+		out := []uint{}
+		for _, u := range users {
+			out = append(out, u.ID)
+		}
+		return out
+	}
+
+	var forward []uint
+	var pages []*models.Page
+	p := &models.Pagination{Limit: 2, Count: true}
+	for {
+		users, page, err := udb.List(ctx, db, nil, f, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if assert.NotNil(t, page.Total) {
+			assert.Equal(t, 5, *page.Total)
+		}
+		forward = append(forward, ids(users)...)
+		pages = append(pages, page)
+		if page.Next == nil {
+			break
+		}
+		p = &models.Pagination{Limit: 2, Cursor: page.Next, Count: true}
+	}
+	assert.Equal(t, expected, forward, "following next cursors should return every user once in order")
+	assert.Len(t, pages, 3)
+	assert.Nil(t, pages[0].Prev, "the first page should have no previous page")
+
+	var backward []uint
+	cursor := pages[len(pages)-1].Prev
+	for cursor != nil {
+		users, page, err := udb.List(ctx, db, nil, f, &models.Pagination{Limit: 2, Cursor: cursor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		backward = append(ids(users), backward...)
+		if assert.NotNil(t, page.Next) {
+			assert.False(t, page.Next.Before)
+		}
+		cursor = page.Prev
+	}
+	assert.Equal(t, expected[:4], backward, "following prev cursors should return the preceding users in order")
+
+	users, page, err := udb.List(ctx, db, nil, f, &models.Pagination{Limit: 2, Offset: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint{3, 5}, ids(users), "offsets should still be supported")
+	assert.NotNil(t, page.Prev)
+	assert.NotNil(t, page.Next)
+	assert.Nil(t, page.Total)
+
+	users, _, err = udb.List(ctx, db, nil, f, &models.Pagination{Limit: 10, Cursor: page.Prev})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint{2, 1}, ids(users), "cursors of offset pages should lead back")
+
+	_, _, err = udb.List(ctx, db, nil, nil, &models.Pagination{Limit: 2, Cursor: pages[0].Next})
+	assert.Equal(t, models.ErrInvalidCursor, err, "cursors should not apply to another order")
+	invalid := &models.Cursor{Columns: pages[0].Next.Columns, Values: []string{"Doe", "x"}}
+	_, _, err = udb.List(ctx, db, nil, f, &models.Pagination{Limit: 2, Cursor: invalid})
+	assert.Equal(t, models.ErrInvalidCursor, err, "cursor values should match their columns")
+}
+
 func TestUpdate(t *testing.T) {
 	cases := []struct {
-		name         string
-		expectedErr  bool
-		usr          *models.User
-		expectedData *models.User
+		name            string
+		expectedErr     bool
+		usr             *models.User
+		expectedData    *models.User
+		expectedVersion uint
 	}{
 		{
 			name: "Success",
@@ -515,8 +795,26 @@ func TestUpdate(t *testing.T) {
 				Address:   "2020 forme",
 				Phone:     "123456",
 				Mobile:    "345678",
-				Base:      models.Base{ID: 2},
+				Base:      models.Base{ID: 2, Version: 1},
 			},
+			expectedVersion: 2,
+		},
+		{
+			name:        "Fail on stale version",
+			expectedErr: true,
+			usr: &models.User{
+				Base:      models.Base{ID: 3},
+				Email:     "stale@village.com",
+				FirstName: "Stale",
+				Username:  "stale",
+			},
+			expectedData: &models.User{
+				Email:     "overwrite@mail.com",
+				FirstName: "Overwrite",
+				Username:  "overwrite",
+				Base:      models.Base{ID: 3, Version: 7},
+			},
+			expectedVersion: 7,
 		},
 	}
 
@@ -526,31 +824,91 @@ func TestUpdate(t *testing.T) {
 	}
 	defer db.Close()
 
-	if err := mockstore.InsertRowsFor(db, superAdmin, cases[0].usr); err != nil {
+	if err := mockstore.InsertRowsFor(db, superAdmin, cases[0].usr, cases[1].usr); err != nil {
 		t.Error(err)
 	}
 
-	udb := store.NewUserDBClient()
+	udb := newUserDBClient(t)
 
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			user := &models.User{}
-			if err := db.First(user, tt.usr.ID).Error; err != nil {
-				t.Error(err)
-			}
+			user := readUser(t, db, tt.usr.ID)
 			tt.expectedData.CreatedAt = user.CreatedAt
 			tt.expectedData.LastLogin = user.LastLogin
 			tt.expectedData.LastPasswordChange = user.LastPasswordChange
-			err := udb.Update(db, tt.expectedData)
+			err := udb.Update(context.Background(), db, tt.expectedData)
 			assert.Equal(t, tt.expectedErr, err != nil)
-			user = &models.User{}
-			if err := db.First(user, tt.usr.ID).Error; err != nil {
-				t.Error(err)
+			assert.Equal(t, tt.expectedVersion, tt.expectedData.Version)
+			if tt.expectedErr {
+				assert.True(t, errors.Is(err, store.ErrStaleVersion), "a stale write should be rejected, got %v", err)
+				tt.expectedData = user
 			}
+			user = readUser(t, db, tt.usr.ID)
+			assert.Equal(t, tt.usr.Password, user.Password, "updates should not write the password")
 			tt.expectedData.UpdatedAt = user.UpdatedAt
+			tt.expectedData.Password = user.Password
 			assert.Equal(t, tt.expectedData, user)
 		})
 	}
+
+	err = udb.Update(context.Background(), db, &models.User{Base: models.Base{ID: 404, Version: 1}})
+	assert.True(t, errors.Is(err, store.ErrRecordNotFound), "updating a missing user should be not found, got %v", err)
+}
+
+func TestChangePassword(t *testing.T) {
+	db, err := mockstore.NewDataBaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := mockstore.InsertRowsFor(db, &superAdmin); err != nil {
+		t.Fatal(err)
+	}
+	udb := newUserDBClient(t)
+	ctx := context.Background()
+	user, err := udb.Create(ctx, db, models.User{Username: "change", Email: "change@mail.com", Password: "hash", Token: "refresh", RoleID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user.ChangePassword("newhash")
+	user.Token = "stolen"
+	assert.Nil(t, udb.ChangePassword(ctx, db, user))
+	stored := readUser(t, db, user.ID)
+	assert.Equal(t, "newhash", stored.Password)
+	assert.Equal(t, "refresh", stored.Token, "changing the password should not write the token")
+	assert.Equal(t, user.Version, stored.Version)
+
+	user.Version--
+	err = udb.ChangePassword(ctx, db, user)
+	assert.True(t, errors.Is(err, store.ErrStaleVersion), "a stale change should be rejected, got %v", err)
+}
+
+func TestRecordLogin(t *testing.T) {
+	db, err := mockstore.NewDataBaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := mockstore.InsertRowsFor(db, &superAdmin); err != nil {
+		t.Fatal(err)
+	}
+	udb := newUserDBClient(t)
+	ctx := context.Background()
+	user, err := udb.Create(ctx, db, models.User{Username: "login", Email: "login@mail.com", Password: "hash", RoleID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user.UpdateLastLogin("refresh")
+	assert.Nil(t, udb.RecordLogin(ctx, db, user))
+	stored := readUser(t, db, user.ID)
+	assert.Equal(t, "refresh", stored.Token)
+	assert.Equal(t, user.Version, stored.Version, "logging in should not version the user")
+
+	user.Password = "changed"
+	err = udb.RecordLogin(ctx, db, user)
+	assert.True(t, errors.Is(err, store.ErrStaleVersion), "a login with a changed password should not be recorded, got %v", err)
 }
 
 func TestDelete(t *testing.T) {
@@ -586,7 +944,7 @@ func TestDelete(t *testing.T) {
 		t.Error(err)
 	}
 
-	udb := store.NewUserDBClient()
+	udb := newUserDBClient(t)
 
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
@@ -596,14 +954,14 @@ func TestDelete(t *testing.T) {
 			}
 			assert.Nil(t, userBefore.DeletedAt, "before user is deleted their deleted_at field should be set to NULL")
 
-			err := udb.Delete(db, userBefore)
+			err := udb.Delete(context.Background(), db, userBefore)
 			assert.Nil(t, err, fmt.Sprintf("should not error on delete, error: %v", err))
 
-			userAfter, err := udb.View(db, tt.id)
+			userAfter, err := udb.View(context.Background(), db, tt.id)
 			emptyUser := new(models.User)
 			assert.Equal(t, true, err != nil, "there should be an error when accessing deleted records")
 			if err != nil {
-				assert.Equal(t, "code=404, message=user not found", err.Error(), "error should be `code=404, message=user not found`")
+				assert.True(t, errors.Is(err, store.ErrRecordNotFound), "error should be a user not found error")
 			}
 			assert.Equal(t, emptyUser, userAfter, "the response to find deleted user should be empty user")
 
@@ -614,3 +972,270 @@ func TestDelete(t *testing.T) {
 		})
 	}
 }
+
+func TestTrash(t *testing.T) {
+	db, err := mockstore.NewDataBaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	live := &models.User{Username: "alive", Email: "alive@mail.com", RoleID: 1}
+	if err := mockstore.InsertRowsFor(db, superAdmin, live); err != nil {
+		t.Fatal(err)
+	}
+	udb := newUserDBClient(t)
+	ctx := context.Background()
+
+	old, err := udb.Create(ctx, db, models.User{Username: "Ghost", Email: "ghost@mail.com", RoleID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recent, err := udb.Create(ctx, db, models.User{Username: "phantom", Email: "phantom@mail.com", RoleID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, udb.Delete(ctx, db, old))
+	assert.Nil(t, udb.Delete(ctx, db, recent))
+	aged := time.Now().Add(-48 * time.Hour)
+	assert.Nil(t, db.Unscoped().Model(&models.User{}).Where("id = ?", old.ID).Update("deleted_at", aged).Error)
+
+	_, err = udb.View(ctx, db, recent.ID)
+	assert.True(t, errors.Is(err, store.ErrRecordNotFound), "deleted users should not be viewed, got %v", err)
+	viewed, err := udb.ViewUnscoped(ctx, db, recent.ID)
+	assert.Nil(t, err, "deleted users should be viewed unscoped")
+	if assert.NotNil(t, viewed) {
+		assert.Equal(t, "phantom@mail.com", viewed.Email)
+	}
+	recent.FirstName = "Erased"
+	assert.True(t, errors.Is(udb.Update(ctx, db, recent), store.ErrRecordNotFound), "deleted users should not be updated")
+	assert.Nil(t, udb.UpdateUnscoped(ctx, db, recent), "deleted users should be updated unscoped")
+	assert.Equal(t, "Erased", readUser(t, db.Unscoped(), recent.ID).FirstName)
+
+	deleted, _, err := udb.ListDeleted(ctx, db, &models.Pagination{Limit: 10})
+	assert.Nil(t, err)
+	if assert.Len(t, deleted, 2, "only deleted users should be listed") {
+		assert.Equal(t, recent.ID, deleted[0].ID, "the most recently deleted user should be listed first")
+		assert.Equal(t, superAdmin, deleted[0].Role)
+	}
+	first, page, err := udb.ListDeleted(ctx, db, &models.Pagination{Limit: 1})
+	assert.Nil(t, err)
+	if assert.Len(t, first, 1) && assert.NotNil(t, page.Next) {
+		next, page, err := udb.ListDeleted(ctx, db, &models.Pagination{Limit: 1, Cursor: page.Next})
+		assert.Nil(t, err)
+		if assert.Len(t, next, 1, "deleted users should be paged by cursor") {
+			assert.Equal(t, old.ID, next[0].ID)
+		}
+		assert.Nil(t, page.Next)
+	}
+
+	_, err = udb.Create(ctx, db, models.User{Username: "ghost", Email: "GHOST@mail.com", RoleID: 1})
+	assert.Nil(t, err, "deleted users should not block their username and email")
+
+	_, err = udb.Restore(ctx, db, old.ID)
+	assert.True(t, errors.Is(err, store.ErrAlreadyExists), "restoring a taken username should conflict, got %v", err)
+
+	_, err = udb.Restore(ctx, db, live.ID)
+	assert.True(t, errors.Is(err, store.ErrRecordNotFound), "live users cannot be restored, got %v", err)
+
+	restored, err := udb.Restore(ctx, db, recent.ID)
+	assert.Nil(t, err)
+	if assert.NotNil(t, restored) {
+		assert.Nil(t, restored.DeletedAt)
+		assert.Equal(t, recent.Version+1, restored.Version, "restoring should bump the version")
+		assert.Equal(t, superAdmin, restored.Role)
+	}
+
+	purged, err := udb.PurgeDeleted(ctx, db, time.Now().Add(-24*time.Hour), 10)
+	assert.Nil(t, err)
+	if assert.Len(t, purged, 1, "only users deleted before the cutoff should be purged") {
+		assert.Equal(t, old.ID, purged[0].ID)
+	}
+	var count int
+	assert.Nil(t, db.Unscoped().Model(&models.User{}).Where("id = ?", old.ID).Count(&count).Error)
+	assert.Equal(t, 0, count, "purged users should be erased")
+
+	purged, err = udb.PurgeDeleted(ctx, db, time.Now(), 10)
+	assert.Nil(t, err)
+	assert.Len(t, purged, 0, "live users should never be purged")
+}
+
+func TestRedactEvents(t *testing.T) {
+	db, err := mockstore.NewDataBaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	usr := &models.User{Base: models.Base{ID: 5}, Username: "jane", Email: "jane@mail.com", FirstName: "Jane", Mobile: "555", RoleID: 1}
+	events := []interface{}{
+		&models.OutboxEvent{Topic: models.EventUserCreated, AggregateID: 5, Payload: `{"id":5,"username":"jane","email":"jane@mail.com","first_name":"Jane","mobile":"555"}`},
+		&models.OutboxEvent{Topic: models.EventUserLoggedIn, AggregateID: 5, Payload: `{"user_id":5,"logged_in_at":"2001-01-01T00:00:00Z"}`},
+		&models.OutboxEvent{Topic: models.EventUserCreated, AggregateID: 6, Payload: `{"id":6,"username":"john"}`},
+	}
+	if err := mockstore.InsertRowsFor(db, append([]interface{}{superAdmin, usr}, events...)...); err != nil {
+		t.Fatal(err)
+	}
+	udb := newUserDBClient(t)
+	ctx := context.Background()
+
+	got, err := udb.Events(ctx, db, 5)
+	assert.Nil(t, err)
+	if assert.Len(t, got, 2, "only the events of the user should be returned") {
+		assert.Equal(t, models.EventUserCreated, got[0].Topic)
+		assert.Equal(t, models.EventUserLoggedIn, got[1].Topic)
+	}
+
+	usr.Anonymize()
+	assert.Nil(t, udb.RedactEvents(ctx, db, usr))
+
+	got, err = udb.Events(ctx, db, 5)
+	assert.Nil(t, err)
+	if assert.Len(t, got, 2, "redacting should keep the audit history") {
+		assert.JSONEq(t, `{"id":5,"username":"erased-5","email":"erased-5@erased.invalid","first_name":""}`, got[0].Payload)
+		assert.JSONEq(t, `{"user_id":5,"logged_in_at":"2001-01-01T00:00:00Z"}`, got[1].Payload)
+	}
+	other, err := udb.Events(ctx, db, 6)
+	assert.Nil(t, err)
+	if assert.Len(t, other, 1) {
+		assert.JSONEq(t, `{"id":6,"username":"john"}`, other[0].Payload, "the events of other users should be untouched")
+	}
+}
+
+func TestEncryption(t *testing.T) {
+	db, err := mockstore.NewDataBaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	legacy := &models.User{Username: "legacy", Email: "legacy@mail.com", Phone: "555", RoleID: 1}
+	if err := mockstore.InsertRowsFor(db, superAdmin, legacy); err != nil {
+		t.Fatal(err)
+	}
+	udb := newUserDBClient(t)
+	ctx := context.Background()
+
+	created, err := udb.Create(ctx, db, models.User{Username: "jane", Email: "Jane@Mail.com", Address: "1 Main St", RoleID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Jane@Mail.com", created.Email)
+	raw := &models.User{}
+	assert.Nil(t, db.First(raw, created.ID).Error)
+	assert.True(t, strings.HasPrefix(raw.Email, "enc:v1:test-1:"), "emails should be encrypted at rest")
+	assert.True(t, strings.HasPrefix(raw.Address, "enc:v1:test-1:"), "addresses should be encrypted at rest")
+	assert.Equal(t, "jane", raw.Username)
+
+	found, err := udb.FindByEmail(ctx, db, "jane@mail.com")
+	assert.Nil(t, err)
+	if assert.NotNil(t, found) {
+		assert.Equal(t, created.ID, found.ID, "emails should be found through their blind index")
+		assert.Equal(t, "1 Main St", found.Address)
+		assert.Equal(t, superAdmin, found.Role)
+	}
+	_, err = udb.FindByEmail(ctx, db, "legacy@mail.com")
+	assert.True(t, errors.Is(err, store.ErrRecordNotFound), "users sealed before their blind index should not be found, got %v", err)
+
+	viewed, err := udb.View(ctx, db, legacy.ID)
+	assert.Nil(t, err)
+	if assert.NotNil(t, viewed) {
+		assert.Equal(t, "legacy@mail.com", viewed.Email, "plaintext rows should still be readable")
+	}
+
+	cfg, err := config.LoadConfigFrom(support.TestingConfigPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Encryption.Keys["test-2"] = "zF38DLaO69loaz0EVtZt/R0U2COKmsc8xxRzJIJovok="
+	cfg.Encryption.ActiveKey = "test-2"
+	rotated, err := keyring.New(cfg.Encryption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdb := store.NewUserDBClient(rotated)
+	last, count, err := rdb.Reencrypt(ctx, db, 0, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, legacy.ID, last)
+	assert.Equal(t, 1, count)
+	last, count, err = rdb.Reencrypt(ctx, db, last, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, created.ID, last)
+	assert.Equal(t, 1, count)
+	last, count, err = rdb.Reencrypt(ctx, db, last, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(0), last, "every user should have been read")
+	assert.Equal(t, 0, count)
+
+	for _, id := range []uint{legacy.ID, created.ID} {
+		raw := &models.User{}
+		assert.Nil(t, db.First(raw, id).Error)
+		assert.True(t, strings.HasPrefix(raw.Email, "enc:v1:test-2:"), "users should be sealed with the active key")
+		assert.Equal(t, uint(1), raw.Version, "re-encrypting should not version users")
+	}
+	found, err = rdb.FindByEmail(ctx, db, "LEGACY@mail.com")
+	assert.Nil(t, err)
+	if assert.NotNil(t, found) {
+		assert.Equal(t, "555", found.Phone)
+	}
+	_, count, err = rdb.Reencrypt(ctx, db, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count, "users sealed with the active key should be left alone")
+
+	_, err = udb.View(ctx, db, legacy.ID)
+	assert.NotNil(t, err, "users sealed with an unknown key should not be readable")
+}
+
+func TestReencryptConcurrentUpdate(t *testing.T) {
+	db, err := mockstore.NewDataBaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := mockstore.InsertRowsFor(db, superAdmin); err != nil {
+		t.Fatal(err)
+	}
+	kr, err := mockstore.NewKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	udb := store.NewUserDBClient(kr)
+	ctx := context.Background()
+	created, err := udb.Create(ctx, db, models.User{Username: "jane", Email: "jane@mail.com", Address: "1 Main St", RoleID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved, err := kr.Encrypt("2 Side St")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the user is updated after it was read by the re-encryption, the
+	// context bound copies of db run the default callbacks
+	once := sync.Once{}
+	gorm.DefaultCallback.Update().Before("gorm:update").Register("test:concurrent_update", func(scope *gorm.Scope) {
+		once.Do(func() {
+			_, err := scope.SQLDB().Exec("UPDATE users SET address = ?, version = version + 1 WHERE id = ?", moved, created.ID)
+			assert.Nil(t, err)
+		})
+	})
+	defer gorm.DefaultCallback.Update().Remove("test:concurrent_update")
+
+	cfg, err := config.LoadConfigFrom(support.TestingConfigPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Encryption.Keys["test-2"] = "zF38DLaO69loaz0EVtZt/R0U2COKmsc8xxRzJIJovok="
+	cfg.Encryption.ActiveKey = "test-2"
+	rotated, err := keyring.New(cfg.Encryption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, count, err := store.NewUserDBClient(rotated).Reencrypt(ctx, db, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	raw := &models.User{}
+	assert.Nil(t, db.First(raw, created.ID).Error)
+	assert.True(t, strings.HasPrefix(raw.Address, "enc:v1:test-2:"), "users should be sealed with the active key")
+	address, err := rotated.Decrypt(raw.Address)
+	assert.Nil(t, err)
+	assert.Equal(t, "2 Side St", address, "concurrent updates should not be overwritten")
+	assert.Equal(t, uint(2), raw.Version)
+}
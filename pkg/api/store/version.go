@@ -0,0 +1,37 @@
+package store
+
+import (
+	"github.com/jinzhu/gorm"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+// saveVersioned writes every column of value but omit, the record embedding
+// base, only if the row still has the version value was read with. On success
+// the version is incremented, ok is false if the row was changed or deleted
+// since.
+func saveVersioned(db *gorm.DB, value interface{}, base *models.Base, omit ...string) (ok bool, err error) {
+	cols := make(map[string]interface{})
+	for _, f := range db.NewScope(value).Fields() {
+		if !f.IsNormal || f.IsIgnored || f.IsPrimaryKey {
+			continue
+		}
+		switch f.Name {
+		case "CreatedAt", "DeletedAt", "Version":
+			continue
+		}
+		cols[f.DBName] = f.Field.Interface()
+	}
+	for _, col := range omit {
+		delete(cols, col)
+	}
+	read := base.Version
+	cols["version"] = read + 1
+
+	// gorm assigns cols to value before running the statement
+	res := db.Model(value).Where("version = ?", read).Updates(cols)
+	if res.Error != nil || res.RowsAffected == 0 {
+		base.Version = read
+	}
+	return res.RowsAffected > 0, res.Error
+}
@@ -0,0 +1,99 @@
+package user
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+// Export is the archive of all data held about a user, as handed over to
+// the user on a data subject access request
+type Export struct {
+	ExportedAt time.Time    `json:"exported_at"`
+	Profile    *models.User `json:"profile"`
+	Session    Session      `json:"session"`
+	Audit      []AuditEvent `json:"audit"`
+}
+
+// AuditEvent is a domain event recorded for a user, without the state of
+// its dispatch
+type AuditEvent struct {
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Payload    string    `json:"payload"`
+}
+
+// Session describes the sign in state of a user, the refresh token is a
+// credential and is never exported
+type Session struct {
+	Active             bool      `json:"active"`
+	LastLogin          time.Time `json:"last_login"`
+	LastPasswordChange time.Time `json:"last_password_change"`
+}
+
+// Export returns the profile, session and audit history of a user, live or
+// soft deleted
+func (u *RequestHandler) Export(ctx context.Context, id uint) (*Export, error) {
+	if err := u.rbac.EnforceUser(ctx, id); err != nil {
+		return nil, err
+	}
+	exp := &Export{ExportedAt: time.Now()}
+	err := u.tx.Transaction(ctx, func(tx *gorm.DB) (err error) {
+		if exp.Profile, err = u.udb.ViewUnscoped(ctx, tx, id); err != nil {
+			return err
+		}
+		events, err := u.udb.Events(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		exp.Audit = make([]AuditEvent, len(events))
+		for i, e := range events {
+			exp.Audit[i] = AuditEvent{Type: e.Topic, OccurredAt: e.CreatedAt, Payload: e.Payload}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	exp.Session = Session{
+		Active:             exp.Profile.Token != "",
+		LastLogin:          exp.Profile.LastLogin,
+		LastPasswordChange: exp.Profile.LastPasswordChange,
+	}
+	return exp, nil
+}
+
+// Erase anonymizes the personal data of a user, in its profile and in its
+// audit history, it is restricted to admins. The user row and its events
+// are kept so that references to the user stay valid. Soft deleted users
+// are erased too, as they are kept until purged.
+func (u *RequestHandler) Erase(ctx context.Context, id uint) error {
+	if err := u.rbac.EnforceRole(ctx, models.AdminRole); err != nil {
+		return err
+	}
+	return u.tx.Transaction(ctx, func(tx *gorm.DB) error {
+		user, err := u.udb.ViewUnscoped(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := u.rbac.IsLowerRole(ctx, user.Role.AccessLevel); err != nil {
+			return err
+		}
+		user.Anonymize()
+		if err := u.udb.UpdateUnscoped(ctx, tx, user); err != nil {
+			return err
+		}
+		if err := u.udb.RedactEvents(ctx, tx, user); err != nil {
+			return err
+		}
+		return u.evt.Publish(ctx, tx, models.EventUserErased, user.ID, erasedEvent{UserID: user.ID})
+	})
+}
+
+// erasedEvent is the payload of the user erased domain event
+type erasedEvent struct {
+	UserID uint `json:"user_id"`
+}
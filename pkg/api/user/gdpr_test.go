@@ -0,0 +1,187 @@
+package user_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/api/user"
+	"github.com/johncoleman83/cerebrum/pkg/utl/mock"
+	"github.com/johncoleman83/cerebrum/pkg/utl/mock/mockstore"
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+func TestExport(t *testing.T) {
+	cases := []struct {
+		name        string
+		expectedErr error
+		expected    *user.Export
+		udb         *mockstore.UserDBClient
+		rbac        *mock.RBAC
+	}{
+		{
+			name: "Fail on RBAC",
+			rbac: &mock.RBAC{
+				EnforceUserFn: func(context.Context, uint) error {
+					return models.ErrGeneric
+				}},
+			expectedErr: models.ErrGeneric,
+		},
+		{
+			name: "Fail on Events",
+			rbac: &mock.RBAC{
+				EnforceUserFn: func(context.Context, uint) error {
+					return nil
+				}},
+			udb: &mockstore.UserDBClient{
+				ViewUnscopedFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+					return &models.User{Base: models.Base{ID: id}}, nil
+				},
+				EventsFn: func(ctx context.Context, db *gorm.DB, id uint) ([]models.OutboxEvent, error) {
+					return nil, models.ErrGeneric
+				},
+			},
+			expectedErr: models.ErrGeneric,
+		},
+		{
+			name: "Success",
+			rbac: &mock.RBAC{
+				EnforceUserFn: func(context.Context, uint) error {
+					return nil
+				}},
+			udb: &mockstore.UserDBClient{
+				ViewUnscopedFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+					return &models.User{
+						Base:               models.Base{ID: id},
+						Username:           "jane",
+						Token:              "refresh",
+						LastLogin:          mock.TestTime(2001),
+						LastPasswordChange: mock.TestTime(2000),
+					}, nil
+				},
+				EventsFn: func(ctx context.Context, db *gorm.DB, id uint) ([]models.OutboxEvent, error) {
+					return []models.OutboxEvent{{
+						ID:          1,
+						Topic:       models.EventUserCreated,
+						AggregateID: id,
+						Payload:     `{"user_id":3}`,
+						Attempts:    2,
+						LastError:   "broker down",
+						CreatedAt:   mock.TestTime(1999),
+						ClaimedBy:   "dispatcher",
+					}}, nil
+				},
+			},
+			expected: &user.Export{
+				Profile: &models.User{
+					Base:               models.Base{ID: 3},
+					Username:           "jane",
+					Token:              "refresh",
+					LastLogin:          mock.TestTime(2001),
+					LastPasswordChange: mock.TestTime(2000),
+				},
+				Session: user.Session{
+					Active:             true,
+					LastLogin:          mock.TestTime(2001),
+					LastPasswordChange: mock.TestTime(2000),
+				},
+				Audit: []user.AuditEvent{{Type: models.EventUserCreated, OccurredAt: mock.TestTime(1999), Payload: `{"user_id":3}`}},
+			},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			s := user.New(nil, mock.NoopTransactor(), tt.udb, tt.rbac, nil, mock.NoopPublisher())
+			exp, err := s.Export(context.Background(), 3)
+			assert.Equal(t, tt.expectedErr, err)
+			if tt.expected == nil {
+				assert.Nil(t, exp)
+				return
+			}
+			assert.False(t, exp.ExportedAt.IsZero())
+			exp.ExportedAt = tt.expected.ExportedAt
+			assert.Equal(t, tt.expected, exp)
+		})
+	}
+}
+
+func TestErase(t *testing.T) {
+	view := func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+		return &models.User{
+			Base:      models.Base{ID: id, Version: 1},
+			FirstName: "Jane",
+			Email:     "jane@mail.com",
+			Role:      models.Role{AccessLevel: models.UserRole},
+		}, nil
+	}
+	var updated, redacted *models.User
+	var topics []string
+	cases := []struct {
+		name        string
+		expectedErr error
+		udb         *mockstore.UserDBClient
+		rbac        *mock.RBAC
+	}{
+		{
+			name: "Fail on EnforceRole",
+			rbac: &mock.RBAC{
+				EnforceRoleFn: func(context.Context, models.AccessRole) error {
+					return models.ErrGeneric
+				}},
+			expectedErr: models.ErrGeneric,
+		},
+		{
+			name: "Fail on IsLowerRole",
+			rbac: &mock.RBAC{
+				EnforceRoleFn: func(context.Context, models.AccessRole) error {
+					return nil
+				},
+				IsLowerRoleFn: func(context.Context, models.AccessRole) error {
+					return models.ErrGeneric
+				}},
+			udb:         &mockstore.UserDBClient{ViewUnscopedFn: view},
+			expectedErr: models.ErrGeneric,
+		},
+		{
+			name: "Success",
+			rbac: &mock.RBAC{
+				EnforceRoleFn: func(context.Context, models.AccessRole) error {
+					return nil
+				},
+				IsLowerRoleFn: func(context.Context, models.AccessRole) error {
+					return nil
+				}},
+			udb: &mockstore.UserDBClient{
+				ViewUnscopedFn: view,
+				UpdateUnscopedFn: func(ctx context.Context, db *gorm.DB, usr *models.User) error {
+					updated = usr
+					return nil
+				},
+				RedactEventsFn: func(ctx context.Context, db *gorm.DB, usr *models.User) error {
+					redacted = usr
+					return nil
+				},
+			},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			evt := &mock.Publisher{
+				PublishFn: func(ctx context.Context, db *gorm.DB, topic string, id uint, payload interface{}) error {
+					topics = append(topics, topic)
+					return nil
+				},
+			}
+			s := user.New(nil, mock.NoopTransactor(), tt.udb, tt.rbac, nil, evt)
+			assert.Equal(t, tt.expectedErr, s.Erase(context.Background(), 4))
+		})
+	}
+	if assert.NotNil(t, updated) {
+		assert.Equal(t, "erased-4@erased.invalid", updated.Email)
+		assert.Empty(t, updated.FirstName)
+		assert.Equal(t, updated, redacted, "events should be redacted with the anonymized user")
+	}
+	assert.Equal(t, []string{models.EventUserErased}, topics)
+}
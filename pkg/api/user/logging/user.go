@@ -1,10 +1,9 @@
 package user
 
 import (
+	"context"
 	"time"
 
-	"github.com/labstack/echo"
-
 	"github.com/johncoleman83/cerebrum/pkg/api/user"
 	"github.com/johncoleman83/cerebrum/pkg/utl/models"
 )
@@ -26,44 +25,44 @@ func New(svc user.Service, logger models.Logger) *LogService {
 }
 
 // Create logging
-func (ls *LogService) Create(c echo.Context, req models.User) (resp *models.User, err error) {
-	dupe := req
-	dupe.Password = "xxx-redacted-xxx"
+func (ls *LogService) Create(ctx context.Context, req models.User) (resp *models.User, err error) {
 	defer func(begin time.Time) {
 		ls.logger.Log(
-			c,
+			ctx,
 			packageName, "Create user request", err,
 			map[string]interface{}{
-				"req":  dupe,
+				"req":  req,
 				"resp": resp,
 				"took": time.Since(begin),
 			},
 		)
 	}(time.Now())
-	return ls.Service.Create(c, req)
+	return ls.Service.Create(ctx, req)
 }
 
 // List logging
-func (ls *LogService) List(c echo.Context, req *models.Pagination) (resp []models.User, err error) {
+func (ls *LogService) List(ctx context.Context, f *models.UserFilter, req *models.Pagination) (resp []models.User, page *models.Page, err error) {
 	defer func(begin time.Time) {
 		ls.logger.Log(
-			c,
+			ctx,
 			packageName, "List user request", err,
 			map[string]interface{}{
-				"req":  req,
-				"resp": resp,
-				"took": time.Since(begin),
+				"req":    req,
+				"filter": f,
+				"resp":   resp,
+				"page":   page,
+				"took":   time.Since(begin),
 			},
 		)
 	}(time.Now())
-	return ls.Service.List(c, req)
+	return ls.Service.List(ctx, f, req)
 }
 
 // View logging
-func (ls *LogService) View(c echo.Context, req uint) (resp *models.User, err error) {
+func (ls *LogService) View(ctx context.Context, req uint) (resp *models.User, err error) {
 	defer func(begin time.Time) {
 		ls.logger.Log(
-			c,
+			ctx,
 			packageName, "View user request", err,
 			map[string]interface{}{
 				"req":  req,
@@ -72,14 +71,14 @@ func (ls *LogService) View(c echo.Context, req uint) (resp *models.User, err err
 			},
 		)
 	}(time.Now())
-	return ls.Service.View(c, req)
+	return ls.Service.View(ctx, req)
 }
 
 // Delete logging
-func (ls *LogService) Delete(c echo.Context, req uint) (err error) {
+func (ls *LogService) Delete(ctx context.Context, req uint) (err error) {
 	defer func(begin time.Time) {
 		ls.logger.Log(
-			c,
+			ctx,
 			packageName, "Delete user request", err,
 			map[string]interface{}{
 				"req":  req,
@@ -87,14 +86,14 @@ func (ls *LogService) Delete(c echo.Context, req uint) (err error) {
 			},
 		)
 	}(time.Now())
-	return ls.Service.Delete(c, req)
+	return ls.Service.Delete(ctx, req)
 }
 
 // Update logging
-func (ls *LogService) Update(c echo.Context, req *user.Update) (resp *models.User, err error) {
+func (ls *LogService) Update(ctx context.Context, req *user.Update) (resp *models.User, err error) {
 	defer func(begin time.Time) {
 		ls.logger.Log(
-			c,
+			ctx,
 			packageName, "Update user request", err,
 			map[string]interface{}{
 				"req":  req,
@@ -103,5 +102,68 @@ func (ls *LogService) Update(c echo.Context, req *user.Update) (resp *models.Use
 			},
 		)
 	}(time.Now())
-	return ls.Service.Update(c, req)
+	return ls.Service.Update(ctx, req)
+}
+
+// ListDeleted logging
+func (ls *LogService) ListDeleted(ctx context.Context, req *models.Pagination) (resp []models.User, page *models.Page, err error) {
+	defer func(begin time.Time) {
+		ls.logger.Log(
+			ctx,
+			packageName, "List deleted users request", err,
+			map[string]interface{}{
+				"req":  req,
+				"resp": resp,
+				"page": page,
+				"took": time.Since(begin),
+			},
+		)
+	}(time.Now())
+	return ls.Service.ListDeleted(ctx, req)
+}
+
+// Restore logging
+func (ls *LogService) Restore(ctx context.Context, req uint) (resp *models.User, err error) {
+	defer func(begin time.Time) {
+		ls.logger.Log(
+			ctx,
+			packageName, "Restore user request", err,
+			map[string]interface{}{
+				"req":  req,
+				"resp": resp,
+				"took": time.Since(begin),
+			},
+		)
+	}(time.Now())
+	return ls.Service.Restore(ctx, req)
+}
+
+// Export logging, the archive is not logged as it holds all personal data of the user
+func (ls *LogService) Export(ctx context.Context, req uint) (resp *user.Export, err error) {
+	defer func(begin time.Time) {
+		ls.logger.Log(
+			ctx,
+			packageName, "Export user request", err,
+			map[string]interface{}{
+				"req":  req,
+				"took": time.Since(begin),
+			},
+		)
+	}(time.Now())
+	return ls.Service.Export(ctx, req)
+}
+
+// Erase logging
+func (ls *LogService) Erase(ctx context.Context, req uint) (err error) {
+	defer func(begin time.Time) {
+		ls.logger.Log(
+			ctx,
+			packageName, "Erase user request", err,
+			map[string]interface{}{
+				"req":  req,
+				"took": time.Since(begin),
+			},
+		)
+	}(time.Now())
+	return ls.Service.Erase(ctx, req)
 }
@@ -0,0 +1,97 @@
+package user
+
+import (
+	"context"
+	"time"
+
+	"github.com/johncoleman83/cerebrum/pkg/api/user"
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+const packageName = "user"
+
+// MetricService represents user metrics service
+type MetricService struct {
+	user.Service
+	recorder models.Recorder
+}
+
+// New creates new user metrics service
+func New(svc user.Service, recorder models.Recorder) *MetricService {
+	return &MetricService{
+		Service:  svc,
+		recorder: recorder,
+	}
+}
+
+// Create metrics
+func (ms *MetricService) Create(ctx context.Context, req models.User) (resp *models.User, err error) {
+	defer func(begin time.Time) {
+		ms.recorder.ObserveCall(packageName, "Create", time.Since(begin), err)
+	}(time.Now())
+	return ms.Service.Create(ctx, req)
+}
+
+// List metrics
+func (ms *MetricService) List(ctx context.Context, f *models.UserFilter, req *models.Pagination) (resp []models.User, page *models.Page, err error) {
+	defer func(begin time.Time) {
+		ms.recorder.ObserveCall(packageName, "List", time.Since(begin), err)
+	}(time.Now())
+	return ms.Service.List(ctx, f, req)
+}
+
+// View metrics
+func (ms *MetricService) View(ctx context.Context, req uint) (resp *models.User, err error) {
+	defer func(begin time.Time) {
+		ms.recorder.ObserveCall(packageName, "View", time.Since(begin), err)
+	}(time.Now())
+	return ms.Service.View(ctx, req)
+}
+
+// Delete metrics
+func (ms *MetricService) Delete(ctx context.Context, req uint) (err error) {
+	defer func(begin time.Time) {
+		ms.recorder.ObserveCall(packageName, "Delete", time.Since(begin), err)
+	}(time.Now())
+	return ms.Service.Delete(ctx, req)
+}
+
+// Update metrics
+func (ms *MetricService) Update(ctx context.Context, req *user.Update) (resp *models.User, err error) {
+	defer func(begin time.Time) {
+		ms.recorder.ObserveCall(packageName, "Update", time.Since(begin), err)
+	}(time.Now())
+	return ms.Service.Update(ctx, req)
+}
+
+// ListDeleted metrics
+func (ms *MetricService) ListDeleted(ctx context.Context, req *models.Pagination) (resp []models.User, page *models.Page, err error) {
+	defer func(begin time.Time) {
+		ms.recorder.ObserveCall(packageName, "ListDeleted", time.Since(begin), err)
+	}(time.Now())
+	return ms.Service.ListDeleted(ctx, req)
+}
+
+// Restore metrics
+func (ms *MetricService) Restore(ctx context.Context, req uint) (resp *models.User, err error) {
+	defer func(begin time.Time) {
+		ms.recorder.ObserveCall(packageName, "Restore", time.Since(begin), err)
+	}(time.Now())
+	return ms.Service.Restore(ctx, req)
+}
+
+// Export metrics
+func (ms *MetricService) Export(ctx context.Context, req uint) (resp *user.Export, err error) {
+	defer func(begin time.Time) {
+		ms.recorder.ObserveCall(packageName, "Export", time.Since(begin), err)
+	}(time.Now())
+	return ms.Service.Export(ctx, req)
+}
+
+// Erase metrics
+func (ms *MetricService) Erase(ctx context.Context, req uint) (err error) {
+	defer func(begin time.Time) {
+		ms.recorder.ObserveCall(packageName, "Erase", time.Since(begin), err)
+	}(time.Now())
+	return ms.Service.Erase(ctx, req)
+}
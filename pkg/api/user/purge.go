@@ -0,0 +1,125 @@
+package user
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/johncoleman83/cerebrum/pkg/api/store"
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+// Purger defaults used when the trash config omits a value
+const (
+	defaultRetention     = 30 * 24 * time.Hour
+	defaultPurgeInterval = time.Hour
+	defaultPurgeBatch    = 100
+)
+
+// purgeLock is the advisory lock taken by the purger of one api instance
+const purgeLock = "cerebrum:purge_users"
+
+// Purger permanently erases users once they have been soft deleted for
+// longer than the retention period, a sweep is skipped while another api
+// instance sharing the database is purging
+type Purger struct {
+	db        *gorm.DB
+	tx        Transactor
+	udb       DBClientInterface
+	evt       Publisher
+	retention time.Duration
+	interval  time.Duration
+	batchSize int
+}
+
+// NewPurger creates a new purger of deleted users
+func NewPurger(db *gorm.DB, c store.Cipher, evt Publisher, cfg *config.Trash) *Purger {
+	p := &Purger{
+		db:        db,
+		tx:        datastore.NewTransactor(db),
+		udb:       store.NewUserDBClient(c),
+		evt:       evt,
+		retention: defaultRetention,
+		interval:  defaultPurgeInterval,
+		batchSize: defaultPurgeBatch,
+	}
+	if cfg == nil {
+		return p
+	}
+	if cfg.RetentionDays > 0 {
+		p.retention = time.Duration(cfg.RetentionDays) * 24 * time.Hour
+	}
+	if cfg.PurgeInterval > 0 {
+		p.interval = time.Duration(cfg.PurgeInterval) * time.Minute
+	}
+	if cfg.BatchSize > 0 {
+		p.batchSize = cfg.BatchSize
+	}
+	return p
+}
+
+// Run purges expired users every interval until ctx is done
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := p.Purge(ctx); err != nil {
+				log.Printf("user purge error %v", err)
+			}
+		}
+	}
+}
+
+// Purge erases every user deleted before the retention period in batches
+// and returns the number of purged users, none if another api instance holds
+// the purge lock
+func (p *Purger) Purge(ctx context.Context) (int, error) {
+	unlock, ok, err := datastore.TryLock(ctx, p.db, purgeLock)
+	if err != nil || !ok {
+		return 0, err
+	}
+	defer unlock()
+	before := time.Now().Add(-p.retention)
+	total := 0
+	for {
+		var purged []models.User
+		err := p.tx.Transaction(ctx, func(tx *gorm.DB) (err error) {
+			if purged, err = p.udb.PurgeDeleted(ctx, tx, before, p.batchSize); err != nil {
+				return err
+			}
+			for _, u := range purged {
+				// the audit history outlives the user but not its personal data
+				u.Anonymize()
+				if err := p.udb.RedactEvents(ctx, tx, &u); err != nil {
+					return err
+				}
+				// the payload must not carry personal data of the erased user
+				if err := p.evt.Publish(ctx, tx, models.EventUserPurged, u.ID, purgedEvent{UserID: u.ID, DeletedAt: u.DeletedAt}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+		total += len(purged)
+		if len(purged) < p.batchSize {
+			return total, nil
+		}
+	}
+}
+
+// purgedEvent is the payload of the user purged domain event
+type purgedEvent struct {
+	UserID    uint       `json:"user_id"`
+	DeletedAt *time.Time `json:"deleted_at"`
+}
@@ -0,0 +1,76 @@
+package user_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/api/user"
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
+	"github.com/johncoleman83/cerebrum/pkg/utl/mock"
+	"github.com/johncoleman83/cerebrum/pkg/utl/mock/mockstore"
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+func TestPurge(t *testing.T) {
+	db, err := mockstore.NewDataBaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	aged := time.Now().Add(-72 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+	rows := []interface{}{
+		&models.Role{ID: 1, AccessLevel: models.SuperAdminRole, Name: "SUPER_ADMIN"},
+		&models.User{Username: "alive", Email: "alive@mail.com", RoleID: 1},
+		&models.User{Base: models.Base{DeletedAt: &recent}, Username: "recent", Email: "recent@mail.com", RoleID: 1},
+	}
+	for _, name := range []string{"agedone", "agedtwo", "agedthree"} {
+		rows = append(rows, &models.User{Base: models.Base{DeletedAt: &aged}, Username: name, Email: name + "@mail.com", RoleID: 1})
+	}
+	if err := mockstore.InsertRowsFor(db, rows...); err != nil {
+		t.Fatal(err)
+	}
+	created := &models.OutboxEvent{Topic: models.EventUserCreated, AggregateID: 3, Payload: `{"id":3,"email":"agedone@mail.com"}`}
+	if err := mockstore.InsertRowsFor(db, created); err != nil {
+		t.Fatal(err)
+	}
+
+	var topics []string
+	evt := &mock.Publisher{
+		PublishFn: func(ctx context.Context, tx *gorm.DB, topic string, id uint, payload interface{}) error {
+			topics = append(topics, topic)
+			return nil
+		},
+	}
+	kr, err := mockstore.NewKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := user.NewPurger(db, kr, evt, &config.Trash{RetentionDays: 2, BatchSize: 2})
+
+	unlock, ok, err := datastore.TryLock(context.Background(), db, "cerebrum:purge_users")
+	if err != nil || !ok {
+		t.Fatalf("taking the purge lock failed, %v", err)
+	}
+	purged, err := p.Purge(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, purged, "nothing should be purged while another instance holds the lock")
+	unlock()
+
+	purged, err = p.Purge(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 3, purged, "only users deleted before the retention period should be purged")
+	assert.Equal(t, []string{models.EventUserPurged, models.EventUserPurged, models.EventUserPurged}, topics)
+
+	var left int
+	assert.Nil(t, db.Unscoped().Model(&models.User{}).Count(&left).Error)
+	assert.Equal(t, 2, left)
+
+	assert.Nil(t, db.First(created, created.ID).Error)
+	assert.JSONEq(t, `{"id":3,"email":"erased-3@erased.invalid"}`, created.Payload, "the events of purged users should be redacted")
+}
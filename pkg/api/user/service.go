@@ -1,10 +1,12 @@
 package user
 
 import (
+	"context"
+	"time"
+
 	"github.com/jinzhu/gorm"
-	"github.com/labstack/echo"
 
-	"github.com/johncoleman83/cerebrum/pkg/api/store"
+	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
 	"github.com/johncoleman83/cerebrum/pkg/utl/models"
 )
 
@@ -16,44 +18,68 @@ type Securer interface {
 
 // DBClientInterface represents user repository interface
 type DBClientInterface interface {
-	Create(*gorm.DB, models.User) (*models.User, error)
-	View(*gorm.DB, uint) (*models.User, error)
-	List(*gorm.DB, *models.ListQuery, *models.Pagination) ([]models.User, error)
-	Update(*gorm.DB, *models.User) error
-	Delete(*gorm.DB, *models.User) error
+	Create(context.Context, *gorm.DB, models.User) (*models.User, error)
+	View(context.Context, *gorm.DB, uint) (*models.User, error)
+	ViewUnscoped(context.Context, *gorm.DB, uint) (*models.User, error)
+	List(context.Context, *gorm.DB, *models.ListQuery, *models.UserFilter, *models.Pagination) ([]models.User, *models.Page, error)
+	Update(context.Context, *gorm.DB, *models.User) error
+	UpdateUnscoped(context.Context, *gorm.DB, *models.User) error
+	Delete(context.Context, *gorm.DB, *models.User) error
+	ListDeleted(context.Context, *gorm.DB, *models.Pagination) ([]models.User, *models.Page, error)
+	Restore(context.Context, *gorm.DB, uint) (*models.User, error)
+	PurgeDeleted(context.Context, *gorm.DB, time.Time, int) ([]models.User, error)
+	Events(context.Context, *gorm.DB, uint) ([]models.OutboxEvent, error)
+	RedactEvents(context.Context, *gorm.DB, *models.User) error
+}
+
+// Transactor represents the interface for running work in a single db transaction
+type Transactor interface {
+	Transaction(context.Context, func(*gorm.DB) error) error
+}
+
+// Publisher represents the domain event outbox interface
+type Publisher interface {
+	Publish(context.Context, *gorm.DB, string, uint, interface{}) error
 }
 
 // RBAC represents role-based-access-control interface
 type RBAC interface {
-	User(echo.Context) *models.AuthUser
-	EnforceUser(echo.Context, uint) error
-	AccountCreate(echo.Context, models.AccessRole, uint, uint) error
-	IsLowerRole(echo.Context, models.AccessRole) error
+	User(context.Context) *models.AuthUser
+	EnforceRole(context.Context, models.AccessRole) error
+	EnforceUser(context.Context, uint) error
+	AccountCreate(context.Context, models.AccessRole, uint, uint) error
+	IsLowerRole(context.Context, models.AccessRole) error
 }
 
 // Service represents user application interface
 type Service interface {
-	Create(echo.Context, models.User) (*models.User, error)
-	View(echo.Context, uint) (*models.User, error)
-	List(echo.Context, *models.Pagination) ([]models.User, error)
-	Update(echo.Context, *Update) (*models.User, error)
-	Delete(echo.Context, uint) error
+	Create(context.Context, models.User) (*models.User, error)
+	View(context.Context, uint) (*models.User, error)
+	List(context.Context, *models.UserFilter, *models.Pagination) ([]models.User, *models.Page, error)
+	Update(context.Context, *Update) (*models.User, error)
+	Delete(context.Context, uint) error
+	ListDeleted(context.Context, *models.Pagination) ([]models.User, *models.Page, error)
+	Restore(context.Context, uint) (*models.User, error)
+	Export(context.Context, uint) (*Export, error)
+	Erase(context.Context, uint) error
 }
 
 // RequestHandler represents user application service
 type RequestHandler struct {
 	db   *gorm.DB
+	tx   Transactor
 	udb  DBClientInterface
 	rbac RBAC
 	sec  Securer
+	evt  Publisher
 }
 
 // New creates new user RequestHandler application service
-func New(db *gorm.DB, udb DBClientInterface, rbac RBAC, sec Securer) *RequestHandler {
-	return &RequestHandler{db: db, udb: udb, rbac: rbac, sec: sec}
+func New(db *gorm.DB, tx Transactor, udb DBClientInterface, rbac RBAC, sec Securer, evt Publisher) *RequestHandler {
+	return &RequestHandler{db: db, tx: tx, udb: udb, rbac: rbac, sec: sec, evt: evt}
 }
 
 // Initialize initalizes User RequestHandler application service with defaults
-func Initialize(db *gorm.DB, rbac RBAC, sec Securer) *RequestHandler {
-	return New(db, store.NewUserDBClient(), rbac, sec)
+func Initialize(db *gorm.DB, udb DBClientInterface, rbac RBAC, sec Securer, evt Publisher) *RequestHandler {
+	return New(db, datastore.NewTransactor(db), udb, rbac, sec, evt)
 }
@@ -0,0 +1,91 @@
+package user
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/api/trace"
+
+	"github.com/johncoleman83/cerebrum/pkg/api/user"
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+	"github.com/johncoleman83/cerebrum/pkg/utl/tracing"
+)
+
+// packageName is the name of the package
+const packageName = "user"
+
+// TraceService represents user tracing service
+type TraceService struct {
+	user.Service
+	tracer trace.Tracer
+}
+
+// New creates new user tracing service
+func New(svc user.Service, tracer trace.Tracer) *TraceService {
+	return &TraceService{
+		Service: svc,
+		tracer:  tracer,
+	}
+}
+
+// Create tracing
+func (ts *TraceService) Create(ctx context.Context, req models.User) (resp *models.User, err error) {
+	ctx, span := ts.tracer.Start(ctx, packageName+".Create")
+	defer func() { tracing.End(span, err) }()
+	return ts.Service.Create(ctx, req)
+}
+
+// List tracing
+func (ts *TraceService) List(ctx context.Context, f *models.UserFilter, req *models.Pagination) (resp []models.User, page *models.Page, err error) {
+	ctx, span := ts.tracer.Start(ctx, packageName+".List")
+	defer func() { tracing.End(span, err) }()
+	return ts.Service.List(ctx, f, req)
+}
+
+// View tracing
+func (ts *TraceService) View(ctx context.Context, req uint) (resp *models.User, err error) {
+	ctx, span := ts.tracer.Start(ctx, packageName+".View")
+	defer func() { tracing.End(span, err) }()
+	return ts.Service.View(ctx, req)
+}
+
+// Delete tracing
+func (ts *TraceService) Delete(ctx context.Context, req uint) (err error) {
+	ctx, span := ts.tracer.Start(ctx, packageName+".Delete")
+	defer func() { tracing.End(span, err) }()
+	return ts.Service.Delete(ctx, req)
+}
+
+// Update tracing
+func (ts *TraceService) Update(ctx context.Context, req *user.Update) (resp *models.User, err error) {
+	ctx, span := ts.tracer.Start(ctx, packageName+".Update")
+	defer func() { tracing.End(span, err) }()
+	return ts.Service.Update(ctx, req)
+}
+
+// ListDeleted tracing
+func (ts *TraceService) ListDeleted(ctx context.Context, req *models.Pagination) (resp []models.User, page *models.Page, err error) {
+	ctx, span := ts.tracer.Start(ctx, packageName+".ListDeleted")
+	defer func() { tracing.End(span, err) }()
+	return ts.Service.ListDeleted(ctx, req)
+}
+
+// Restore tracing
+func (ts *TraceService) Restore(ctx context.Context, req uint) (resp *models.User, err error) {
+	ctx, span := ts.tracer.Start(ctx, packageName+".Restore")
+	defer func() { tracing.End(span, err) }()
+	return ts.Service.Restore(ctx, req)
+}
+
+// Export tracing
+func (ts *TraceService) Export(ctx context.Context, req uint) (resp *user.Export, err error) {
+	ctx, span := ts.tracer.Start(ctx, packageName+".Export")
+	defer func() { tracing.End(span, err) }()
+	return ts.Service.Export(ctx, req)
+}
+
+// Erase tracing
+func (ts *TraceService) Erase(ctx context.Context, req uint) (err error) {
+	ctx, span := ts.tracer.Start(ctx, packageName+".Erase")
+	defer func() { tracing.End(span, err) }()
+	return ts.Service.Erase(ctx, req)
+}
@@ -2,22 +2,59 @@
 package transport
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/johncoleman83/cerebrum/pkg/api/user"
 
 	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+	"github.com/johncoleman83/cerebrum/pkg/utl/server"
 
 	"github.com/labstack/echo"
 )
 
 // Custom errors
 var (
-	ErrUnknownRole         = echo.NewHTTPError(http.StatusBadRequest, "role is unknown")
-	ErrPasswordsNotMaching = echo.NewHTTPError(http.StatusBadRequest, "passwords do not match")
+	ErrUnknownRole         = models.NewError(http.StatusBadRequest, "unknown_role", "role is unknown")
+	ErrPasswordsNotMaching = models.NewError(http.StatusBadRequest, "passwords_not_matching", "passwords do not match")
+	ErrInvalidRange        = models.NewError(http.StatusBadRequest, "invalid_range", "time range must end after it starts")
+	ErrInvalidIfMatch      = models.NewError(http.StatusBadRequest, "invalid_if_match", "If-Match must be the ETag of the user")
 )
 
+// Conditional request headers
+const (
+	headerETag    = "ETag"
+	headerIfMatch = "If-Match"
+)
+
+// etag returns the entity tag of a user version
+func etag(version uint) string {
+	return strconv.Quote(strconv.FormatUint(uint64(version), 10))
+}
+
+// ifMatch parses the If-Match header into the version the client expects,
+// nil if the header is absent or "*". Weak or malformed tags are rejected
+// with ErrInvalidIfMatch.
+func ifMatch(c echo.Context) (*uint, error) {
+	h := strings.TrimSpace(c.Request().Header.Get(headerIfMatch))
+	if h == "" || h == "*" {
+		return nil, nil
+	}
+	tag, err := strconv.Unquote(h)
+	if err != nil || strings.HasPrefix(h, "W/") {
+		return nil, ErrInvalidIfMatch
+	}
+	v, err := strconv.ParseUint(tag, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidIfMatch
+	}
+	version := uint(v)
+	return &version, nil
+}
+
 // HTTP represents user http service
 type HTTP struct {
 	svc user.Service
@@ -30,9 +67,13 @@ func NewHTTP(svc user.Service, er *echo.Group) {
 
 	ur.POST("", h.create)
 	ur.GET("", h.list)
+	ur.GET("/deleted", h.listDeleted)
 	ur.GET("/:id", h.view)
 	ur.PATCH("/:id", h.update)
 	ur.DELETE("/:id", h.delete)
+	ur.POST("/:id/restore", h.restore)
+	ur.GET("/:id/export", h.export)
+	ur.POST("/:id/erase", h.erase)
 }
 
 // createReq is a used to serialize the request payload to a struct
@@ -76,7 +117,7 @@ func (h *HTTP) create(c echo.Context) error {
 		return ErrUnknownRole
 	}
 
-	usr, err := h.svc.Create(c, models.User{
+	usr, err := h.svc.Create(c.Request().Context(), models.User{
 		Username:  r.Username,
 		Password:  r.Password,
 		Email:     r.Email,
@@ -95,16 +136,106 @@ func (h *HTTP) create(c echo.Context) error {
 	return c.JSON(http.StatusOK, usr)
 }
 
-// listResponse contains the users list and page for the list response
+// listResponse contains the users list and page for the list response,
+// with the cursors of the next and previous pages and the total if requested
 type listResponse struct {
 	Users []models.User `json:"users"`
 	Page  int           `json:"page"`
+	Next  string        `json:"next,omitempty"`
+	Prev  string        `json:"prev,omitempty"`
+	Total *int          `json:"total,omitempty"`
+}
+
+// newListResponse returns the response of a list request and sets its links
+func newListResponse(c echo.Context, users []models.User, r *models.PaginationReq, p *models.Page) listResponse {
+	server.SetPageLinks(c, p)
+	resp := listResponse{Users: users, Page: r.Page}
+	if p == nil {
+		return resp
+	}
+	if p.Next != nil {
+		resp.Next = p.Next.String()
+	}
+	if p.Prev != nil {
+		resp.Prev = p.Prev.String()
+	}
+	resp.Total = p.Total
+	return resp
+}
+
+// listReq holds the pagination, filters, search and sort of list requests
+type listReq struct {
+	models.PaginationReq
+
+	RoleID    uint `query:"role_id"`
+	TeamID    uint `query:"team_id"`
+	AccountID uint `query:"account_id"`
+
+	CreatedAfter    string `query:"created_after"`
+	CreatedBefore   string `query:"created_before"`
+	LastLoginAfter  string `query:"last_login_after"`
+	LastLoginBefore string `query:"last_login_before"`
+
+	Q    string `query:"q" validate:"max=100"`
+	Sort string `query:"sort" validate:"max=200"`
+}
+
+// filter converts the request into a user filter, times are RFC 3339 and
+// sort is a comma separated list of fields, prefixed with - to sort descending
+func (r *listReq) filter() (*models.UserFilter, error) {
+	f := &models.UserFilter{
+		RoleID:    r.RoleID,
+		TeamID:    r.TeamID,
+		AccountID: r.AccountID,
+		Search:    strings.TrimSpace(r.Q),
+	}
+	times := []struct {
+		name  string
+		value string
+		dst   **time.Time
+	}{
+		{"created_after", r.CreatedAfter, &f.CreatedAfter},
+		{"created_before", r.CreatedBefore, &f.CreatedBefore},
+		{"last_login_after", r.LastLoginAfter, &f.LastLoginAfter},
+		{"last_login_before", r.LastLoginBefore, &f.LastLoginBefore},
+	}
+	for _, t := range times {
+		if t.value == "" {
+			continue
+		}
+		v, err := time.Parse(time.RFC3339, t.value)
+		if err != nil {
+			return nil, models.NewError(http.StatusBadRequest, "invalid_time", fmt.Sprintf("%s must be an RFC 3339 time", t.name))
+		}
+		*t.dst = &v
+	}
+	if f.CreatedAfter != nil && f.CreatedBefore != nil && !f.CreatedAfter.Before(*f.CreatedBefore) {
+		return nil, ErrInvalidRange
+	}
+	if f.LastLoginAfter != nil && f.LastLoginBefore != nil && !f.LastLoginAfter.Before(*f.LastLoginBefore) {
+		return nil, ErrInvalidRange
+	}
+	if r.Sort == "" {
+		return f, nil
+	}
+	seen := make(map[string]bool)
+	for _, field := range strings.Split(r.Sort, ",") {
+		field = strings.TrimSpace(field)
+		desc := strings.HasPrefix(field, "-")
+		field = strings.TrimPrefix(field, "-")
+		if !models.UserSortColumns[field] || seen[field] {
+			return nil, models.NewError(http.StatusBadRequest, "invalid_sort", fmt.Sprintf("cannot sort by %q", field))
+		}
+		seen[field] = true
+		f.Sort = append(f.Sort, models.SortField{Column: field, Desc: desc})
+	}
+	return f, nil
 }
 
 // list Returns list of users. Depending on the user role requesting it:
 // it may return all users for SuperAdmin/Admin users,
 // all account/team users for Account/Team admins
-// and an error for non-admin users.
+// and an error for non-admin users. Users may be filtered, searched and sorted.
 //
 // usage: GET /v1/users users listUsers
 //
@@ -119,6 +250,65 @@ type listResponse struct {
 //   description: page number
 //   type: integer
 //   required: false
+// - name: cursor
+//   in: query
+//   description: cursor of the next or previous page, from a previous response, instead of page
+//   type: string
+//   required: false
+// - name: count
+//   in: query
+//   description: whether to return the total number of results
+//   type: boolean
+//   required: false
+// - name: role_id
+//   in: query
+//   description: only users with this role
+//   type: integer
+//   required: false
+// - name: team_id
+//   in: query
+//   description: only users of this team
+//   type: integer
+//   required: false
+// - name: account_id
+//   in: query
+//   description: only users of this account
+//   type: integer
+//   required: false
+// - name: created_after
+//   in: query
+//   description: only users created at or after this RFC 3339 time
+//   type: string
+//   format: date-time
+//   required: false
+// - name: created_before
+//   in: query
+//   description: only users created before this RFC 3339 time
+//   type: string
+//   format: date-time
+//   required: false
+// - name: last_login_after
+//   in: query
+//   description: only users who last logged in at or after this RFC 3339 time
+//   type: string
+//   format: date-time
+//   required: false
+// - name: last_login_before
+//   in: query
+//   description: only users who last logged in before this RFC 3339 time
+//   type: string
+//   format: date-time
+//   required: false
+// - name: q
+//   in: query
+//   description: search in first name, last name and username, or exact email
+//   type: string
+//   required: false
+// - name: sort
+//   in: query
+//   description: comma separated fields to sort by, prefixed with - for descending order
+//   type: string
+//   required: false
 //
 // responses:
 //   "200":
@@ -132,18 +322,27 @@ type listResponse struct {
 //   "500":
 //     "$ref": "#/responses/err"
 func (h *HTTP) list(c echo.Context) error {
-	p := new(models.PaginationReq)
-	if err := c.Bind(p); err != nil {
+	r := new(listReq)
+	if err := c.Bind(r); err != nil {
+		return err
+	}
+	f, err := r.filter()
+	if err != nil {
+		return err
+	}
+
+	p, err := r.NewPagination()
+	if err != nil {
 		return err
 	}
 
-	result, err := h.svc.List(c, p.NewPagination())
+	result, page, err := h.svc.List(c.Request().Context(), f, p)
 
 	if err != nil {
 		return err
 	}
 
-	return c.JSON(http.StatusOK, listResponse{result, p.Page})
+	return c.JSON(http.StatusOK, newListResponse(c, result, &r.PaginationReq, page))
 }
 
 // view returns a single user with same id as request id
@@ -159,7 +358,7 @@ func (h *HTTP) list(c echo.Context) error {
 //
 // responses:
 //   "200":
-//     "$ref": "#/responses/userResp"
+//     "$ref": "#/responses/userVersionedResp"
 //   "400":
 //     "$ref": "#/responses/err"
 //   "401":
@@ -176,11 +375,12 @@ func (h *HTTP) view(c echo.Context) error {
 		return models.ErrBadRequest
 	}
 
-	result, err := h.svc.View(c, uint(id))
+	result, err := h.svc.View(c.Request().Context(), uint(id))
 	if err != nil {
 		return err
 	}
 
+	c.Response().Header().Set(headerETag, etag(result.Version))
 	return c.JSON(http.StatusOK, result)
 }
 
@@ -210,16 +410,24 @@ type updateReq struct {
 //   required: true
 //   schema:
 //     "$ref": "#/definitions/userUpdate"
+// - name: If-Match
+//   in: header
+//   description: ETag of the user as read by the client, the update fails with 409 if the user was modified since
+//   type: string
 //
 // responses:
 //   "200":
-//     "$ref": "#/responses/userResp"
+//     "$ref": "#/responses/userVersionedResp"
 //   "400":
 //     "$ref": "#/responses/errMsg"
 //   "401":
 //     "$ref": "#/responses/err"
 //   "403":
 //     "$ref": "#/responses/err"
+//   "404":
+//     "$ref": "#/responses/err"
+//   "409":
+//     "$ref": "#/responses/err"
 //   "500":
 //     "$ref": "#/responses/err"
 func (h *HTTP) update(c echo.Context) error {
@@ -233,19 +441,26 @@ func (h *HTTP) update(c echo.Context) error {
 		return err
 	}
 
-	usr, err := h.svc.Update(c, &user.Update{
+	version, err := ifMatch(c)
+	if err != nil {
+		return err
+	}
+
+	usr, err := h.svc.Update(c.Request().Context(), &user.Update{
 		ID:        uint(id),
 		FirstName: req.FirstName,
 		LastName:  req.LastName,
 		Mobile:    req.Mobile,
 		Phone:     req.Phone,
 		Address:   req.Address,
+		Version:   version,
 	})
 
 	if err != nil {
 		return err
 	}
 
+	c.Response().Header().Set(headerETag, etag(usr.Version))
 	return c.JSON(http.StatusOK, usr)
 }
 
@@ -277,7 +492,193 @@ func (h *HTTP) delete(c echo.Context) error {
 		return models.ErrBadRequest
 	}
 
-	if err := h.svc.Delete(c, uint(id)); err != nil {
+	if err := h.svc.Delete(c.Request().Context(), uint(id)); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// listDeleted returns the soft deleted users, most recently deleted first.
+// Deleted users are permanently purged after the trash retention period.
+//
+// usage: GET /v1/users/deleted users listDeletedUsers
+//
+// parameters:
+// - name: limit
+//   in: query
+//   description: number of results
+//   type: integer
+//   required: false
+// - name: page
+//   in: query
+//   description: page number
+//   type: integer
+//   required: false
+// - name: cursor
+//   in: query
+//   description: cursor of the next or previous page, from a previous response, instead of page
+//   type: string
+//   required: false
+// - name: count
+//   in: query
+//   description: whether to return the total number of results
+//   type: boolean
+//   required: false
+//
+// responses:
+//   "200":
+//     "$ref": "#/responses/userListResp"
+//   "400":
+//     "$ref": "#/responses/errMsg"
+//   "401":
+//     "$ref": "#/responses/err"
+//   "403":
+//     "$ref": "#/responses/err"
+//   "500":
+//     "$ref": "#/responses/err"
+//   "503":
+//     "$ref": "#/responses/err"
+func (h *HTTP) listDeleted(c echo.Context) error {
+	p := new(models.PaginationReq)
+	if err := c.Bind(p); err != nil {
+		return err
+	}
+
+	pg, err := p.NewPagination()
+	if err != nil {
+		return err
+	}
+
+	result, page, err := h.svc.ListDeleted(c.Request().Context(), pg)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newListResponse(c, result, p, page))
+}
+
+// restore restores a soft deleted user with requested ID.
+//
+// usage: POST /v1/users/{id}/restore users userRestore
+//
+// parameters:
+// - name: id
+//   in: path
+//   description: id of user
+//   type: integer
+//   required: true
+//
+// responses:
+//   "200":
+//     "$ref": "#/responses/userVersionedResp"
+//   "400":
+//     "$ref": "#/responses/err"
+//   "401":
+//     "$ref": "#/responses/err"
+//   "403":
+//     "$ref": "#/responses/err"
+//   "404":
+//     "$ref": "#/responses/err"
+//   "409":
+//     "$ref": "#/responses/err"
+//   "500":
+//     "$ref": "#/responses/err"
+//   "503":
+//     "$ref": "#/responses/err"
+func (h *HTTP) restore(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return models.ErrBadRequest
+	}
+
+	usr, err := h.svc.Restore(c.Request().Context(), uint(id))
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(headerETag, etag(usr.Version))
+	return c.JSON(http.StatusOK, usr)
+}
+
+// export returns an archive of all data held about a user with requested ID:
+// profile, session and audit history, as a JSON attachment.
+//
+// usage: GET /v1/users/{id}/export users userExport
+//
+// parameters:
+// - name: id
+//   in: path
+//   description: id of user
+//   type: integer
+//   required: true
+//
+// responses:
+//   "200":
+//     "$ref": "#/responses/userExportResp"
+//   "400":
+//     "$ref": "#/responses/err"
+//   "401":
+//     "$ref": "#/responses/err"
+//   "403":
+//     "$ref": "#/responses/err"
+//   "404":
+//     "$ref": "#/responses/err"
+//   "500":
+//     "$ref": "#/responses/err"
+//   "503":
+//     "$ref": "#/responses/err"
+func (h *HTTP) export(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return models.ErrBadRequest
+	}
+
+	exp, err := h.svc.Export(c.Request().Context(), uint(id))
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="user-%d-export.json"`, id))
+	return c.JSON(http.StatusOK, exp)
+}
+
+// erase anonymizes the personal data of a user with requested ID,
+// the user and its audit history are kept.
+//
+// usage: POST /v1/users/{id}/erase users userErase
+//
+// parameters:
+// - name: id
+//   in: path
+//   description: id of user
+//   type: integer
+//   required: true
+//
+// responses:
+//   "200":
+//     "$ref": "#/responses/ok"
+//   "400":
+//     "$ref": "#/responses/err"
+//   "401":
+//     "$ref": "#/responses/err"
+//   "403":
+//     "$ref": "#/responses/err"
+//   "404":
+//     "$ref": "#/responses/err"
+//   "409":
+//     "$ref": "#/responses/err"
+//   "500":
+//     "$ref": "#/responses/err"
+//   "503":
+//     "$ref": "#/responses/err"
+func (h *HTTP) erase(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return models.ErrBadRequest
+	}
+
+	if err := h.svc.Erase(c.Request().Context(), uint(id)); err != nil {
 		return err
 	}
 
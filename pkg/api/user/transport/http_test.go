@@ -2,13 +2,16 @@ package transport_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/johncoleman83/cerebrum/pkg/utl/models"
 
+	"github.com/johncoleman83/cerebrum/pkg/api/store"
 	"github.com/johncoleman83/cerebrum/pkg/api/user"
 	"github.com/johncoleman83/cerebrum/pkg/api/user/transport"
 
@@ -17,7 +20,6 @@ import (
 	"github.com/johncoleman83/cerebrum/pkg/utl/server"
 
 	"github.com/jinzhu/gorm"
-	"github.com/labstack/echo"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -54,8 +56,8 @@ func TestCreate(t *testing.T) {
 			name: "Fail on invalid role",
 			req:  `{"first_name":"William","last_name":"Abbott","username":"williamabbot","password":"hunter123","password_confirm":"hunter123","email":"williamabbot@gmail.com","account_id":1,"team_id":2,"role_id":5}`,
 			rbac: &mock.RBAC{
-				AccountCreateFn: func(c echo.Context, roleID models.AccessRole, accountID, teamID uint) error {
-					return echo.ErrForbidden
+				AccountCreateFn: func(ctx context.Context, roleID models.AccessRole, accountID, teamID uint) error {
+					return models.ErrForbidden
 				},
 			},
 			expectedStatus: http.StatusForbidden,
@@ -64,8 +66,8 @@ func TestCreate(t *testing.T) {
 			name: "Fail on RBAC",
 			req:  `{"first_name":"Sarah","last_name":"Smith","username":"sarahsmith","password":"hunter123","password_confirm":"hunter123","email":"sarahsmith@gmail.com","account_id":1,"team_id":2,"role_id":5}`,
 			rbac: &mock.RBAC{
-				AccountCreateFn: func(c echo.Context, roleID models.AccessRole, accountID, teamID uint) error {
-					return echo.ErrForbidden
+				AccountCreateFn: func(ctx context.Context, roleID models.AccessRole, accountID, teamID uint) error {
+					return models.ErrForbidden
 				},
 			},
 			expectedStatus: http.StatusForbidden,
@@ -75,12 +77,12 @@ func TestCreate(t *testing.T) {
 			name: "Success",
 			req:  `{"first_name":"Edwin","last_name":"Abbott","username":"edwinabbott","password":"hunter123","password_confirm":"hunter123","email":"edwinabbott@gmail.com","account_id":1,"team_id":2,"role_id":5}`,
 			rbac: &mock.RBAC{
-				AccountCreateFn: func(c echo.Context, roleID models.AccessRole, accountID, teamID uint) error {
+				AccountCreateFn: func(ctx context.Context, roleID models.AccessRole, accountID, teamID uint) error {
 					return nil
 				},
 			},
 			udb: &mockstore.UserDBClient{
-				CreateFn: func(db *gorm.DB, usr models.User) (*models.User, error) {
+				CreateFn: func(ctx context.Context, db *gorm.DB, usr models.User) (*models.User, error) {
 					usr.ID = 1
 					usr.CreatedAt = mock.TestTime(2018)
 					usr.UpdatedAt = mock.TestTime(2018)
@@ -119,9 +121,9 @@ func TestCreate(t *testing.T) {
 
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			r := server.New()
+			r := server.New(nil)
 			rg := r.Group("")
-			transport.NewHTTP(user.New(nil, tt.udb, tt.rbac, tt.sec), rg)
+			transport.NewHTTP(user.New(nil, mock.NoopTransactor(), tt.udb, tt.rbac, tt.sec, mock.NoopPublisher()), rg)
 			ts := httptest.NewServer(r)
 			defer ts.Close()
 			path := ts.URL + "/users"
@@ -146,12 +148,16 @@ func TestList(t *testing.T) {
 	type listResponse struct {
 		Users []models.User `json:"users"`
 		Page  int           `json:"page"`
+		Next  string        `json:"next"`
+		Prev  string        `json:"prev"`
+		Total *int          `json:"total"`
 	}
 	cases := []struct {
 		name           string
 		req            string
 		expectedStatus int
 		expectedResp   *listResponse
+		expectedLink   string
 		udb            *mockstore.UserDBClient
 		rbac           *mock.RBAC
 		sec            *mock.Secure
@@ -161,11 +167,91 @@ func TestList(t *testing.T) {
 			req:            `?limit=2222&page=-1`,
 			expectedStatus: http.StatusBadRequest,
 		},
+		{
+			name:           "Fail on invalid cursor",
+			req:            `?cursor=garbage`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Success with cursor and count",
+			req:  `?limit=1&count=true&cursor=` + (&models.Cursor{Columns: []string{"id"}, Values: []string{"10"}}).String(),
+			rbac: &mock.RBAC{
+				UserFn: func(ctx context.Context) *models.AuthUser {
+					return &models.AuthUser{ID: 1, AccessLevel: models.SuperAdminRole}
+				}},
+			udb: &mockstore.UserDBClient{
+				ListFn: func(ctx context.Context, db *gorm.DB, q *models.ListQuery, f *models.UserFilter, p *models.Pagination) ([]models.User, *models.Page, error) {
+					if p.Cursor == nil || p.Cursor.Values[0] != "10" || !p.Count {
+						return nil, nil, models.ErrGeneric
+					}
+					total := 12
+					return []models.User{{Base: models.Base{ID: 11}}}, &models.Page{
+						Next:  &models.Cursor{Columns: []string{"id"}, Values: []string{"11"}},
+						Prev:  &models.Cursor{Columns: []string{"id"}, Values: []string{"11"}, Before: true},
+						Total: &total,
+					}, nil
+				},
+			},
+			expectedStatus: http.StatusOK,
+			expectedResp: &listResponse{
+				Users: []models.User{{Base: models.Base{ID: 11}}},
+				Next:  (&models.Cursor{Columns: []string{"id"}, Values: []string{"11"}}).String(),
+				Prev:  (&models.Cursor{Columns: []string{"id"}, Values: []string{"11"}, Before: true}).String(),
+				Total: func() *int { n := 12; return &n }(),
+			},
+			expectedLink: `</users?count=true&cursor=` + (&models.Cursor{Columns: []string{"id"}, Values: []string{"11"}}).String() + `&limit=1>; rel="next", ` +
+				`</users?count=true&cursor=` + (&models.Cursor{Columns: []string{"id"}, Values: []string{"11"}, Before: true}).String() + `&limit=1>; rel="prev", ` +
+				`</users?count=true&limit=1>; rel="first"`,
+		},
+		{
+			name:           "Fail on unknown sort field",
+			req:            `?sort=-last_name,password`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Fail on duplicate sort field",
+			req:            `?sort=last_name,-last_name`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Fail on invalid time",
+			req:            `?created_after=yesterday`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Fail on inverted time range",
+			req:            `?last_login_after=2020-02-01T00:00:00Z&last_login_before=2020-01-01T00:00:00Z`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Success with filters and sort",
+			req:  `?role_id=3&team_id=4&account_id=5&created_after=2020-01-01T00:00:00Z&created_before=2020-02-01T00:00:00%2B01:00&q=+jane+&sort=-last_name,first_name`,
+			rbac: &mock.RBAC{
+				UserFn: func(ctx context.Context) *models.AuthUser {
+					return &models.AuthUser{ID: 1, AccessLevel: models.SuperAdminRole}
+				}},
+			udb: &mockstore.UserDBClient{
+				ListFn: func(ctx context.Context, db *gorm.DB, q *models.ListQuery, f *models.UserFilter, p *models.Pagination) ([]models.User, *models.Page, error) {
+					after := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+					before := time.Date(2020, 1, 31, 23, 0, 0, 0, time.UTC)
+					ok := f.RoleID == 3 && f.TeamID == 4 && f.AccountID == 5 &&
+						f.CreatedAfter.Equal(after) && f.CreatedBefore.Equal(before) &&
+						f.LastLoginAfter == nil && f.LastLoginBefore == nil && f.Search == "jane" &&
+						assert.ObjectsAreEqual([]models.SortField{{Column: "last_name", Desc: true}, {Column: "first_name"}}, f.Sort)
+					if !ok {
+						return nil, nil, models.ErrGeneric
+					}
+					return []models.User{}, nil, nil
+				},
+			},
+			expectedStatus: http.StatusOK,
+			expectedResp:   &listResponse{Users: []models.User{}, Page: 0},
+		},
 		{
 			name: "Fail on query list",
 			req:  `?limit=100&page=1`,
 			rbac: &mock.RBAC{
-				UserFn: func(c echo.Context) *models.AuthUser {
+				UserFn: func(ctx context.Context) *models.AuthUser {
 					return &models.AuthUser{
 						ID:          1,
 						AccountID:   2,
@@ -180,7 +266,7 @@ func TestList(t *testing.T) {
 			name: "Success",
 			req:  `?limit=100&page=1`,
 			rbac: &mock.RBAC{
-				UserFn: func(c echo.Context) *models.AuthUser {
+				UserFn: func(ctx context.Context) *models.AuthUser {
 					return &models.AuthUser{
 						ID:          1,
 						AccountID:   2,
@@ -190,7 +276,7 @@ func TestList(t *testing.T) {
 					}
 				}},
 			udb: &mockstore.UserDBClient{
-				ListFn: func(db *gorm.DB, q *models.ListQuery, p *models.Pagination) ([]models.User, error) {
+				ListFn: func(ctx context.Context, db *gorm.DB, q *models.ListQuery, f *models.UserFilter, p *models.Pagination) ([]models.User, *models.Page, error) {
 					if p.Limit == 100 && p.Offset == 100 {
 						return []models.User{
 							{
@@ -227,9 +313,9 @@ func TestList(t *testing.T) {
 									Name:        "ADMIN",
 								},
 							},
-						}, nil
+						}, nil, nil
 					}
-					return nil, models.ErrGeneric
+					return nil, nil, models.ErrGeneric
 				},
 			},
 			expectedStatus: http.StatusOK,
@@ -275,9 +361,9 @@ func TestList(t *testing.T) {
 
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			r := server.New()
+			r := server.New(nil)
 			rg := r.Group("")
-			transport.NewHTTP(user.New(nil, tt.udb, tt.rbac, tt.sec), rg)
+			transport.NewHTTP(user.New(nil, mock.NoopTransactor(), tt.udb, tt.rbac, tt.sec, mock.NoopPublisher()), rg)
 			ts := httptest.NewServer(r)
 			defer ts.Close()
 			path := ts.URL + "/users" + tt.req
@@ -294,6 +380,7 @@ func TestList(t *testing.T) {
 				assert.Equal(t, tt.expectedResp, response)
 			}
 			assert.Equal(t, tt.expectedStatus, res.StatusCode)
+			assert.Equal(t, tt.expectedLink, res.Header.Get(server.HeaderLink))
 		})
 	}
 }
@@ -304,6 +391,7 @@ func TestView(t *testing.T) {
 		req            string
 		expectedStatus int
 		expectedResp   *models.User
+		expectedETag   string
 		udb            *mockstore.UserDBClient
 		rbac           *mock.RBAC
 		sec            *mock.Secure
@@ -317,8 +405,8 @@ func TestView(t *testing.T) {
 			name: "Fail on RBAC",
 			req:  `1`,
 			rbac: &mock.RBAC{
-				EnforceUserFn: func(echo.Context, uint) error {
-					return echo.ErrForbidden
+				EnforceUserFn: func(context.Context, uint) error {
+					return models.ErrForbidden
 				},
 			},
 			expectedStatus: http.StatusForbidden,
@@ -327,17 +415,18 @@ func TestView(t *testing.T) {
 			name: "Success",
 			req:  `1`,
 			rbac: &mock.RBAC{
-				EnforceUserFn: func(echo.Context, uint) error {
+				EnforceUserFn: func(context.Context, uint) error {
 					return nil
 				},
 			},
 			udb: &mockstore.UserDBClient{
-				ViewFn: func(db *gorm.DB, id uint) (*models.User, error) {
+				ViewFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
 					return &models.User{
 						Base: models.Base{
 							ID:        1,
 							CreatedAt: mock.TestTime(2000),
 							UpdatedAt: mock.TestTime(2000),
+							Version:   3,
 						},
 						FirstName: "Rocinante",
 						LastName:  "deLaMancha",
@@ -351,19 +440,21 @@ func TestView(t *testing.T) {
 					ID:        1,
 					CreatedAt: mock.TestTime(2000),
 					UpdatedAt: mock.TestTime(2000),
+					Version:   3,
 				},
 				FirstName: "Rocinante",
 				LastName:  "deLaMancha",
 				Username:  "RocinantedeLaMancha",
 			},
+			expectedETag: `"3"`,
 		},
 	}
 
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			r := server.New()
+			r := server.New(nil)
 			rg := r.Group("")
-			transport.NewHTTP(user.New(nil, tt.udb, tt.rbac, tt.sec), rg)
+			transport.NewHTTP(user.New(nil, mock.NoopTransactor(), tt.udb, tt.rbac, tt.sec, mock.NoopPublisher()), rg)
 			ts := httptest.NewServer(r)
 			defer ts.Close()
 			path := ts.URL + "/users/" + tt.req
@@ -380,6 +471,7 @@ func TestView(t *testing.T) {
 				assert.Equal(t, tt.expectedResp, response)
 			}
 			assert.Equal(t, tt.expectedStatus, res.StatusCode)
+			assert.Equal(t, tt.expectedETag, res.Header.Get("ETag"))
 		})
 	}
 }
@@ -389,8 +481,10 @@ func TestUpdate(t *testing.T) {
 		name           string
 		req            string
 		id             string
+		ifMatch        string
 		expectedStatus int
 		expectedResp   *models.User
+		expectedETag   string
 		udb            *mockstore.UserDBClient
 		rbac           *mock.RBAC
 		sec            *mock.Secure
@@ -411,8 +505,8 @@ func TestUpdate(t *testing.T) {
 			id:   `1`,
 			req:  `{"first_name":"jj","last_name":"okocha","mobile":"123456","phone":"321321","address":"home"}`,
 			rbac: &mock.RBAC{
-				EnforceUserFn: func(echo.Context, uint) error {
-					return echo.ErrForbidden
+				EnforceUserFn: func(context.Context, uint) error {
+					return models.ErrForbidden
 				},
 			},
 			expectedStatus: http.StatusForbidden,
@@ -422,12 +516,12 @@ func TestUpdate(t *testing.T) {
 			id:   `1`,
 			req:  `{"first_name":"jj","last_name":"okocha","phone":"321321","address":"home"}`,
 			rbac: &mock.RBAC{
-				EnforceUserFn: func(echo.Context, uint) error {
+				EnforceUserFn: func(context.Context, uint) error {
 					return nil
 				},
 			},
 			udb: &mockstore.UserDBClient{
-				ViewFn: func(db *gorm.DB, id uint) (*models.User, error) {
+				ViewFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
 					return &models.User{
 						Base: models.Base{
 							ID:        1,
@@ -441,7 +535,7 @@ func TestUpdate(t *testing.T) {
 						Phone:     "332223",
 					}, nil
 				},
-				UpdateFn: func(db *gorm.DB, usr *models.User) error {
+				UpdateFn: func(ctx context.Context, db *gorm.DB, usr *models.User) error {
 					usr.UpdatedAt = mock.TestTime(2010)
 					usr.Mobile = "991991"
 					return nil
@@ -461,6 +555,81 @@ func TestUpdate(t *testing.T) {
 				Address:   "home",
 				Mobile:    "991991",
 			},
+			expectedETag: `"0"`,
+		},
+		{
+			name:    "Fail on stale If-Match",
+			id:      `1`,
+			req:     `{"first_name":"jj"}`,
+			ifMatch: `"3"`,
+			rbac: &mock.RBAC{
+				EnforceUserFn: func(context.Context, uint) error {
+					return nil
+				},
+			},
+			udb: &mockstore.UserDBClient{
+				ViewFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+					return &models.User{Base: models.Base{ID: 1, Version: 4}}, nil
+				},
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "Fail on weak If-Match",
+			id:             `1`,
+			req:            `{"first_name":"jj"}`,
+			ifMatch:        `W/"4"`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Fail on malformed If-Match",
+			id:             `1`,
+			req:            `{"first_name":"jj"}`,
+			ifMatch:        `"v4"`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "Fail on concurrent modification",
+			id:      `1`,
+			req:     `{"first_name":"jj"}`,
+			ifMatch: `"4"`,
+			rbac: &mock.RBAC{
+				EnforceUserFn: func(context.Context, uint) error {
+					return nil
+				},
+			},
+			udb: &mockstore.UserDBClient{
+				ViewFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+					return &models.User{Base: models.Base{ID: 1, Version: 4}}, nil
+				},
+				UpdateFn: func(ctx context.Context, db *gorm.DB, usr *models.User) error {
+					return store.ErrStaleVersion
+				},
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:    "Success with If-Match",
+			id:      `1`,
+			req:     `{"first_name":"jj"}`,
+			ifMatch: `"4"`,
+			rbac: &mock.RBAC{
+				EnforceUserFn: func(context.Context, uint) error {
+					return nil
+				},
+			},
+			udb: &mockstore.UserDBClient{
+				ViewFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+					return &models.User{Base: models.Base{ID: 1, Version: 4}}, nil
+				},
+				UpdateFn: func(ctx context.Context, db *gorm.DB, usr *models.User) error {
+					usr.Version++
+					return nil
+				},
+			},
+			expectedStatus: http.StatusOK,
+			expectedResp:   &models.User{Base: models.Base{ID: 1, Version: 5}, FirstName: "jj"},
+			expectedETag:   `"5"`,
 		},
 	}
 
@@ -468,14 +637,17 @@ func TestUpdate(t *testing.T) {
 
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			r := server.New()
+			r := server.New(nil)
 			rg := r.Group("")
-			transport.NewHTTP(user.New(nil, tt.udb, tt.rbac, tt.sec), rg)
+			transport.NewHTTP(user.New(nil, mock.NoopTransactor(), tt.udb, tt.rbac, tt.sec, mock.NoopPublisher()), rg)
 			ts := httptest.NewServer(r)
 			defer ts.Close()
 			path := ts.URL + "/users/" + tt.id
 			req, _ := http.NewRequest("PATCH", path, bytes.NewBufferString(tt.req))
 			req.Header.Set("Content-Type", "application/json")
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
 			res, err := client.Do(req)
 			if err != nil {
 				t.Fatal(err)
@@ -489,6 +661,7 @@ func TestUpdate(t *testing.T) {
 				assert.Equal(t, tt.expectedResp, response)
 			}
 			assert.Equal(t, tt.expectedStatus, res.StatusCode)
+			assert.Equal(t, tt.expectedETag, res.Header.Get("ETag"))
 		})
 	}
 }
@@ -511,7 +684,7 @@ func TestDelete(t *testing.T) {
 			name: "Fail on RBAC",
 			id:   `1`,
 			udb: &mockstore.UserDBClient{
-				ViewFn: func(db *gorm.DB, id uint) (*models.User, error) {
+				ViewFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
 					return &models.User{
 						Role: models.Role{
 							AccessLevel: models.AccountAdminRole,
@@ -520,8 +693,8 @@ func TestDelete(t *testing.T) {
 				},
 			},
 			rbac: &mock.RBAC{
-				IsLowerRoleFn: func(echo.Context, models.AccessRole) error {
-					return echo.ErrForbidden
+				IsLowerRoleFn: func(context.Context, models.AccessRole) error {
+					return models.ErrForbidden
 				},
 			},
 			expectedStatus: http.StatusForbidden,
@@ -530,19 +703,19 @@ func TestDelete(t *testing.T) {
 			name: "Success",
 			id:   `1`,
 			udb: &mockstore.UserDBClient{
-				ViewFn: func(db *gorm.DB, id uint) (*models.User, error) {
+				ViewFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
 					return &models.User{
 						Role: models.Role{
 							AccessLevel: models.AccountAdminRole,
 						},
 					}, nil
 				},
-				DeleteFn: func(*gorm.DB, *models.User) error {
+				DeleteFn: func(context.Context, *gorm.DB, *models.User) error {
 					return nil
 				},
 			},
 			rbac: &mock.RBAC{
-				IsLowerRoleFn: func(echo.Context, models.AccessRole) error {
+				IsLowerRoleFn: func(context.Context, models.AccessRole) error {
 					return nil
 				},
 			},
@@ -554,9 +727,9 @@ func TestDelete(t *testing.T) {
 
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			r := server.New()
+			r := server.New(nil)
 			rg := r.Group("")
-			transport.NewHTTP(user.New(nil, tt.udb, tt.rbac, tt.sec), rg)
+			transport.NewHTTP(user.New(nil, mock.NoopTransactor(), tt.udb, tt.rbac, tt.sec, mock.NoopPublisher()), rg)
 			ts := httptest.NewServer(r)
 			defer ts.Close()
 			path := ts.URL + "/users/" + tt.id
@@ -570,3 +743,281 @@ func TestDelete(t *testing.T) {
 		})
 	}
 }
+
+func TestListDeleted(t *testing.T) {
+	type listResponse struct {
+		Users []models.User `json:"users"`
+		Page  int           `json:"page"`
+	}
+	cases := []struct {
+		name           string
+		expectedStatus int
+		expectedResp   *listResponse
+		rbac           *mock.RBAC
+		udb            *mockstore.UserDBClient
+	}{
+		{
+			name: "Fail on RBAC",
+			rbac: &mock.RBAC{
+				EnforceRoleFn: func(context.Context, models.AccessRole) error {
+					return models.ErrForbidden
+				},
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "Success",
+			rbac: &mock.RBAC{
+				EnforceRoleFn: func(context.Context, models.AccessRole) error {
+					return nil
+				},
+			},
+			udb: &mockstore.UserDBClient{
+				ListDeletedFn: func(ctx context.Context, db *gorm.DB, p *models.Pagination) ([]models.User, *models.Page, error) {
+					return []models.User{{Base: models.Base{ID: 3, DeletedAt: mock.TestTimePtr(2001)}, Username: "gone"}}, nil, nil
+				},
+			},
+			expectedStatus: http.StatusOK,
+			expectedResp: &listResponse{
+				Users: []models.User{{Base: models.Base{ID: 3, DeletedAt: mock.TestTimePtr(2001)}, Username: "gone"}},
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := server.New(nil)
+			rg := r.Group("")
+			transport.NewHTTP(user.New(nil, mock.NoopTransactor(), tt.udb, tt.rbac, nil, mock.NoopPublisher()), rg)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+			res, err := http.Get(ts.URL + "/users/deleted")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			if tt.expectedResp != nil {
+				response := new(listResponse)
+				if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, tt.expectedResp, response)
+			}
+			assert.Equal(t, tt.expectedStatus, res.StatusCode)
+		})
+	}
+}
+
+func TestRestore(t *testing.T) {
+	cases := []struct {
+		name           string
+		id             string
+		expectedStatus int
+		expectedETag   string
+		rbac           *mock.RBAC
+		udb            *mockstore.UserDBClient
+	}{
+		{
+			name:           "Invalid request",
+			id:             `a`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Fail on taken username",
+			id:   `1`,
+			rbac: &mock.RBAC{
+				EnforceRoleFn: func(context.Context, models.AccessRole) error {
+					return nil
+				},
+			},
+			udb: &mockstore.UserDBClient{
+				RestoreFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+					return nil, store.ErrAlreadyExists
+				},
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name: "Success",
+			id:   `1`,
+			rbac: &mock.RBAC{
+				EnforceRoleFn: func(context.Context, models.AccessRole) error {
+					return nil
+				},
+			},
+			udb: &mockstore.UserDBClient{
+				RestoreFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+					return &models.User{Base: models.Base{ID: id, Version: 2}}, nil
+				},
+			},
+			expectedStatus: http.StatusOK,
+			expectedETag:   `"2"`,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := server.New(nil)
+			rg := r.Group("")
+			transport.NewHTTP(user.New(nil, mock.NoopTransactor(), tt.udb, tt.rbac, nil, mock.NoopPublisher()), rg)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+			res, err := http.Post(ts.URL+"/users/"+tt.id+"/restore", "application/json", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			assert.Equal(t, tt.expectedStatus, res.StatusCode)
+			assert.Equal(t, tt.expectedETag, res.Header.Get("ETag"))
+		})
+	}
+}
+
+func TestExport(t *testing.T) {
+	cases := []struct {
+		name                string
+		id                  string
+		expectedStatus      int
+		expectedDisposition string
+		rbac                *mock.RBAC
+		udb                 *mockstore.UserDBClient
+	}{
+		{
+			name:           "Invalid request",
+			id:             `a`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Fail on RBAC",
+			id:   `1`,
+			rbac: &mock.RBAC{
+				EnforceUserFn: func(context.Context, uint) error {
+					return models.ErrForbidden
+				},
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "Success",
+			id:   `1`,
+			rbac: &mock.RBAC{
+				EnforceUserFn: func(context.Context, uint) error {
+					return nil
+				},
+			},
+			udb: &mockstore.UserDBClient{
+				ViewUnscopedFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+					return &models.User{Base: models.Base{ID: id}, Username: "jane", Token: "refresh"}, nil
+				},
+				EventsFn: func(ctx context.Context, db *gorm.DB, id uint) ([]models.OutboxEvent, error) {
+					return []models.OutboxEvent{{ID: 1, Topic: models.EventUserCreated, AggregateID: id, Attempts: 2, LastError: "broker down"}}, nil
+				},
+			},
+			expectedStatus:      http.StatusOK,
+			expectedDisposition: `attachment; filename="user-1-export.json"`,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := server.New(nil)
+			rg := r.Group("")
+			transport.NewHTTP(user.New(nil, mock.NoopTransactor(), tt.udb, tt.rbac, nil, mock.NoopPublisher()), rg)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+			res, err := http.Get(ts.URL + "/users/" + tt.id + "/export")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			assert.Equal(t, tt.expectedStatus, res.StatusCode)
+			assert.Equal(t, tt.expectedDisposition, res.Header.Get("Content-Disposition"))
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			var exp struct {
+				Profile models.User
+				Session user.Session
+				Audit   []map[string]interface{}
+			}
+			if err := json.NewDecoder(res.Body).Decode(&exp); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "jane", exp.Profile.Username)
+			assert.True(t, exp.Session.Active)
+			if assert.Len(t, exp.Audit, 1) {
+				fields := make([]string, 0, len(exp.Audit[0]))
+				for f := range exp.Audit[0] {
+					fields = append(fields, f)
+				}
+				assert.ElementsMatch(t, []string{"type", "occurred_at", "payload"}, fields, "only the event type, time and payload should be exported")
+			}
+		})
+	}
+}
+
+func TestErase(t *testing.T) {
+	cases := []struct {
+		name           string
+		id             string
+		expectedStatus int
+		rbac           *mock.RBAC
+		udb            *mockstore.UserDBClient
+	}{
+		{
+			name:           "Invalid request",
+			id:             `a`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Fail on RBAC",
+			id:   `1`,
+			rbac: &mock.RBAC{
+				EnforceRoleFn: func(context.Context, models.AccessRole) error {
+					return models.ErrForbidden
+				},
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "Success",
+			id:   `1`,
+			rbac: &mock.RBAC{
+				EnforceRoleFn: func(context.Context, models.AccessRole) error {
+					return nil
+				},
+				IsLowerRoleFn: func(context.Context, models.AccessRole) error {
+					return nil
+				},
+			},
+			udb: &mockstore.UserDBClient{
+				ViewUnscopedFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+					return &models.User{Base: models.Base{ID: id}, Email: "jane@mail.com"}, nil
+				},
+				UpdateUnscopedFn: func(context.Context, *gorm.DB, *models.User) error {
+					return nil
+				},
+				RedactEventsFn: func(context.Context, *gorm.DB, *models.User) error {
+					return nil
+				},
+			},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := server.New(nil)
+			rg := r.Group("")
+			transport.NewHTTP(user.New(nil, mock.NoopTransactor(), tt.udb, tt.rbac, nil, mock.NoopPublisher()), rg)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+			res, err := http.Post(ts.URL+"/users/"+tt.id+"/erase", "application/json", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			assert.Equal(t, tt.expectedStatus, res.StatusCode)
+		})
+	}
+}
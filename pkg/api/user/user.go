@@ -1,9 +1,10 @@
 package user
 
 import (
+	"context"
 	"net/http"
 
-	"github.com/labstack/echo"
+	"github.com/jinzhu/gorm"
 
 	"github.com/johncoleman83/cerebrum/pkg/utl/models"
 	"github.com/johncoleman83/cerebrum/pkg/utl/query"
@@ -12,76 +13,192 @@ import (
 
 // Custom errors
 var (
-	ErrInsecurePassword = echo.NewHTTPError(http.StatusBadRequest, "insecure password")
+	ErrInsecurePassword = models.NewError(http.StatusBadRequest, "insecure_password", "insecure password")
+	ErrVersionMismatch  = models.NewError(http.StatusConflict, "stale_version", "user was modified since it was read")
 )
 
 // Create creates a new user account
-func (u *RequestHandler) Create(c echo.Context, req models.User) (*models.User, error) {
-	if err := u.rbac.AccountCreate(c, req.Role.AccessLevel, req.AccountID, req.TeamID); err != nil {
+func (u *RequestHandler) Create(ctx context.Context, req models.User) (*models.User, error) {
+	if err := u.rbac.AccountCreate(ctx, req.Role.AccessLevel, req.AccountID, req.TeamID); err != nil {
 		return nil, err
 	}
 	if ok := u.sec.Password(req.Password, req.FirstName, req.LastName, req.Username, req.Email); !ok {
 		return nil, ErrInsecurePassword
 	}
 	req.Password = u.sec.Hash(req.Password)
-	return u.udb.Create(u.db, req)
+
+	var usr *models.User
+	err := u.tx.Transaction(ctx, func(tx *gorm.DB) (err error) {
+		if usr, err = u.udb.Create(ctx, tx, req); err != nil {
+			return err
+		}
+		return u.evt.Publish(ctx, tx, models.EventUserCreated, usr.ID, createdEvent{
+			UserID:    usr.ID,
+			AccountID: usr.AccountID,
+			TeamID:    usr.TeamID,
+			RoleID:    usr.RoleID,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return usr, nil
 }
 
-// List returns list of users
-func (u *RequestHandler) List(c echo.Context, p *models.Pagination) ([]models.User, error) {
-	au := u.rbac.User(c)
+// List returns a page of the users matching the filter among the users the
+// current user may list
+func (u *RequestHandler) List(ctx context.Context, f *models.UserFilter, p *models.Pagination) ([]models.User, *models.Page, error) {
+	au := u.rbac.User(ctx)
+	if au == nil {
+		return nil, nil, models.ErrUnauthorized
+	}
 	q, err := query.List(au)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return u.udb.List(u.db, q, p)
+	return u.udb.List(ctx, u.db, q, f, p)
 }
 
 // View returns single user
-func (u *RequestHandler) View(c echo.Context, id uint) (*models.User, error) {
-	if err := u.rbac.EnforceUser(c, id); err != nil {
+func (u *RequestHandler) View(ctx context.Context, id uint) (*models.User, error) {
+	if err := u.rbac.EnforceUser(ctx, id); err != nil {
 		return nil, err
 	}
-	return u.udb.View(u.db, id)
+	return u.udb.View(ctx, u.db, id)
 }
 
 // Delete deletes a user
-func (u *RequestHandler) Delete(c echo.Context, id uint) error {
-	user, err := u.udb.View(u.db, id)
-	if err != nil {
-		return err
+func (u *RequestHandler) Delete(ctx context.Context, id uint) error {
+	return u.tx.Transaction(ctx, func(tx *gorm.DB) error {
+		user, err := u.udb.View(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := u.rbac.IsLowerRole(ctx, user.Role.AccessLevel); err != nil {
+			return err
+		}
+		if err := u.udb.Delete(ctx, tx, user); err != nil {
+			return err
+		}
+		return u.evt.Publish(ctx, tx, models.EventUserDeleted, user.ID, deletedEvent{UserID: user.ID})
+	})
+}
+
+// ListDeleted returns a page of the soft deleted users, it is restricted to admins
+func (u *RequestHandler) ListDeleted(ctx context.Context, p *models.Pagination) ([]models.User, *models.Page, error) {
+	if err := u.rbac.EnforceRole(ctx, models.AdminRole); err != nil {
+		return nil, nil, err
 	}
-	if err := u.rbac.IsLowerRole(c, user.Role.AccessLevel); err != nil {
-		return err
+	return u.udb.ListDeleted(ctx, u.db, p)
+}
+
+// Restore restores a soft deleted user, it is restricted to admins
+func (u *RequestHandler) Restore(ctx context.Context, id uint) (*models.User, error) {
+	if err := u.rbac.EnforceRole(ctx, models.AdminRole); err != nil {
+		return nil, err
+	}
+	var usr *models.User
+	err := u.tx.Transaction(ctx, func(tx *gorm.DB) (err error) {
+		if usr, err = u.udb.Restore(ctx, tx, id); err != nil {
+			return err
+		}
+		return u.evt.Publish(ctx, tx, models.EventUserRestored, usr.ID, restoredEvent{UserID: usr.ID, Version: usr.Version})
+	})
+	if err != nil {
+		return nil, err
 	}
-	return u.udb.Delete(u.db, user)
+	return usr, nil
 }
 
 // Update contains user's information used for updating
 type Update struct {
 	ID        uint
-	FirstName *string
-	LastName  *string
-	Mobile    *string
-	Phone     *string
-	Address   *string
+	FirstName *string `log:"redact"`
+	LastName  *string `log:"redact"`
+	Mobile    *string `log:"redact"`
+	Phone     *string `log:"redact"`
+	Address   *string `log:"redact"`
+
+	// Version, if set, is the version the client read, the update is
+	// rejected with ErrVersionMismatch if the user changed since
+	Version *uint `structs:"-"`
 }
 
 // Update updates user's contact information
-func (u *RequestHandler) Update(c echo.Context, req *Update) (*models.User, error) {
-	if err := u.rbac.EnforceUser(c, req.ID); err != nil {
+func (u *RequestHandler) Update(ctx context.Context, req *Update) (*models.User, error) {
+	if err := u.rbac.EnforceUser(ctx, req.ID); err != nil {
 		return nil, err
 	}
 
-	user, err := u.udb.View(u.db, req.ID)
+	var user *models.User
+	err := u.tx.Transaction(ctx, func(tx *gorm.DB) (err error) {
+		if user, err = u.udb.View(ctx, tx, req.ID); err != nil {
+			return err
+		}
+		if req.Version != nil && *req.Version != user.Version {
+			return ErrVersionMismatch
+		}
+		structs.Merge(user, req)
+		if err := u.udb.Update(ctx, tx, user); err != nil {
+			return err
+		}
+		return u.evt.Publish(ctx, tx, models.EventUserUpdated, user.ID, updatedEvent{
+			UserID:  user.ID,
+			Version: user.Version,
+			Fields:  req.fields(),
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	structs.Merge(user, req)
-	if err := u.udb.Update(u.db, user); err != nil {
-		return nil, err
+	return user, nil
+}
+
+// fields returns the json names of the fields set by req
+func (req *Update) fields() []string {
+	var fields []string
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"first_name", req.FirstName != nil},
+		{"last_name", req.LastName != nil},
+		{"mobile", req.Mobile != nil},
+		{"phone", req.Phone != nil},
+		{"address", req.Address != nil},
+	} {
+		if f.set {
+			fields = append(fields, f.name)
+		}
 	}
+	return fields
+}
 
-	return user, nil
+// createdEvent is the payload of the user created domain event, the
+// payloads of user events hold ids and the names of changed fields but
+// never personal data, as the outbox is not encrypted
+type createdEvent struct {
+	UserID    uint `json:"user_id"`
+	AccountID uint `json:"account_id"`
+	TeamID    uint `json:"team_id"`
+	RoleID    uint `json:"role_id"`
+}
+
+// updatedEvent is the payload of the user updated domain event
+type updatedEvent struct {
+	UserID  uint     `json:"user_id"`
+	Version uint     `json:"version"`
+	Fields  []string `json:"fields"`
+}
+
+// deletedEvent is the payload of the user deleted domain event
+type deletedEvent struct {
+	UserID uint `json:"user_id"`
+}
+
+// restoredEvent is the payload of the user restored domain event
+type restoredEvent struct {
+	UserID  uint `json:"user_id"`
+	Version uint `json:"version"`
 }
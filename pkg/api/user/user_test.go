@@ -1,10 +1,11 @@
 package user_test
 
 import (
+	"context"
+	"encoding/json"
 	"testing"
 
 	"github.com/jinzhu/gorm"
-	"github.com/labstack/echo"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/johncoleman83/cerebrum/pkg/api/user"
@@ -15,7 +16,6 @@ import (
 
 func TestCreate(t *testing.T) {
 	type args struct {
-		c   echo.Context
 		req models.User
 	}
 	cases := []struct {
@@ -26,6 +26,7 @@ func TestCreate(t *testing.T) {
 		udb          *mockstore.UserDBClient
 		rbac         *mock.RBAC
 		sec          *mock.Secure
+		evt          *mock.Publisher
 	}{
 		{
 			name: "Fail on is lower role",
@@ -38,7 +39,7 @@ func TestCreate(t *testing.T) {
 				Email:     "byoung@gmail.com",
 			}},
 			rbac: &mock.RBAC{
-				AccountCreateFn: func(echo.Context, models.AccessRole, uint, uint) error {
+				AccountCreateFn: func(context.Context, models.AccessRole, uint, uint) error {
 					return models.ErrGeneric
 				},
 			},
@@ -63,7 +64,7 @@ func TestCreate(t *testing.T) {
 				Email:     "tinaturner@gmail.com",
 			}},
 			rbac: &mock.RBAC{
-				AccountCreateFn: func(echo.Context, models.AccessRole, uint, uint) error {
+				AccountCreateFn: func(context.Context, models.AccessRole, uint, uint) error {
 					return nil
 				},
 			},
@@ -77,6 +78,41 @@ func TestCreate(t *testing.T) {
 			},
 			expectedErr: true,
 		},
+		{
+			name: "Fail on publishing created event",
+			args: args{req: models.User{
+				FirstName: "Grace",
+				LastName:  "Hopper",
+				Username:  "GraceHopper",
+				RoleID:    1,
+				Password:  "Thranduil8822",
+				Email:     "ghopper@gmail.com",
+			}},
+			udb: &mockstore.UserDBClient{
+				CreateFn: func(ctx context.Context, db *gorm.DB, u models.User) (*models.User, error) {
+					u.Base.ID = 1
+					return &u, nil
+				},
+			},
+			rbac: &mock.RBAC{
+				AccountCreateFn: func(context.Context, models.AccessRole, uint, uint) error {
+					return nil
+				}},
+			sec: &mock.Secure{
+				HashFn: func(string) string {
+					return "h4$h3d"
+				},
+				PasswordFn: func(string, ...string) bool {
+					return true
+				},
+			},
+			evt: &mock.Publisher{
+				PublishFn: func(ctx context.Context, db *gorm.DB, topic string, id uint, payload interface{}) error {
+					return models.ErrGeneric
+				},
+			},
+			expectedErr: true,
+		},
 		{
 			name: "Success",
 			args: args{req: models.User{
@@ -88,7 +124,7 @@ func TestCreate(t *testing.T) {
 				Email:     "owinfrey@gmail.com",
 			}},
 			udb: &mockstore.UserDBClient{
-				CreateFn: func(db *gorm.DB, u models.User) (*models.User, error) {
+				CreateFn: func(ctx context.Context, db *gorm.DB, u models.User) (*models.User, error) {
 					u.CreatedAt = mock.TestTime(2000)
 					u.UpdatedAt = mock.TestTime(2000)
 					u.Base.ID = 1
@@ -96,7 +132,7 @@ func TestCreate(t *testing.T) {
 				},
 			},
 			rbac: &mock.RBAC{
-				AccountCreateFn: func(echo.Context, models.AccessRole, uint, uint) error {
+				AccountCreateFn: func(context.Context, models.AccessRole, uint, uint) error {
 					return nil
 				}},
 			sec: &mock.Secure{
@@ -122,8 +158,12 @@ func TestCreate(t *testing.T) {
 			}}}
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			s := user.New(nil, tt.udb, tt.rbac, tt.sec)
-			usr, err := s.Create(tt.args.c, tt.args.req)
+			evt := tt.evt
+			if evt == nil {
+				evt = mock.NoopPublisher()
+			}
+			s := user.New(nil, mock.NoopTransactor(), tt.udb, tt.rbac, tt.sec, evt)
+			usr, err := s.Create(context.Background(), tt.args.req)
 			assert.Equal(t, tt.expectedErr, err != nil)
 			assert.Equal(t, tt.expectedData, usr)
 		})
@@ -132,7 +172,6 @@ func TestCreate(t *testing.T) {
 
 func TestView(t *testing.T) {
 	type args struct {
-		c  echo.Context
 		id uint
 	}
 	cases := []struct {
@@ -147,7 +186,7 @@ func TestView(t *testing.T) {
 			name: "Fail on RBAC",
 			args: args{id: 5},
 			rbac: &mock.RBAC{
-				EnforceUserFn: func(c echo.Context, id uint) error {
+				EnforceUserFn: func(ctx context.Context, id uint) error {
 					return models.ErrGeneric
 				}},
 			expectedErr: models.ErrGeneric,
@@ -166,11 +205,11 @@ func TestView(t *testing.T) {
 				Username:  "WilliamFaukner",
 			},
 			rbac: &mock.RBAC{
-				EnforceUserFn: func(c echo.Context, id uint) error {
+				EnforceUserFn: func(ctx context.Context, id uint) error {
 					return nil
 				}},
 			udb: &mockstore.UserDBClient{
-				ViewFn: func(db *gorm.DB, id uint) (*models.User, error) {
+				ViewFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
 					if id == 1 {
 						return &models.User{
 							Base: models.Base{
@@ -189,8 +228,8 @@ func TestView(t *testing.T) {
 	}
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			s := user.New(nil, tt.udb, tt.rbac, nil)
-			usr, err := s.View(tt.args.c, tt.args.id)
+			s := user.New(nil, mock.NoopTransactor(), tt.udb, tt.rbac, nil, mock.NoopPublisher())
+			usr, err := s.View(context.Background(), tt.args.id)
 			assert.Equal(t, tt.expectedData, usr)
 			assert.Equal(t, tt.expectedErr, err)
 		})
@@ -199,7 +238,6 @@ func TestView(t *testing.T) {
 
 func TestList(t *testing.T) {
 	type args struct {
-		c   echo.Context
 		pgn *models.Pagination
 	}
 	cases := []struct {
@@ -212,13 +250,13 @@ func TestList(t *testing.T) {
 	}{
 		{
 			name: "Fail on query List",
-			args: args{c: nil, pgn: &models.Pagination{
+			args: args{pgn: &models.Pagination{
 				Limit:  100,
 				Offset: 200,
 			}},
 			expectedErr: true,
 			rbac: &mock.RBAC{
-				UserFn: func(c echo.Context) *models.AuthUser {
+				UserFn: func(ctx context.Context) *models.AuthUser {
 					return &models.AuthUser{
 						ID:          1,
 						AccountID:   2,
@@ -228,12 +266,12 @@ func TestList(t *testing.T) {
 				}}},
 		{
 			name: "Success",
-			args: args{c: nil, pgn: &models.Pagination{
+			args: args{pgn: &models.Pagination{
 				Limit:  100,
 				Offset: 200,
 			}},
 			rbac: &mock.RBAC{
-				UserFn: func(c echo.Context) *models.AuthUser {
+				UserFn: func(ctx context.Context) *models.AuthUser {
 					return &models.AuthUser{
 						ID:          1,
 						AccountID:   2,
@@ -242,7 +280,7 @@ func TestList(t *testing.T) {
 					}
 				}},
 			udb: &mockstore.UserDBClient{
-				ListFn: func(*gorm.DB, *models.ListQuery, *models.Pagination) ([]models.User, error) {
+				ListFn: func(context.Context, *gorm.DB, *models.ListQuery, *models.UserFilter, *models.Pagination) ([]models.User, *models.Page, error) {
 					return []models.User{
 						{
 							Base: models.Base{
@@ -266,7 +304,7 @@ func TestList(t *testing.T) {
 							Email:     "Prestonphelps@aol.com",
 							Username:  "Prestonphelps",
 						},
-					}, nil
+					}, nil, nil
 				}},
 			expectedData: []models.User{
 				{
@@ -296,8 +334,8 @@ func TestList(t *testing.T) {
 	}
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			s := user.New(nil, tt.udb, tt.rbac, nil)
-			usrs, err := s.List(tt.args.c, tt.args.pgn)
+			s := user.New(nil, mock.NoopTransactor(), tt.udb, tt.rbac, nil, mock.NoopPublisher())
+			usrs, _, err := s.List(context.Background(), nil, tt.args.pgn)
 			assert.Equal(t, tt.expectedData, usrs)
 			assert.Equal(t, tt.expectedErr, err != nil)
 		})
@@ -307,7 +345,6 @@ func TestList(t *testing.T) {
 
 func TestDelete(t *testing.T) {
 	type args struct {
-		c  echo.Context
 		id uint
 	}
 	cases := []struct {
@@ -322,7 +359,7 @@ func TestDelete(t *testing.T) {
 			args:        args{id: 1},
 			expectedErr: models.ErrGeneric,
 			udb: &mockstore.UserDBClient{
-				ViewFn: func(db *gorm.DB, id uint) (*models.User, error) {
+				ViewFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
 					if id != 1 {
 						return nil, nil
 					}
@@ -334,7 +371,7 @@ func TestDelete(t *testing.T) {
 			name: "Fail on RBAC",
 			args: args{id: 1},
 			udb: &mockstore.UserDBClient{
-				ViewFn: func(db *gorm.DB, id uint) (*models.User, error) {
+				ViewFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
 					return &models.User{
 						Base: models.Base{
 							ID:        id,
@@ -350,7 +387,7 @@ func TestDelete(t *testing.T) {
 				},
 			},
 			rbac: &mock.RBAC{
-				IsLowerRoleFn: func(echo.Context, models.AccessRole) error {
+				IsLowerRoleFn: func(context.Context, models.AccessRole) error {
 					return models.ErrGeneric
 				}},
 			expectedErr: models.ErrGeneric,
@@ -359,7 +396,7 @@ func TestDelete(t *testing.T) {
 			name: "Success",
 			args: args{id: 1},
 			udb: &mockstore.UserDBClient{
-				ViewFn: func(db *gorm.DB, id uint) (*models.User, error) {
+				ViewFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
 					return &models.User{
 						Base: models.Base{
 							ID:        id,
@@ -375,20 +412,20 @@ func TestDelete(t *testing.T) {
 						},
 					}, nil
 				},
-				DeleteFn: func(db *gorm.DB, usr *models.User) error {
+				DeleteFn: func(ctx context.Context, db *gorm.DB, usr *models.User) error {
 					return nil
 				},
 			},
 			rbac: &mock.RBAC{
-				IsLowerRoleFn: func(echo.Context, models.AccessRole) error {
+				IsLowerRoleFn: func(context.Context, models.AccessRole) error {
 					return nil
 				}},
 		},
 	}
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			s := user.New(nil, tt.udb, tt.rbac, nil)
-			err := s.Delete(tt.args.c, tt.args.id)
+			s := user.New(nil, mock.NoopTransactor(), tt.udb, tt.rbac, nil, mock.NoopPublisher())
+			err := s.Delete(context.Background(), tt.args.id)
 			if err != tt.expectedErr {
 				t.Errorf("Expected error %v, received %v", tt.expectedErr, err)
 			}
@@ -396,9 +433,117 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+func TestListDeleted(t *testing.T) {
+	cases := []struct {
+		name         string
+		expectedData []models.User
+		expectedErr  error
+		udb          *mockstore.UserDBClient
+		rbac         *mock.RBAC
+	}{
+		{
+			name: "Fail on RBAC",
+			rbac: &mock.RBAC{
+				EnforceRoleFn: func(context.Context, models.AccessRole) error {
+					return models.ErrGeneric
+				}},
+			expectedErr: models.ErrGeneric,
+		},
+		{
+			name: "Success",
+			rbac: &mock.RBAC{
+				EnforceRoleFn: func(ctx context.Context, role models.AccessRole) error {
+					if role != models.AdminRole {
+						return models.ErrGeneric
+					}
+					return nil
+				}},
+			udb: &mockstore.UserDBClient{
+				ListDeletedFn: func(ctx context.Context, db *gorm.DB, p *models.Pagination) ([]models.User, *models.Page, error) {
+					return []models.User{{Base: models.Base{ID: 4, DeletedAt: mock.TestTimePtr(2001)}}}, nil, nil
+				},
+			},
+			expectedData: []models.User{{Base: models.Base{ID: 4, DeletedAt: mock.TestTimePtr(2001)}}},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			s := user.New(nil, mock.NoopTransactor(), tt.udb, tt.rbac, nil, mock.NoopPublisher())
+			users, _, err := s.ListDeleted(context.Background(), &models.Pagination{Limit: 10})
+			assert.Equal(t, tt.expectedData, users)
+			assert.Equal(t, tt.expectedErr, err)
+		})
+	}
+}
+
+func TestRestore(t *testing.T) {
+	cases := []struct {
+		name         string
+		expectedData *models.User
+		expectedErr  error
+		expectedEvt  string
+		udb          *mockstore.UserDBClient
+		rbac         *mock.RBAC
+	}{
+		{
+			name: "Fail on RBAC",
+			rbac: &mock.RBAC{
+				EnforceRoleFn: func(context.Context, models.AccessRole) error {
+					return models.ErrGeneric
+				}},
+			expectedErr: models.ErrGeneric,
+		},
+		{
+			name: "Fail on Restore",
+			rbac: &mock.RBAC{
+				EnforceRoleFn: func(context.Context, models.AccessRole) error {
+					return nil
+				}},
+			udb: &mockstore.UserDBClient{
+				RestoreFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+					return nil, models.ErrGeneric
+				},
+			},
+			expectedErr: models.ErrGeneric,
+		},
+		{
+			name: "Success",
+			rbac: &mock.RBAC{
+				EnforceRoleFn: func(context.Context, models.AccessRole) error {
+					return nil
+				}},
+			udb: &mockstore.UserDBClient{
+				RestoreFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+					return &models.User{Base: models.Base{ID: id, Version: 2}, Username: "jane", Email: "jane@mail.com"}, nil
+				},
+			},
+			expectedData: &models.User{Base: models.Base{ID: 7, Version: 2}, Username: "jane", Email: "jane@mail.com"},
+			expectedEvt:  `{"user_id":7,"version":2}`,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var evt string
+			pub := &mock.Publisher{
+				PublishFn: func(ctx context.Context, db *gorm.DB, topic string, id uint, payload interface{}) error {
+					data, err := json.Marshal(payload)
+					evt = string(data)
+					return err
+				},
+			}
+			s := user.New(nil, mock.NoopTransactor(), tt.udb, tt.rbac, nil, pub)
+			usr, err := s.Restore(context.Background(), 7)
+			assert.Equal(t, tt.expectedData, usr)
+			assert.Equal(t, tt.expectedErr, err)
+			if tt.expectedEvt != "" {
+				assert.JSONEq(t, tt.expectedEvt, evt, "the event should not carry personal data")
+			}
+		})
+	}
+}
+
 func TestUpdate(t *testing.T) {
 	type args struct {
-		c   echo.Context
 		upd *user.Update
 	}
 	cases := []struct {
@@ -415,7 +560,7 @@ func TestUpdate(t *testing.T) {
 				ID: 1,
 			}},
 			rbac: &mock.RBAC{
-				EnforceUserFn: func(c echo.Context, id uint) error {
+				EnforceUserFn: func(ctx context.Context, id uint) error {
 					return models.ErrGeneric
 				}},
 			expectedErr: models.ErrGeneric,
@@ -426,12 +571,12 @@ func TestUpdate(t *testing.T) {
 				ID: 1,
 			}},
 			rbac: &mock.RBAC{
-				EnforceUserFn: func(c echo.Context, id uint) error {
+				EnforceUserFn: func(ctx context.Context, id uint) error {
 					return nil
 				}},
 			expectedErr: models.ErrGeneric,
 			udb: &mockstore.UserDBClient{
-				ViewFn: func(db *gorm.DB, id uint) (*models.User, error) {
+				ViewFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
 					if id != 1 {
 						return nil, nil
 					}
@@ -439,18 +584,35 @@ func TestUpdate(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Fail on version mismatch",
+			args: args{upd: &user.Update{
+				ID:      1,
+				Version: func(v uint) *uint { return &v }(2),
+			}},
+			rbac: &mock.RBAC{
+				EnforceUserFn: func(ctx context.Context, id uint) error {
+					return nil
+				}},
+			expectedErr: user.ErrVersionMismatch,
+			udb: &mockstore.UserDBClient{
+				ViewFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+					return &models.User{Base: models.Base{ID: 1, Version: 3}}, nil
+				},
+			},
+		},
 		{
 			name: "Fail on Update",
 			args: args{upd: &user.Update{
 				ID: 1,
 			}},
 			rbac: &mock.RBAC{
-				EnforceUserFn: func(c echo.Context, id uint) error {
+				EnforceUserFn: func(ctx context.Context, id uint) error {
 					return nil
 				}},
 			expectedErr: models.ErrGeneric,
 			udb: &mockstore.UserDBClient{
-				ViewFn: func(db *gorm.DB, id uint) (*models.User, error) {
+				ViewFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
 					return &models.User{
 						Base: models.Base{
 							ID:        1,
@@ -468,7 +630,7 @@ func TestUpdate(t *testing.T) {
 						Email:     "golang@go.org",
 					}, nil
 				},
-				UpdateFn: func(db *gorm.DB, usr *models.User) error {
+				UpdateFn: func(ctx context.Context, db *gorm.DB, usr *models.User) error {
 					return models.ErrGeneric
 				},
 			},
@@ -483,7 +645,7 @@ func TestUpdate(t *testing.T) {
 				Phone:     mock.Str2Ptr("234567"),
 			}},
 			rbac: &mock.RBAC{
-				EnforceUserFn: func(c echo.Context, id uint) error {
+				EnforceUserFn: func(ctx context.Context, id uint) error {
 					return nil
 				}},
 			expectedData: &models.User{
@@ -503,7 +665,7 @@ func TestUpdate(t *testing.T) {
 				Email:     "golang@go.org",
 			},
 			udb: &mockstore.UserDBClient{
-				ViewFn: func(db *gorm.DB, id uint) (*models.User, error) {
+				ViewFn: func(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
 					return &models.User{
 						Base: models.Base{
 							ID:        1,
@@ -521,7 +683,7 @@ func TestUpdate(t *testing.T) {
 						Email:     "golang@go.org",
 					}, nil
 				},
-				UpdateFn: func(db *gorm.DB, usr *models.User) error {
+				UpdateFn: func(ctx context.Context, db *gorm.DB, usr *models.User) error {
 					usr.UpdatedAt = mock.TestTime(2000)
 					return nil
 				},
@@ -530,8 +692,8 @@ func TestUpdate(t *testing.T) {
 	}
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			s := user.New(nil, tt.udb, tt.rbac, nil)
-			usr, err := s.Update(tt.args.c, tt.args.upd)
+			s := user.New(nil, mock.NoopTransactor(), tt.udb, tt.rbac, nil, mock.NoopPublisher())
+			usr, err := s.Update(context.Background(), tt.args.upd)
 			assert.Equal(t, tt.expectedData, usr)
 			assert.Equal(t, tt.expectedErr, err)
 		})
@@ -539,7 +701,7 @@ func TestUpdate(t *testing.T) {
 }
 
 func TestInitialize(t *testing.T) {
-	u := user.Initialize(nil, nil, nil)
+	u := user.Initialize(nil, nil, nil, nil, nil)
 	if u == nil {
 		t.Error("User service not initialized")
 	}
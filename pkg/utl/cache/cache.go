@@ -0,0 +1,63 @@
+// Package cache contains the caches of hot lookups. Values are opaque bytes
+// kept for a time to live, either in an in-process LRU or in Redis, which is
+// shared between the api instances.
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+)
+
+// Cache drivers
+const (
+	DriverMemory = "memory"
+	DriverRedis  = "redis"
+)
+
+const (
+	defaultTTL  = time.Minute
+	defaultSize = 10000
+)
+
+// Cache stores values by key for a limited time. Callers must tolerate
+// errors by falling back to the source of the values.
+type Cache interface {
+	// Get returns the value of key, ok is false if it is missing or expired
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// New returns the cache configured by cfg, metered, and the ttl of its
+// entries. The cache is a nil interface when caching is disabled.
+func New(cfg *config.Cache) (Cache, time.Duration, error) {
+	if cfg == nil || cfg.Driver == "" {
+		return nil, 0, nil
+	}
+	ttl := defaultTTL
+	if cfg.TTL > 0 {
+		ttl = time.Duration(cfg.TTL) * time.Second
+	}
+	switch cfg.Driver {
+	case DriverMemory:
+		size := defaultSize
+		if cfg.Size > 0 {
+			size = cfg.Size
+		}
+		return NewMetered(NewLRU(size)), ttl, nil
+	case DriverRedis:
+		client := redis.NewClient(&redis.Options{
+			Addr:     cfg.RedisAddr,
+			Password: cfg.RedisPassword,
+			DB:       cfg.RedisDB,
+			PoolSize: cfg.RedisPoolSize,
+		})
+		return NewMetered(NewRedis(client, cfg.KeyPrefix)), ttl, nil
+	}
+	return nil, 0, fmt.Errorf("cache: unknown driver %q", cfg.Driver)
+}
@@ -0,0 +1,54 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/cache"
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+	"github.com/johncoleman83/cerebrum/pkg/utl/mock"
+)
+
+func TestNew(t *testing.T) {
+	cases := []struct {
+		name        string
+		cfg         *config.Cache
+		expectedTTL time.Duration
+		expectedNil bool
+		expectedErr bool
+	}{
+		{name: "Disabled without config", expectedNil: true},
+		{name: "Disabled without driver", cfg: &config.Cache{TTL: 10}, expectedNil: true},
+		{name: "Fail on unknown driver", cfg: &config.Cache{Driver: "memcached"}, expectedNil: true, expectedErr: true},
+		{name: "Success with memory", cfg: &config.Cache{Driver: "memory"}, expectedTTL: time.Minute},
+		{name: "Success with redis", cfg: &config.Cache{Driver: "redis", RedisAddr: "localhost:6379", TTL: 30}, expectedTTL: 30 * time.Second},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			c, ttl, err := cache.New(tt.cfg)
+			assert.Equal(t, tt.expectedErr, err != nil)
+			assert.Equal(t, tt.expectedNil, c == nil)
+			assert.Equal(t, tt.expectedTTL, ttl)
+		})
+	}
+}
+
+func TestMetered(t *testing.T) {
+	ctx := context.Background()
+	r := mock.NewRedis()
+	c := cache.NewMetered(cache.NewRedis(r, ""))
+
+	_, _, _ = c.Get(ctx, "a")
+	assert.Nil(t, c.Set(ctx, "a", []byte("1"), time.Minute))
+	_, _, _ = c.Get(ctx, "a")
+	_, _, _ = c.Get(ctx, "a")
+	r.Err = errors.New("connection refused")
+	_, _, _ = c.Get(ctx, "a")
+	_ = c.Set(ctx, "a", []byte("1"), time.Minute)
+
+	assert.Equal(t, cache.Stats{Hits: 2, Misses: 1, Errors: 2}, c.Stats())
+}
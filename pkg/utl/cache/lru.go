@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LRU is an in-process cache which evicts the least recently used entries
+// once it holds size entries, expired entries are dropped when read
+type LRU struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewLRU creates a new LRU cache of size entries
+func NewLRU(size int) *LRU {
+	return &LRU{size: size, order: list.New(), entries: make(map[string]*list.Element, size)}
+}
+
+// Get returns a copy of the value of key
+func (l *LRU) Get(_ context.Context, key string) ([]byte, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	el, ok := l.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	e := el.Value.(*lruEntry)
+	if !time.Now().Before(e.expires) {
+		l.remove(el)
+		return nil, false, nil
+	}
+	l.order.MoveToFront(el)
+	return append([]byte(nil), e.value...), true, nil
+}
+
+// Set stores a copy of value for key until ttl elapses
+func (l *LRU) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e := &lruEntry{key: key, value: append([]byte(nil), value...), expires: time.Now().Add(ttl)}
+	if el, ok := l.entries[key]; ok {
+		el.Value = e
+		l.order.MoveToFront(el)
+		return nil
+	}
+	l.entries[key] = l.order.PushFront(e)
+	for l.order.Len() > l.size {
+		l.remove(l.order.Back())
+	}
+	return nil
+}
+
+// Delete removes keys
+func (l *LRU) Delete(_ context.Context, keys ...string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := l.entries[key]; ok {
+			l.remove(el)
+		}
+	}
+	return nil
+}
+
+// Len returns the number of entries, including expired ones not read since
+func (l *LRU) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
+
+func (l *LRU) remove(el *list.Element) {
+	l.order.Remove(el)
+	delete(l.entries, el.Value.(*lruEntry).key)
+}
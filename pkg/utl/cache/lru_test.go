@@ -0,0 +1,55 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/cache"
+)
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewLRU(2)
+
+	_, ok, err := c.Get(ctx, "a")
+	assert.Nil(t, err)
+	assert.False(t, ok, "missing keys should miss")
+
+	value := []byte("1")
+	assert.Nil(t, c.Set(ctx, "a", value, time.Minute))
+	value[0] = 'x'
+	got, ok, err := c.Get(ctx, "a")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), got, "values should be copied in")
+	got[0] = 'y'
+	got, _, _ = c.Get(ctx, "a")
+	assert.Equal(t, []byte("1"), got, "values should be copied out")
+
+	assert.Nil(t, c.Set(ctx, "b", []byte("2"), time.Minute))
+	_, _, _ = c.Get(ctx, "a")
+	assert.Nil(t, c.Set(ctx, "c", []byte("3"), time.Minute))
+	assert.Equal(t, 2, c.Len())
+	_, ok, _ = c.Get(ctx, "b")
+	assert.False(t, ok, "the least recently used key should be evicted")
+	_, ok, _ = c.Get(ctx, "a")
+	assert.True(t, ok, "recently used keys should be kept")
+
+	assert.Nil(t, c.Set(ctx, "a", []byte("4"), time.Minute))
+	got, _, _ = c.Get(ctx, "a")
+	assert.Equal(t, []byte("4"), got, "values should be replaced")
+	assert.Equal(t, 2, c.Len())
+
+	assert.Nil(t, c.Delete(ctx, "a", "missing"))
+	_, ok, _ = c.Get(ctx, "a")
+	assert.False(t, ok, "deleted keys should miss")
+
+	assert.Nil(t, c.Set(ctx, "d", []byte("5"), time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	_, ok, _ = c.Get(ctx, "d")
+	assert.False(t, ok, "expired keys should miss")
+	assert.Equal(t, 1, c.Len(), "expired keys should be dropped once read")
+}
@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Stats holds the number of lookups of a cache by outcome
+type Stats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Errors uint64 `json:"errors"`
+}
+
+// Metered is a cache which counts the hits and misses of another cache
+type Metered struct {
+	Cache
+	hits, misses, errors uint64
+}
+
+// NewMetered wraps c with lookup counters
+func NewMetered(c Cache) *Metered {
+	return &Metered{Cache: c}
+}
+
+// Get returns the value of key and counts the lookup, failed lookups are
+// counted as errors and not as misses
+func (m *Metered) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, ok, err := m.Cache.Get(ctx, key)
+	switch {
+	case err != nil:
+		atomic.AddUint64(&m.errors, 1)
+	case ok:
+		atomic.AddUint64(&m.hits, 1)
+	default:
+		atomic.AddUint64(&m.misses, 1)
+	}
+	return value, ok, err
+}
+
+// Set stores value for key and counts failures
+func (m *Metered) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	err := m.Cache.Set(ctx, key, value, ttl)
+	if err != nil {
+		atomic.AddUint64(&m.errors, 1)
+	}
+	return err
+}
+
+// Stats returns the counters since the cache was created
+func (m *Metered) Stats() Stats {
+	return Stats{
+		Hits:   atomic.LoadUint64(&m.hits),
+		Misses: atomic.LoadUint64(&m.misses),
+		Errors: atomic.LoadUint64(&m.errors),
+	}
+}
@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// RedisClient represents the redis commands used by the cache, it is
+// implemented by the clients of github.com/go-redis/redis
+type RedisClient interface {
+	Get(key string) *redis.StringCmd
+	Set(key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	Del(keys ...string) *redis.IntCmd
+}
+
+// Redis is a cache shared by the api instances, its keys are prefixed so
+// that the redis database may be shared with other applications
+type Redis struct {
+	client RedisClient
+	prefix string
+}
+
+// NewRedis creates a new redis cache
+func NewRedis(c RedisClient, prefix string) *Redis {
+	return &Redis{client: c, prefix: prefix}
+}
+
+// Get returns the value of key
+func (r *Redis) Get(_ context.Context, key string) ([]byte, bool, error) {
+	value, err := r.client.Get(r.prefix + key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set stores value for key until ttl elapses
+func (r *Redis) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(r.prefix+key, value, ttl).Err()
+}
+
+// Delete removes keys
+func (r *Redis) Delete(_ context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = r.prefix + key
+	}
+	return r.client.Del(prefixed...).Err()
+}
@@ -0,0 +1,47 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/cache"
+	"github.com/johncoleman83/cerebrum/pkg/utl/mock"
+)
+
+func TestRedis(t *testing.T) {
+	ctx := context.Background()
+	r := mock.NewRedis()
+	c := cache.NewRedis(r, "cerebrum:")
+
+	_, ok, err := c.Get(ctx, "a")
+	assert.Nil(t, err)
+	assert.False(t, ok, "missing keys should miss")
+
+	assert.Nil(t, c.Set(ctx, "a", []byte("1"), time.Minute))
+	assert.Equal(t, []string{"cerebrum:a"}, r.Keys(), "keys should be prefixed")
+	got, ok, err := c.Get(ctx, "a")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), got)
+
+	assert.Nil(t, c.Delete(ctx))
+	assert.Nil(t, c.Delete(ctx, "a", "b"))
+	_, ok, _ = c.Get(ctx, "a")
+	assert.False(t, ok, "deleted keys should miss")
+
+	assert.Nil(t, c.Set(ctx, "d", []byte("5"), time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	_, ok, _ = c.Get(ctx, "d")
+	assert.False(t, ok, "expired keys should miss")
+
+	r.Err = errors.New("connection refused")
+	_, ok, err = c.Get(ctx, "a")
+	assert.False(t, ok)
+	assert.NotNil(t, err, "redis errors should not be reported as misses")
+	assert.NotNil(t, c.Set(ctx, "a", []byte("1"), time.Minute))
+	assert.NotNil(t, c.Delete(ctx, "a"))
+}
@@ -14,6 +14,16 @@ type Configuration struct {
 	DB     *Database    `yaml:"database,omitempty"`
 	JWT    *JWT         `yaml:"jwt,omitempty"`
 	App    *Application `yaml:"application,omitempty"`
+	Events *Events      `yaml:"events,omitempty"`
+	Trash  *Trash       `yaml:"trash,omitempty"`
+
+	Encryption *Encryption `yaml:"encryption,omitempty"`
+	Cache      *Cache      `yaml:"cache,omitempty"`
+	Tracing    *Tracing    `yaml:"tracing,omitempty"`
+	Logging    *Logging    `yaml:"logging,omitempty"`
+	RateLimit  *RateLimit  `yaml:"rate_limit,omitempty"`
+
+	Idempotency *Idempotency `yaml:"idempotency,omitempty"`
 }
 
 // Database holds data necessery for database configuration
@@ -26,6 +36,32 @@ type Database struct {
 	Host     string `yaml:"host,omitempty"`
 	Port     string `yaml:"port,omitempty"`
 	Settings string `yaml:"settings,omitempty"`
+
+	QueryTimeout      int            `yaml:"query_timeout_milliseconds,omitempty"`
+	OperationTimeouts map[string]int `yaml:"operation_timeouts_milliseconds,omitempty"`
+
+	TransactionRetries int `yaml:"transaction_retries,omitempty"`
+	TransactionBackoff int `yaml:"transaction_backoff_milliseconds,omitempty"`
+
+	MaxOpenConns       int    `yaml:"max_open_connections,omitempty"`
+	MaxIdleConns       int    `yaml:"max_idle_connections,omitempty"`
+	ConnMaxLifetime    int    `yaml:"connection_max_lifetime_seconds,omitempty"`
+	SlowQueryThreshold int    `yaml:"slow_query_threshold_milliseconds,omitempty"`
+	LogLevel           string `yaml:"log_level,omitempty"`
+
+	Replicas             []*Replica `yaml:"replicas,omitempty"`
+	ReplicaCheckInterval int        `yaml:"replica_check_interval_seconds,omitempty"`
+	ReplicaMaxLag        int        `yaml:"replica_max_lag_seconds,omitempty"`
+}
+
+// Replica holds data necessery for connecting to a read replica of the
+// database, the fields which are not set are those of the primary
+type Replica struct {
+	User     string `yaml:"user,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	Name     string `yaml:"name,omitempty"`
+	Host     string `yaml:"host,omitempty"`
+	Port     string `yaml:"port,omitempty"`
 }
 
 // Server holds data necessery for server configuration
@@ -34,6 +70,14 @@ type Server struct {
 	Debug        bool   `yaml:"debug,omitempty"`
 	ReadTimeout  int    `yaml:"read_timeout_seconds,omitempty"`
 	WriteTimeout int    `yaml:"write_timeout_seconds,omitempty"`
+
+	ProbeTimeout  int `yaml:"probe_timeout_milliseconds,omitempty"`
+	ShutdownDrain int `yaml:"shutdown_drain_seconds,omitempty"`
+
+	// HealthToken, if set, authorizes the requests to /health which are
+	// sent the internal health reports, and the requests to /metrics which
+	// is not served otherwise
+	HealthToken string `yaml:"health_token,omitempty"`
 }
 
 // JWT holds data necessery for JWT configuration
@@ -51,6 +95,107 @@ type Application struct {
 	SwaggerUIPath  string `yaml:"swagger_ui_path,omitempty"`
 }
 
+// Events holds data necessery for the domain event outbox dispatcher
+type Events struct {
+	DispatchInterval int `yaml:"dispatch_interval_milliseconds,omitempty"`
+	BatchSize        int `yaml:"batch_size,omitempty"`
+	MaxAttempts      int `yaml:"max_attempts,omitempty"`
+	Lease            int `yaml:"lease_seconds,omitempty"`
+}
+
+// Trash holds data necessery for purging soft deleted records
+type Trash struct {
+	RetentionDays int `yaml:"retention_days,omitempty"`
+	PurgeInterval int `yaml:"purge_interval_minutes,omitempty"`
+	BatchSize     int `yaml:"batch_size,omitempty"`
+}
+
+// Encryption holds the keys used to encrypt personal data at rest, keys are
+// base64 encoded 256 bit keys by key id. Keys may also be read from a
+// KeyFile holding the same fields, so that they are kept out of the config.
+type Encryption struct {
+	ActiveKey     string            `yaml:"active_key,omitempty"`
+	Keys          map[string]string `yaml:"keys,omitempty"`
+	BlindIndexKey string            `yaml:"blind_index_key,omitempty"`
+	KeyFile       string            `yaml:"key_file,omitempty"`
+}
+
+// Cache holds data necessery for caching hot lookups, Driver is memory for
+// an in-process LRU of Size entries or redis, caching is disabled without it
+type Cache struct {
+	Driver        string `yaml:"driver,omitempty"`
+	TTL           int    `yaml:"ttl_seconds,omitempty"`
+	Size          int    `yaml:"size,omitempty"`
+	KeyPrefix     string `yaml:"key_prefix,omitempty"`
+	RedisAddr     string `yaml:"redis_addr,omitempty"`
+	RedisPassword string `yaml:"redis_password,omitempty"`
+	RedisDB       int    `yaml:"redis_db,omitempty"`
+	RedisPoolSize int    `yaml:"redis_pool_size,omitempty"`
+}
+
+// Tracing holds data necessery for tracing requests, Exporter is otlp for
+// an OpenTelemetry collector at Endpoint or stdout, tracing is disabled
+// without it. SampleRatio is the fraction of traces sampled, all by default.
+type Tracing struct {
+	Exporter    string            `yaml:"exporter,omitempty"`
+	Endpoint    string            `yaml:"endpoint,omitempty"`
+	Headers     map[string]string `yaml:"headers,omitempty"`
+	ServiceName string            `yaml:"service_name,omitempty"`
+	SampleRatio float64           `yaml:"sample_ratio,omitempty"`
+	Timeout     int               `yaml:"timeout_milliseconds,omitempty"`
+}
+
+// Logging holds data necessery for the service and access logs, Level is
+// the minimum level logged, Format is json or console and Output is stdout,
+// stderr or the path of a file the logs are appended to. Levels overrides
+// Level by source, such as user or access, and Sampling logs one in every N
+// successes of a source, failures are always logged. Redact lists the paths
+// of the params logged redacted, such as resp.email, see zlog.
+type Logging struct {
+	Level  string `yaml:"level,omitempty"`
+	Format string `yaml:"format,omitempty"`
+	Output string `yaml:"output,omitempty"`
+
+	Levels   map[string]string `yaml:"levels,omitempty"`
+	Sampling map[string]int    `yaml:"sampling,omitempty"`
+	Redact   []string          `yaml:"redact,omitempty"`
+}
+
+// RateLimit holds data necessery for rate limiting clients with token
+// buckets, Store is memory or redis, whose buckets are shared by the api
+// instances, limiting is disabled without it. Groups are the limits of the
+// route groups by name, such as login, refresh or v1. The client ip is read
+// from the X-Forwarded-For and X-Real-IP headers only if TrustProxy is set.
+type RateLimit struct {
+	Store         string                     `yaml:"store,omitempty"`
+	KeyPrefix     string                     `yaml:"key_prefix,omitempty"`
+	RedisAddr     string                     `yaml:"redis_addr,omitempty"`
+	RedisPassword string                     `yaml:"redis_password,omitempty"`
+	RedisDB       int                        `yaml:"redis_db,omitempty"`
+	RedisPoolSize int                        `yaml:"redis_pool_size,omitempty"`
+	TrustProxy    bool                       `yaml:"trust_proxy,omitempty"`
+	Groups        map[string]*RateLimitGroup `yaml:"groups,omitempty"`
+}
+
+// RateLimitGroup holds the limit of the clients of a route group, Key is
+// ip, user or token and identifies the clients, which are refilled Rate
+// requests per minute up to Burst requests
+type RateLimitGroup struct {
+	Key   string `yaml:"key,omitempty"`
+	Rate  int    `yaml:"requests_per_minute,omitempty"`
+	Burst int    `yaml:"burst,omitempty"`
+}
+
+// Idempotency holds data necessery for replaying the responses of retried
+// requests, responses are kept for Retention hours and expired keys are
+// purged every PurgeInterval minutes. Keys whose request has not completed
+// within LockTimeout seconds are considered abandoned.
+type Idempotency struct {
+	Retention     int `yaml:"retention_hours,omitempty"`
+	PurgeInterval int `yaml:"purge_interval_minutes,omitempty"`
+	LockTimeout   int `yaml:"lock_timeout_seconds,omitempty"`
+}
+
 // LoadConfigFrom returns Configuration struct compile from input path
 // reads the input file and builds a config struct
 // that is serialized from all the data in the config rile
@@ -36,14 +36,18 @@ func TestLoad(t *testing.T) {
 			path: support.TestingConfigPath(),
 			expectedData: &config.Configuration{
 				DB: &config.Database{
-					Dialect:  "mysql",
-					User:     "mysql_test_user",
-					Password: "mysql_test_password",
-					Name:     "cerebrum_mysql_test_db",
-					Protocol: "tcp",
-					Host:     "localhost",
-					Port:     "3306",
-					Settings: "tls=skip-verify&charset=utf8&parseTime=True&loc=Local&autocommit=true&timeout=20s",
+					Dialect:  "sqlite3",
+					Name:     "cerebrum_sqlite_test_db",
+					Settings: "mode=memory&_foreign_keys=1&_busy_timeout=5000",
+
+					QueryTimeout: 5000,
+					OperationTimeouts: map[string]int{
+						"transaction": 15000,
+						"user.list":   10000,
+					},
+					TransactionRetries: 3,
+					TransactionBackoff: 20,
+					LogLevel:           "error",
 				},
 				Server: &config.Server{
 					Port:         ":8080",
@@ -62,6 +66,29 @@ func TestLoad(t *testing.T) {
 					MinPasswordStr: 3,
 					SwaggerUIPath:  "third_party/swaggerui/dist",
 				},
+				Events: &config.Events{
+					DispatchInterval: 100,
+					BatchSize:        100,
+					MaxAttempts:      10,
+					Lease:            30,
+				},
+				Trash: &config.Trash{
+					RetentionDays: 30,
+					PurgeInterval: 1,
+					BatchSize:     100,
+				},
+				Encryption: &config.Encryption{
+					ActiveKey: "test-1",
+					Keys: map[string]string{
+						"test-1": "AbwAR8+EB73INdsA/hJbaYoGbOLrNc/LziVCs7Anxmc=",
+					},
+					BlindIndexKey: "a+TALmFq5339q8JkgnvvnWCjkrhk21SOCXGs0fiWcGc=",
+				},
+				Cache: &config.Cache{
+					Driver: "memory",
+					TTL:    60,
+					Size:   1000,
+				},
 			},
 		},
 	}
@@ -0,0 +1,247 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel/api/trace"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+)
+
+// settingsKey is the gorm setting holding the options of a db created by NewGormDb
+const settingsKey = "cerebrum:datastore"
+
+// ctxKey is the gorm setting holding the context of a context bound copy
+const ctxKey = "cerebrum:context"
+
+// settings are the connection options every context bound copy of a db inherits
+type settings struct {
+	logLevel     string
+	slowQuery    time.Duration
+	queryTimeout time.Duration
+	opTimeouts   map[string]time.Duration
+	txRetries    int
+	txBackoff    time.Duration
+	replicas     *Replicas
+	tracer       trace.Tracer
+}
+
+// newSettings reads the logging options, the query timeouts and the
+// transaction retry policy from the database config
+func newSettings(dbConfig *config.Database) (*settings, error) {
+	s := &settings{
+		logLevel:     dbConfig.LogLevel,
+		slowQuery:    time.Duration(dbConfig.SlowQueryThreshold) * time.Millisecond,
+		queryTimeout: time.Duration(dbConfig.QueryTimeout) * time.Millisecond,
+		opTimeouts:   make(map[string]time.Duration, len(dbConfig.OperationTimeouts)),
+		txRetries:    dbConfig.TransactionRetries,
+		txBackoff:    time.Duration(dbConfig.TransactionBackoff) * time.Millisecond,
+	}
+	switch s.logLevel {
+	case "", LogSilent, LogErrors, LogAll:
+	default:
+		return nil, fmt.Errorf("unsupported sql log level %q", s.logLevel)
+	}
+	for op, ms := range dbConfig.OperationTimeouts {
+		s.opTimeouts[op] = time.Duration(ms) * time.Millisecond
+	}
+	return s, nil
+}
+
+// setLogLevel sets the gorm log mode and logger of db matching the sql log
+// level, every statement is traced once slow queries are logged
+func (s *settings) setLogLevel(db *gorm.DB) {
+	switch {
+	case s.logLevel == LogAll || s.slowQuery > 0:
+		db.LogMode(true)
+	case s.logLevel == LogSilent:
+		db.LogMode(false)
+	}
+	db.SetLogger(&sqlLogger{s: s, Logger: gorm.Logger{LogWriter: log.New(os.Stdout, "\r\n", 0)}})
+}
+
+// sqlLogger filters the statements and errors gorm logs by the sql log level
+type sqlLogger struct {
+	gorm.Logger
+	s *settings
+}
+
+// Print logs statements slower than the slow query threshold without their
+// arguments, as they may hold personal data, and then logs the statements
+// and errors of the sql log level in the format of gorm
+func (l *sqlLogger) Print(values ...interface{}) {
+	if len(values) > 3 && values[0] == "sql" {
+		if d, ok := values[2].(time.Duration); ok && l.s.slowQuery > 0 && d >= l.s.slowQuery {
+			log.Printf("slow query took %v: %s", d, values[3])
+		}
+		if l.s.logLevel != LogAll {
+			return
+		}
+	}
+	if l.s.logLevel != LogSilent {
+		l.Logger.Print(values...)
+	}
+}
+
+// timeout returns the timeout of op, falling back to the query timeout
+func (s *settings) timeout(op string) time.Duration {
+	if t, ok := s.opTimeouts[op]; ok {
+		return t
+	}
+	return s.queryTimeout
+}
+
+// settingsOf returns the settings of db, or the zero value without timeouts
+func settingsOf(db *gorm.DB) *settings {
+	if v, ok := db.Get(settingsKey); ok {
+		if s, ok := v.(*settings); ok {
+			return s
+		}
+	}
+	return &settings{}
+}
+
+// WithContext returns a copy of db which runs every statement with ctx, so
+// that canceling ctx aborts the running SQL. The timeout configured for op,
+// or the query timeout if op has none, is added as a deadline to ctx. The
+// returned cancel func releases the deadline and must be called once the
+// operation finished. db may be the root connection or a transaction, search
+// conditions and the settings of db other than those of this package are not
+// kept. The copy runs the callbacks of gorm.DefaultCallback rather than those
+// registered on db, and can not begin transactions, see Transactor.
+func WithContext(ctx context.Context, db *gorm.DB, op string) (*gorm.DB, context.CancelFunc) {
+	return withContext(ctx, db, op, nil)
+}
+
+// ReadContext is WithContext for read only operations, outside of
+// transactions they run on a healthy replica of db unless the request of
+// ctx is pinned to the primary, see WithReadYourWrites
+func ReadContext(ctx context.Context, db *gorm.DB, op string) (*gorm.DB, context.CancelFunc) {
+	s := settingsOf(db)
+	if s.replicas == nil || InTransaction(db) || pinned(ctx) {
+		return withContext(ctx, db, op, nil)
+	}
+	return withContext(ctx, db, op, s.replicas.pick())
+}
+
+// withContext implements WithContext, statements outside of transactions run
+// on replica instead of the connection pool of db if it is not nil
+func withContext(ctx context.Context, db *gorm.DB, op string, replica *sql.DB) (*gorm.DB, context.CancelFunc) {
+	s := settingsOf(db)
+	var cancel context.CancelFunc
+	if t := s.timeout(op); t > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	if s.tracer != nil {
+		ctx, cancel = s.startSpan(ctx, op, db.Dialect().GetName(), cancel)
+	}
+
+	var common gorm.SQLCommon
+	switch c := db.CommonDB().(type) {
+	case *sql.DB:
+		if replica == nil {
+			replica = c
+		}
+		common = &ctxDB{ctx: ctx, db: replica}
+	case *ctxDB:
+		if replica == nil {
+			replica = c.db
+		}
+		common = &ctxDB{ctx: ctx, db: replica}
+	case *sql.Tx:
+		common = &ctxTx{ctx: ctx, tx: c}
+	case *ctxTx:
+		common = &ctxTx{ctx: ctx, tx: c.tx}
+	default:
+		return db, cancel
+	}
+	return bind(ctx, db, common), cancel
+}
+
+// bind returns a copy of db running its statements on common, the copy is
+// opened on common rather than cloned from db as gorm does not export the
+// connection of a db. It keeps the settings, the logger and the commit hooks
+// of db.
+func bind(ctx context.Context, db *gorm.DB, common gorm.SQLCommon) *gorm.DB {
+	cdb, err := gorm.Open(db.Dialect().GetName(), common)
+	if err != nil {
+		return db
+	}
+	s := settingsOf(db)
+	s.setLogLevel(cdb)
+	cdb.InstantSet(settingsKey, s)
+	if hooks, ok := db.Get(commitHooksKey); ok {
+		cdb.InstantSet(commitHooksKey, hooks)
+	}
+	cdb.InstantSet(ctxKey, ctx)
+	return cdb
+}
+
+// InTransaction reports whether db runs its statements in a transaction
+func InTransaction(db *gorm.DB) bool {
+	switch db.CommonDB().(type) {
+	case *sql.Tx, *ctxTx:
+		return true
+	}
+	return false
+}
+
+// ctxDB runs the statements gorm issues on a connection pool with a context
+type ctxDB struct {
+	ctx context.Context
+	db  *sql.DB
+}
+
+// Exec executes a query without returning any rows
+func (c *ctxDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.db.ExecContext(c.ctx, query, args...)
+}
+
+// Prepare creates a prepared statement for later queries or executions
+func (c *ctxDB) Prepare(query string) (*sql.Stmt, error) {
+	return c.db.PrepareContext(c.ctx, query)
+}
+
+// Query executes a query that returns rows
+func (c *ctxDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.db.QueryContext(c.ctx, query, args...)
+}
+
+// QueryRow executes a query that is expected to return at most one row
+func (c *ctxDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.db.QueryRowContext(c.ctx, query, args...)
+}
+
+// ctxTx runs the statements gorm issues in a transaction with a context
+type ctxTx struct {
+	ctx context.Context
+	tx  *sql.Tx
+}
+
+// Exec executes a query without returning any rows
+func (c *ctxTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.tx.ExecContext(c.ctx, query, args...)
+}
+
+// Prepare creates a prepared statement for use within the transaction
+func (c *ctxTx) Prepare(query string) (*sql.Stmt, error) {
+	return c.tx.PrepareContext(c.ctx, query)
+}
+
+// Query executes a query that returns rows
+func (c *ctxTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.tx.QueryContext(c.ctx, query, args...)
+}
+
+// QueryRow executes a query that is expected to return at most one row
+func (c *ctxTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.tx.QueryRowContext(c.ctx, query, args...)
+}
@@ -0,0 +1,144 @@
+package datastore_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
+	"github.com/johncoleman83/cerebrum/pkg/utl/support"
+)
+
+// endlessQuery never finishes on its own
+const endlessQuery = "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c) SELECT count(*) FROM c"
+
+type note struct {
+	ID   uint `gorm:"primary_key"`
+	Text string
+}
+
+func newTestDB(t *testing.T, timeouts map[string]int) *gorm.DB {
+	cfg, err := config.LoadConfigFrom(support.TestingConfigPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DB.OperationTimeouts = timeouts
+	cfg.DB.LogLevel = datastore.LogSilent
+	db, err := datastore.NewGormDb(cfg.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateTable(&note{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestWithContext(t *testing.T) {
+	db := newTestDB(t, map[string]int{"slow": 50})
+	defer db.Close()
+
+	cdb, cancel := datastore.WithContext(context.Background(), db, "fast")
+	assert.Nil(t, cdb.Create(&note{Text: "bound"}).Error, "a live context should not affect statements")
+	cancel()
+	assert.NotNil(t, cdb.Create(&note{Text: "canceled"}).Error, "statements should fail once the context is canceled")
+
+	cdb, cancel = datastore.WithContext(context.Background(), db, "slow")
+	defer cancel()
+	start := time.Now()
+	var count int
+	err := cdb.Raw(endlessQuery).Row().Scan(&count)
+	assert.NotNil(t, err, "the running query should be interrupted by the operation timeout")
+	assert.True(t, time.Since(start) < 5*time.Second, "the query should stop shortly after the timeout")
+
+	ctx, cancelReq := context.WithCancel(context.Background())
+	cdb, cancel = datastore.WithContext(ctx, db, "fast")
+	defer cancel()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancelReq()
+	}()
+	err = cdb.Raw(endlessQuery).Row().Scan(&count)
+	assert.NotNil(t, err, "canceling the parent context should interrupt the running query")
+
+	var n int
+	assert.Nil(t, db.Model(&note{}).Count(&n).Error, "the root db should not be bound to any context")
+	assert.Equal(t, 1, n)
+}
+
+func TestWithContextNested(t *testing.T) {
+	db := newTestDB(t, map[string]int{"slow": 50})
+	defer db.Close()
+
+	cdb, cancel := datastore.WithContext(context.Background(), db, "fast")
+	defer cancel()
+	cdb, cancelSlow := datastore.WithContext(context.Background(), cdb, "slow")
+	defer cancelSlow()
+	var count int
+	err := cdb.Raw(endlessQuery).Row().Scan(&count)
+	assert.NotNil(t, err, "copies of copies should keep the operation timeouts of the root db")
+}
+
+func TestTransactor(t *testing.T) {
+	// canceling a transaction discards its connection, which would drop an
+	// in-memory database
+	dir, err := ioutil.TempDir("", "transactor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg, err := config.LoadConfigFrom(support.TestingConfigPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DB.Name = filepath.Join(dir, "cerebrum.db")
+	cfg.DB.Settings = "_busy_timeout=5000"
+	cfg.DB.LogLevel = datastore.LogSilent
+	db, err := datastore.NewGormDb(cfg.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.CreateTable(&note{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	tr := datastore.NewTransactor(db)
+
+	err = tr.Transaction(context.Background(), func(tx *gorm.DB) error {
+		return tx.Create(&note{Text: "committed"}).Error
+	})
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = tr.Transaction(ctx, func(tx *gorm.DB) error {
+		if err := tx.Create(&note{Text: "rolled back"}).Error; err != nil {
+			return err
+		}
+		cancel()
+		tx, done := datastore.WithContext(ctx, tx, "insert")
+		defer done()
+		return tx.Create(&note{Text: "after cancel"}).Error
+	})
+	assert.NotNil(t, err, "the transaction should fail once its context is canceled")
+
+	ctx, cancel = context.WithCancel(context.Background())
+	err = tr.Transaction(ctx, func(tx *gorm.DB) error {
+		if err := tx.Create(&note{Text: "canceled before commit"}).Error; err != nil {
+			return err
+		}
+		cancel()
+		return nil
+	})
+	assert.NotNil(t, err, "the transaction should be rolled back once its context is canceled")
+
+	var notes []note
+	assert.Nil(t, db.Find(&notes).Error)
+	assert.Len(t, notes, 1, "only the committed transaction should be persisted")
+}
@@ -0,0 +1,122 @@
+// Package datastore creates an ORM connection to the
+// databse and persistence layer
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"    // for use with gorm
+	_ "github.com/jinzhu/gorm/dialects/postgres" // for use with gorm
+	_ "github.com/jinzhu/gorm/dialects/sqlite"   // for use with gorm
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+)
+
+// Supported database dialects, these are the values accepted by config.Database.Dialect
+const (
+	MySQL    = "mysql"
+	Postgres = "postgres"
+	SQLite   = "sqlite3"
+)
+
+// SQL log levels, these are the values accepted by config.Database.LogLevel,
+// errors are logged by default
+const (
+	LogSilent = "silent"
+	LogErrors = "error"
+	LogAll    = "all"
+)
+
+// Dialect returns the gorm dialect name for the configured dialect
+func Dialect(dbConfig *config.Database) (string, error) {
+	switch dbConfig.Dialect {
+	case MySQL:
+		return MySQL, nil
+	case Postgres, "postgresql":
+		return Postgres, nil
+	case SQLite, "sqlite":
+		return SQLite, nil
+	default:
+		return "", fmt.Errorf("unsupported database dialect %q", dbConfig.Dialect)
+	}
+}
+
+// FormatDSN creates the datastore name string for database connections
+// in the format expected by the driver of the configured dialect
+func FormatDSN(dbConfig *config.Database) (string, error) {
+	dialect, err := Dialect(dbConfig)
+	if err != nil {
+		return "", err
+	}
+	switch dialect {
+	case Postgres:
+		return FormatPostgresDSN(dbConfig), nil
+	case SQLite:
+		return FormatSQLiteDSN(dbConfig), nil
+	default:
+		return FormatMySQLDSN(dbConfig), nil
+	}
+}
+
+// NewGormDb creates new database connection to the configured database,
+// and to its read replicas which are reached through ReadContext
+func NewGormDb(dbConfig *config.Database) (*gorm.DB, error) {
+	dialect, err := Dialect(dbConfig)
+	if err != nil {
+		return nil, err
+	}
+	dsn, err := FormatDSN(dbConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := newSettings(dbConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(dialect, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	configurePool(db.DB(), dialect, dbConfig)
+	s.setLogLevel(db)
+	db.InstantSet(settingsKey, s)
+	if err = db.Exec("SELECT 1").Error; err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if len(dbConfig.Replicas) > 0 {
+		if s.replicas, err = openReplicas(dialect, dbConfig); err != nil {
+			db.Close()
+			return nil, err
+		}
+		s.replicas.Check(context.Background())
+	}
+
+	return db, nil
+}
+
+// configurePool applies the connection pool settings of the database config
+func configurePool(db *sql.DB, dialect string, dbConfig *config.Database) {
+	if dbConfig.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(dbConfig.MaxIdleConns)
+	}
+	if dbConfig.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(time.Duration(dbConfig.ConnMaxLifetime) * time.Second)
+	}
+	switch {
+	case dialect == SQLite:
+		// sqlite only supports a single writer, and every connection to an
+		// in-memory database would otherwise open its own empty database
+		db.SetMaxOpenConns(1)
+	case dbConfig.MaxOpenConns > 0:
+		db.SetMaxOpenConns(dbConfig.MaxOpenConns)
+	}
+}
@@ -0,0 +1,191 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Driver specific error codes
+const (
+	mysqlDuplicateEntry     = 1062
+	mysqlLockWaitTimeout    = 1205
+	mysqlDeadlock           = 1213
+	mysqlQueryInterrupted   = 3024
+	mysqlTooManyConnections = 1040
+	mysqlServerShutdown     = 1053
+
+	postgresUniqueViolation = "23505"
+	postgresQueryCanceled   = "57014"
+	postgresLockNotAvail    = "55P03"
+
+	postgresSerializationFailure = "40001"
+	postgresDeadlockDetected     = "40P01"
+
+	// database/sql does not export the error returned by a closed *sql.DB
+	errDBClosed = "sql: database is closed"
+)
+
+// unwrapErrors returns the errors held by err, gorm collects multiple errors
+// of one operation in a gorm.Errors, which may itself be wrapped
+func unwrapErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	var errs gorm.Errors
+	if errors.As(err, &errs) {
+		return errs
+	}
+	return []error{err}
+}
+
+// IsDuplicateKeyError reports whether err is a unique or primary key
+// constraint violation returned by any of the supported drivers
+func IsDuplicateKeyError(err error) bool {
+	for _, e := range unwrapErrors(err) {
+		var (
+			me *mysql.MySQLError
+			pe *pq.Error
+			se sqlite3.Error
+		)
+		switch {
+		case errors.As(e, &me):
+			if me.Number == mysqlDuplicateEntry {
+				return true
+			}
+		case errors.As(e, &pe):
+			if pe.Code == postgresUniqueViolation {
+				return true
+			}
+		case errors.As(e, &se):
+			if se.ExtendedCode == sqlite3.ErrConstraintUnique || se.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsCanceledError reports whether err was caused by canceling the context
+// of the statement, which happens once the client of the request went away
+func IsCanceledError(err error) bool {
+	for _, e := range unwrapErrors(err) {
+		if errors.Is(e, context.Canceled) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTimeoutError reports whether err was caused by an expired deadline, a
+// statement canceled by the server or waiting too long on a lock
+func IsTimeoutError(err error) bool {
+	for _, e := range unwrapErrors(err) {
+		if errors.Is(e, context.DeadlineExceeded) {
+			return true
+		}
+		var (
+			ne net.Error
+			me *mysql.MySQLError
+			pe *pq.Error
+			se sqlite3.Error
+		)
+		switch {
+		case errors.As(e, &ne):
+			if ne.Timeout() {
+				return true
+			}
+		case errors.As(e, &me):
+			if me.Number == mysqlLockWaitTimeout || me.Number == mysqlQueryInterrupted {
+				return true
+			}
+		case errors.As(e, &pe):
+			if pe.Code == postgresQueryCanceled || pe.Code == postgresLockNotAvail {
+				return true
+			}
+		case errors.As(e, &se):
+			if se.Code == sqlite3.ErrBusy || se.Code == sqlite3.ErrLocked {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unavailableErrors are the errors of a lost connection
+var unavailableErrors = []error{driver.ErrBadConn, sql.ErrConnDone, mysql.ErrInvalidConn, io.EOF, io.ErrUnexpectedEOF}
+
+// IsUnavailableError reports whether err was caused by a lost or refused
+// connection to the database server
+func IsUnavailableError(err error) bool {
+	for _, e := range unwrapErrors(err) {
+		for _, target := range unavailableErrors {
+			if errors.Is(e, target) {
+				return true
+			}
+		}
+		if e.Error() == errDBClosed {
+			return true
+		}
+		var (
+			ne net.Error
+			me *mysql.MySQLError
+			pe *pq.Error
+			se sqlite3.Error
+		)
+		switch {
+		case errors.As(e, &ne):
+			if !ne.Timeout() {
+				return true
+			}
+		case errors.As(e, &me):
+			if me.Number == mysqlTooManyConnections || me.Number == mysqlServerShutdown {
+				return true
+			}
+		case errors.As(e, &pe):
+			// class 08 is connection exception, 53 insufficient resources and 57P admin shutdown
+			if pe.Code.Class() == "08" || pe.Code.Class() == "53" || pe.Code == "57P01" || pe.Code == "57P02" || pe.Code == "57P03" {
+				return true
+			}
+		case errors.As(e, &se):
+			if se.Code == sqlite3.ErrCantOpen || se.Code == sqlite3.ErrIoErr {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsRetryableError reports whether err aborted a transaction because of a
+// deadlock or a serialization failure, running the transaction again may
+// succeed. Errors wrapped by the store layer are unwrapped.
+func IsRetryableError(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		for _, e := range unwrapErrors(err) {
+			if isRetryable(e) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isRetryable(err error) bool {
+	switch de := err.(type) {
+	case *mysql.MySQLError:
+		return de.Number == mysqlDeadlock
+	case *pq.Error:
+		return de.Code == postgresSerializationFailure || de.Code == postgresDeadlockDetected
+	case sqlite3.Error:
+		return de.ExtendedCode == sqlite3.ErrBusySnapshot
+	}
+	return false
+}
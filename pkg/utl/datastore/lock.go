@@ -0,0 +1,56 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+
+	"github.com/jinzhu/gorm"
+)
+
+// errNoPool is returned by TryLock for a db which is not a connection pool
+var errNoPool = errors.New("advisory locks need the root connection pool")
+
+// localLocks holds the names locked on dialects without advisory locks,
+// which only serve a single process
+var localLocks sync.Map
+
+// TryLock takes the advisory lock name without waiting for it and reports
+// whether it was taken, so that only one of the api instances sharing the
+// database runs a periodic job. The lock is held by a dedicated connection
+// until unlock is called, unlock is nil if the lock was not taken.
+func TryLock(ctx context.Context, db *gorm.DB, name string) (unlock func(), ok bool, err error) {
+	dialect := db.Dialect().GetName()
+	if dialect != MySQL && dialect != Postgres {
+		if _, held := localLocks.LoadOrStore(name, struct{}{}); held {
+			return nil, false, nil
+		}
+		return func() { localLocks.Delete(name) }, true, nil
+	}
+	pool := db.DB()
+	if pool == nil {
+		return nil, false, errNoPool
+	}
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	lock, release := "SELECT pg_try_advisory_lock(hashtext($1))", "SELECT pg_advisory_unlock(hashtext($1))"
+	if dialect == MySQL {
+		lock, release = "SELECT COALESCE(GET_LOCK(?, 0), 0) = 1", "SELECT RELEASE_LOCK(?)"
+	}
+	if err := conn.QueryRowContext(ctx, lock, name).Scan(&ok); err != nil || !ok {
+		conn.Close()
+		return nil, false, err
+	}
+	return func() {
+		// discarding the connection releases the lock should the release fail
+		var released sql.NullBool
+		if err := conn.QueryRowContext(context.Background(), release, name).Scan(&released); err != nil {
+			_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}, true, nil
+}
@@ -0,0 +1,35 @@
+package datastore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
+)
+
+func TestTryLock(t *testing.T) {
+	db := newTestDB(t, nil)
+	defer db.Close()
+	ctx := context.Background()
+
+	unlock, ok, err := datastore.TryLock(ctx, db, "job")
+	assert.Nil(t, err)
+	assert.True(t, ok, "a free lock should be taken")
+
+	_, ok, err = datastore.TryLock(ctx, db, "job")
+	assert.Nil(t, err)
+	assert.False(t, ok, "a held lock should not be taken twice")
+
+	other, ok, err := datastore.TryLock(ctx, db, "other")
+	assert.Nil(t, err)
+	assert.True(t, ok, "locks should be independent by name")
+	other()
+
+	unlock()
+	unlock, ok, err = datastore.TryLock(ctx, db, "job")
+	assert.Nil(t, err)
+	assert.True(t, ok, "a released lock should be taken again")
+	unlock()
+}
@@ -0,0 +1,21 @@
+package datastore
+
+import (
+	"net"
+	"net/url"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+)
+
+// FormatPostgresDSN creates the connection url for postgres connections,
+// Settings are passed through as the url query, e.g. `sslmode=disable`
+func FormatPostgresDSN(dbConfig *config.Database) string {
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(dbConfig.User, dbConfig.Password),
+		Host:     net.JoinHostPort(dbConfig.Host, dbConfig.Port),
+		Path:     "/" + dbConfig.Name,
+		RawQuery: dbConfig.Settings,
+	}
+	return dsn.String()
+}
@@ -0,0 +1,264 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+)
+
+// Replica defaults used when the database config omits a value
+const (
+	defaultReplicaCheckInterval = 10 * time.Second
+	defaultReplicaMaxLag        = 5 * time.Second
+)
+
+// errReplicationStopped is returned by the lag check of a replica which no
+// longer replicates the primary
+var errReplicationStopped = errors.New("replication is stopped")
+
+// Replicas are the read replicas of a database, reads are spread over the
+// healthy replicas and fall back to the primary once none is healthy
+type Replicas struct {
+	replicas []*replica
+	next     uint32
+	interval time.Duration
+	maxLag   time.Duration
+	dialect  string
+}
+
+// replica is the connection pool of a read replica and its last known health
+type replica struct {
+	db      *sql.DB
+	healthy int32
+}
+
+// openReplicas opens a connection pool to every replica of the database
+// config, replicas are considered healthy once a health check succeeded
+func openReplicas(dialect string, dbConfig *config.Database) (*Replicas, error) {
+	r := &Replicas{
+		interval: time.Duration(dbConfig.ReplicaCheckInterval) * time.Second,
+		maxLag:   time.Duration(dbConfig.ReplicaMaxLag) * time.Second,
+		dialect:  dialect,
+	}
+	if r.interval <= 0 {
+		r.interval = defaultReplicaCheckInterval
+	}
+	if r.maxLag <= 0 {
+		r.maxLag = defaultReplicaMaxLag
+	}
+	for _, rc := range dbConfig.Replicas {
+		dsn, err := FormatDSN(replicaConfig(dbConfig, rc))
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		db, err := sql.Open(dialect, dsn)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		configurePool(db, dialect, dbConfig)
+		r.replicas = append(r.replicas, &replica{db: db})
+	}
+	return r, nil
+}
+
+// replicaConfig returns the config of the primary with the fields set for
+// the replica replaced
+func replicaConfig(primary *config.Database, rc *config.Replica) *config.Database {
+	c := *primary
+	for _, f := range []struct{ dst, src *string }{
+		{&c.User, &rc.User},
+		{&c.Password, &rc.Password},
+		{&c.Name, &rc.Name},
+		{&c.Host, &rc.Host},
+		{&c.Port, &rc.Port},
+	} {
+		if *f.src != "" {
+			*f.dst = *f.src
+		}
+	}
+	return &c
+}
+
+// ReplicasOf returns the replicas of a db created by NewGormDb, or nil if
+// none are configured
+func ReplicasOf(db *gorm.DB) *Replicas {
+	return settingsOf(db).replicas
+}
+
+// Check records whether every replica is healthy, that is reachable and
+// lagging behind the primary by at most the max lag
+func (r *Replicas) Check(ctx context.Context) {
+	for _, rep := range r.replicas {
+		ctx, cancel := context.WithTimeout(ctx, r.interval)
+		var healthy int32
+		if lag, err := replicationLag(ctx, r.dialect, rep.db); err == nil && lag <= r.maxLag {
+			healthy = 1
+		}
+		cancel()
+		atomic.StoreInt32(&rep.healthy, healthy)
+	}
+}
+
+// replicationLag returns how far db, a replica of dialect, lags behind its
+// primary. Databases which are not replicas do not lag.
+func replicationLag(ctx context.Context, dialect string, db *sql.DB) (time.Duration, error) {
+	switch dialect {
+	case MySQL:
+		return mysqlLag(ctx, db)
+	case Postgres:
+		// a replica which replayed everything it received is not lagging, the
+		// time of its last replayed transaction is then that of an idle primary
+		var seconds float64
+		err := db.QueryRowContext(ctx, `SELECT CASE
+			WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+			ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0) END`).Scan(&seconds)
+		return time.Duration(seconds * float64(time.Second)), err
+	default:
+		return 0, db.PingContext(ctx)
+	}
+}
+
+// mysqlLag returns the Seconds_Behind_Master of a mysql replica, which is
+// null once replication stopped
+func mysqlLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	rows, err := db.QueryContext(ctx, "SHOW SLAVE STATUS")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return 0, rows.Err()
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	values := make([]sql.NullString, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+	for i, col := range cols {
+		if col != "Seconds_Behind_Master" {
+			continue
+		}
+		if !values[i].Valid {
+			return 0, errReplicationStopped
+		}
+		seconds, err := strconv.Atoi(values[i].String)
+		return time.Duration(seconds) * time.Second, err
+	}
+	return 0, errReplicationStopped
+}
+
+// Run checks the health of the replicas at the configured interval until
+// ctx is done
+func (r *Replicas) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		r.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Healthy returns the number of replicas which passed their last health check
+func (r *Replicas) Healthy() int {
+	n := 0
+	for _, rep := range r.replicas {
+		if atomic.LoadInt32(&rep.healthy) == 1 {
+			n++
+		}
+	}
+	return n
+}
+
+// MaxLag returns how far a healthy replica may lag behind the primary, it
+// is zero if r is nil
+func (r *Replicas) MaxLag() time.Duration {
+	if r == nil {
+		return 0
+	}
+	return r.maxLag
+}
+
+// Len returns the number of replicas
+func (r *Replicas) Len() int {
+	return len(r.replicas)
+}
+
+// Close closes the connection pools of the replicas
+func (r *Replicas) Close() error {
+	var err error
+	for _, rep := range r.replicas {
+		if cerr := rep.db.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// pick returns the next healthy replica in round robin order, or nil if no
+// replica is healthy
+func (r *Replicas) pick() *sql.DB {
+	n := uint32(len(r.replicas))
+	for i := uint32(0); i < n; i++ {
+		rep := r.replicas[(atomic.AddUint32(&r.next, 1)-1)%n]
+		if atomic.LoadInt32(&rep.healthy) == 1 {
+			return rep.db
+		}
+	}
+	return nil
+}
+
+// pinKey is the context key of the pin of a request to the primary
+type pinKey struct{}
+
+// pin records whether a unit of work ran with a context, and until when the
+// client of the request is pinned by its earlier writes
+type pin struct {
+	wrote int32
+	until time.Time
+}
+
+// WithReadYourWrites returns a copy of ctx whose reads go to the primary
+// before until, or once a unit of work ran with it, so that a client reads
+// its own writes even while the replicas lag behind
+func WithReadYourWrites(ctx context.Context, until time.Time) context.Context {
+	return context.WithValue(ctx, pinKey{}, &pin{until: until})
+}
+
+// Wrote reports whether a unit of work ran with ctx
+func Wrote(ctx context.Context) bool {
+	p, ok := ctx.Value(pinKey{}).(*pin)
+	return ok && atomic.LoadInt32(&p.wrote) == 1
+}
+
+// markWrite pins the request of ctx to the primary
+func markWrite(ctx context.Context) {
+	if p, ok := ctx.Value(pinKey{}).(*pin); ok {
+		atomic.StoreInt32(&p.wrote, 1)
+	}
+}
+
+// pinned reports whether the request of ctx is pinned to the primary
+func pinned(ctx context.Context) bool {
+	p, ok := ctx.Value(pinKey{}).(*pin)
+	return ok && (atomic.LoadInt32(&p.wrote) == 1 || time.Now().Before(p.until))
+}
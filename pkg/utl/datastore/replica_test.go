@@ -0,0 +1,86 @@
+package datastore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
+	"github.com/johncoleman83/cerebrum/pkg/utl/support"
+)
+
+// readNote returns the text of the first note read with ReadContext
+func readNote(ctx context.Context, t *testing.T, db *gorm.DB) string {
+	rdb, cancel := datastore.ReadContext(ctx, db, "note.view")
+	defer cancel()
+	var n note
+	if err := rdb.First(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n.Text
+}
+
+func TestReadContext(t *testing.T) {
+	cfg, err := config.LoadConfigFrom(support.TestingConfigPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DB.Replicas = []*config.Replica{{Name: "cerebrum_sqlite_test_replica"}}
+	cfg.DB.LogLevel = datastore.LogSilent
+	db, err := datastore.NewGormDb(cfg.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	replicas := datastore.ReplicasOf(db)
+	if !assert.NotNil(t, replicas) {
+		return
+	}
+	defer replicas.Close()
+	assert.Equal(t, 1, replicas.Len())
+	assert.Equal(t, 1, replicas.Healthy())
+
+	ctx := context.Background()
+	assert.Nil(t, db.CreateTable(&note{}).Error)
+	assert.Nil(t, db.Create(&note{Text: "primary"}).Error)
+	rdb, cancel := datastore.ReadContext(ctx, db, "note.seed")
+	assert.Nil(t, rdb.CreateTable(&note{}).Error, "replicas should be reached through ReadContext")
+	assert.Nil(t, rdb.Create(&note{Text: "replica"}).Error)
+	cancel()
+
+	assert.Equal(t, "replica", readNote(ctx, t, db), "reads should go to the replicas")
+	wdb, cancel := datastore.WithContext(ctx, db, "note.view")
+	var n note
+	assert.Nil(t, wdb.First(&n).Error)
+	assert.Equal(t, "primary", n.Text, "other operations should go to the primary")
+	cancel()
+
+	tr := datastore.NewTransactor(db)
+	err = tr.Transaction(ctx, func(tx *gorm.DB) error {
+		assert.Equal(t, "primary", readNote(ctx, t, tx), "reads of units of work should go to the primary")
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "replica", readNote(ctx, t, db), "requests should only be pinned with read your writes")
+
+	req := datastore.WithReadYourWrites(ctx, time.Time{})
+	assert.Equal(t, "replica", readNote(req, t, db), "requests should not be pinned before they write")
+	assert.False(t, datastore.Wrote(req))
+	assert.Nil(t, tr.Transaction(req, func(*gorm.DB) error { return nil }))
+	assert.True(t, datastore.Wrote(req))
+	assert.Equal(t, "primary", readNote(req, t, db), "requests should read their own writes")
+
+	req = datastore.WithReadYourWrites(ctx, time.Now().Add(time.Minute))
+	assert.Equal(t, "primary", readNote(req, t, db), "clients should read their earlier writes")
+	req = datastore.WithReadYourWrites(ctx, time.Now().Add(-time.Second))
+	assert.Equal(t, "replica", readNote(req, t, db), "clients should be pinned until the replicas caught up")
+
+	assert.Nil(t, replicas.Close())
+	replicas.Check(ctx)
+	assert.Equal(t, 0, replicas.Healthy())
+	assert.Equal(t, "primary", readNote(ctx, t, db), "reads should fall back to the primary")
+}
@@ -0,0 +1,15 @@
+package datastore
+
+import (
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+)
+
+// FormatSQLiteDSN creates the file uri for sqlite connections, where Name is
+// the database file path and Settings are uri parameters such as `mode=memory`
+func FormatSQLiteDSN(dbConfig *config.Database) string {
+	dsn := "file:" + dbConfig.Name
+	if dbConfig.Settings != "" {
+		dsn += "?" + dbConfig.Settings
+	}
+	return dsn
+}
@@ -0,0 +1,61 @@
+package datastore
+
+import (
+	"database/sql"
+	"sync/atomic"
+
+	"github.com/jinzhu/gorm"
+)
+
+// PoolStats are the statistics of a connection pool
+type PoolStats struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	WaitDurationMillis int64 `json:"wait_duration_milliseconds"`
+	MaxIdleClosed      int64 `json:"max_idle_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+}
+
+// ReplicaStats are the statistics of the connection pool of a read replica
+type ReplicaStats struct {
+	PoolStats
+	Healthy bool `json:"healthy"`
+}
+
+// Stats are the statistics of the connection pools of a database
+type Stats struct {
+	Primary  PoolStats      `json:"primary"`
+	Replicas []ReplicaStats `json:"replicas,omitempty"`
+}
+
+// StatsOf returns the statistics of the connection pools of a db created by
+// NewGormDb
+func StatsOf(db *gorm.DB) Stats {
+	st := Stats{Primary: newPoolStats(db.DB().Stats())}
+	if r := ReplicasOf(db); r != nil {
+		for _, rep := range r.replicas {
+			st.Replicas = append(st.Replicas, ReplicaStats{
+				PoolStats: newPoolStats(rep.db.Stats()),
+				Healthy:   atomic.LoadInt32(&rep.healthy) == 1,
+			})
+		}
+	}
+	return st
+}
+
+// newPoolStats converts the statistics of the sql package
+func newPoolStats(s sql.DBStats) PoolStats {
+	return PoolStats{
+		MaxOpenConnections: s.MaxOpenConnections,
+		OpenConnections:    s.OpenConnections,
+		InUse:              s.InUse,
+		Idle:               s.Idle,
+		WaitCount:          s.WaitCount,
+		WaitDurationMillis: s.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      s.MaxIdleClosed,
+		MaxLifetimeClosed:  s.MaxLifetimeClosed,
+	}
+}
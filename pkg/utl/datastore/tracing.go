@@ -0,0 +1,101 @@
+package datastore
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel/api/kv"
+	"go.opentelemetry.io/otel/api/standard"
+	"go.opentelemetry.io/otel/api/trace"
+	"google.golang.org/grpc/codes"
+)
+
+// spanKey is the gorm instance setting holding the span of a statement
+const spanKey = "cerebrum:span"
+
+// init registers the callbacks tracing the statements of every db, they
+// only trace the context bound copies of dbs given a tracer with SetTracer
+func init() {
+	cb := gorm.DefaultCallback
+	cb.Create().Before("gorm:create").Register("cerebrum:start_span", startStatement("create"))
+	cb.Create().After("gorm:create").Register("cerebrum:end_span", endStatement)
+	cb.Query().Before("gorm:query").Register("cerebrum:start_span", startStatement("query"))
+	cb.Query().After("gorm:query").Register("cerebrum:end_span", endStatement)
+	cb.RowQuery().Before("gorm:row_query").Register("cerebrum:start_span", startStatement("row_query"))
+	cb.RowQuery().After("gorm:row_query").Register("cerebrum:end_span", endStatement)
+	cb.Update().Before("gorm:update").Register("cerebrum:start_span", startStatement("update"))
+	cb.Update().After("gorm:update").Register("cerebrum:end_span", endStatement)
+	cb.Delete().Before("gorm:delete").Register("cerebrum:start_span", startStatement("delete"))
+	cb.Delete().After("gorm:delete").Register("cerebrum:end_span", endStatement)
+}
+
+// SetTracer traces the operations run on the context bound copies of db
+// with tracer, every statement of an operation is traced as its child span.
+// It must be called once on the root db before db is shared.
+func SetTracer(db *gorm.DB, tracer trace.Tracer) {
+	v, ok := db.Get(settingsKey)
+	if !ok {
+		return
+	}
+	if s, ok := v.(*settings); ok {
+		s.tracer = tracer
+	}
+}
+
+// startSpan starts the span of op as a child of the span of ctx, the
+// returned cancel func ends it before calling cancel
+func (s *settings) startSpan(ctx context.Context, op, dialect string, cancel context.CancelFunc) (context.Context, context.CancelFunc) {
+	ctx, span := s.tracer.Start(ctx, op, trace.WithAttributes(standard.DBTypeKey.String(dialect)))
+	return ctx, func() {
+		span.End()
+		cancel()
+	}
+}
+
+// startStatement returns a callback starting the span of a statement as a
+// child of the context its db is bound to, statements run outside of a
+// context or without a tracer are not traced. Statements are traced without
+// their arguments as they may hold personal data.
+func startStatement(kind string) func(*gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		s := settingsOf(scope.DB())
+		if s.tracer == nil {
+			return
+		}
+		v, ok := scope.Get(ctxKey)
+		if !ok {
+			return
+		}
+		ctx, ok := v.(context.Context)
+		if !ok {
+			return
+		}
+		_, span := s.tracer.Start(ctx, "gorm."+kind,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(standard.DBTypeKey.String(scope.Dialect().GetName())),
+		)
+		scope.InstanceSet(spanKey, span)
+	}
+}
+
+// endStatement is a callback ending the span of a statement, it is failed
+// if the statement failed unless no record was found. The error is left out
+// as database errors may quote the values of the statement.
+func endStatement(scope *gorm.Scope) {
+	v, ok := scope.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span, ok := v.(trace.Span)
+	if !ok {
+		return
+	}
+	span.SetAttributes(
+		standard.DBStatementKey.String(scope.SQL),
+		kv.Int64("db.rows_affected", scope.DB().RowsAffected),
+	)
+	if err := scope.DB().Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		span.SetStatus(codes.Unknown, "statement failed")
+	}
+	span.End()
+}
@@ -0,0 +1,93 @@
+package datastore_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/api/standard"
+	"google.golang.org/grpc/codes"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
+	"github.com/johncoleman83/cerebrum/pkg/utl/tracing"
+)
+
+func TestSetTracer(t *testing.T) {
+	db := newTestDB(t, nil)
+	defer db.Close()
+	exp := tracing.NewInMemoryExporter()
+	tr, err := tracing.NewWithExporter(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	datastore.SetTracer(db, tr.Tracer())
+
+	ctx, req := tr.Tracer().Start(context.Background(), "request")
+	cdb, cancel := datastore.WithContext(ctx, db, "note.create")
+	assert.Nil(t, cdb.Create(&note{Text: "secret"}).Error)
+	cancel()
+	cdb, cancel = datastore.WithContext(ctx, db, "note.view")
+	assert.NotNil(t, cdb.First(&note{}, 404).Error)
+	assert.NotNil(t, cdb.Table("missing").Find(&[]note{}).Error)
+	cancel()
+	req.End()
+
+	spans := exp.Spans()
+	if !assert.Len(t, spans, 6) {
+		return
+	}
+	names := make([]string, len(spans))
+	for i, s := range spans {
+		names[i] = s.Name
+		assert.Equal(t, req.SpanContext().TraceID, s.SpanContext.TraceID, "every span should belong to the request trace")
+	}
+	assert.Equal(t, []string{"gorm.create", "note.create", "gorm.query", "gorm.query", "note.view", "request"}, names)
+
+	insert, create := spans[0], spans[1]
+	assert.Equal(t, create.SpanContext.SpanID, insert.ParentSpanID, "statements should be children of their operation")
+	assert.Equal(t, req.SpanContext().SpanID, create.ParentSpanID, "operations should be children of the request")
+	for _, kv := range insert.Attributes {
+		if kv.Key == standard.DBStatementKey {
+			assert.True(t, strings.HasPrefix(kv.Value.AsString(), "INSERT INTO"))
+			assert.NotContains(t, kv.Value.AsString(), "secret", "arguments should not be traced")
+		}
+	}
+	assert.Equal(t, codes.OK, spans[2].StatusCode, "missing records should not fail statements")
+	assert.Equal(t, codes.Unknown, spans[3].StatusCode, "failed statements should fail their span")
+}
+
+func TestSetTracerConcurrent(t *testing.T) {
+	db := newTestDB(t, nil)
+	defer db.Close()
+	exp := tracing.NewInMemoryExporter()
+	tr, err := tracing.NewWithExporter(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	datastore.SetTracer(db, tr.Tracer())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cdb, cancel := datastore.WithContext(context.Background(), db, "note.list")
+			defer cancel()
+			cdb.Find(&[]note{})
+		}()
+	}
+	wg.Wait()
+
+	parents := make(map[string]int)
+	for _, s := range exp.Spans() {
+		if s.Name == "gorm.query" {
+			parents[s.ParentSpanID.String()]++
+		}
+	}
+	assert.Len(t, parents, 8, "every operation should trace its own statement")
+	for _, n := range parents {
+		assert.Equal(t, 1, n, "statements should be traced once")
+	}
+}
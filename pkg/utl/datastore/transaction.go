@@ -0,0 +1,124 @@
+package datastore
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Transactor runs units of work, functions spanning several store calls, in
+// transactions bound to a context
+type Transactor struct {
+	db *gorm.DB
+}
+
+// NewTransactor creates a new Transactor for the input db, the retry policy
+// is read from the database config db was opened with
+func NewTransactor(db *gorm.DB) *Transactor {
+	return &Transactor{db: db}
+}
+
+// Transaction runs fn in a single transaction which is committed if fn
+// returns nil, and rolled back if fn returns an error or panics. The
+// transaction is begun with ctx, so the database rolls it back as soon as
+// ctx is done, and committing it fails from then on.
+// Transactions aborted by the database because of a deadlock or a
+// serialization failure are retried with an exponential backoff, so fn may
+// run more than once and must not have side effects outside of the tx. The
+// request of ctx is pinned to the primary from then on.
+func (t *Transactor) Transaction(ctx context.Context, fn func(*gorm.DB) error) error {
+	s := settingsOf(t.db)
+	markWrite(ctx)
+	for attempt := 0; ; attempt++ {
+		err := t.run(ctx, fn)
+		if err == nil || attempt >= s.txRetries || !IsRetryableError(err) {
+			return err
+		}
+		timer := time.NewTimer(backoff(s.txBackoff, attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// run runs fn in one transaction attempt, and then the funcs registered
+// with AfterCommit if it committed
+func (t *Transactor) run(ctx context.Context, fn func(*gorm.DB) error) error {
+	db, cancel := WithContext(ctx, t.db, "transaction")
+	defer cancel()
+	pool, ok := db.CommonDB().(*ctxDB)
+	if !ok {
+		return gorm.ErrCantStartTransaction
+	}
+	sqlTx, err := pool.db.BeginTx(pool.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			_ = sqlTx.Rollback()
+			panic(r)
+		}
+	}()
+	hooks := new(commitHooks)
+	tx := bind(pool.ctx, db, &ctxTx{ctx: pool.ctx, tx: sqlTx}).InstantSet(commitHooksKey, hooks)
+	if err := fn(tx); err != nil {
+		_ = sqlTx.Rollback()
+		return err
+	}
+	if err := sqlTx.Commit(); err != nil {
+		return err
+	}
+	hooks.run()
+	return nil
+}
+
+// commitHooksKey is the gorm setting holding the funcs run once the
+// transaction of a db committed
+const commitHooksKey = "cerebrum:commit_hooks"
+
+// commitHooks are the funcs run once a transaction committed
+type commitHooks struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+func (h *commitHooks) run() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, fn := range h.fns {
+		fn()
+	}
+}
+
+// AfterCommit runs fn once the unit of work of db committed, so that its
+// writes are visible to other connections, and never if it is rolled back.
+// fn runs right away if db is not in a unit of work of a Transactor.
+func AfterCommit(db *gorm.DB, fn func()) {
+	if v, ok := db.Get(commitHooksKey); ok {
+		if h, ok := v.(*commitHooks); ok {
+			h.mu.Lock()
+			h.fns = append(h.fns, fn)
+			h.mu.Unlock()
+			return
+		}
+	}
+	fn()
+}
+
+// backoff returns the delay before the retry following attempt, it doubles
+// with every attempt and is jittered so that the competing transactions do
+// not collide again
+func backoff(base time.Duration, attempt int) time.Duration {
+	d := base << uint(attempt)
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
@@ -0,0 +1,129 @@
+package datastore_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
+)
+
+func TestTransactorRetry(t *testing.T) {
+	deadlock := &pq.Error{Code: "40P01"}
+	cases := []struct {
+		name             string
+		failures         int
+		err              error
+		expectedAttempts int
+		expectedErr      bool
+		expectedNotes    int
+	}{
+		{
+			name:             "Success on first attempt",
+			expectedAttempts: 1,
+			expectedNotes:    1,
+		},
+		{
+			name:             "Success after retrying deadlocks",
+			failures:         2,
+			err:              deadlock,
+			expectedAttempts: 3,
+			expectedNotes:    1,
+		},
+		{
+			name:             "Success after retrying a wrapped deadlock",
+			failures:         1,
+			err:              fmt.Errorf("user.update: %w", &mysql.MySQLError{Number: 1213}),
+			expectedAttempts: 2,
+			expectedNotes:    1,
+		},
+		{
+			name:             "Fail after exhausting the retries",
+			failures:         10,
+			err:              deadlock,
+			expectedAttempts: 4,
+			expectedErr:      true,
+		},
+		{
+			name:             "Fail without retrying other errors",
+			failures:         1,
+			err:              errors.New("constraint violation"),
+			expectedAttempts: 1,
+			expectedErr:      true,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t, nil)
+			defer db.Close()
+			tr := datastore.NewTransactor(db)
+
+			attempts := 0
+			err := tr.Transaction(context.Background(), func(tx *gorm.DB) error {
+				attempts++
+				if err := tx.Create(&note{Text: "unit of work"}).Error; err != nil {
+					return err
+				}
+				if attempts <= tt.failures {
+					return tt.err
+				}
+				return nil
+			})
+			assert.Equal(t, tt.expectedErr, err != nil, "unexpected error %v", err)
+			assert.Equal(t, tt.expectedAttempts, attempts)
+
+			var n int
+			assert.Nil(t, db.Model(&note{}).Count(&n).Error)
+			assert.Equal(t, tt.expectedNotes, n, "failed attempts should be rolled back")
+		})
+	}
+}
+
+func TestTransactorRetryCanceled(t *testing.T) {
+	db := newTestDB(t, nil)
+	defer db.Close()
+	tr := datastore.NewTransactor(db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	err := tr.Transaction(ctx, func(tx *gorm.DB) error {
+		attempts++
+		cancel()
+		return &pq.Error{Code: "40P01"}
+	})
+	assert.Equal(t, context.Canceled, err, "a canceled request should not be retried")
+	assert.Equal(t, 1, attempts)
+}
+
+func TestAfterCommit(t *testing.T) {
+	db := newTestDB(t, nil)
+	defer db.Close()
+	tr := datastore.NewTransactor(db)
+
+	var ran []string
+	err := tr.Transaction(context.Background(), func(tx *gorm.DB) error {
+		cdb, cancel := datastore.WithContext(context.Background(), tx, "note.create")
+		defer cancel()
+		datastore.AfterCommit(cdb, func() { ran = append(ran, "committed") })
+		assert.Empty(t, ran, "hooks should not run before the commit")
+		return cdb.Create(&note{Text: "committed"}).Error
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"committed"}, ran)
+
+	err = tr.Transaction(context.Background(), func(tx *gorm.DB) error {
+		datastore.AfterCommit(tx, func() { ran = append(ran, "rolled back") })
+		return errors.New("failed")
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"committed"}, ran, "hooks should not run once rolled back")
+
+	datastore.AfterCommit(db, func() { ran = append(ran, "direct") })
+	assert.Equal(t, []string{"committed", "direct"}, ran, "hooks should run right away outside of units of work")
+}
@@ -0,0 +1,64 @@
+package eventbus
+
+import (
+	"fmt"
+	"sync"
+)
+
+// AllTopics can be used to subscribe a handler to every topic
+const AllTopics = "*"
+
+// Handler processes a single event delivered by a broker
+type Handler func(Event) error
+
+// Broker represents the event broker interface used by the dispatcher
+type Broker interface {
+	Publish(Event) error
+	Subscribe(string, Handler)
+}
+
+// InMemoryBroker fans events out synchronously to in-process subscribers
+type InMemoryBroker struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+// NewInMemoryBroker creates a new broker without subscribers
+func NewInMemoryBroker() *InMemoryBroker {
+	return &InMemoryBroker{handlers: make(map[string][]Handler)}
+}
+
+// Subscribe registers h for events on topic, or on every topic with AllTopics
+func (b *InMemoryBroker) Subscribe(topic string, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[topic] = append(b.handlers[topic], h)
+}
+
+// Publish delivers the event to every subscriber of its topic. All subscribers
+// are called even when some fail, the first error is returned so the
+// dispatcher retries the event later. Subscribers must therefore be idempotent.
+func (b *InMemoryBroker) Publish(e Event) error {
+	b.mu.RLock()
+	handlers := make([]Handler, 0, len(b.handlers[e.Topic])+len(b.handlers[AllTopics]))
+	handlers = append(handlers, b.handlers[e.Topic]...)
+	handlers = append(handlers, b.handlers[AllTopics]...)
+	b.mu.RUnlock()
+
+	var (
+		firstErr error
+		failed   int
+	)
+	for _, h := range handlers {
+		if err := h(e); err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if firstErr != nil {
+		return fmt.Errorf("%d of %d subscribers failed for %s event %d, %v", failed, len(handlers), e.Topic, e.ID, firstErr)
+	}
+	return nil
+}
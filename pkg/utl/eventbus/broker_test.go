@@ -0,0 +1,60 @@
+package eventbus_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/eventbus"
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+func TestInMemoryBroker(t *testing.T) {
+	t.Run("events should fan out to topic and wildcard subscribers only", func(t *testing.T) {
+		b := eventbus.NewInMemoryBroker()
+		var created, deleted, all []uint
+		b.Subscribe(models.EventUserCreated, func(e eventbus.Event) error {
+			created = append(created, e.ID)
+			return nil
+		})
+		b.Subscribe(models.EventUserDeleted, func(e eventbus.Event) error {
+			deleted = append(deleted, e.ID)
+			return nil
+		})
+		b.Subscribe(eventbus.AllTopics, func(e eventbus.Event) error {
+			all = append(all, e.ID)
+			return nil
+		})
+
+		assert.Nil(t, b.Publish(eventbus.Event{ID: 1, Topic: models.EventUserCreated}))
+		assert.Nil(t, b.Publish(eventbus.Event{ID: 2, Topic: models.EventUserUpdated}))
+
+		assert.Equal(t, []uint{1}, created, "created subscriber should only receive created events")
+		assert.Nil(t, deleted, "deleted subscriber should not receive any events")
+		assert.Equal(t, []uint{1, 2}, all, "wildcard subscriber should receive every event")
+	})
+
+	t.Run("a failing subscriber should not stop delivery to the others", func(t *testing.T) {
+		b := eventbus.NewInMemoryBroker()
+		delivered := 0
+		b.Subscribe(models.EventUserCreated, func(e eventbus.Event) error {
+			return models.ErrGeneric
+		})
+		b.Subscribe(models.EventUserCreated, func(e eventbus.Event) error {
+			delivered++
+			return nil
+		})
+
+		err := b.Publish(eventbus.Event{ID: 1, Topic: models.EventUserCreated})
+		assert.NotNil(t, err, "the subscriber error should be returned so the event is retried")
+		assert.Equal(t, 1, delivered, "the healthy subscriber should still receive the event")
+	})
+}
+
+func TestEventDecode(t *testing.T) {
+	e := eventbus.Event{Payload: []byte(`{"id":7,"username":"marcopolo"}`)}
+	usr := new(models.User)
+	assert.Nil(t, e.Decode(usr))
+	assert.Equal(t, uint(7), usr.ID)
+	assert.Equal(t, "marcopolo", usr.Username)
+}
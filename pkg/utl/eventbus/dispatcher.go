@@ -0,0 +1,164 @@
+package eventbus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+// Dispatcher defaults used when the events config omits a value
+const (
+	defaultDispatchInterval = time.Second
+	defaultBatchSize        = 100
+	defaultMaxAttempts      = 10
+	defaultLease            = 30 * time.Second
+)
+
+// Dispatcher polls the outbox table and hands pending events to the broker.
+// Delivery is at-least-once: an event is only marked dispatched after the
+// broker accepted it, and failed events are retried until MaxAttempts.
+// Dispatchers running on several replicas claim rows with a lease before
+// publishing them, so an event is only handed out twice if its claim expired.
+type Dispatcher struct {
+	db          *gorm.DB
+	broker      Broker
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+	lease       time.Duration
+}
+
+// NewDispatcher creates a new outbox dispatcher
+func NewDispatcher(db *gorm.DB, b Broker, cfg *config.Events) *Dispatcher {
+	d := &Dispatcher{
+		db:          db,
+		broker:      b,
+		interval:    defaultDispatchInterval,
+		batchSize:   defaultBatchSize,
+		maxAttempts: defaultMaxAttempts,
+		lease:       defaultLease,
+	}
+	if cfg == nil {
+		return d
+	}
+	if cfg.DispatchInterval > 0 {
+		d.interval = time.Duration(cfg.DispatchInterval) * time.Millisecond
+	}
+	if cfg.BatchSize > 0 {
+		d.batchSize = cfg.BatchSize
+	}
+	if cfg.MaxAttempts > 0 {
+		d.maxAttempts = cfg.MaxAttempts
+	}
+	if cfg.Lease > 0 {
+		d.lease = time.Duration(cfg.Lease) * time.Second
+	}
+	return d
+}
+
+// Run dispatches pending events every interval until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := d.Dispatch(ctx); err != nil {
+				log.Printf("outbox dispatch error %v", err)
+			}
+		}
+	}
+}
+
+// Dispatch delivers one batch of pending events in the order they were
+// recorded and returns the number of events successfully delivered, the
+// batch is abandoned once ctx is done
+func (d *Dispatcher) Dispatch(ctx context.Context) (int, error) {
+	db, cancel := datastore.WithContext(ctx, d.db, "outbox.dispatch")
+	defer cancel()
+	pending, err := d.claim(db)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for i := range pending {
+		row := &pending[i]
+		if err := d.broker.Publish(newEventFrom(row)); err != nil {
+			if err := db.Model(row).Updates(map[string]interface{}{
+				"attempts":      row.Attempts + 1,
+				"last_error":    err.Error(),
+				"claimed_until": gorm.Expr("NULL"),
+			}).Error; err != nil {
+				return delivered, err
+			}
+			continue
+		}
+		if err := db.Model(row).Update("dispatched_at", time.Now()).Error; err != nil {
+			return delivered, err
+		}
+		delivered++
+	}
+	return delivered, nil
+}
+
+// claim leases the next batch of pending events to this dispatch and
+// returns them, rows claimed by another dispatcher are skipped until their
+// lease expires
+func (d *Dispatcher) claim(db *gorm.DB) ([]models.OutboxEvent, error) {
+	now := time.Now().UTC()
+	claimable := db.Where("dispatched_at IS NULL AND attempts < ?", d.maxAttempts).
+		Where("claimed_until IS NULL OR claimed_until < ?", now)
+	var ids []uint
+	if err := claimable.Model(&models.OutboxEvent{}).
+		Order("id asc").Limit(d.batchSize).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	token, err := newClaimToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := claimable.Model(&models.OutboxEvent{}).Where("id IN (?)", ids).Updates(map[string]interface{}{
+		"claimed_by":    token,
+		"claimed_until": now.Add(d.lease),
+	}).Error; err != nil {
+		return nil, err
+	}
+	var claimed []models.OutboxEvent
+	err = db.Where("claimed_by = ?", token).Order("id asc").Find(&claimed).Error
+	return claimed, err
+}
+
+// newClaimToken returns a random 128 bit claim token in hex
+func newClaimToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// newEventFrom converts an outbox row into a broker event
+func newEventFrom(row *models.OutboxEvent) Event {
+	return Event{
+		ID:          row.ID,
+		Topic:       row.Topic,
+		AggregateID: row.AggregateID,
+		Payload:     json.RawMessage(row.Payload),
+		OccurredAt:  row.CreatedAt,
+	}
+}
@@ -0,0 +1,157 @@
+package eventbus_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+	"github.com/johncoleman83/cerebrum/pkg/utl/eventbus"
+	"github.com/johncoleman83/cerebrum/pkg/utl/mock/mockstore"
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+func TestOutboxPublish(t *testing.T) {
+	db, err := mockstore.NewDataBaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	outbox := eventbus.NewOutbox()
+	errRollback := errors.New("rollback")
+
+	t.Run("events should not be stored when the transaction rolls back", func(t *testing.T) {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := outbox.Publish(context.Background(), tx, models.EventUserCreated, 1, models.User{Username: "rolledback"}); err != nil {
+				return err
+			}
+			return errRollback
+		})
+		assert.Equal(t, errRollback, err)
+		count := 0
+		assert.Nil(t, db.Model(&models.OutboxEvent{}).Count(&count).Error)
+		assert.Equal(t, 0, count, "the outbox should be empty after a rollback")
+	})
+
+	t.Run("events should be stored when the transaction commits", func(t *testing.T) {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return outbox.Publish(context.Background(), tx, models.EventUserCreated, 2, models.User{Username: "committed"})
+		})
+		assert.Nil(t, err)
+		row := new(models.OutboxEvent)
+		assert.Nil(t, db.First(row).Error)
+		assert.Equal(t, models.EventUserCreated, row.Topic)
+		assert.Equal(t, uint(2), row.AggregateID)
+		assert.Contains(t, row.Payload, `"username":"committed"`)
+		assert.Nil(t, row.DispatchedAt)
+	})
+}
+
+func TestDispatch(t *testing.T) {
+	db, err := mockstore.NewDataBaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	outbox := eventbus.NewOutbox()
+	for id := uint(1); id <= 3; id++ {
+		if err := outbox.Publish(context.Background(), db, models.EventUserCreated, id, models.User{Base: models.Base{ID: id}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	broker := eventbus.NewInMemoryBroker()
+	var received []uint
+	failing := true
+	broker.Subscribe(models.EventUserCreated, func(e eventbus.Event) error {
+		if e.AggregateID == 2 && failing {
+			return models.ErrGeneric
+		}
+		received = append(received, e.AggregateID)
+		return nil
+	})
+	d := eventbus.NewDispatcher(db, broker, &config.Events{MaxAttempts: 2})
+
+	t.Run("failed events should be kept for a retry", func(t *testing.T) {
+		delivered, err := d.Dispatch(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, 2, delivered)
+		assert.Equal(t, []uint{1, 3}, received)
+
+		row := new(models.OutboxEvent)
+		assert.Nil(t, db.Where("aggregate_id = ?", 2).First(row).Error)
+		assert.Equal(t, 1, row.Attempts)
+		assert.Nil(t, row.DispatchedAt)
+		assert.NotEmpty(t, row.LastError)
+	})
+
+	t.Run("retried events should be delivered once the subscriber recovers", func(t *testing.T) {
+		failing = false
+		delivered, err := d.Dispatch(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, 1, delivered)
+		assert.Equal(t, []uint{1, 3, 2}, received)
+
+		delivered, err = d.Dispatch(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, 0, delivered, "dispatched events should never be delivered twice")
+	})
+
+	t.Run("events should be given up after max attempts", func(t *testing.T) {
+		if err := outbox.Publish(context.Background(), db, models.EventUserCreated, 2, models.User{}); err != nil {
+			t.Fatal(err)
+		}
+		failing = true
+		for i := 0; i < 3; i++ {
+			delivered, err := d.Dispatch(context.Background())
+			assert.Nil(t, err)
+			assert.Equal(t, 0, delivered)
+		}
+		row := new(models.OutboxEvent)
+		assert.Nil(t, db.Where("aggregate_id = ? AND dispatched_at IS NULL", 2).First(row).Error)
+		assert.Equal(t, 2, row.Attempts, "attempts should stop at the configured maximum")
+	})
+}
+
+func TestDispatchClaims(t *testing.T) {
+	db, err := mockstore.NewDataBaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	outbox := eventbus.NewOutbox()
+	for id := uint(1); id <= 2; id++ {
+		if err := outbox.Publish(context.Background(), db, models.EventUserCreated, id, models.User{Base: models.Base{ID: id}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	other := eventbus.NewDispatcher(db, eventbus.NewInMemoryBroker(), nil)
+	broker := eventbus.NewInMemoryBroker()
+	var received []uint
+	concurrent := -1
+	broker.Subscribe(models.EventUserCreated, func(e eventbus.Event) error {
+		if concurrent < 0 {
+			delivered, err := other.Dispatch(context.Background())
+			assert.Nil(t, err)
+			concurrent = delivered
+		}
+		received = append(received, e.AggregateID)
+		return nil
+	})
+	d := eventbus.NewDispatcher(db, broker, nil)
+
+	t.Run("claimed events should not be delivered by a concurrent dispatcher", func(t *testing.T) {
+		delivered, err := d.Dispatch(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, 2, delivered)
+		assert.Equal(t, []uint{1, 2}, received)
+		assert.Equal(t, 0, concurrent, "the concurrent dispatcher should skip claimed events")
+	})
+}
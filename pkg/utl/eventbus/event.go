@@ -0,0 +1,23 @@
+// Package eventbus contains the domain event bus. Services record events in
+// the outbox table inside the same transaction as the write they describe,
+// and the dispatcher later fans them out to subscribers through a broker.
+package eventbus
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event represents a dispatched domain event as seen by brokers and subscribers
+type Event struct {
+	ID          uint            `json:"id"`
+	Topic       string          `json:"topic"`
+	AggregateID uint            `json:"aggregate_id"`
+	Payload     json.RawMessage `json:"payload"`
+	OccurredAt  time.Time       `json:"occurred_at"`
+}
+
+// Decode unmarshals the event's JSON payload into v
+func (e Event) Decode(v interface{}) error {
+	return json.Unmarshal(e.Payload, v)
+}
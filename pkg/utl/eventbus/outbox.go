@@ -0,0 +1,37 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+// Outbox writes domain events into the outbox table
+type Outbox struct{}
+
+// NewOutbox returns a new outbox publisher
+func NewOutbox() *Outbox {
+	return &Outbox{}
+}
+
+// Publish serializes the payload and stores a new event in the outbox table.
+// db should be the transaction that holds the write the event describes, so
+// that the event is only ever visible to the dispatcher if the write commits.
+func (o *Outbox) Publish(ctx context.Context, db *gorm.DB, topic string, aggregateID uint, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("unable to encode %s event payload, %v", topic, err)
+	}
+	db, cancel := datastore.WithContext(ctx, db, "outbox.publish")
+	defer cancel()
+	return db.Create(&models.OutboxEvent{
+		Topic:       topic,
+		AggregateID: aggregateID,
+		Payload:     string(data),
+	}).Error
+}
@@ -0,0 +1,312 @@
+// Package idempotency replays the responses of mutating requests retried
+// with the same Idempotency-Key header, so that retries of timed out
+// requests do not apply them twice.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+// Header is the request header holding the idempotency key
+const Header = "Idempotency-Key"
+
+// ReplayedHeader is set on the responses which are replayed
+const ReplayedHeader = "Idempotent-Replayed"
+
+// maxKeyLength is the size of the key column
+const maxKeyLength = 255
+
+// replayedHeaders are the response headers stored with the response and
+// replayed, besides its content type
+var replayedHeaders = []string{echo.HeaderLocation, echo.HeaderLastModified, "ETag", "Link"}
+
+// Keys defaults used when the idempotency config omits a value
+const (
+	defaultRetention     = 24 * time.Hour
+	defaultPurgeInterval = time.Hour
+	defaultLockTimeout   = time.Minute
+)
+
+// Custom errors
+var (
+	ErrKeyTooLong = models.NewError(http.StatusBadRequest, "idempotency_key_too_long", "Idempotency-Key must be at most 255 characters long.")
+	ErrKeyReused  = models.NewError(http.StatusUnprocessableEntity, "idempotency_key_reused", "Idempotency-Key was already used by a different request.")
+	ErrInFlight   = models.NewError(http.StatusConflict, "idempotency_key_in_flight", "A request with the same Idempotency-Key is in progress, retry later.")
+)
+
+// Cipher represents the encryption of the stored responses
+type Cipher interface {
+	Encrypt(string) (string, error)
+	Decrypt(string) (string, error)
+}
+
+// Keys stores the responses of the requests sent with an idempotency key
+// in the idempotency keys table
+type Keys struct {
+	db          *gorm.DB
+	cipher      Cipher
+	retention   time.Duration
+	interval    time.Duration
+	lockTimeout time.Duration
+}
+
+// New creates new idempotency keys stored in db
+func New(db *gorm.DB, c Cipher, cfg *config.Idempotency) *Keys {
+	k := &Keys{
+		db:          db,
+		cipher:      c,
+		retention:   defaultRetention,
+		interval:    defaultPurgeInterval,
+		lockTimeout: defaultLockTimeout,
+	}
+	if cfg == nil {
+		return k
+	}
+	if cfg.Retention > 0 {
+		k.retention = time.Duration(cfg.Retention) * time.Hour
+	}
+	if cfg.PurgeInterval > 0 {
+		k.interval = time.Duration(cfg.PurgeInterval) * time.Minute
+	}
+	if cfg.LockTimeout > 0 {
+		k.lockTimeout = time.Duration(cfg.LockTimeout) * time.Second
+	}
+	return k
+}
+
+// Middleware returns a middleware which stores the response of the POST,
+// PATCH and DELETE requests sent with an idempotency key and replays it to
+// the requests repeating the key and the payload. Keys reused by different
+// requests are rejected, as are repeats of requests still in flight. Server
+// errors are not stored so that the requests failing them may be retried.
+// It must run after the authentication of the requests, keys are scoped to
+// their user.
+func (k *Keys) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			key := req.Header.Get(Header)
+			if key == "" || !mutating(req.Method) {
+				return next(c)
+			}
+			if len(key) > maxKeyLength {
+				return ErrKeyTooLong
+			}
+			body, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				return err
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			row := &models.IdempotencyKey{Key: key, RequestHash: hash(req, body)}
+			if u, ok := models.PrincipalFrom(req.Context()); ok {
+				row.UserID = u.ID
+			}
+			prev, err := k.claim(req.Context(), row)
+			if err != nil {
+				return err
+			}
+			if prev != nil {
+				return k.replay(c, row, prev)
+			}
+
+			res := c.Response()
+			rec := &recorder{ResponseWriter: res.Writer}
+			res.Writer = rec
+			defer func() {
+				res.Writer = rec.ResponseWriter
+				// the panic is answered by the recover middleware with a
+				// server error, which is not stored
+				if r := recover(); r != nil {
+					k.release(row)
+					panic(r)
+				}
+			}()
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+			k.complete(row, res, rec.body.Bytes())
+			return nil
+		}
+	}
+}
+
+// mutating reports whether requests of method are replayed
+func mutating(method string) bool {
+	return method == http.MethodPost || method == http.MethodPatch || method == http.MethodDelete
+}
+
+// hash returns the hash of the method, the uri and the body of req
+func hash(req *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method + " " + req.URL.RequestURI() + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// claim stores row as in flight and returns nil, or the row of the previous
+// request with the same key. Expired and abandoned rows are replaced.
+func (k *Keys) claim(ctx context.Context, row *models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	db, cancel := datastore.WithContext(ctx, k.db, "idempotency.claim")
+	defer cancel()
+	for attempt := 0; attempt < 3; attempt++ {
+		err := db.Create(row).Error
+		if err == nil || !datastore.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+		prev := new(models.IdempotencyKey)
+		err = db.Where("user_id = ? AND idempotency_key = ?", row.UserID, row.Key).First(prev).Error
+		if gorm.IsRecordNotFoundError(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !k.expired(prev) {
+			return prev, nil
+		}
+		if err := db.Delete(prev).Error; err != nil {
+			return nil, err
+		}
+	}
+	return nil, ErrInFlight
+}
+
+// expired reports whether row is past its retention, or still in flight
+// past the lock timeout as its request was abandoned
+func (k *Keys) expired(row *models.IdempotencyKey) bool {
+	age := time.Since(row.CreatedAt)
+	return age > k.retention || row.Status == 0 && age > k.lockTimeout
+}
+
+// replay writes the response of prev, the previous request with the key of
+// the request of row
+func (k *Keys) replay(c echo.Context, row, prev *models.IdempotencyKey) error {
+	if prev.RequestHash != row.RequestHash {
+		return ErrKeyReused
+	}
+	if prev.Status == 0 {
+		return ErrInFlight
+	}
+	body, err := k.cipher.Decrypt(prev.Body)
+	if err != nil {
+		return err
+	}
+	h := c.Response().Header()
+	if prev.Headers != "" {
+		var headers map[string]string
+		if err := json.Unmarshal([]byte(prev.Headers), &headers); err != nil {
+			return err
+		}
+		for name, v := range headers {
+			h.Set(name, v)
+		}
+	}
+	h.Set(ReplayedHeader, "true")
+	if prev.ContentType == "" {
+		return c.NoContent(prev.Status)
+	}
+	return c.Blob(prev.Status, prev.ContentType, []byte(body))
+}
+
+// complete stores the response of the request of row, or removes row if it
+// failed with a server error. It runs after the request context may have
+// been canceled, which would leave row in flight.
+func (k *Keys) complete(row *models.IdempotencyKey, res *echo.Response, body []byte) {
+	db, cancel := datastore.WithContext(context.Background(), k.db, "idempotency.complete")
+	defer cancel()
+	err := k.store(db, row, res, body)
+	if err != nil {
+		log.Printf("idempotency key error %v", err)
+	}
+}
+
+// store updates row with the response res of its request holding body
+func (k *Keys) store(db *gorm.DB, row *models.IdempotencyKey, res *echo.Response, body []byte) error {
+	if res.Status >= http.StatusInternalServerError {
+		return db.Delete(row).Error
+	}
+	sealed, err := k.cipher.Encrypt(string(body))
+	if err != nil {
+		db.Delete(row)
+		return err
+	}
+	headers := make(map[string]string)
+	for _, name := range replayedHeaders {
+		if v := res.Header().Get(name); v != "" {
+			headers[name] = v
+		}
+	}
+	encoded, err := json.Marshal(headers)
+	if err != nil {
+		db.Delete(row)
+		return err
+	}
+	return db.Model(row).Updates(map[string]interface{}{
+		"status":       res.Status,
+		"content_type": res.Header().Get(echo.HeaderContentType),
+		"headers":      string(encoded),
+		"body":         sealed,
+	}).Error
+}
+
+// release removes row of a request which panicked, so that its retries are
+// not rejected as in flight until the lock timeout
+func (k *Keys) release(row *models.IdempotencyKey) {
+	db, cancel := datastore.WithContext(context.Background(), k.db, "idempotency.release")
+	defer cancel()
+	if err := db.Delete(row).Error; err != nil {
+		log.Printf("idempotency key error %v", err)
+	}
+}
+
+// Run purges expired keys every interval until ctx is done
+func (k *Keys) Run(ctx context.Context) {
+	ticker := time.NewTicker(k.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := k.Purge(ctx); err != nil {
+				log.Printf("idempotency key purge error %v", err)
+			}
+		}
+	}
+}
+
+// Purge deletes the keys stored before the retention period and returns
+// the number of deleted keys
+func (k *Keys) Purge(ctx context.Context) (int64, error) {
+	db, cancel := datastore.WithContext(ctx, k.db, "idempotency.purge")
+	defer cancel()
+	res := db.Where("created_at < ?", time.Now().Add(-k.retention)).Delete(&models.IdempotencyKey{})
+	return res.RowsAffected, res.Error
+}
+
+// recorder copies the body written to a response
+type recorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
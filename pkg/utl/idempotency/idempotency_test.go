@@ -0,0 +1,261 @@
+package idempotency_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+	"github.com/johncoleman83/cerebrum/pkg/utl/idempotency"
+	"github.com/johncoleman83/cerebrum/pkg/utl/mock/mockstore"
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+	"github.com/johncoleman83/cerebrum/pkg/utl/server"
+)
+
+func TestMiddleware(t *testing.T) {
+	db, err := mockstore.NewDataBaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	kr, err := mockstore.NewKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := idempotency.New(db, kr, nil)
+
+	created := 0
+	e := server.New(nil)
+	authenticate := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			id := uint(1)
+			if req.Header.Get("X-User") == "2" {
+				id = 2
+			}
+			c.SetRequest(req.WithContext(models.WithPrincipal(req.Context(), &models.AuthUser{ID: id})))
+			return next(c)
+		}
+	}
+	e.Use(authenticate, keys.Middleware())
+	e.POST("/users", func(c echo.Context) error {
+		var u struct {
+			Email string `json:"email"`
+		}
+		if err := c.Bind(&u); err != nil {
+			return err
+		}
+		switch u.Email {
+		case "down@mail.com":
+			return echo.NewHTTPError(http.StatusServiceUnavailable)
+		case "taken@mail.com":
+			return models.NewError(http.StatusConflict, "already_exists", "username or email already exists")
+		case "panic@mail.com":
+			panic("boom")
+		}
+		created++
+		c.Response().Header().Set("ETag", `"`+strconv.Itoa(created)+`"`)
+		return c.JSON(http.StatusCreated, map[string]interface{}{"id": created, "email": u.Email})
+	})
+
+	cases := []struct {
+		name         string
+		key          string
+		user         string
+		body         string
+		wantStatus   int
+		wantBody     string
+		wantCode     string
+		wantETag     string
+		wantReplayed bool
+		wantCreated  int
+	}{
+		{
+			name:        "Runs requests without a key",
+			body:        `{"email":"a@mail.com"}`,
+			wantStatus:  http.StatusCreated,
+			wantBody:    `{"email":"a@mail.com","id":1}`,
+			wantCreated: 1,
+		},
+		{
+			name:        "Runs the first request of a key",
+			key:         "k1",
+			body:        `{"email":"b@mail.com"}`,
+			wantStatus:  http.StatusCreated,
+			wantBody:    `{"email":"b@mail.com","id":2}`,
+			wantETag:    `"2"`,
+			wantCreated: 2,
+		},
+		{
+			name:         "Replays the response to repeats",
+			key:          "k1",
+			body:         `{"email":"b@mail.com"}`,
+			wantStatus:   http.StatusCreated,
+			wantBody:     `{"email":"b@mail.com","id":2}`,
+			wantETag:     `"2"`,
+			wantReplayed: true,
+			wantCreated:  2,
+		},
+		{
+			name:        "Rejects keys reused with another payload",
+			key:         "k1",
+			body:        `{"email":"c@mail.com"}`,
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantCreated: 2,
+		},
+		{
+			name:        "Scopes keys to their user",
+			key:         "k1",
+			user:        "2",
+			body:        `{"email":"c@mail.com"}`,
+			wantStatus:  http.StatusCreated,
+			wantBody:    `{"email":"c@mail.com","id":3}`,
+			wantCreated: 3,
+		},
+		{
+			name:        "Stores client errors",
+			key:         "k2",
+			body:        `{"email":"taken@mail.com"}`,
+			wantStatus:  http.StatusConflict,
+			wantCode:    "already_exists",
+			wantCreated: 3,
+		},
+		{
+			name:         "Replays client errors",
+			key:          "k2",
+			body:         `{"email":"taken@mail.com"}`,
+			wantStatus:   http.StatusConflict,
+			wantCode:     "already_exists",
+			wantReplayed: true,
+			wantCreated:  3,
+		},
+		{
+			name:        "Does not store server errors",
+			key:         "k3",
+			body:        `{"email":"down@mail.com"}`,
+			wantStatus:  http.StatusServiceUnavailable,
+			wantCreated: 3,
+		},
+		{
+			name:        "Lets failed requests be retried",
+			key:         "k3",
+			body:        `{"email":"down@mail.com"}`,
+			wantStatus:  http.StatusServiceUnavailable,
+			wantCreated: 3,
+		},
+		{
+			name:        "Does not store panics",
+			key:         "k4",
+			body:        `{"email":"panic@mail.com"}`,
+			wantStatus:  http.StatusInternalServerError,
+			wantCreated: 3,
+		},
+		{
+			name:        "Lets panicked requests be retried",
+			key:         "k4",
+			body:        `{"email":"panic@mail.com"}`,
+			wantStatus:  http.StatusInternalServerError,
+			wantCreated: 3,
+		},
+		{
+			name:        "Rejects long keys",
+			key:         strings.Repeat("k", 256),
+			body:        `{"email":"d@mail.com"}`,
+			wantStatus:  http.StatusBadRequest,
+			wantCreated: 3,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			if tt.key != "" {
+				req.Header.Set(idempotency.Header, tt.key)
+			}
+			req.Header.Set("X-User", tt.user)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, rec.Body.String())
+			}
+			if tt.wantCode != "" {
+				assert.Contains(t, rec.Body.String(), `"code":"`+tt.wantCode+`"`)
+			}
+			if tt.wantETag != "" {
+				assert.Equal(t, tt.wantETag, rec.Header().Get("ETag"), "headers should be replayed")
+			}
+			assert.Equal(t, tt.wantReplayed, rec.Header().Get(idempotency.ReplayedHeader) == "true")
+			assert.Equal(t, tt.wantCreated, created)
+		})
+	}
+
+	var row models.IdempotencyKey
+	assert.Nil(t, db.Where("idempotency_key = ? AND user_id = ?", "k1", 1).First(&row).Error)
+	assert.NotContains(t, row.Body, "b@mail.com", "responses should be stored sealed")
+}
+
+func TestInFlight(t *testing.T) {
+	db, err := mockstore.NewDataBaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	kr, err := mockstore.NewKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := idempotency.New(db, kr, &config.Idempotency{LockTimeout: 1})
+
+	e := server.New(nil)
+	e.Use(keys.Middleware())
+	e.DELETE("/users/1", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/users/1", nil)
+		req.Header.Set(idempotency.Header, "k1")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, send().Code)
+	assert.Nil(t, db.Exec("UPDATE idempotency_keys SET status = 0").Error)
+	assert.Equal(t, http.StatusConflict, send().Code, "repeats of requests in flight should be rejected")
+
+	assert.Nil(t, db.Exec("UPDATE idempotency_keys SET created_at = ?", time.Now().Add(-2*time.Second)).Error)
+	rec := send()
+	assert.Equal(t, http.StatusOK, rec.Code, "abandoned keys should be claimed again")
+	assert.Equal(t, "", rec.Header().Get(idempotency.ReplayedHeader))
+
+	rec = send()
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "true", rec.Header().Get(idempotency.ReplayedHeader), "responses without a body should be replayed")
+}
+
+func TestPurge(t *testing.T) {
+	db, err := mockstore.NewDataBaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	keys := idempotency.New(db, nil, &config.Idempotency{Retention: 1})
+	assert.Nil(t, mockstore.InsertRowsFor(db,
+		&models.IdempotencyKey{Key: "old", CreatedAt: time.Now().Add(-2 * time.Hour)},
+		&models.IdempotencyKey{Key: "new"},
+	))
+	n, err := keys.Purge(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	var left []models.IdempotencyKey
+	assert.Nil(t, db.Find(&left).Error)
+	if assert.Len(t, left, 1) {
+		assert.Equal(t, "new", left[0].Key)
+	}
+}
@@ -0,0 +1,234 @@
+// Package keyring encrypts personal data at rest with envelope encryption.
+// Every value is sealed with its own random data key, which is in turn sealed
+// with the active key encryption key of the keyring. Older keys are kept to
+// open values sealed before a rotation.
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+)
+
+// prefix marks sealed values, values without it are legacy plaintext
+const prefix = "enc:v1:"
+
+// keySize is the size of the key encryption, data and blind index keys
+const keySize = 32
+
+// ErrMalformed is returned when a sealed value cannot be parsed
+var ErrMalformed = errors.New("keyring: malformed sealed value")
+
+// Keyring seals and opens values and computes blind indexes
+type Keyring struct {
+	active string
+	keks   map[string]cipher.AEAD
+	index  []byte
+}
+
+// New creates a new keyring from the encryption config, merged with the
+// key file of the config if any
+func New(cfg *config.Encryption) (*Keyring, error) {
+	if cfg == nil {
+		return nil, errors.New("keyring: missing encryption config")
+	}
+	merged, err := withKeyFile(cfg)
+	if err != nil {
+		return nil, err
+	}
+	k := &Keyring{active: merged.ActiveKey, keks: make(map[string]cipher.AEAD, len(merged.Keys))}
+	for id, encoded := range merged.Keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("keyring: invalid key id %q", id)
+		}
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("keyring: key %q: %v", id, err)
+		}
+		if k.keks[id], err = newAEAD(key); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := k.keks[k.active]; !ok {
+		return nil, fmt.Errorf("keyring: active key %q is not configured", k.active)
+	}
+	if k.index, err = decodeKey(merged.BlindIndexKey); err != nil {
+		return nil, fmt.Errorf("keyring: blind index key: %v", err)
+	}
+	return k, nil
+}
+
+// withKeyFile returns cfg with the keys of its key file added, the active
+// and blind index keys of cfg take precedence over the ones of the file
+func withKeyFile(cfg *config.Encryption) (*config.Encryption, error) {
+	merged := &config.Encryption{
+		ActiveKey:     cfg.ActiveKey,
+		Keys:          make(map[string]string, len(cfg.Keys)),
+		BlindIndexKey: cfg.BlindIndexKey,
+	}
+	for id, key := range cfg.Keys {
+		merged.Keys[id] = key
+	}
+	if cfg.KeyFile == "" {
+		return merged, nil
+	}
+	data, err := ioutil.ReadFile(cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("keyring: error reading key file, %v", err)
+	}
+	file := new(config.Encryption)
+	if err := yaml.Unmarshal(data, file); err != nil {
+		return nil, fmt.Errorf("keyring: unable to decode key file, %v", err)
+	}
+	for id, key := range file.Keys {
+		if v, ok := merged.Keys[id]; ok && v != key {
+			return nil, fmt.Errorf("keyring: key %q differs between config and key file", id)
+		}
+		merged.Keys[id] = key
+	}
+	if merged.ActiveKey == "" {
+		merged.ActiveKey = file.ActiveKey
+	}
+	if merged.BlindIndexKey == "" {
+		merged.BlindIndexKey = file.BlindIndexKey
+	}
+	return merged, nil
+}
+
+// decodeKey decodes a base64 encoded 256 bit key
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", keySize, len(key))
+	}
+	return key, nil
+}
+
+// newAEAD returns AES-256-GCM with key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with aead under a random nonce which is prepended
+func seal(aead cipher.AEAD, plaintext, data []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, data), nil
+}
+
+// open decrypts a value sealed by seal
+func open(aead cipher.AEAD, sealed, data []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	n := aead.NonceSize()
+	return aead.Open(nil, sealed[:n], sealed[n:], data)
+}
+
+// Encrypt seals value with a new data key wrapped by the active key, empty
+// values are kept empty
+func (k *Keyring) Encrypt(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	dek := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return "", err
+	}
+	// the key id is authenticated with the data key so it cannot be swapped
+	wrapped, err := seal(k.keks[k.active], dek, []byte(k.active))
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return "", err
+	}
+	body, err := seal(aead, []byte(value), nil)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	return prefix + k.active + ":" + enc.EncodeToString(wrapped) + ":" + enc.EncodeToString(body), nil
+}
+
+// Decrypt opens a value sealed by Encrypt with any key of the keyring,
+// values which are not sealed are returned as they are
+func (k *Keyring) Decrypt(value string) (string, error) {
+	if !strings.HasPrefix(value, prefix) {
+		return value, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", ErrMalformed
+	}
+	kek, ok := k.keks[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("keyring: unknown key %q", parts[0])
+	}
+	enc := base64.RawURLEncoding
+	wrapped, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	body, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	dek, err := open(kek, wrapped, []byte(parts[0]))
+	if err != nil {
+		return "", fmt.Errorf("keyring: unable to unwrap data key, %v", err)
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(aead, body, nil)
+	if err != nil {
+		return "", fmt.Errorf("keyring: unable to decrypt value, %v", err)
+	}
+	return string(plaintext), nil
+}
+
+// Stale reports whether value should be sealed again, because it is
+// plaintext or was sealed with a key other than the active one
+func (k *Keyring) Stale(value string) bool {
+	if value == "" {
+		return false
+	}
+	return !strings.HasPrefix(value, prefix+k.active+":")
+}
+
+// BlindIndex returns a keyed hash of value which allows exact,
+// case-insensitive lookups without decrypting, empty values have no index
+func (k *Keyring) BlindIndex(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, k.index)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
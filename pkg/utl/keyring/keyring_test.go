@@ -0,0 +1,162 @@
+package keyring_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+	"github.com/johncoleman83/cerebrum/pkg/utl/keyring"
+)
+
+const (
+	oldKey   = "AbwAR8+EB73INdsA/hJbaYoGbOLrNc/LziVCs7Anxmc="
+	newKey   = "zF38DLaO69loaz0EVtZt/R0U2COKmsc8xxRzJIJovok="
+	indexKey = "a+TALmFq5339q8JkgnvvnWCjkrhk21SOCXGs0fiWcGc="
+)
+
+func TestNew(t *testing.T) {
+	cases := []struct {
+		name        string
+		cfg         *config.Encryption
+		expectedErr bool
+	}{
+		{name: "Fail on missing config", expectedErr: true},
+		{
+			name:        "Fail on unknown active key",
+			cfg:         &config.Encryption{ActiveKey: "2", Keys: map[string]string{"1": oldKey}, BlindIndexKey: indexKey},
+			expectedErr: true,
+		},
+		{
+			name:        "Fail on short key",
+			cfg:         &config.Encryption{ActiveKey: "1", Keys: map[string]string{"1": "c2hvcnQ="}, BlindIndexKey: indexKey},
+			expectedErr: true,
+		},
+		{
+			name:        "Fail on invalid key id",
+			cfg:         &config.Encryption{ActiveKey: "a:b", Keys: map[string]string{"a:b": oldKey}, BlindIndexKey: indexKey},
+			expectedErr: true,
+		},
+		{
+			name:        "Fail on missing blind index key",
+			cfg:         &config.Encryption{ActiveKey: "1", Keys: map[string]string{"1": oldKey}},
+			expectedErr: true,
+		},
+		{
+			name:        "Fail on missing key file",
+			cfg:         &config.Encryption{KeyFile: "./path/does/not/exist"},
+			expectedErr: true,
+		},
+		{
+			name: "Success",
+			cfg:  &config.Encryption{ActiveKey: "1", Keys: map[string]string{"1": oldKey}, BlindIndexKey: indexKey},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := keyring.New(tt.cfg)
+			assert.Equal(t, tt.expectedErr, err != nil, "error: %v", err)
+			assert.Equal(t, tt.expectedErr, k == nil)
+		})
+	}
+}
+
+func TestKeyFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "keys*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	content := "active_key: \"2\"\nkeys:\n  \"2\": " + newKey + "\nblind_index_key: " + indexKey + "\n"
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	k, err := keyring.New(&config.Encryption{Keys: map[string]string{"1": oldKey}, KeyFile: f.Name()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := k.Encrypt("jane@mail.com")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(sealed, "enc:v1:2:"), "the active key of the key file should be used")
+
+	_, err = keyring.New(&config.Encryption{Keys: map[string]string{"2": oldKey}, KeyFile: f.Name()})
+	assert.NotNil(t, err, "conflicting keys should be rejected")
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	old, err := keyring.New(&config.Encryption{ActiveKey: "1", Keys: map[string]string{"1": oldKey}, BlindIndexKey: indexKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := keyring.New(&config.Encryption{ActiveKey: "2", Keys: map[string]string{"1": oldKey, "2": newKey}, BlindIndexKey: indexKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := old.Encrypt("1 Main St")
+	assert.Nil(t, err)
+	assert.NotContains(t, sealed, "Main")
+	again, err := old.Encrypt("1 Main St")
+	assert.Nil(t, err)
+	assert.NotEqual(t, sealed, again, "every value should be sealed with a new data key")
+
+	opened, err := rotated.Decrypt(sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, "1 Main St", opened, "values sealed with a retired key should still open")
+	assert.True(t, rotated.Stale(sealed))
+	assert.False(t, old.Stale(sealed))
+
+	resealed, err := rotated.Encrypt(opened)
+	assert.Nil(t, err)
+	assert.False(t, rotated.Stale(resealed))
+	_, err = old.Decrypt(resealed)
+	assert.NotNil(t, err, "values sealed with an unknown key should not open")
+
+	// a byte in the middle of the body, as the last chars may be padding bits
+	i := len(resealed) - 8
+	flipped := byte('A')
+	if resealed[i] == 'A' {
+		flipped = 'B'
+	}
+	tampered := resealed[:i] + string(flipped) + resealed[i+1:]
+	_, err = rotated.Decrypt(tampered)
+	assert.NotNil(t, err, "tampered values should not open")
+	swapped := strings.Replace(resealed, "enc:v1:2:", "enc:v1:1:", 1)
+	_, err = rotated.Decrypt(swapped)
+	assert.NotNil(t, err, "the key id should be authenticated")
+	_, err = rotated.Decrypt("enc:v1:2:garbage")
+	assert.Equal(t, keyring.ErrMalformed, err)
+
+	plain, err := rotated.Decrypt("legacy@mail.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "legacy@mail.com", plain, "plaintext values should be returned as they are")
+	assert.True(t, rotated.Stale("legacy@mail.com"))
+
+	empty, err := rotated.Encrypt("")
+	assert.Nil(t, err)
+	assert.Equal(t, "", empty)
+	assert.False(t, rotated.Stale(""))
+}
+
+func TestBlindIndex(t *testing.T) {
+	k, err := keyring.New(&config.Encryption{ActiveKey: "1", Keys: map[string]string{"1": oldKey}, BlindIndexKey: indexKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := k.BlindIndex("Jane@Mail.com")
+	assert.Len(t, idx, 64)
+	assert.Equal(t, idx, k.BlindIndex(" jane@mail.com "), "the index should ignore case and surrounding spaces")
+	assert.NotEqual(t, idx, k.BlindIndex("john@mail.com"))
+	assert.Equal(t, "", k.BlindIndex(""))
+
+	other, err := keyring.New(&config.Encryption{ActiveKey: "1", Keys: map[string]string{"1": oldKey}, BlindIndexKey: newKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEqual(t, idx, other.BlindIndex("jane@mail.com"), "the index should depend on its key")
+}
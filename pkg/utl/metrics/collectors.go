@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/cache"
+	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
+)
+
+var (
+	dbLabels = []string{"pool"}
+
+	dbMaxOpen = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", "max_open_connections"),
+		"Maximum number of open connections of the pool.", dbLabels, nil)
+	dbOpen = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", "open_connections"),
+		"Number of open connections of the pool.", dbLabels, nil)
+	dbInUse = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", "in_use_connections"),
+		"Number of connections of the pool in use.", dbLabels, nil)
+	dbIdle = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", "idle_connections"),
+		"Number of idle connections of the pool.", dbLabels, nil)
+	dbWaits = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", "waits_total"),
+		"Number of connections waited for.", dbLabels, nil)
+	dbWaitTime = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", "wait_duration_seconds_total"),
+		"Time blocked waiting for connections.", dbLabels, nil)
+	dbIdleClosed = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", "max_idle_closed_total"),
+		"Number of connections closed because of the idle connection limit.", dbLabels, nil)
+	dbLifetimeClosed = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", "max_lifetime_closed_total"),
+		"Number of connections closed because of the connection lifetime.", dbLabels, nil)
+	dbHealthy = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", "replica_healthy"),
+		"Whether the replica passed its last health check.", dbLabels, nil)
+
+	cacheLookups = prometheus.NewDesc(prometheus.BuildFQName(namespace, "cache", "lookups_total"),
+		"Number of cache lookups by result.", []string{"result"}, nil)
+)
+
+// DBCollector collects the statistics of the connection pools of a
+// database, the primary pool is labeled primary and replicas by index
+type DBCollector struct {
+	stats func() datastore.Stats
+}
+
+// NewDBCollector creates a collector of the pool statistics returned by stats
+func NewDBCollector(stats func() datastore.Stats) *DBCollector {
+	return &DBCollector{stats: stats}
+}
+
+// Describe sends the descriptors of the pool metrics
+func (d *DBCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{dbMaxOpen, dbOpen, dbInUse, dbIdle, dbWaits, dbWaitTime, dbIdleClosed, dbLifetimeClosed, dbHealthy} {
+		ch <- desc
+	}
+}
+
+// Collect sends the current pool statistics
+func (d *DBCollector) Collect(ch chan<- prometheus.Metric) {
+	st := d.stats()
+	collectPool(ch, "primary", st.Primary)
+	for i, r := range st.Replicas {
+		pool := "replica-" + strconv.Itoa(i)
+		collectPool(ch, pool, r.PoolStats)
+		healthy := 0.0
+		if r.Healthy {
+			healthy = 1
+		}
+		ch <- prometheus.MustNewConstMetric(dbHealthy, prometheus.GaugeValue, healthy, pool)
+	}
+}
+
+// collectPool sends the statistics of a pool
+func collectPool(ch chan<- prometheus.Metric, pool string, s datastore.PoolStats) {
+	ch <- prometheus.MustNewConstMetric(dbMaxOpen, prometheus.GaugeValue, float64(s.MaxOpenConnections), pool)
+	ch <- prometheus.MustNewConstMetric(dbOpen, prometheus.GaugeValue, float64(s.OpenConnections), pool)
+	ch <- prometheus.MustNewConstMetric(dbInUse, prometheus.GaugeValue, float64(s.InUse), pool)
+	ch <- prometheus.MustNewConstMetric(dbIdle, prometheus.GaugeValue, float64(s.Idle), pool)
+	ch <- prometheus.MustNewConstMetric(dbWaits, prometheus.CounterValue, float64(s.WaitCount), pool)
+	ch <- prometheus.MustNewConstMetric(dbWaitTime, prometheus.CounterValue, float64(s.WaitDurationMillis)/1000, pool)
+	ch <- prometheus.MustNewConstMetric(dbIdleClosed, prometheus.CounterValue, float64(s.MaxIdleClosed), pool)
+	ch <- prometheus.MustNewConstMetric(dbLifetimeClosed, prometheus.CounterValue, float64(s.MaxLifetimeClosed), pool)
+}
+
+// CacheCollector collects the lookup counters of a cache
+type CacheCollector struct {
+	stats func() cache.Stats
+}
+
+// NewCacheCollector creates a collector of the lookup counters returned by stats
+func NewCacheCollector(stats func() cache.Stats) *CacheCollector {
+	return &CacheCollector{stats: stats}
+}
+
+// Describe sends the descriptor of the lookup counters
+func (c *CacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheLookups
+}
+
+// Collect sends the current lookup counters
+func (c *CacheCollector) Collect(ch chan<- prometheus.Metric) {
+	st := c.stats()
+	ch <- prometheus.MustNewConstMetric(cacheLookups, prometheus.CounterValue, float64(st.Hits), "hit")
+	ch <- prometheus.MustNewConstMetric(cacheLookups, prometheus.CounterValue, float64(st.Misses), "miss")
+	ch <- prometheus.MustNewConstMetric(cacheLookups, prometheus.CounterValue, float64(st.Errors), "error")
+}
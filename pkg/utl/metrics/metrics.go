@@ -0,0 +1,151 @@
+// Package metrics records the metrics of the api and exposes them to
+// Prometheus
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the name of every metric
+const namespace = "cerebrum"
+
+// Results of the calls and attempts counted
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Metrics holds the metrics of the api in its own registry
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests     *prometheus.CounterVec
+	requestTimes *prometheus.HistogramVec
+	calls        *prometheus.CounterVec
+	callTimes    *prometheus.HistogramVec
+	logins       *prometheus.CounterVec
+	refreshes    *prometheus.CounterVec
+}
+
+// New creates the metrics of the api, along with the metrics of the go
+// runtime and of the process
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Number of HTTP requests by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		requestTimes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of HTTP requests by method, route and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		calls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "service",
+			Name:      "calls_total",
+			Help:      "Number of service method calls by service, method and result.",
+		}, []string{"service", "method", "result"}),
+		callTimes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "service",
+			Name:      "call_duration_seconds",
+			Help:      "Latency of service method calls by service and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"service", "method"}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "auth",
+			Name:      "logins_total",
+			Help:      "Number of login attempts by result.",
+		}, []string{"result"}),
+		refreshes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "auth",
+			Name:      "token_refreshes_total",
+			Help:      "Number of token refreshes by result.",
+		}, []string{"result"}),
+	}
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.requests, m.requestTimes, m.calls, m.callTimes, m.logins, m.refreshes,
+	)
+	return m
+}
+
+// Register adds collectors to the registry of the metrics
+func (m *Metrics) Register(cs ...prometheus.Collector) error {
+	for _, c := range cs {
+		if err := m.registry.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler returns the handler of GET /metrics
+func (m *Metrics) Handler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+}
+
+// Middleware returns a middleware counting requests and observing their
+// latency by route, errors are handled before so that their status is known
+func (m *Metrics) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			begin := time.Now()
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			status := c.Response().Status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			labels := prometheus.Labels{"method": c.Request().Method, "route": route, "status": strconv.Itoa(status)}
+			m.requests.With(labels).Inc()
+			m.requestTimes.With(labels).Observe(time.Since(begin).Seconds())
+			return nil
+		}
+	}
+}
+
+// ObserveCall counts a service method call by its result and observes its
+// latency
+func (m *Metrics) ObserveCall(service, method string, took time.Duration, err error) {
+	m.calls.WithLabelValues(service, method, result(err)).Inc()
+	m.callTimes.WithLabelValues(service, method).Observe(took.Seconds())
+}
+
+// CountLogin counts a login attempt by its result
+func (m *Metrics) CountLogin(err error) {
+	m.logins.WithLabelValues(result(err)).Inc()
+}
+
+// CountRefresh counts a token refresh by its result
+func (m *Metrics) CountRefresh(err error) {
+	m.refreshes.WithLabelValues(result(err)).Inc()
+}
+
+// result returns the result label of a call returning err
+func result(err error) string {
+	if err != nil {
+		return ResultFailure
+	}
+	return ResultSuccess
+}
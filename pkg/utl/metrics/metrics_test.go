@@ -0,0 +1,84 @@
+package metrics_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/cache"
+	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
+	"github.com/johncoleman83/cerebrum/pkg/utl/metrics"
+)
+
+// scrape returns the exposition of the metrics served by e
+func scrape(t *testing.T, e *echo.Echo) string {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("scraping metrics failed with %d", rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	m := metrics.New()
+	e := echo.New()
+	e.Use(m.Middleware())
+	e.GET("/metrics", m.Handler())
+	e.GET("/users/:id", func(c echo.Context) error {
+		if c.Param("id") == "0" {
+			return echo.NewHTTPError(http.StatusNotFound)
+		}
+		return c.NoContent(http.StatusOK)
+	})
+	for _, path := range []string{"/users/1", "/users/2", "/users/0"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	m.ObserveCall("user", "View", 10*time.Millisecond, nil)
+	m.ObserveCall("user", "View", 10*time.Millisecond, errors.New("not found"))
+	m.CountLogin(nil)
+	m.CountLogin(errors.New("invalid credentials"))
+	m.CountLogin(errors.New("invalid credentials"))
+	m.CountRefresh(nil)
+
+	assert.Nil(t, m.Register(
+		metrics.NewDBCollector(func() datastore.Stats {
+			return datastore.Stats{
+				Primary:  datastore.PoolStats{MaxOpenConnections: 25, OpenConnections: 3, WaitDurationMillis: 1500},
+				Replicas: []datastore.ReplicaStats{{PoolStats: datastore.PoolStats{OpenConnections: 2}, Healthy: true}},
+			}
+		}),
+		metrics.NewCacheCollector(func() cache.Stats { return cache.Stats{Hits: 7, Misses: 2} }),
+	))
+
+	out := scrape(t, e)
+	for _, line := range []string{
+		`cerebrum_http_requests_total{method="GET",route="/users/:id",status="200"} 2`,
+		`cerebrum_http_requests_total{method="GET",route="/users/:id",status="404"} 1`,
+		`cerebrum_http_request_duration_seconds_count{method="GET",route="/users/:id",status="200"} 2`,
+		`cerebrum_service_calls_total{method="View",result="success",service="user"} 1`,
+		`cerebrum_service_calls_total{method="View",result="failure",service="user"} 1`,
+		`cerebrum_service_call_duration_seconds_count{method="View",service="user"} 2`,
+		`cerebrum_auth_logins_total{result="success"} 1`,
+		`cerebrum_auth_logins_total{result="failure"} 2`,
+		`cerebrum_auth_token_refreshes_total{result="success"} 1`,
+		`cerebrum_db_max_open_connections{pool="primary"} 25`,
+		`cerebrum_db_open_connections{pool="primary"} 3`,
+		`cerebrum_db_wait_duration_seconds_total{pool="primary"} 1.5`,
+		`cerebrum_db_open_connections{pool="replica-0"} 2`,
+		`cerebrum_db_replica_healthy{pool="replica-0"} 1`,
+		`cerebrum_cache_lookups_total{result="hit"} 7`,
+		`cerebrum_cache_lookups_total{result="miss"} 2`,
+		`go_goroutines`,
+	} {
+		assert.Contains(t, out, line)
+	}
+	assert.NotNil(t, m.Register(metrics.NewCacheCollector(func() cache.Stats { return cache.Stats{} })),
+		"collectors should not be registered twice")
+}
@@ -2,7 +2,6 @@
 package jsonwebtoken
 
 import (
-	"net/http"
 	"strings"
 	"time"
 
@@ -43,24 +42,24 @@ func (j *Service) MWFunc() echo.MiddlewareFunc {
 		return func(c echo.Context) error {
 			token, err := j.ParseToken(c)
 			if err != nil || !token.Valid {
-				return c.NoContent(http.StatusUnauthorized)
+				return models.ErrUnauthorized
 			}
 
 			claims := token.Claims.(jwtGo.MapClaims)
 
-			id := uint(claims["id"].(float64))
-			accountID := uint(claims["c"].(float64))
-			teamID := uint(claims["l"].(float64))
-			username := claims["u"].(string)
-			email := claims["e"].(string)
-			role := models.AccessRole(claims["r"].(float64))
-
-			c.Set("id", id)
-			c.Set("account_id", accountID)
-			c.Set("team_id", teamID)
-			c.Set("username", username)
-			c.Set("email", email)
-			c.Set("role", role)
+			au := &models.AuthUser{
+				ID:          uint(claims["id"].(float64)),
+				AccountID:   uint(claims["c"].(float64)),
+				TeamID:      uint(claims["l"].(float64)),
+				Username:    claims["u"].(string),
+				Email:       claims["e"].(string),
+				AccessLevel: models.AccessRole(claims["r"].(float64)),
+			}
+
+			// the principal travels with the request context so the
+			// services never need to know about echo
+			req := c.Request()
+			c.SetRequest(req.WithContext(models.WithPrincipal(req.Context(), au)))
 
 			return next(c)
 		}
@@ -1,6 +1,7 @@
 package jsonwebtoken_test
 
 import (
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -24,6 +25,9 @@ func echoHandler(mw ...echo.MiddlewareFunc) *echo.Echo {
 }
 
 func hwHandler(c echo.Context) error {
+	if u, ok := models.PrincipalFrom(c.Request().Context()); ok {
+		return c.String(200, "Hello "+u.Username)
+	}
 	return c.String(200, "Hello World")
 }
 
@@ -31,6 +35,7 @@ func TestMWFunc(t *testing.T) {
 	cases := []struct {
 		name           string
 		expectedStatus int
+		expectedBody   string
 		header         string
 		signMethod     string
 	}{
@@ -52,6 +57,7 @@ func TestMWFunc(t *testing.T) {
 			name:           "Success",
 			header:         mock.HeaderValid(),
 			expectedStatus: http.StatusOK,
+			expectedBody:   "Hello johndoe",
 		},
 	}
 	jwtMW := jwtService.New("jwtsecret", "HS256", 60)
@@ -69,6 +75,10 @@ func TestMWFunc(t *testing.T) {
 				t.Fatal("Cannot create http request")
 			}
 			assert.Equal(t, tt.expectedStatus, res.StatusCode)
+			if tt.expectedBody != "" {
+				body, _ := ioutil.ReadAll(res.Body)
+				assert.Equal(t, tt.expectedBody, string(body), "handler should see the token's principal")
+			}
 		})
 	}
 }
@@ -0,0 +1,66 @@
+package migrate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VersionFormat is the time layout used for migration versions
+const VersionFormat = "20060102150405"
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// template is the skeleton of a new migration file
+const template = `package %s
+
+import (
+	"github.com/jinzhu/gorm"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/migrate"
+)
+
+func init() {
+	register(migrate.Migration{
+		Version: %d,
+		Name:    %q,
+		Up: func(db *gorm.DB) error {
+			return nil
+		},
+		Down: func(db *gorm.DB) error {
+			return nil
+		},
+	})
+}
+`
+
+// Create writes a new, empty migration file named `<version>_<name>.go` into
+// dir and returns its path. The version is derived from the input time.
+func Create(dir, name string, now time.Time) (string, error) {
+	name = strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return "", fmt.Errorf("migration name must contain letters or digits")
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return "", fmt.Errorf("error finding the migrations directory, %v", err)
+	}
+	version := now.UTC().Format(VersionFormat)
+	path := filepath.Join(dir, fmt.Sprintf("%s_%s.go", version, name))
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("migration file %s already exists", path)
+	}
+	v, err := strconv.ParseInt(version, 10, 64)
+	if err != nil {
+		return "", err
+	}
+	src := fmt.Sprintf(template, filepath.Base(dir), v, name)
+	if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,69 @@
+package migrate_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/migrate"
+)
+
+func TestCreate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	now := time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		name         string
+		dir          string
+		input        string
+		expectedFile string
+		expectedErr  bool
+	}{
+		{
+			name:        "Fail on empty name",
+			dir:         dir,
+			input:       " -- ",
+			expectedErr: true,
+		},
+		{
+			name:        "Fail on missing directory",
+			dir:         filepath.Join(dir, "missing"),
+			input:       "add_users",
+			expectedErr: true,
+		},
+		{
+			name:         "Success",
+			dir:          dir,
+			input:        "Add Users-Index",
+			expectedFile: "20261019093000_add_users_index.go",
+		},
+		{
+			name:        "Fail on existing file",
+			dir:         dir,
+			input:       "add_users_index",
+			expectedErr: true,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := migrate.Create(tt.dir, tt.input, now)
+			assert.Equal(t, tt.expectedErr, err != nil)
+			if tt.expectedFile == "" {
+				return
+			}
+			assert.Equal(t, filepath.Join(dir, tt.expectedFile), path)
+			src, err := ioutil.ReadFile(path)
+			assert.Nil(t, err)
+			assert.Contains(t, string(src), "Version: 20261019093000,")
+			assert.Contains(t, string(src), `Name:    "add_users_index",`)
+		})
+	}
+}
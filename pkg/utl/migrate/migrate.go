@@ -0,0 +1,216 @@
+// Package migrate contains support for ordered, versioned schema migrations.
+// Applied versions are tracked in the schema_migrations table.
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Custom errors
+var (
+	ErrSchemaBehind   = errors.New("database schema is behind")
+	ErrUnknownApplied = errors.New("applied migration is unknown to this build")
+)
+
+// Migration represents a single versioned schema change
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(*gorm.DB) error
+	Down    func(*gorm.DB) error
+}
+
+// Status holds the state of a single migration, AppliedAt is nil when pending
+type Status struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+// schemaMigration represents a row of the schema_migrations table
+type schemaMigration struct {
+	Version   int64  `gorm:"primary_key;auto_increment:false"`
+	Name      string `gorm:"size:255"`
+	AppliedAt time.Time
+}
+
+// TableName sets the name of the migrations tracking table
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrator applies and reverts migrations on a database
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// New creates a new Migrator, migrations are sorted by version which must be unique
+func New(db *gorm.DB, migrations []Migration) (*Migrator, error) {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, m := range sorted {
+		if m.Up == nil || m.Down == nil {
+			return nil, fmt.Errorf("migration %d_%s must define both up and down", m.Version, m.Name)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("duplicate migration version %d", m.Version)
+		}
+	}
+	return &Migrator{db: db, migrations: sorted}, nil
+}
+
+// applied returns the applied migrations keyed by version
+func (m *Migrator) applied() (map[int64]schemaMigration, error) {
+	if err := m.db.AutoMigrate(&schemaMigration{}).Error; err != nil {
+		return nil, err
+	}
+	var rows []schemaMigration
+	if err := m.db.Order("version asc").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]schemaMigration, len(rows))
+	for _, r := range rows {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// Status returns the state of every known migration in version order
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	status := make([]Status, 0, len(m.migrations))
+	for _, mg := range m.migrations {
+		s := Status{Version: mg.Version, Name: mg.Name}
+		if r, ok := applied[mg.Version]; ok {
+			appliedAt := r.AppliedAt
+			s.AppliedAt = &appliedAt
+		}
+		status = append(status, s)
+	}
+	return status, nil
+}
+
+// Pending returns the migrations which have not been applied yet
+func (m *Migrator) Pending() ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, mg := range m.migrations {
+		if _, ok := applied[mg.Version]; !ok {
+			pending = append(pending, mg)
+		}
+	}
+	return pending, nil
+}
+
+// EnsureCurrent returns ErrSchemaBehind if any migration has not been applied
+func (m *Migrator) EnsureCurrent() error {
+	pending, err := m.Pending()
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w, %d pending migration(s) starting at %d_%s, run `cerebrum migrate up`",
+			ErrSchemaBehind, len(pending), pending[0].Version, pending[0].Name)
+	}
+	return nil
+}
+
+// Up applies up to steps pending migrations in version order, all of them if
+// steps is less than 1, and returns the applied migrations. Every migration
+// runs in a transaction together with its schema_migrations row, which is
+// only atomic on dialects with transactional DDL: mysql commits each DDL
+// statement implicitly, so a failed migration may be partially applied and
+// Up functions should skip changes which already exist to be re-runnable.
+func (m *Migrator) Up(steps int) ([]Migration, error) {
+	pending, err := m.Pending()
+	if err != nil {
+		return nil, err
+	}
+	if steps > 0 && steps < len(pending) {
+		pending = pending[:steps]
+	}
+	var done []Migration
+	for _, mg := range pending {
+		mg := mg
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := mg.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{Version: mg.Version, Name: mg.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s up failed, %w", mg.Version, mg.Name, err)
+		}
+		done = append(done, mg)
+	}
+	return done, nil
+}
+
+// Down reverts up to steps applied migrations, newest first, and returns the
+// reverted migrations. A step of less than 1 reverts a single migration.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	if steps < 1 {
+		steps = 1
+	}
+	known := make(map[int64]Migration, len(m.migrations))
+	for _, mg := range m.migrations {
+		known[mg.Version] = mg
+	}
+	versions := make([]int64, 0, len(applied))
+	for v := range applied {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+	var done []Migration
+	for _, v := range versions {
+		if len(done) == steps {
+			break
+		}
+		mg, ok := known[v]
+		if !ok {
+			return done, fmt.Errorf("%w, version %d", ErrUnknownApplied, v)
+		}
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := mg.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigration{Version: mg.Version}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s down failed, %w", mg.Version, mg.Name, err)
+		}
+		done = append(done, mg)
+	}
+	return done, nil
+}
+
+// Reset reverts every applied migration
+func (m *Migrator) Reset() error {
+	applied, err := m.applied()
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		return nil
+	}
+	_, err = m.Down(len(applied))
+	return err
+}
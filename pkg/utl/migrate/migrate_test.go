@@ -0,0 +1,180 @@
+package migrate_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
+	"github.com/johncoleman83/cerebrum/pkg/utl/migrate"
+	"github.com/johncoleman83/cerebrum/pkg/utl/support"
+)
+
+func newDB(t *testing.T) *gorm.DB {
+	cfg, err := config.LoadConfigFrom(support.TestingConfigPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := datastore.NewGormDb(cfg.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.LogMode(false)
+	return db
+}
+
+func createTable(name string) func(*gorm.DB) error {
+	return func(db *gorm.DB) error {
+		return db.Exec("CREATE TABLE " + name + " (id integer)").Error
+	}
+}
+
+func dropTable(name string) func(*gorm.DB) error {
+	return func(db *gorm.DB) error {
+		return db.Exec("DROP TABLE " + name).Error
+	}
+}
+
+func testMigrations() []migrate.Migration {
+	return []migrate.Migration{
+		{Version: 3, Name: "create_c", Up: createTable("c"), Down: dropTable("c")},
+		{Version: 1, Name: "create_a", Up: createTable("a"), Down: dropTable("a")},
+		{Version: 2, Name: "create_b", Up: createTable("b"), Down: dropTable("b")},
+	}
+}
+
+func TestNew(t *testing.T) {
+	noop := func(*gorm.DB) error { return nil }
+	cases := []struct {
+		name        string
+		migrations  []migrate.Migration
+		expectedErr bool
+	}{
+		{
+			name: "Fail on duplicate versions",
+			migrations: []migrate.Migration{
+				{Version: 1, Name: "a", Up: noop, Down: noop},
+				{Version: 1, Name: "b", Up: noop, Down: noop},
+			},
+			expectedErr: true,
+		},
+		{
+			name:        "Fail on missing down",
+			migrations:  []migrate.Migration{{Version: 1, Name: "a", Up: noop}},
+			expectedErr: true,
+		},
+		{
+			name:       "Success",
+			migrations: testMigrations(),
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := migrate.New(nil, tt.migrations)
+			assert.Equal(t, tt.expectedErr, err != nil)
+		})
+	}
+}
+
+func TestUpDown(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+	m, err := migrate.New(db, testMigrations())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, errors.Is(m.EnsureCurrent(), migrate.ErrSchemaBehind), "fresh db should be behind")
+
+	done, err := m.Up(2)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 2}, versions(done), "migrations should be applied in version order")
+	assert.True(t, db.HasTable("a") && db.HasTable("b") && !db.HasTable("c"))
+
+	status, err := m.Status()
+	assert.Nil(t, err)
+	assert.NotNil(t, status[0].AppliedAt)
+	assert.NotNil(t, status[1].AppliedAt)
+	assert.Nil(t, status[2].AppliedAt, "the last migration should still be pending")
+	assert.NotNil(t, m.EnsureCurrent())
+
+	done, err = m.Up(0)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{3}, versions(done))
+	assert.Nil(t, m.EnsureCurrent(), "schema should be current after applying all migrations")
+
+	done, err = m.Up(0)
+	assert.Nil(t, err)
+	assert.Empty(t, done, "up should be a no-op when nothing is pending")
+
+	done, err = m.Down(0)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{3}, versions(done), "down should revert the newest migration by default")
+	assert.False(t, db.HasTable("c"))
+
+	assert.Nil(t, m.Reset())
+	assert.False(t, db.HasTable("a") || db.HasTable("b"))
+	pending, err := m.Pending()
+	assert.Nil(t, err)
+	assert.Len(t, pending, 3)
+}
+
+func TestUpFailure(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+	m, err := migrate.New(db, []migrate.Migration{
+		{Version: 1, Name: "create_a", Up: createTable("a"), Down: dropTable("a")},
+		{
+			Version: 2,
+			Name:    "broken",
+			Up: func(db *gorm.DB) error {
+				if err := createTable("b")(db); err != nil {
+					return err
+				}
+				return errors.New("broken migration")
+			},
+			Down: dropTable("b"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := m.Up(0)
+	assert.NotNil(t, err)
+	assert.Equal(t, []int64{1}, versions(done), "migrations before the failure should stay applied")
+	assert.False(t, db.HasTable("b"), "a failed migration should be rolled back")
+	pending, err := m.Pending()
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{2}, versions(pending))
+}
+
+func TestDownUnknown(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+	m, err := migrate.New(db, testMigrations())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(0); err != nil {
+		t.Fatal(err)
+	}
+	older, err := migrate.New(db, testMigrations()[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = older.Down(1)
+	assert.True(t, errors.Is(err, migrate.ErrUnknownApplied), "a migration unknown to the build cannot be reverted")
+	assert.Nil(t, older.EnsureCurrent(), "a schema ahead of the build is current")
+}
+
+func versions(migrations []migrate.Migration) []int64 {
+	var v []int64
+	for _, m := range migrations {
+		v = append(v, m.Version)
+	}
+	return v
+}
@@ -0,0 +1,45 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Transactor mock
+type Transactor struct {
+	TransactionFn func(context.Context, func(*gorm.DB) error) error
+}
+
+// Transaction mock
+func (t *Transactor) Transaction(ctx context.Context, fn func(*gorm.DB) error) error {
+	return t.TransactionFn(ctx, fn)
+}
+
+// Publisher mock
+type Publisher struct {
+	PublishFn func(context.Context, *gorm.DB, string, uint, interface{}) error
+}
+
+// Publish mock
+func (p *Publisher) Publish(ctx context.Context, db *gorm.DB, topic string, aggregateID uint, payload interface{}) error {
+	return p.PublishFn(ctx, db, topic, aggregateID, payload)
+}
+
+// NoopTransactor returns a Transactor mock which runs the callback without a db
+func NoopTransactor() *Transactor {
+	return &Transactor{
+		TransactionFn: func(ctx context.Context, fn func(*gorm.DB) error) error {
+			return fn(nil)
+		},
+	}
+}
+
+// NoopPublisher returns a Publisher mock which accepts every event
+func NoopPublisher() *Publisher {
+	return &Publisher{
+		PublishFn: func(context.Context, *gorm.DB, string, uint, interface{}) error {
+			return nil
+		},
+	}
+}
@@ -2,19 +2,28 @@ package mockstore
 
 import (
 	"errors"
+	"os"
 
 	"github.com/jinzhu/gorm"
-	_ "github.com/jinzhu/gorm/dialects/mysql" // for use with gorm
 
+	"github.com/johncoleman83/cerebrum/pkg/api/migrations"
 	"github.com/johncoleman83/cerebrum/pkg/utl/config"
 	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
-	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+	"github.com/johncoleman83/cerebrum/pkg/utl/keyring"
 	"github.com/johncoleman83/cerebrum/pkg/utl/support"
 )
 
-// NewDataBaseConnection creates and returns a new GORM connection to the test DB
-func NewDataBaseConnection() (*gorm.DB, error) {
+// TestingConfigEnv is the environmental variable which can hold the path of a
+// config file to run the db tests against, by default an in-memory sqlite db
+// from the testing config is used
+const TestingConfigEnv = "CEREBRUM_TESTING_CONFIG"
+
+// testingConfig loads the testing config, or the config TestingConfigEnv points to
+func testingConfig() (*config.Configuration, error) {
 	cfgPath := support.TestingConfigPath()
+	if envPath := os.Getenv(TestingConfigEnv); envPath != "" {
+		cfgPath = envPath
+	}
 	cfg, err := config.LoadConfigFrom(cfgPath)
 	if err != nil {
 		return nil, err
@@ -22,35 +31,46 @@ func NewDataBaseConnection() (*gorm.DB, error) {
 	if cfg == nil {
 		return nil, errors.New("unknown error loading testing yaml file")
 	}
-	db, err := datastore.NewMySQLGormDb(cfg.DB)
+	return cfg, nil
+}
+
+// NewKeyring returns the keyring of the testing config
+func NewKeyring() (*keyring.Keyring, error) {
+	cfg, err := testingConfig()
 	if err != nil {
 		return nil, err
 	}
-	if err := DropAndCreateAllTablesFor(db); err != nil {
+	return keyring.New(cfg.Encryption)
+}
+
+// NewDataBaseConnection creates and returns a new GORM connection to the test DB
+func NewDataBaseConnection() (*gorm.DB, error) {
+	cfg, err := testingConfig()
+	if err != nil {
+		return nil, err
+	}
+	db, err := datastore.NewGormDb(cfg.DB)
+	if err != nil {
+		return nil, err
+	}
+	if err := ResetSchemaFor(db); err != nil {
 		return nil, err
 	}
 	return db, nil
 }
 
-// DropAndCreateAllTablesFor drops all tables in input db and recreates the ones listed in the function
-func DropAndCreateAllTablesFor(db *gorm.DB) error {
-	modelsList := []interface{}{
-		&models.Account{},
-		&models.Team{},
-		&models.Role{},
-		&models.User{},
+// ResetSchemaFor reverts every applied migration of the input db and then
+// migrates it up to the latest version
+func ResetSchemaFor(db *gorm.DB) error {
+	m, err := migrations.New(db)
+	if err != nil {
+		return err
 	}
-	for _, model := range modelsList {
-		if db.HasTable(model) {
-			if err := db.DropTable(model).Error; err != nil {
-				return err
-			}
-		}
-		if err := db.CreateTable(model).Error; err != nil {
-			return err
-		}
+	if err := m.Reset(); err != nil {
+		return err
 	}
-	return nil
+	_, err = m.Up(0)
+	return err
 }
 
 // InsertRowsFor inserts multiple values into database
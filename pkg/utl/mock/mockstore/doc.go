@@ -1,3 +1,4 @@
 // Package mockstore is used for testing purposes to mock the store package
-// and mock a mysql db through a docker container of mysql
+// and to connect to a test db, an in-memory sqlite db by default or e.g. a
+// mysql db through a docker container of mysql
 package mockstore
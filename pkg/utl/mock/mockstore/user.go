@@ -1,6 +1,9 @@
 package mockstore
 
 import (
+	"context"
+	"time"
+
 	"github.com/jinzhu/gorm"
 
 	"github.com/johncoleman83/cerebrum/pkg/utl/models"
@@ -8,46 +11,106 @@ import (
 
 // UserDBClient database mock
 type UserDBClient struct {
-	CreateFn         func(*gorm.DB, models.User) (*models.User, error)
-	ViewFn           func(*gorm.DB, uint) (*models.User, error)
-	FindByUsernameFn func(*gorm.DB, string) (*models.User, error)
-	FindByTokenFn    func(*gorm.DB, string) (*models.User, error)
-	ListFn           func(*gorm.DB, *models.ListQuery, *models.Pagination) ([]models.User, error)
-	DeleteFn         func(*gorm.DB, *models.User) error
-	UpdateFn         func(*gorm.DB, *models.User) error
+	CreateFn          func(context.Context, *gorm.DB, models.User) (*models.User, error)
+	ViewFn            func(context.Context, *gorm.DB, uint) (*models.User, error)
+	ViewUnscopedFn    func(context.Context, *gorm.DB, uint) (*models.User, error)
+	ViewCredentialsFn func(context.Context, *gorm.DB, uint) (*models.User, error)
+	FindByUsernameFn  func(context.Context, *gorm.DB, string) (*models.User, error)
+	FindByTokenFn     func(context.Context, *gorm.DB, string) (*models.User, error)
+	ListFn            func(context.Context, *gorm.DB, *models.ListQuery, *models.UserFilter, *models.Pagination) ([]models.User, *models.Page, error)
+	DeleteFn          func(context.Context, *gorm.DB, *models.User) error
+	UpdateFn          func(context.Context, *gorm.DB, *models.User) error
+	UpdateUnscopedFn  func(context.Context, *gorm.DB, *models.User) error
+	ChangePasswordFn  func(context.Context, *gorm.DB, *models.User) error
+	RecordLoginFn     func(context.Context, *gorm.DB, *models.User) error
+	ListDeletedFn     func(context.Context, *gorm.DB, *models.Pagination) ([]models.User, *models.Page, error)
+	RestoreFn         func(context.Context, *gorm.DB, uint) (*models.User, error)
+	PurgeDeletedFn    func(context.Context, *gorm.DB, time.Time, int) ([]models.User, error)
+	EventsFn          func(context.Context, *gorm.DB, uint) ([]models.OutboxEvent, error)
+	RedactEventsFn    func(context.Context, *gorm.DB, *models.User) error
 }
 
 // Create mock
-func (u *UserDBClient) Create(db *gorm.DB, usr models.User) (*models.User, error) {
-	return u.CreateFn(db, usr)
+func (u *UserDBClient) Create(ctx context.Context, db *gorm.DB, usr models.User) (*models.User, error) {
+	return u.CreateFn(ctx, db, usr)
 }
 
 // View mock
-func (u *UserDBClient) View(db *gorm.DB, id uint) (*models.User, error) {
-	return u.ViewFn(db, id)
+func (u *UserDBClient) View(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+	return u.ViewFn(ctx, db, id)
+}
+
+// ViewUnscoped mock
+func (u *UserDBClient) ViewUnscoped(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+	return u.ViewUnscopedFn(ctx, db, id)
+}
+
+// ViewCredentials mock
+func (u *UserDBClient) ViewCredentials(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+	return u.ViewCredentialsFn(ctx, db, id)
 }
 
 // FindByUsername mock
-func (u *UserDBClient) FindByUsername(db *gorm.DB, uname string) (*models.User, error) {
-	return u.FindByUsernameFn(db, uname)
+func (u *UserDBClient) FindByUsername(ctx context.Context, db *gorm.DB, uname string) (*models.User, error) {
+	return u.FindByUsernameFn(ctx, db, uname)
 }
 
 // FindByToken mock
-func (u *UserDBClient) FindByToken(db *gorm.DB, token string) (*models.User, error) {
-	return u.FindByTokenFn(db, token)
+func (u *UserDBClient) FindByToken(ctx context.Context, db *gorm.DB, token string) (*models.User, error) {
+	return u.FindByTokenFn(ctx, db, token)
 }
 
 // List mock
-func (u *UserDBClient) List(db *gorm.DB, lq *models.ListQuery, p *models.Pagination) ([]models.User, error) {
-	return u.ListFn(db, lq, p)
+func (u *UserDBClient) List(ctx context.Context, db *gorm.DB, lq *models.ListQuery, f *models.UserFilter, p *models.Pagination) ([]models.User, *models.Page, error) {
+	return u.ListFn(ctx, db, lq, f, p)
 }
 
 // Delete mock
-func (u *UserDBClient) Delete(db *gorm.DB, usr *models.User) error {
-	return u.DeleteFn(db, usr)
+func (u *UserDBClient) Delete(ctx context.Context, db *gorm.DB, usr *models.User) error {
+	return u.DeleteFn(ctx, db, usr)
 }
 
 // Update mock
-func (u *UserDBClient) Update(db *gorm.DB, usr *models.User) error {
-	return u.UpdateFn(db, usr)
+func (u *UserDBClient) Update(ctx context.Context, db *gorm.DB, usr *models.User) error {
+	return u.UpdateFn(ctx, db, usr)
+}
+
+// ChangePassword mock
+func (u *UserDBClient) ChangePassword(ctx context.Context, db *gorm.DB, usr *models.User) error {
+	return u.ChangePasswordFn(ctx, db, usr)
+}
+
+// RecordLogin mock
+func (u *UserDBClient) RecordLogin(ctx context.Context, db *gorm.DB, usr *models.User) error {
+	return u.RecordLoginFn(ctx, db, usr)
+}
+
+// UpdateUnscoped mock
+func (u *UserDBClient) UpdateUnscoped(ctx context.Context, db *gorm.DB, usr *models.User) error {
+	return u.UpdateUnscopedFn(ctx, db, usr)
+}
+
+// ListDeleted mock
+func (u *UserDBClient) ListDeleted(ctx context.Context, db *gorm.DB, p *models.Pagination) ([]models.User, *models.Page, error) {
+	return u.ListDeletedFn(ctx, db, p)
+}
+
+// Restore mock
+func (u *UserDBClient) Restore(ctx context.Context, db *gorm.DB, id uint) (*models.User, error) {
+	return u.RestoreFn(ctx, db, id)
+}
+
+// PurgeDeleted mock
+func (u *UserDBClient) PurgeDeleted(ctx context.Context, db *gorm.DB, before time.Time, limit int) ([]models.User, error) {
+	return u.PurgeDeletedFn(ctx, db, before, limit)
+}
+
+// Events mock
+func (u *UserDBClient) Events(ctx context.Context, db *gorm.DB, id uint) ([]models.OutboxEvent, error) {
+	return u.EventsFn(ctx, db, id)
+}
+
+// RedactEvents mock
+func (u *UserDBClient) RedactEvents(ctx context.Context, db *gorm.DB, usr *models.User) error {
+	return u.RedactEventsFn(ctx, db, usr)
 }
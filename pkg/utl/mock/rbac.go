@@ -1,53 +1,53 @@
 package mock
 
 import (
-	"github.com/labstack/echo"
+	"context"
 
 	"github.com/johncoleman83/cerebrum/pkg/utl/models"
 )
 
 // RBAC Mock
 type RBAC struct {
-	UserFn           func(echo.Context) *models.AuthUser
-	EnforceRoleFn    func(echo.Context, models.AccessRole) error
-	EnforceUserFn    func(echo.Context, uint) error
-	EnforceAccountFn func(echo.Context, uint) error
-	EnforceTeamFn    func(echo.Context, uint) error
-	AccountCreateFn  func(echo.Context, models.AccessRole, uint, uint) error
-	IsLowerRoleFn    func(echo.Context, models.AccessRole) error
+	UserFn           func(context.Context) *models.AuthUser
+	EnforceRoleFn    func(context.Context, models.AccessRole) error
+	EnforceUserFn    func(context.Context, uint) error
+	EnforceAccountFn func(context.Context, uint) error
+	EnforceTeamFn    func(context.Context, uint) error
+	AccountCreateFn  func(context.Context, models.AccessRole, uint, uint) error
+	IsLowerRoleFn    func(context.Context, models.AccessRole) error
 }
 
 // User mock
-func (a *RBAC) User(c echo.Context) *models.AuthUser {
-	return a.UserFn(c)
+func (a *RBAC) User(ctx context.Context) *models.AuthUser {
+	return a.UserFn(ctx)
 }
 
 // EnforceRole mock
-func (a *RBAC) EnforceRole(c echo.Context, role models.AccessRole) error {
-	return a.EnforceRoleFn(c, role)
+func (a *RBAC) EnforceRole(ctx context.Context, role models.AccessRole) error {
+	return a.EnforceRoleFn(ctx, role)
 }
 
 // EnforceUser mock
-func (a *RBAC) EnforceUser(c echo.Context, id uint) error {
-	return a.EnforceUserFn(c, id)
+func (a *RBAC) EnforceUser(ctx context.Context, id uint) error {
+	return a.EnforceUserFn(ctx, id)
 }
 
 // EnforceAccount mock
-func (a *RBAC) EnforceAccount(c echo.Context, id uint) error {
-	return a.EnforceAccountFn(c, id)
+func (a *RBAC) EnforceAccount(ctx context.Context, id uint) error {
+	return a.EnforceAccountFn(ctx, id)
 }
 
 // EnforceTeam mock
-func (a *RBAC) EnforceTeam(c echo.Context, id uint) error {
-	return a.EnforceTeamFn(c, id)
+func (a *RBAC) EnforceTeam(ctx context.Context, id uint) error {
+	return a.EnforceTeamFn(ctx, id)
 }
 
 // AccountCreate mock
-func (a *RBAC) AccountCreate(c echo.Context, roleID models.AccessRole, accountID, teamID uint) error {
-	return a.AccountCreateFn(c, roleID, accountID, teamID)
+func (a *RBAC) AccountCreate(ctx context.Context, roleID models.AccessRole, accountID, teamID uint) error {
+	return a.AccountCreateFn(ctx, roleID, accountID, teamID)
 }
 
 // IsLowerRole mock
-func (a *RBAC) IsLowerRole(c echo.Context, role models.AccessRole) error {
-	return a.IsLowerRoleFn(c, role)
+func (a *RBAC) IsLowerRole(ctx context.Context, role models.AccessRole) error {
+	return a.IsLowerRoleFn(ctx, role)
 }
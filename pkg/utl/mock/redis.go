@@ -0,0 +1,100 @@
+package mock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Redis is a local stand-in for a redis server, it keeps the values of the
+// GET, SET and DEL commands in memory and fails every command with Err.
+// Scripts are not run, EVAL replies with EvalFn.
+type Redis struct {
+	Err    error
+	EvalFn func(script string, keys []string, args ...interface{}) (interface{}, error)
+
+	mu      sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+}
+
+// NewRedis creates a new empty redis stand-in
+func NewRedis() *Redis {
+	return &Redis{values: make(map[string]string), expires: make(map[string]time.Time)}
+}
+
+// Get mock
+func (r *Redis) Get(key string) *redis.StringCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Err != nil {
+		return redis.NewStringResult("", r.Err)
+	}
+	if exp, ok := r.expires[key]; ok && !time.Now().Before(exp) {
+		delete(r.values, key)
+		delete(r.expires, key)
+	}
+	v, ok := r.values[key]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(v, nil)
+}
+
+// Set mock, values are stored as strings like redis does
+func (r *Redis) Set(key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Err != nil {
+		return redis.NewStatusResult("", r.Err)
+	}
+	switch v := value.(type) {
+	case []byte:
+		r.values[key] = string(v)
+	case string:
+		r.values[key] = v
+	}
+	delete(r.expires, key)
+	if expiration > 0 {
+		r.expires[key] = time.Now().Add(expiration)
+	}
+	return redis.NewStatusResult("OK", nil)
+}
+
+// Del mock
+func (r *Redis) Del(keys ...string) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Err != nil {
+		return redis.NewIntResult(0, r.Err)
+	}
+	var n int64
+	for _, key := range keys {
+		if _, ok := r.values[key]; ok {
+			n++
+		}
+		delete(r.values, key)
+		delete(r.expires, key)
+	}
+	return redis.NewIntResult(n, nil)
+}
+
+// Eval mock
+func (r *Redis) Eval(script string, keys []string, args ...interface{}) *redis.Cmd {
+	if r.Err != nil {
+		return redis.NewCmdResult(nil, r.Err)
+	}
+	return redis.NewCmdResult(r.EvalFn(script, keys, args...))
+}
+
+// Keys returns the stored keys
+func (r *Redis) Keys() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := make([]string, 0, len(r.values))
+	for key := range r.values {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -1,29 +1,29 @@
 package models
 
 import (
-	"github.com/labstack/echo"
+	"context"
 )
 
 // AuthToken holds authentication token details with refresh token
 type AuthToken struct {
-	Token        string `json:"token"`
+	Token        string `json:"token" log:"redact"`
 	Expires      string `json:"expires"`
-	RefreshToken string `json:"refresh_token"`
+	RefreshToken string `json:"refresh_token" log:"redact"`
 }
 
 // RefreshToken holds authentication token details
 type RefreshToken struct {
-	Token   string `json:"token"`
+	Token   string `json:"token" log:"redact"`
 	Expires string `json:"expires"`
 }
 
 // RBACService represents role-based access control service interface
 type RBACService interface {
-	User(echo.Context) *AuthUser
-	EnforceRole(echo.Context, AccessRole) error
-	EnforceUser(echo.Context, uint) error
-	EnforceAccount(echo.Context, uint) error
-	EnforceTeam(echo.Context, uint) error
-	AccountCreate(echo.Context, AccessRole, uint, uint) error
-	IsLowerRole(echo.Context, AccessRole) error
+	User(context.Context) *AuthUser
+	EnforceRole(context.Context, AccessRole) error
+	EnforceUser(context.Context, uint) error
+	EnforceAccount(context.Context, uint) error
+	EnforceTeam(context.Context, uint) error
+	AccountCreate(context.Context, AccessRole, uint, uint) error
+	IsLowerRole(context.Context, AccessRole) error
 }
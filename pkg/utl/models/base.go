@@ -8,6 +8,9 @@ type Base struct {
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
 	DeletedAt *time.Time `json:"deleted_at" sql:"index"`
+
+	// Version is incremented by every update, stale writes are rejected
+	Version uint `json:"version" gorm:"not null;default:1"`
 }
 
 // ListQuery holds account/team data used for list db queries
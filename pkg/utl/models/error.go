@@ -2,6 +2,7 @@ package models
 
 import (
 	"errors"
+	"net/http"
 
 	"github.com/labstack/echo"
 )
@@ -15,4 +16,26 @@ var (
 
 	// ErrUnauthorized (401) is returned when user is not authorized
 	ErrUnauthorized = echo.ErrUnauthorized
+
+	// ErrForbidden (403) is returned when the principal may not access a resource
+	ErrForbidden = NewError(http.StatusForbidden, "forbidden", "access is forbidden")
 )
+
+// Error is an error reported to clients with the http Status and a stable
+// machine readable Code, such as insecure_password, which clients may rely
+// on whatever the Message
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+// NewError creates a new error of status identified by code
+func NewError(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// Error returns the message of the error
+func (e *Error) Error() string {
+	return e.Message
+}
@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// Domain event topics published by the api services
+const (
+	// EventUserCreated is published after a new user is persisted
+	EventUserCreated = "user.created"
+
+	// EventUserUpdated is published after a user's contact info is changed
+	EventUserUpdated = "user.updated"
+
+	// EventUserDeleted is published after a user is (soft) deleted
+	EventUserDeleted = "user.deleted"
+
+	// EventUserRestored is published after a soft deleted user is restored
+	EventUserRestored = "user.restored"
+
+	// EventUserPurged is published after a soft deleted user is permanently erased
+	EventUserPurged = "user.purged"
+
+	// EventUserErased is published after the personal data of a user is anonymized
+	EventUserErased = "user.erased"
+
+	// EventUserLoggedIn is published after a user successfully authenticates
+	EventUserLoggedIn = "user.logged_in"
+
+	// EventPasswordChanged is published after a user changes their password
+	EventPasswordChanged = "password.changed"
+)
+
+// UserEventTopics are the topics of the events whose aggregate is a user
+var UserEventTopics = []string{
+	EventUserCreated,
+	EventUserUpdated,
+	EventUserDeleted,
+	EventUserRestored,
+	EventUserPurged,
+	EventUserErased,
+	EventUserLoggedIn,
+	EventPasswordChanged,
+}
+
+// OutboxEvent represents a domain event stored in the transactional outbox
+// table until the dispatcher hands it over to the event broker
+type OutboxEvent struct {
+	ID           uint       `gorm:"primary_key" json:"id"`
+	Topic        string     `json:"topic" gorm:"size:255;index"`
+	AggregateID  uint       `json:"aggregate_id"`
+	Payload      string     `json:"payload" gorm:"type:text" log:"redact"`
+	Attempts     int        `json:"attempts"`
+	LastError    string     `json:"last_error,omitempty" gorm:"type:text"`
+	CreatedAt    time.Time  `json:"created_at"`
+	DispatchedAt *time.Time `json:"dispatched_at" sql:"index"`
+	ClaimedBy    string     `json:"-" gorm:"size:32"`
+	ClaimedUntil *time.Time `json:"-"`
+}
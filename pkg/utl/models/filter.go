@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// SortField orders list queries by a column
+type SortField struct {
+	Column string
+	Desc   bool
+}
+
+// UserFilter holds the filters, free-text search and order of user list
+// queries, zero values do not filter
+type UserFilter struct {
+	RoleID    uint
+	TeamID    uint
+	AccountID uint
+
+	// Time ranges include their lower bound and exclude their upper bound
+	CreatedAfter    *time.Time
+	CreatedBefore   *time.Time
+	LastLoginAfter  *time.Time
+	LastLoginBefore *time.Time
+
+	// Search matches names and username by substring and email exactly,
+	// as emails are encrypted at rest
+	Search string
+
+	Sort []SortField
+}
+
+// UserSortColumns are the columns user list queries may be sorted by
+var UserSortColumns = map[string]bool{
+	"id":         true,
+	"first_name": true,
+	"last_name":  true,
+	"username":   true,
+	"created_at": true,
+	"updated_at": true,
+	"last_login": true,
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// IdempotencyKey represents the response of a mutating request sent with an
+// Idempotency-Key header, which is replayed to the retries of the request.
+// Keys are scoped to the user sending them, Status is zero while the request
+// is in flight and Body is sealed as it may hold personal data. Headers holds
+// the replayed response headers as a JSON object.
+type IdempotencyKey struct {
+	ID          uint      `gorm:"primary_key" json:"id"`
+	UserID      uint      `json:"user_id" gorm:"unique_index:ux_idempotency_keys_user_key"`
+	Key         string    `json:"key" gorm:"column:idempotency_key;size:255;unique_index:ux_idempotency_keys_user_key"`
+	RequestHash string    `json:"request_hash" gorm:"size:64"`
+	Status      int       `json:"status"`
+	ContentType string    `json:"content_type" gorm:"size:255"`
+	Headers     string    `json:"headers" gorm:"type:text"`
+	Body        string    `json:"body" gorm:"type:text" log:"redact"`
+	CreatedAt   time.Time `json:"created_at" sql:"index"`
+}
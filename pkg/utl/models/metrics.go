@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Recorder represents metrics recording interface
+type Recorder interface {
+	// service, method, took, error
+	ObserveCall(string, string, time.Duration, error)
+	// error of a login attempt
+	CountLogin(error)
+	// error of a token refresh
+	CountRefresh(error)
+}
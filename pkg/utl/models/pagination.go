@@ -1,25 +1,48 @@
 package models
 
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+)
+
 // Pagination constants
 const (
 	paginationDefaultLimit = 100
 	paginationMaxLimit     = 1000
 )
 
+var (
+	// ErrInvalidCursor (400) is returned for cursors which cannot be decoded
+	// or do not match the order of the list query
+	ErrInvalidCursor = NewError(http.StatusBadRequest, "invalid_cursor", "invalid cursor")
+
+	// ErrCursorWithPage (400) is returned when both a cursor and a page are requested
+	ErrCursorWithPage = NewError(http.StatusBadRequest, "cursor_with_page", "cursor cannot be combined with page")
+)
+
 // Pagination holds paginations data
 type Pagination struct {
 	Limit  int `json:"limit,omitempty"`
 	Offset int `json:"offset,omitempty"`
+
+	// Cursor continues from the boundary of another page, Offset is then ignored
+	Cursor *Cursor `json:"cursor,omitempty"`
+
+	// Count requests the total number of results
+	Count bool `json:"count,omitempty"`
 }
 
 // PaginationReq holds pagination http fields and tags
 type PaginationReq struct {
-	Limit int `query:"limit"`
-	Page  int `query:"page" validate:"min=0"`
+	Limit  int    `query:"limit"`
+	Page   int    `query:"page" validate:"min=0"`
+	Cursor string `query:"cursor"`
+	Count  bool   `query:"count"`
 }
 
 // NewPagination checks and converts http pagination into database pagination model
-func (p *PaginationReq) NewPagination() *Pagination {
+func (p *PaginationReq) NewPagination() (*Pagination, error) {
 	if p.Limit < 1 {
 		p.Limit = paginationDefaultLimit
 	}
@@ -28,5 +51,56 @@ func (p *PaginationReq) NewPagination() *Pagination {
 		p.Limit = paginationMaxLimit
 	}
 
-	return &Pagination{Limit: p.Limit, Offset: p.Page * p.Limit}
+	pg := &Pagination{Limit: p.Limit, Offset: p.Page * p.Limit, Count: p.Count}
+	if p.Cursor == "" {
+		return pg, nil
+	}
+	if p.Page != 0 {
+		return nil, ErrCursorWithPage
+	}
+	cur, err := ParseCursor(p.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	pg.Offset, pg.Cursor = 0, cur
+	return pg, nil
+}
+
+// Cursor points at the boundary row of a page for keyset pagination, it
+// holds the values of the row for each sort column of the list query
+type Cursor struct {
+	Columns []string `json:"c"`
+	Values  []string `json:"v"`
+
+	// Before selects the rows preceding the boundary instead of following it
+	Before bool `json:"b,omitempty"`
+}
+
+// String encodes the cursor into an opaque url safe token
+func (c *Cursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor decodes a cursor encoded by String
+func ParseCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c := new(Cursor)
+	if err := json.Unmarshal(data, c); err != nil || len(c.Columns) == 0 || len(c.Columns) != len(c.Values) {
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// Page describes where a list result stands among all the results
+type Page struct {
+	// Next and Prev are nil when there are no results after or before the page
+	Next *Cursor
+	Prev *Cursor
+
+	// Total is the number of results of all pages, set if it was requested
+	Total *int
 }
@@ -0,0 +1,21 @@
+package models
+
+import "context"
+
+// principalKey is the context key of the authenticated user
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the authenticated user on
+// whose behalf the services act, transports set it after authentication
+func WithPrincipal(ctx context.Context, u *AuthUser) context.Context {
+	return context.WithValue(ctx, principalKey{}, u)
+}
+
+// PrincipalFrom returns the authenticated user carried by ctx, if any
+func PrincipalFrom(ctx context.Context) (*AuthUser, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	u, ok := ctx.Value(principalKey{}).(*AuthUser)
+	return u, ok && u != nil
+}
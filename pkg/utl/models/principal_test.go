@@ -0,0 +1,23 @@
+package models_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+func TestPrincipal(t *testing.T) {
+	_, ok := models.PrincipalFrom(context.Background())
+	assert.False(t, ok, "there should be no principal in an empty context")
+
+	_, ok = models.PrincipalFrom(models.WithPrincipal(context.Background(), nil))
+	assert.False(t, ok, "a nil principal should not be reported")
+
+	au := &models.AuthUser{ID: 7, Username: "rocinante", AccessLevel: models.UserRole}
+	got, ok := models.PrincipalFrom(models.WithPrincipal(context.Background(), au))
+	assert.True(t, ok)
+	assert.Equal(t, au, got)
+}
@@ -0,0 +1,21 @@
+package models
+
+import "context"
+
+// requestIDKey is the context key of the id of the request being served
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the id of the request it
+// serves, logs and error responses refer to the request by it
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns the id of the request carried by ctx, if any
+func RequestIDFrom(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok && id != ""
+}
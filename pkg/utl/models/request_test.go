@@ -0,0 +1,22 @@
+package models_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+func TestRequestID(t *testing.T) {
+	_, ok := models.RequestIDFrom(context.Background())
+	assert.False(t, ok, "there should be no request id in an empty context")
+
+	_, ok = models.RequestIDFrom(models.WithRequestID(context.Background(), ""))
+	assert.False(t, ok, "an empty request id should not be reported")
+
+	got, ok := models.RequestIDFrom(models.WithRequestID(context.Background(), "req-1"))
+	assert.True(t, ok)
+	assert.Equal(t, "req-1", got)
+}
@@ -1,21 +1,26 @@
 package models
 
 import (
+	"fmt"
 	"time"
 )
 
-// User represents user domain model
+// User represents user domain model, its personal data and credentials are
+// tagged to be redacted from logs
 type User struct {
 	Base
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
+	FirstName string `json:"first_name" log:"redact"`
+	LastName  string `json:"last_name" log:"redact"`
 	Username  string `json:"username"`
-	Password  string `json:"-"`
-	Email     string `json:"email"`
+	Password  string `json:"-" log:"redact"`
+	Email     string `json:"email" log:"redact"`
 
-	Mobile  string `json:"mobile,omitempty"`
-	Phone   string `json:"phone,omitempty"`
-	Address string `json:"address,omitempty"`
+	// EmailIndex is the blind index of Email, which is encrypted at rest
+	EmailIndex *string `json:"-"`
+
+	Mobile  string `json:"mobile,omitempty" log:"redact"`
+	Phone   string `json:"phone,omitempty" log:"redact"`
+	Address string `json:"address,omitempty" log:"redact"`
 
 	AccountID uint `json:"account_id"`
 	TeamID    uint `json:"team_id"`
@@ -23,7 +28,7 @@ type User struct {
 	Role   Role `json:"role,omitempty" gorm:"foreignkey:ID;association_foreignkey:RoleID;"`
 	RoleID uint `json:"-"`
 
-	Token string `json:"-"`
+	Token string `json:"-" log:"redact"`
 
 	LastLogin          time.Time `json:"last_login,omitempty" gorm:"default:CURRENT_TIMESTAMP"`
 	LastPasswordChange time.Time `json:"last_password_change,omitempty" gorm:"default:CURRENT_TIMESTAMP"`
@@ -35,7 +40,7 @@ type AuthUser struct {
 	AccountID   uint
 	TeamID      uint
 	Username    string
-	Email       string
+	Email       string `log:"redact"`
 	AccessLevel AccessRole
 }
 
@@ -50,3 +55,17 @@ func (u *User) UpdateLastLogin(token string) {
 	u.Token = token
 	u.LastLogin = time.Now()
 }
+
+// Anonymize replaces the personal data of the user by placeholders and
+// revokes its credentials, username and email are kept unique per user
+func (u *User) Anonymize() {
+	u.FirstName = ""
+	u.LastName = ""
+	u.Username = fmt.Sprintf("erased-%d", u.ID)
+	u.Email = fmt.Sprintf("erased-%d@erased.invalid", u.ID)
+	u.Mobile = ""
+	u.Phone = ""
+	u.Address = ""
+	u.Password = ""
+	u.Token = ""
+}
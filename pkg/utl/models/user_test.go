@@ -44,24 +44,80 @@ func TestUpdateLastLogin(t *testing.T) {
 	}
 }
 
+func TestAnonymize(t *testing.T) {
+	user := &models.User{
+		Base:      models.Base{ID: 7},
+		FirstName: "Jane",
+		LastName:  "Doe",
+		Username:  "janedoe",
+		Password:  "h4$h3D",
+		Email:     "jane@mail.com",
+		Mobile:    "555",
+		Phone:     "556",
+		Address:   "1 Main St",
+		AccountID: 1,
+		TeamID:    2,
+		RoleID:    3,
+		Token:     "helloWorld",
+	}
+
+	user.Anonymize()
+	assert.Equal(t, &models.User{
+		Base:      models.Base{ID: 7},
+		Username:  "erased-7",
+		Email:     "erased-7@erased.invalid",
+		AccountID: 1,
+		TeamID:    2,
+		RoleID:    3,
+	}, user)
+}
+
 func TestPaginationLimit(t *testing.T) {
 	reqNegativeLimit := models.PaginationReq{Limit: -5, Page: 2}
 	expected := &models.Pagination{Limit: 100, Offset: 200}
-	assert.Equal(t, expected, reqNegativeLimit.NewPagination(), "negative limit should get set to default")
+	p, err := reqNegativeLimit.NewPagination()
+	assert.Nil(t, err)
+	assert.Equal(t, expected, p, "negative limit should get set to default")
 
 	reqMaxLimit := models.PaginationReq{Limit: 1001, Page: 2}
 	expected.Limit, expected.Offset = 1000, 2000
-	assert.Equal(t, expected, reqMaxLimit.NewPagination(), "beyond max limit should get set to default")
+	p, err = reqMaxLimit.NewPagination()
+	assert.Nil(t, err)
+	assert.Equal(t, expected, p, "beyond max limit should get set to default")
 
 	reqTooBigLimit := models.PaginationReq{Limit: 9999999, Page: 2}
 	expected.Limit, expected.Offset = 1000, 2000
-	assert.Equal(t, expected, reqTooBigLimit.NewPagination(), "way beyond max limit should get set to default")
+	p, err = reqTooBigLimit.NewPagination()
+	assert.Nil(t, err)
+	assert.Equal(t, expected, p, "way beyond max limit should get set to default")
 
 	reqNoChangeAllZeros := models.PaginationReq{Limit: 0, Page: 0}
 	expected.Limit, expected.Offset = 100, 0
-	assert.Equal(t, expected, reqNoChangeAllZeros.NewPagination(), "zeros should get set to default")
+	p, err = reqNoChangeAllZeros.NewPagination()
+	assert.Nil(t, err)
+	assert.Equal(t, expected, p, "zeros should get set to default")
 
 	reqNoChange := models.PaginationReq{Limit: 95, Page: 25}
 	expected.Limit, expected.Offset = 95, 2375
-	assert.Equal(t, expected, reqNoChange.NewPagination(), "some random offset and limit within the bounds should stay the same")
+	p, err = reqNoChange.NewPagination()
+	assert.Nil(t, err)
+	assert.Equal(t, expected, p, "some random offset and limit within the bounds should stay the same")
+}
+
+func TestPaginationCursor(t *testing.T) {
+	cursor := &models.Cursor{Columns: []string{"-last_name", "id"}, Values: []string{"Smith", "42"}, Before: true}
+	req := models.PaginationReq{Limit: 10, Cursor: cursor.String(), Count: true}
+	p, err := req.NewPagination()
+	assert.Nil(t, err)
+	assert.Equal(t, &models.Pagination{Limit: 10, Cursor: cursor, Count: true}, p)
+
+	req.Page = 1
+	_, err = req.NewPagination()
+	assert.Equal(t, models.ErrCursorWithPage, err, "cursors should not be combined with pages")
+
+	for _, invalid := range []string{"not base64!", "bm90IGpzb24", (&models.Cursor{Columns: []string{"id"}}).String()} {
+		req := models.PaginationReq{Cursor: invalid}
+		_, err := req.NewPagination()
+		assert.Equal(t, models.ErrInvalidCursor, err, "cursor %q should be invalid", invalid)
+	}
 }
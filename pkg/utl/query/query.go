@@ -2,8 +2,6 @@
 package query
 
 import (
-	"github.com/labstack/echo"
-
 	"github.com/johncoleman83/cerebrum/pkg/utl/models"
 )
 
@@ -17,6 +15,6 @@ func List(u *models.AuthUser) (*models.ListQuery, error) {
 	case u.AccessLevel == models.TeamAdminRole:
 		return &models.ListQuery{Query: "team_id = ?", ID: u.TeamID}, nil
 	default:
-		return nil, echo.ErrForbidden
+		return nil, models.ErrForbidden
 	}
 }
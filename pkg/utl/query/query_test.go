@@ -5,8 +5,6 @@ import (
 
 	"github.com/johncoleman83/cerebrum/pkg/utl/models"
 
-	"github.com/labstack/echo"
-
 	"github.com/johncoleman83/cerebrum/pkg/utl/query"
 	"github.com/stretchr/testify/assert"
 )
@@ -53,7 +51,7 @@ func TestList(t *testing.T) {
 			args: args{user: &models.AuthUser{
 				AccessLevel: models.UserRole,
 			}},
-			expectedErr: echo.ErrForbidden,
+			expectedErr: models.ErrForbidden,
 		},
 	}
 	for _, tt := range cases {
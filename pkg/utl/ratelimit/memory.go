@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is the interval at which full buckets are dropped
+const sweepInterval = time.Minute
+
+// Memory keeps the buckets in process, buckets are dropped once full as a
+// missing bucket is full
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time
+}
+
+// NewMemory creates a new in process store
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*bucket), swept: time.Now()}
+}
+
+// Take takes a token from the bucket of key
+func (m *Memory) Take(_ context.Context, key string, l Limit) (Result, error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.swept) >= sweepInterval {
+		m.sweep(now)
+	}
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.Burst), last: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.Burst), b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	res := result(allowed, b.tokens, l)
+	b.full = now.Add(res.Reset)
+	return res, nil
+}
+
+// sweep drops the buckets which are full by now
+func (m *Memory) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+	m.swept = now
+}
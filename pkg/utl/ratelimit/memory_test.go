@@ -0,0 +1,36 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/ratelimit"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	m := ratelimit.NewMemory()
+	l := ratelimit.Limit{Rate: 20, Burst: 2}
+
+	for i := 1; i >= 0; i-- {
+		res, err := m.Take(ctx, "a", l)
+		assert.Nil(t, err)
+		assert.True(t, res.Allowed, "the burst should be allowed")
+		assert.Equal(t, i, res.Remaining)
+	}
+	res, _ := m.Take(ctx, "a", l)
+	assert.False(t, res.Allowed, "empty buckets should reject")
+	assert.True(t, res.RetryAfter > 0 && res.RetryAfter <= 50*time.Millisecond, "a token should be available at the rate")
+	assert.True(t, res.Reset > res.RetryAfter)
+
+	res, _ = m.Take(ctx, "b", l)
+	assert.True(t, res.Allowed, "keys should have their own bucket")
+
+	time.Sleep(60 * time.Millisecond)
+	res, _ = m.Take(ctx, "a", l)
+	assert.True(t, res.Allowed, "buckets should be refilled")
+	assert.Equal(t, 0, res.Remaining)
+}
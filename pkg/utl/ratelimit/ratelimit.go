@@ -0,0 +1,212 @@
+// Package ratelimit limits the requests of clients with token buckets by
+// route group. Buckets are kept either in process or in Redis, which is
+// shared between the api instances so that they enforce a single budget.
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/labstack/echo"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+// Stores of the buckets
+const (
+	StoreMemory = "memory"
+	StoreRedis  = "redis"
+)
+
+// Keys identifying the clients of a group, user and token fall back to the
+// ip of clients which are not authenticated
+const (
+	KeyIP    = "ip"
+	KeyUser  = "user"
+	KeyToken = "token"
+)
+
+// ErrTooManyRequests is returned to clients once their bucket is empty
+var ErrTooManyRequests = models.NewError(http.StatusTooManyRequests, "rate_limited", "Too many requests, retry later.")
+
+// Limit is a bucket holding up to Burst tokens, refilled Rate tokens a second
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result is the state of a bucket once a token was taken from it
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is the time until a token is available, if not Allowed
+	RetryAfter time.Duration
+	// Reset is the time until the bucket is full
+	Reset time.Duration
+}
+
+// Store keeps the buckets of the clients
+type Store interface {
+	// Take takes a token from the bucket of key, which is full if missing
+	Take(ctx context.Context, key string, l Limit) (Result, error)
+}
+
+// Limiter limits the requests of the clients of route groups
+type Limiter struct {
+	store      Store
+	groups     map[string]group
+	trustProxy bool
+}
+
+type group struct {
+	key   string
+	limit Limit
+}
+
+// New returns the limiter configured by cfg, it limits nothing when rate
+// limiting is disabled
+func New(cfg *config.RateLimit) (*Limiter, error) {
+	if cfg == nil || cfg.Store == "" {
+		return &Limiter{}, nil
+	}
+	switch cfg.Store {
+	case StoreMemory:
+		return NewWithStore(NewMemory(), cfg)
+	case StoreRedis:
+		client := redis.NewClient(&redis.Options{
+			Addr:     cfg.RedisAddr,
+			Password: cfg.RedisPassword,
+			DB:       cfg.RedisDB,
+			PoolSize: cfg.RedisPoolSize,
+		})
+		return NewWithStore(NewRedis(client, cfg.KeyPrefix), cfg)
+	}
+	return nil, fmt.Errorf("ratelimit: unknown store %q", cfg.Store)
+}
+
+// NewWithStore returns the limiter of the groups of cfg keeping its buckets
+// in s, the store of cfg is ignored
+func NewWithStore(s Store, cfg *config.RateLimit) (*Limiter, error) {
+	l := &Limiter{store: s, groups: make(map[string]group), trustProxy: cfg.TrustProxy}
+	for name, g := range cfg.Groups {
+		if g == nil {
+			continue
+		}
+		switch g.Key {
+		case KeyIP, KeyUser, KeyToken:
+		default:
+			return nil, fmt.Errorf("ratelimit: unknown key %q of group %s", g.Key, name)
+		}
+		if g.Rate <= 0 {
+			return nil, fmt.Errorf("ratelimit: group %s has no rate", name)
+		}
+		burst := g.Burst
+		if burst <= 0 {
+			burst = g.Rate
+		}
+		l.groups[name] = group{key: g.Key, limit: Limit{Rate: float64(g.Rate) / 60, Burst: burst}}
+	}
+	return l, nil
+}
+
+// Middleware returns a middleware limiting the requests of the clients of
+// the group name, only the requests of routes are limited if any are given.
+// The state of the bucket is reported in the RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers, exhausted clients are
+// answered 429 with a Retry-After header. Requests are let through if the
+// store fails, so that it does not take the api down, and every request is
+// let through if the group is not configured.
+func (l *Limiter) Middleware(name string, routes ...string) echo.MiddlewareFunc {
+	g, ok := l.groups[name]
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !ok || len(routes) > 0 && !contains(routes, c.Path()) {
+				return next(c)
+			}
+			res, err := l.store.Take(c.Request().Context(), name+":"+l.client(c, g.key), g.limit)
+			if err != nil {
+				log.Printf("ratelimit: group %s: %v", name, err)
+				return next(c)
+			}
+			h := c.Response().Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(g.limit.Burst))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", seconds(res.Reset))
+			if !res.Allowed {
+				h.Set("Retry-After", seconds(res.RetryAfter))
+				return ErrTooManyRequests
+			}
+			return next(c)
+		}
+	}
+}
+
+// client returns the key of the client of c, tokens are hashed so that they
+// are not kept by the store
+func (l *Limiter) client(c echo.Context, key string) string {
+	switch key {
+	case KeyUser:
+		if u, ok := models.PrincipalFrom(c.Request().Context()); ok {
+			return "user:" + strconv.FormatUint(uint64(u.ID), 10)
+		}
+	case KeyToken:
+		auth := c.Request().Header.Get(echo.HeaderAuthorization)
+		if token := strings.TrimPrefix(auth, "Bearer "); token != auth && token != "" {
+			sum := sha256.Sum256([]byte(token))
+			return "token:" + hex.EncodeToString(sum[:16])
+		}
+	}
+	return "ip:" + l.ip(c)
+}
+
+// ip returns the ip of the client of c, the headers set by proxies are
+// only trusted if configured as clients may forge them
+func (l *Limiter) ip(c echo.Context) string {
+	if l.trustProxy {
+		return c.RealIP()
+	}
+	addr := c.Request().RemoteAddr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+func contains(routes []string, path string) bool {
+	for _, r := range routes {
+		if r == path {
+			return true
+		}
+	}
+	return false
+}
+
+// seconds formats d as a number of seconds, rounded up
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// result returns the result of taking a token from a bucket left holding
+// tokens
+func result(allowed bool, tokens float64, l Limit) Result {
+	res := Result{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(l.Burst) - tokens) / l.Rate * float64(time.Second)),
+	}
+	if !allowed {
+		res.RetryAfter = time.Duration((1 - tokens) / l.Rate * float64(time.Second))
+	}
+	return res
+}
@@ -0,0 +1,208 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+	"github.com/johncoleman83/cerebrum/pkg/utl/ratelimit"
+	"github.com/johncoleman83/cerebrum/pkg/utl/server"
+)
+
+func TestNew(t *testing.T) {
+	cases := []struct {
+		name    string
+		cfg     *config.RateLimit
+		wantErr bool
+	}{
+		{name: "Disabled without config"},
+		{name: "Disabled without store", cfg: &config.RateLimit{Groups: map[string]*config.RateLimitGroup{"v1": {Key: "ip", Rate: 1}}}},
+		{name: "Unknown store", cfg: &config.RateLimit{Store: "memcached"}, wantErr: true},
+		{name: "Unknown key", cfg: &config.RateLimit{Store: "memory", Groups: map[string]*config.RateLimitGroup{"v1": {Key: "session", Rate: 1}}}, wantErr: true},
+		{name: "Missing rate", cfg: &config.RateLimit{Store: "memory", Groups: map[string]*config.RateLimitGroup{"v1": {Key: "ip"}}}, wantErr: true},
+		{name: "Memory store", cfg: &config.RateLimit{Store: "memory", Groups: map[string]*config.RateLimitGroup{"v1": {Key: "user", Rate: 60}}}},
+		{name: "Redis store", cfg: &config.RateLimit{Store: "redis", RedisAddr: "localhost:6379"}},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := ratelimit.New(tt.cfg)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantErr, l == nil)
+		})
+	}
+}
+
+type storeFn func(ctx context.Context, key string, l ratelimit.Limit) (ratelimit.Result, error)
+
+func (f storeFn) Take(ctx context.Context, key string, l ratelimit.Limit) (ratelimit.Result, error) {
+	return f(ctx, key, l)
+}
+
+func TestMiddleware(t *testing.T) {
+	cfg := &config.RateLimit{Groups: map[string]*config.RateLimitGroup{
+		"login": {Key: "ip", Rate: 1, Burst: 2},
+		"v1":    {Key: "user", Rate: 60, Burst: 1},
+		"api":   {Key: "token", Rate: 60, Burst: 1},
+	}}
+	var takenKey string
+	var takeErr error
+	memory := ratelimit.NewMemory()
+	l, err := ratelimit.NewWithStore(storeFn(func(ctx context.Context, key string, lim ratelimit.Limit) (ratelimit.Result, error) {
+		takenKey = key
+		if takeErr != nil {
+			return ratelimit.Result{}, takeErr
+		}
+		return memory.Take(ctx, key, lim)
+	}), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := server.New(nil)
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.Use(l.Middleware("login", "/login"))
+	e.POST("/login", ok)
+	e.GET("/health", ok)
+	authenticate := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			c.SetRequest(req.WithContext(models.WithPrincipal(req.Context(), &models.AuthUser{ID: 7})))
+			return next(c)
+		}
+	}
+	e.GET("/v1/me", ok, authenticate, l.Middleware("v1"))
+	e.GET("/api/me", ok, l.Middleware("api"))
+	e.GET("/none", ok, l.Middleware("none"))
+
+	cases := []struct {
+		name       string
+		method     string
+		path       string
+		remoteAddr string
+		header     map[string]string
+		takeErr    error
+		wantStatus int
+		wantKey    string
+		wantHeader map[string]string
+	}{
+		{
+			name:       "Allows the burst of a client",
+			method:     http.MethodPost,
+			path:       "/login",
+			wantStatus: http.StatusOK,
+			wantKey:    "login:ip:192.0.2.1",
+			wantHeader: map[string]string{"RateLimit-Limit": "2", "RateLimit-Remaining": "1", "RateLimit-Reset": "60"},
+		},
+		{
+			name:       "Ignores forwarded ips",
+			method:     http.MethodPost,
+			path:       "/login",
+			header:     map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			wantStatus: http.StatusOK,
+			wantKey:    "login:ip:192.0.2.1",
+			wantHeader: map[string]string{"RateLimit-Remaining": "0"},
+		},
+		{
+			name:       "Rejects a client past its burst",
+			method:     http.MethodPost,
+			path:       "/login",
+			wantStatus: http.StatusTooManyRequests,
+			wantKey:    "login:ip:192.0.2.1",
+			wantHeader: map[string]string{"RateLimit-Remaining": "0", "RateLimit-Reset": "120", "Retry-After": "60"},
+		},
+		{
+			name:       "Limits clients separately",
+			method:     http.MethodPost,
+			path:       "/login",
+			remoteAddr: "192.0.2.2:1234",
+			wantStatus: http.StatusOK,
+			wantKey:    "login:ip:192.0.2.2",
+		},
+		{
+			name:       "Lets other routes through",
+			method:     http.MethodGet,
+			path:       "/health",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Limits authenticated users",
+			method:     http.MethodGet,
+			path:       "/v1/me",
+			wantStatus: http.StatusOK,
+			wantKey:    "v1:user:7",
+		},
+		{
+			name:       "Limits tokens without storing them",
+			method:     http.MethodGet,
+			path:       "/api/me",
+			header:     map[string]string{"Authorization": "Bearer secret"},
+			wantStatus: http.StatusOK,
+			wantKey:    "api:token:2bb80d537b1da3e38bd30361aa855686",
+		},
+		{
+			name:       "Limits anonymous clients by ip",
+			method:     http.MethodGet,
+			path:       "/api/me",
+			wantStatus: http.StatusOK,
+			wantKey:    "api:ip:192.0.2.1",
+		},
+		{
+			name:       "Lets unconfigured groups through",
+			method:     http.MethodGet,
+			path:       "/none",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Lets requests through if the store fails",
+			method:     http.MethodGet,
+			path:       "/v1/me",
+			takeErr:    errors.New("connection refused"),
+			wantStatus: http.StatusOK,
+			wantKey:    "v1:user:7",
+			wantHeader: map[string]string{"RateLimit-Limit": ""},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			takenKey, takeErr = "", tt.takeErr
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantKey, takenKey)
+			for k, v := range tt.wantHeader {
+				assert.Equal(t, v, rec.Header().Get(k), k)
+			}
+		})
+	}
+}
+
+func TestMiddlewareTrustProxy(t *testing.T) {
+	var takenKey string
+	l, err := ratelimit.NewWithStore(storeFn(func(_ context.Context, key string, _ ratelimit.Limit) (ratelimit.Result, error) {
+		takenKey = key
+		return ratelimit.Result{Allowed: true}, nil
+	}), &config.RateLimit{TrustProxy: true, Groups: map[string]*config.RateLimitGroup{"v1": {Key: "ip", Rate: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, l.Middleware("v1"))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Forwarded-For", "198.51.100.1, 192.0.2.9")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "v1:ip:198.51.100.1", takenKey)
+}
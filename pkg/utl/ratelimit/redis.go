@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/go-redis/redis"
+)
+
+// takeScript takes a token from the bucket hash at KEYS[1], refilled
+// ARGV[1] tokens a second up to ARGV[2] tokens, and returns whether it was
+// taken and the tokens left. It reads the clock of the redis server so that
+// the api instances agree on the time, and expires buckets once full.
+const takeScript = `
+redis.replicate_commands()
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(b[1]) or burst
+local last = tonumber(b[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - last) * rate / 1000)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'last', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) * 1000 / rate) + 1000)
+return {allowed, tostring(tokens)}
+`
+
+// RedisClient represents the redis commands used by the store, it is
+// implemented by the clients of github.com/go-redis/redis
+type RedisClient interface {
+	Eval(script string, keys []string, args ...interface{}) *redis.Cmd
+}
+
+// Redis keeps the buckets in redis, which is shared by the api instances,
+// its keys are prefixed so that the redis database may be shared with other
+// applications. Buckets are taken from atomically by a script.
+type Redis struct {
+	client RedisClient
+	prefix string
+}
+
+// NewRedis creates a new redis store
+func NewRedis(c RedisClient, prefix string) *Redis {
+	return &Redis{client: c, prefix: prefix}
+}
+
+// Take takes a token from the bucket of key
+func (r *Redis) Take(_ context.Context, key string, l Limit) (Result, error) {
+	v, err := r.client.Eval(takeScript, []string{r.prefix + key}, l.Rate, l.Burst).Result()
+	if err != nil {
+		return Result{}, err
+	}
+	reply, ok := v.([]interface{})
+	if !ok || len(reply) != 2 {
+		return Result{}, fmt.Errorf("unexpected reply %v", v)
+	}
+	allowed, ok := reply[0].(int64)
+	if !ok {
+		return Result{}, fmt.Errorf("unexpected reply %v", v)
+	}
+	s, ok := reply[1].(string)
+	if !ok {
+		return Result{}, fmt.Errorf("unexpected reply %v", v)
+	}
+	tokens, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("unexpected reply %v", v)
+	}
+	return result(allowed == 1, tokens, l), nil
+}
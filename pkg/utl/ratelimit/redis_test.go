@@ -0,0 +1,59 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/mock"
+	"github.com/johncoleman83/cerebrum/pkg/utl/ratelimit"
+)
+
+func TestRedis(t *testing.T) {
+	l := ratelimit.Limit{Rate: 1, Burst: 5}
+	cases := []struct {
+		name       string
+		reply      interface{}
+		err        error
+		wantErr    bool
+		wantResult ratelimit.Result
+	}{
+		{
+			name:       "Allowed",
+			reply:      []interface{}{int64(1), "3.5"},
+			wantResult: ratelimit.Result{Allowed: true, Remaining: 3, Reset: 1500 * time.Millisecond},
+		},
+		{
+			name:       "Rejected",
+			reply:      []interface{}{int64(0), "0.25"},
+			wantResult: ratelimit.Result{Remaining: 0, RetryAfter: 750 * time.Millisecond, Reset: 4750 * time.Millisecond},
+		},
+		{
+			name:    "Unexpected reply",
+			reply:   []interface{}{int64(1), int64(3)},
+			wantErr: true,
+		},
+		{
+			name:    "Redis failure",
+			err:     errors.New("connection refused"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := mock.NewRedis()
+			r.Err = tt.err
+			r.EvalFn = func(script string, keys []string, args ...interface{}) (interface{}, error) {
+				assert.Equal(t, []string{"cerebrum:login:ip:192.0.2.1"}, keys, "keys should be prefixed")
+				assert.Equal(t, []interface{}{l.Rate, l.Burst}, args)
+				return tt.reply, nil
+			}
+			got, err := ratelimit.NewRedis(r, "cerebrum:").Take(context.Background(), "login:ip:192.0.2.1", l)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantResult, got)
+		})
+	}
+}
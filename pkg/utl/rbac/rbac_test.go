@@ -1,22 +1,22 @@
 package rbac_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/johncoleman83/cerebrum/pkg/utl/models"
 
-	"github.com/johncoleman83/cerebrum/pkg/utl/mock"
 	rbacService "github.com/johncoleman83/cerebrum/pkg/utl/rbac"
 
-	"github.com/labstack/echo"
-
 	"github.com/stretchr/testify/assert"
 )
 
+func principal(u models.AuthUser) context.Context {
+	return models.WithPrincipal(context.Background(), &u)
+}
+
 func TestUser(t *testing.T) {
-	ctx := mock.EchoCtxWithKeys([]string{
-		"id", "account_id", "team_id", "username", "email", "role"},
-		uint(9), uint(15), uint(52), "rocinante", "rocinante@gmail.com", models.SuperAdminRole)
+	ctx := principal(models.AuthUser{ID: uint(9), AccountID: uint(15), TeamID: uint(52), Username: "rocinante", Email: "rocinante@gmail.com", AccessLevel: models.SuperAdminRole})
 	expectedUser := &models.AuthUser{
 		ID:          uint(9),
 		Username:    "rocinante",
@@ -27,11 +27,23 @@ func TestUser(t *testing.T) {
 	}
 	rbac := rbacService.New()
 	assert.Equal(t, expectedUser, rbac.User(ctx))
+	assert.Nil(t, rbac.User(context.Background()), "there should be no user without a principal")
+}
+
+func TestMissingPrincipal(t *testing.T) {
+	ctx := context.Background()
+	rbac := rbacService.New()
+	assert.Equal(t, models.ErrUnauthorized, rbac.EnforceRole(ctx, models.UserRole))
+	assert.Equal(t, models.ErrUnauthorized, rbac.EnforceUser(ctx, 0))
+	assert.Equal(t, models.ErrUnauthorized, rbac.EnforceAccount(ctx, 0))
+	assert.Equal(t, models.ErrUnauthorized, rbac.EnforceTeam(ctx, 0))
+	assert.Equal(t, models.ErrUnauthorized, rbac.AccountCreate(ctx, models.UserRole, 0, 0))
+	assert.Equal(t, models.ErrUnauthorized, rbac.IsLowerRole(ctx, models.UserRole))
 }
 
 func TestEnforceRole(t *testing.T) {
 	type args struct {
-		ctx  echo.Context
+		ctx  context.Context
 		role models.AccessRole
 	}
 	cases := []struct {
@@ -41,12 +53,12 @@ func TestEnforceRole(t *testing.T) {
 	}{
 		{
 			name:        "Not authorized",
-			args:        args{ctx: mock.EchoCtxWithKeys([]string{"role"}, models.AccountAdminRole), role: models.SuperAdminRole},
+			args:        args{ctx: principal(models.AuthUser{AccessLevel: models.AccountAdminRole}), role: models.SuperAdminRole},
 			expectedErr: true,
 		},
 		{
 			name:        "Authorized",
-			args:        args{ctx: mock.EchoCtxWithKeys([]string{"role"}, models.SuperAdminRole), role: models.AccountAdminRole},
+			args:        args{ctx: principal(models.AuthUser{AccessLevel: models.SuperAdminRole}), role: models.AccountAdminRole},
 			expectedErr: false,
 		},
 	}
@@ -54,14 +66,14 @@ func TestEnforceRole(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			rbac := rbacService.New()
 			res := rbac.EnforceRole(tt.args.ctx, tt.args.role)
-			assert.Equal(t, tt.expectedErr, res == echo.ErrForbidden)
+			assert.Equal(t, tt.expectedErr, res == models.ErrForbidden)
 		})
 	}
 }
 
 func TestEnforceUser(t *testing.T) {
 	type args struct {
-		ctx echo.Context
+		ctx context.Context
 		id  uint
 	}
 	cases := []struct {
@@ -71,17 +83,17 @@ func TestEnforceUser(t *testing.T) {
 	}{
 		{
 			name:        "Not same user, not an admin",
-			args:        args{ctx: mock.EchoCtxWithKeys([]string{"id", "role"}, uint(15), models.TeamAdminRole), id: uint(122)},
+			args:        args{ctx: principal(models.AuthUser{ID: uint(15), AccessLevel: models.TeamAdminRole}), id: uint(122)},
 			expectedErr: true,
 		},
 		{
 			name:        "Not same user, but admin",
-			args:        args{ctx: mock.EchoCtxWithKeys([]string{"id", "role"}, uint(22), models.SuperAdminRole), id: uint(44)},
+			args:        args{ctx: principal(models.AuthUser{ID: uint(22), AccessLevel: models.SuperAdminRole}), id: uint(44)},
 			expectedErr: false,
 		},
 		{
 			name:        "Same user",
-			args:        args{ctx: mock.EchoCtxWithKeys([]string{"id", "role"}, uint(8), models.AdminRole), id: uint(8)},
+			args:        args{ctx: principal(models.AuthUser{ID: uint(8), AccessLevel: models.AdminRole}), id: uint(8)},
 			expectedErr: false,
 		},
 	}
@@ -89,14 +101,14 @@ func TestEnforceUser(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			rbac := rbacService.New()
 			res := rbac.EnforceUser(tt.args.ctx, tt.args.id)
-			assert.Equal(t, tt.expectedErr, res == echo.ErrForbidden)
+			assert.Equal(t, tt.expectedErr, res == models.ErrForbidden)
 		})
 	}
 }
 
 func TestEnforceAccount(t *testing.T) {
 	type args struct {
-		ctx echo.Context
+		ctx context.Context
 		id  uint
 	}
 	cases := []struct {
@@ -106,22 +118,22 @@ func TestEnforceAccount(t *testing.T) {
 	}{
 		{
 			name:        "Not same account, not an admin",
-			args:        args{ctx: mock.EchoCtxWithKeys([]string{"account_id", "role"}, uint(7), models.UserRole), id: uint(9)},
+			args:        args{ctx: principal(models.AuthUser{AccountID: uint(7), AccessLevel: models.UserRole}), id: uint(9)},
 			expectedErr: true,
 		},
 		{
 			name:        "Same account, not account admin or admin",
-			args:        args{ctx: mock.EchoCtxWithKeys([]string{"account_id", "role"}, uint(22), models.UserRole), id: uint(22)},
+			args:        args{ctx: principal(models.AuthUser{AccountID: uint(22), AccessLevel: models.UserRole}), id: uint(22)},
 			expectedErr: true,
 		},
 		{
 			name:        "Same account, account admin",
-			args:        args{ctx: mock.EchoCtxWithKeys([]string{"account_id", "role"}, uint(5), models.AccountAdminRole), id: uint(5)},
+			args:        args{ctx: principal(models.AuthUser{AccountID: uint(5), AccessLevel: models.AccountAdminRole}), id: uint(5)},
 			expectedErr: false,
 		},
 		{
 			name:        "Not same account but admin",
-			args:        args{ctx: mock.EchoCtxWithKeys([]string{"account_id", "role"}, uint(8), models.AdminRole), id: uint(9)},
+			args:        args{ctx: principal(models.AuthUser{AccountID: uint(8), AccessLevel: models.AdminRole}), id: uint(9)},
 			expectedErr: false,
 		},
 	}
@@ -129,14 +141,14 @@ func TestEnforceAccount(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			rbac := rbacService.New()
 			res := rbac.EnforceAccount(tt.args.ctx, tt.args.id)
-			assert.Equal(t, tt.expectedErr, res == echo.ErrForbidden)
+			assert.Equal(t, tt.expectedErr, res == models.ErrForbidden)
 		})
 	}
 }
 
 func TestEnforceTeam(t *testing.T) {
 	type args struct {
-		ctx echo.Context
+		ctx context.Context
 		id  uint
 	}
 	cases := []struct {
@@ -146,22 +158,22 @@ func TestEnforceTeam(t *testing.T) {
 	}{
 		{
 			name:        "Not same team, not an admin",
-			args:        args{ctx: mock.EchoCtxWithKeys([]string{"team_id", "role"}, uint(7), models.UserRole), id: uint(9)},
+			args:        args{ctx: principal(models.AuthUser{TeamID: uint(7), AccessLevel: models.UserRole}), id: uint(9)},
 			expectedErr: true,
 		},
 		{
 			name:        "Same team, not account admin or admin",
-			args:        args{ctx: mock.EchoCtxWithKeys([]string{"team_id", "role"}, uint(22), models.UserRole), id: uint(22)},
+			args:        args{ctx: principal(models.AuthUser{TeamID: uint(22), AccessLevel: models.UserRole}), id: uint(22)},
 			expectedErr: true,
 		},
 		{
 			name:        "Same team, account admin",
-			args:        args{ctx: mock.EchoCtxWithKeys([]string{"team_id", "role"}, uint(5), models.AccountAdminRole), id: uint(5)},
+			args:        args{ctx: principal(models.AuthUser{TeamID: uint(5), AccessLevel: models.AccountAdminRole}), id: uint(5)},
 			expectedErr: false,
 		},
 		{
 			name:        "Team admin",
-			args:        args{ctx: mock.EchoCtxWithKeys([]string{"team_id", "role"}, uint(5), models.TeamAdminRole), id: uint(5)},
+			args:        args{ctx: principal(models.AuthUser{TeamID: uint(5), AccessLevel: models.TeamAdminRole}), id: uint(5)},
 			expectedErr: false,
 		},
 	}
@@ -169,14 +181,14 @@ func TestEnforceTeam(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			rbac := rbacService.New()
 			res := rbac.EnforceTeam(tt.args.ctx, tt.args.id)
-			assert.Equal(t, tt.expectedErr, res == echo.ErrForbidden)
+			assert.Equal(t, tt.expectedErr, res == models.ErrForbidden)
 		})
 	}
 }
 
 func TestAccountCreate(t *testing.T) {
 	type args struct {
-		ctx        echo.Context
+		ctx        context.Context
 		roleID     models.AccessRole
 		account_id uint
 		team_id    uint
@@ -188,32 +200,32 @@ func TestAccountCreate(t *testing.T) {
 	}{
 		{
 			name:        "Different team, account, creating user role, not an admin",
-			args:        args{ctx: mock.EchoCtxWithKeys([]string{"account_id", "team_id", "role"}, uint(2), uint(3), models.UserRole), roleID: models.AccessRole(500), account_id: uint(7), team_id: uint(8)},
+			args:        args{ctx: principal(models.AuthUser{AccountID: uint(2), TeamID: uint(3), AccessLevel: models.UserRole}), roleID: models.AccessRole(500), account_id: uint(7), team_id: uint(8)},
 			expectedErr: true,
 		},
 		{
 			name:        "Same team, not account, creating user role, not an admin",
-			args:        args{ctx: mock.EchoCtxWithKeys([]string{"account_id", "team_id", "role"}, uint(2), uint(3), models.UserRole), roleID: models.AccessRole(500), account_id: uint(2), team_id: uint(8)},
+			args:        args{ctx: principal(models.AuthUser{AccountID: uint(2), TeamID: uint(3), AccessLevel: models.UserRole}), roleID: models.AccessRole(500), account_id: uint(2), team_id: uint(8)},
 			expectedErr: true,
 		},
 		{
 			name:        "Different team, account, creating user role, not an admin",
-			args:        args{ctx: mock.EchoCtxWithKeys([]string{"account_id", "team_id", "role"}, uint(2), uint(3), models.AccountAdminRole), roleID: models.AccessRole(400), account_id: uint(2), team_id: uint(4)},
+			args:        args{ctx: principal(models.AuthUser{AccountID: uint(2), TeamID: uint(3), AccessLevel: models.AccountAdminRole}), roleID: models.AccessRole(400), account_id: uint(2), team_id: uint(4)},
 			expectedErr: false,
 		},
 		{
 			name:        "Same team, account, creating user role, not an admin",
-			args:        args{ctx: mock.EchoCtxWithKeys([]string{"account_id", "team_id", "role"}, uint(2), uint(3), models.AccountAdminRole), roleID: models.AccessRole(500), account_id: uint(2), team_id: uint(3)},
+			args:        args{ctx: principal(models.AuthUser{AccountID: uint(2), TeamID: uint(3), AccessLevel: models.AccountAdminRole}), roleID: models.AccessRole(500), account_id: uint(2), team_id: uint(3)},
 			expectedErr: false,
 		},
 		{
 			name:        "Same team, account, creating user role, admin",
-			args:        args{ctx: mock.EchoCtxWithKeys([]string{"account_id", "team_id", "role"}, uint(2), uint(3), models.AccountAdminRole), roleID: models.AccessRole(500), account_id: uint(2), team_id: uint(3)},
+			args:        args{ctx: principal(models.AuthUser{AccountID: uint(2), TeamID: uint(3), AccessLevel: models.AccountAdminRole}), roleID: models.AccessRole(500), account_id: uint(2), team_id: uint(3)},
 			expectedErr: false,
 		},
 		{
 			name:        "Different everything, admin",
-			args:        args{ctx: mock.EchoCtxWithKeys([]string{"account_id", "team_id", "role"}, uint(2), uint(3), models.AdminRole), roleID: models.AccessRole(200), account_id: uint(7), team_id: uint(4)},
+			args:        args{ctx: principal(models.AuthUser{AccountID: uint(2), TeamID: uint(3), AccessLevel: models.AdminRole}), roleID: models.AccessRole(200), account_id: uint(7), team_id: uint(4)},
 			expectedErr: false,
 		},
 	}
@@ -221,13 +233,13 @@ func TestAccountCreate(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			rbac := rbacService.New()
 			res := rbac.AccountCreate(tt.args.ctx, tt.args.roleID, tt.args.account_id, tt.args.team_id)
-			assert.Equal(t, tt.expectedErr, res == echo.ErrForbidden)
+			assert.Equal(t, tt.expectedErr, res == models.ErrForbidden)
 		})
 	}
 }
 
 func TestIsLowerRole(t *testing.T) {
-	ctx := mock.EchoCtxWithKeys([]string{"role"}, models.AccountAdminRole)
+	ctx := principal(models.AuthUser{AccessLevel: models.AccountAdminRole})
 	rbac := rbacService.New()
 	if rbac.IsLowerRole(ctx, models.TeamAdminRole) != nil {
 		t.Error("The requested user is higher role than the user requesting it")
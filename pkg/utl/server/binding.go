@@ -1,6 +1,9 @@
 package server
 
 import (
+	"reflect"
+	"strings"
+
 	"github.com/go-playground/validator"
 	"github.com/labstack/echo"
 )
@@ -28,7 +31,58 @@ type CustomValidator struct {
 	V *validator.Validate
 }
 
+// NewValidator initializes custom server validator, fields are named by
+// their json name, or by their query parameter for those bound from the
+// query string, so that validation errors point at the request
+func NewValidator() *CustomValidator {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = f.Tag.Get("query")
+		}
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	return &CustomValidator{V: v}
+}
+
+// queryValidationErrors are the validation errors of a request bound from
+// the query string, which are reported by parameter instead of by pointer
+type queryValidationErrors struct {
+	validator.ValidationErrors
+}
+
+// Unwrap returns the validation errors
+func (e queryValidationErrors) Unwrap() error {
+	return e.ValidationErrors
+}
+
 // Validate validates the request
 func (cv *CustomValidator) Validate(i interface{}) error {
-	return cv.V.Struct(i)
+	err := cv.V.Struct(i)
+	if ve, ok := err.(validator.ValidationErrors); ok && boundFromQuery(i) {
+		return queryValidationErrors{ve}
+	}
+	return err
+}
+
+// boundFromQuery reports whether the struct i points at has fields bound
+// from the query string
+func boundFromQuery(i interface{}) bool {
+	t := reflect.TypeOf(i)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return false
+	}
+	for n := 0; n < t.NumField(); n++ {
+		if _, ok := t.Field(n).Tag.Lookup("query"); ok {
+			return true
+		}
+	}
+	return false
 }
@@ -1,13 +1,27 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/go-playground/validator"
 	"github.com/labstack/echo"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
 )
 
+// ProblemContentType is the media type of the error responses, see RFC 7807
+const ProblemContentType = "application/problem+json"
+
+// problemTypePrefix prefixes the code of a problem into its type uri
+const problemTypePrefix = "urn:cerebrum:problem:"
+
+// codeValidationFailed is the code of the requests failing validation
+const codeValidationFailed = "validation_failed"
+
 type customErrHandler struct {
 	e *echo.Echo
 }
@@ -25,57 +39,164 @@ func getVldErrorMsg(s string) string {
 	return " failed on " + s + " validation"
 }
 
-type resp struct {
-	Message string `json:"message"`
+// problem is the body of the error responses, Code is the stable machine
+// readable code of the problem and Errors the problems of the invalid fields
+// of the request. The error itself is never sent, it is logged instead.
+type problem struct {
+	Type      string         `json:"type"`
+	Title     string         `json:"title"`
+	Status    int            `json:"status"`
+	Detail    string         `json:"detail,omitempty"`
+	Instance  string         `json:"instance,omitempty"`
+	Code      string         `json:"code"`
+	RequestID string         `json:"request_id,omitempty"`
+	Errors    []fieldProblem `json:"errors,omitempty"`
 }
 
-func (ce *customErrHandler) handler(err error, c echo.Context) {
-	var (
-		code = http.StatusInternalServerError
-		msg  interface{}
-	)
+// fieldProblem is the problem of a field of the request, Pointer is the JSON
+// pointer of a body field, Parameter the name of a query parameter and Code
+// the failed validation
+type fieldProblem struct {
+	Pointer   string `json:"pointer,omitempty"`
+	Parameter string `json:"parameter,omitempty"`
+	Code      string `json:"code"`
+	Detail    string `json:"detail"`
+}
 
-	type resp struct {
-		Message interface{} `json:"message"`
+// kindError is implemented by errors classified by kind, such as the store
+// errors, which keeps the server independent of the packages returning them
+type kindError interface {
+	error
+	ErrorKind() string
+	ErrorCode() string
+	PublicMessage() string
+}
+
+// statusClientClosedRequest is the status of requests whose client went
+// away, it is only logged as the response is never received
+const statusClientClosedRequest = 499
+
+var kindCodes = map[string]int{
+	"not_found":   http.StatusNotFound,
+	"conflict":    http.StatusConflict,
+	"unavailable": http.StatusServiceUnavailable,
+	"timeout":     http.StatusServiceUnavailable,
+	"canceled":    statusClientClosedRequest,
+}
+
+// asKindError returns the first kindError in the chain of err
+func asKindError(err error) (kindError, bool) {
+	var ke kindError
+	if errors.As(err, &ke) {
+		return ke, true
 	}
+	return nil, false
+}
 
-	if ce.e.Debug {
-		msg = err.Error()
-		switch err.(type) {
-		case *echo.HTTPError:
-			code = err.(*echo.HTTPError).Code
-		case validator.ValidationErrors:
-			code = http.StatusBadRequest
+// statusCode returns the code of the errors of status which have none,
+// such as not_found
+func statusCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "http_" + strconv.Itoa(status)
+	}
+	return strings.ToLower(strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(text))
+}
+
+// newProblem returns the problem reported to clients for err, the details
+// of unexpected errors are left out
+func newProblem(err error) *problem {
+	p := &problem{Status: http.StatusInternalServerError}
+	var (
+		ae *models.Error
+		qe queryValidationErrors
+		ve validator.ValidationErrors
+		he *echo.HTTPError
+	)
+	ke, isKindError := asKindError(err)
+	switch {
+	case errors.As(err, &ae):
+		p.Status, p.Code, p.Detail = ae.Status, ae.Code, ae.Message
+	case errors.As(err, &qe):
+		p.Status, p.Code = http.StatusBadRequest, codeValidationFailed
+		p.Detail = "request query is invalid"
+		for _, fe := range qe.ValidationErrors {
+			p.Errors = append(p.Errors, fieldProblem{
+				Parameter: fe.Field(),
+				Code:      fe.ActualTag(),
+				Detail:    fe.Field() + getVldErrorMsg(fe.ActualTag()),
+			})
+		}
+	case errors.As(err, &ve):
+		p.Status, p.Code = http.StatusBadRequest, codeValidationFailed
+		p.Detail = "request body is invalid"
+		for _, fe := range ve {
+			p.Errors = append(p.Errors, fieldProblem{
+				Pointer: jsonPointer(fe.Namespace()),
+				Code:    fe.ActualTag(),
+				Detail:  fe.Field() + getVldErrorMsg(fe.ActualTag()),
+			})
 		}
-	} else {
-		switch e := err.(type) {
-		case *echo.HTTPError:
-			code = e.Code
-			msg = e.Message
-			if e.Internal != nil {
-				msg = fmt.Sprintf("%v, %v", err, e.Internal)
-			}
-		case validator.ValidationErrors:
-			var errMsg []string
-			for _, v := range e {
-				errMsg = append(errMsg, fmt.Sprintf("%s%s", v.Field(), getVldErrorMsg(v.ActualTag())))
-			}
-			msg = resp{Message: errMsg}
-			code = http.StatusBadRequest
-		default:
-			msg = http.StatusText(code)
+	case isKindError:
+		if status, ok := kindCodes[ke.ErrorKind()]; ok {
+			p.Status, p.Code, p.Detail = status, ke.ErrorCode(), ke.PublicMessage()
 		}
-		if _, ok := msg.(string); ok {
-			msg = resp{Message: msg}
+	case errors.As(err, &he):
+		p.Status = he.Code
+		if msg := fmt.Sprint(he.Message); msg != http.StatusText(he.Code) {
+			p.Detail = msg
 		}
 	}
+	if p.Code == "" {
+		p.Code = statusCode(p.Status)
+	}
+	p.Type = problemTypePrefix + p.Code
+	p.Title = http.StatusText(p.Status)
+	if p.Status == statusClientClosedRequest {
+		p.Title = "Client Closed Request"
+	}
+	return p
+}
+
+// jsonPointer returns the JSON pointer of the field at namespace, such as
+// /address/street for User.address.street, validated structs name their
+// fields by their json name
+func jsonPointer(namespace string) string {
+	segments := strings.Split(namespace, ".")[1:]
+	escape := strings.NewReplacer("~", "~0", "/", "~1")
+	var b strings.Builder
+	for _, seg := range segments {
+		name, index := seg, ""
+		if i := strings.Index(seg, "["); i >= 0 && strings.HasSuffix(seg, "]") {
+			name, index = seg[:i], seg[i+1:len(seg)-1]
+		}
+		b.WriteString("/" + escape.Replace(name))
+		if index != "" {
+			b.WriteString("/" + escape.Replace(index))
+		}
+	}
+	return b.String()
+}
+
+// handler responds with the problem of err as application/problem+json,
+// the error itself is logged with the request id in debug mode and for
+// unexpected errors, as it may hold internal details
+func (ce *customErrHandler) handler(err error, c echo.Context) {
+	p := newProblem(err)
+	// every response refers to the request, so that it may be found in logs
+	p.RequestID, _ = models.RequestIDFrom(c.Request().Context())
+	p.Instance = c.Request().URL.Path
+	if ce.e.Debug || p.Status >= http.StatusInternalServerError {
+		ce.e.Logger.Errorf("request %s failed, %v", p.RequestID, err)
+	}
 
 	// Send response
 	if !c.Response().Committed {
 		if c.Request().Method == "HEAD" {
-			err = c.NoContent(code)
+			err = c.NoContent(p.Status)
 		} else {
-			err = c.JSON(code, msg)
+			c.Response().Header().Set(echo.HeaderContentType, ProblemContentType)
+			err = c.JSON(p.Status, p)
 		}
 		if err != nil {
 			ce.e.Logger.Error(err)
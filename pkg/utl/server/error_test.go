@@ -0,0 +1,201 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+	"github.com/johncoleman83/cerebrum/pkg/utl/server"
+)
+
+// kindErr mimics the store errors classified by kind
+type kindErr struct {
+	kind string
+	code string
+	msg  string
+}
+
+func (e kindErr) Error() string         { return "store: " + e.msg + ": driver detail" }
+func (e kindErr) ErrorKind() string     { return e.kind }
+func (e kindErr) ErrorCode() string     { return e.code }
+func (e kindErr) PublicMessage() string { return e.msg }
+
+type address struct {
+	Street string `json:"street" validate:"required"`
+}
+
+type listReq struct {
+	Q    string `query:"q" validate:"max=3"`
+	Page int    `query:"page" validate:"min=0"`
+}
+
+type createReq struct {
+	Email     string    `json:"email" validate:"required"`
+	FirstName string    `json:"first_name" validate:"min=2"`
+	Address   address   `json:"address"`
+	Phones    []address `json:"phones" validate:"dive"`
+}
+
+func TestErrorHandler(t *testing.T) {
+	cases := []struct {
+		name         string
+		err          error
+		debug        bool
+		requestID    string
+		expectedCode int
+		expectedBody string
+		expectedLog  string
+	}{
+		{
+			name:         "Coded error",
+			err:          models.NewError(http.StatusBadRequest, "insecure_password", "insecure password"),
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"type":"urn:cerebrum:problem:insecure_password","title":"Bad Request","status":400,
+				"detail":"insecure password","instance":"/users","code":"insecure_password"}`,
+		},
+		{
+			name:         "Coded error wrapped by a service",
+			err:          fmt.Errorf("creating user: %w", models.NewError(http.StatusPreconditionFailed, "version_mismatch", "user was modified")),
+			expectedCode: http.StatusPreconditionFailed,
+			expectedBody: `{"type":"urn:cerebrum:problem:version_mismatch","title":"Precondition Failed","status":412,
+				"detail":"user was modified","instance":"/users","code":"version_mismatch"}`,
+		},
+		{
+			name:         "Not found",
+			err:          kindErr{kind: "not_found", code: "user_not_found", msg: "user not found"},
+			expectedCode: http.StatusNotFound,
+			expectedBody: `{"type":"urn:cerebrum:problem:user_not_found","title":"Not Found","status":404,
+				"detail":"user not found","instance":"/users","code":"user_not_found"}`,
+		},
+		{
+			name:         "Conflict",
+			err:          kindErr{kind: "conflict", code: "already_exists", msg: "username or email already exists"},
+			expectedCode: http.StatusConflict,
+			expectedBody: `{"type":"urn:cerebrum:problem:already_exists","title":"Conflict","status":409,
+				"detail":"username or email already exists","instance":"/users","code":"already_exists"}`,
+		},
+		{
+			name:         "Unavailable wrapped by a service",
+			err:          fmt.Errorf("viewing user: %w", kindErr{kind: "unavailable", code: "unavailable", msg: "database is unavailable"}),
+			expectedCode: http.StatusServiceUnavailable,
+			expectedBody: `{"type":"urn:cerebrum:problem:unavailable","title":"Service Unavailable","status":503,
+				"detail":"database is unavailable","instance":"/users","code":"unavailable"}`,
+		},
+		{
+			name:         "Canceled by the client",
+			err:          kindErr{kind: "canceled", code: "canceled", msg: "request was canceled"},
+			expectedCode: 499,
+			expectedBody: `{"type":"urn:cerebrum:problem:canceled","title":"Client Closed Request","status":499,
+				"detail":"request was canceled","instance":"/users","code":"canceled"}`,
+		},
+		{
+			name:         "Internal kind does not leak details",
+			err:          kindErr{kind: "internal", code: "internal", msg: "database error"},
+			expectedCode: http.StatusInternalServerError,
+			expectedBody: `{"type":"urn:cerebrum:problem:internal_server_error","title":"Internal Server Error","status":500,
+				"instance":"/users","code":"internal_server_error"}`,
+		},
+		{
+			name:         "Echo error",
+			err:          echo.ErrForbidden,
+			expectedCode: http.StatusForbidden,
+			expectedBody: `{"type":"urn:cerebrum:problem:forbidden","title":"Forbidden","status":403,
+				"instance":"/users","code":"forbidden"}`,
+		},
+		{
+			name:         "Echo error with a message",
+			err:          echo.NewHTTPError(http.StatusBadRequest, "Syntax error: offset=1"),
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"type":"urn:cerebrum:problem:bad_request","title":"Bad Request","status":400,
+				"detail":"Syntax error: offset=1","instance":"/users","code":"bad_request"}`,
+		},
+		{
+			name:         "Validation errors point at their fields",
+			err:          server.NewValidator().Validate(&createReq{FirstName: "a", Phones: []address{{Street: "Main"}, {}}}),
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"type":"urn:cerebrum:problem:validation_failed","title":"Bad Request","status":400,
+				"detail":"request body is invalid","instance":"/users","code":"validation_failed","errors":[
+				{"pointer":"/email","code":"required","detail":"email is required, but was not received"},
+				{"pointer":"/first_name","code":"min","detail":"first_name's value or length is less than allowed"},
+				{"pointer":"/address/street","code":"required","detail":"street is required, but was not received"},
+				{"pointer":"/phones/1/street","code":"required","detail":"street is required, but was not received"}]}`,
+		},
+		{
+			name:         "Validation errors of query structs name their parameters",
+			err:          server.NewValidator().Validate(&listReq{Q: "long", Page: -1}),
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"type":"urn:cerebrum:problem:validation_failed","title":"Bad Request","status":400,
+				"detail":"request query is invalid","instance":"/users","code":"validation_failed","errors":[
+				{"parameter":"q","code":"max","detail":"q's value or length is bigger than allowed"},
+				{"parameter":"page","code":"min","detail":"page's value or length is less than allowed"}]}`,
+		},
+		{
+			name:         "Unknown error",
+			err:          errors.New("boom"),
+			expectedCode: http.StatusInternalServerError,
+			expectedBody: `{"type":"urn:cerebrum:problem:internal_server_error","title":"Internal Server Error","status":500,
+				"instance":"/users","code":"internal_server_error"}`,
+		},
+		{
+			name:         "Debug mode logs the error instead of sending it",
+			err:          models.NewError(http.StatusBadRequest, "insecure_password", "insecure password"),
+			debug:        true,
+			requestID:    "req-7",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"type":"urn:cerebrum:problem:insecure_password","title":"Bad Request","status":400,
+				"detail":"insecure password","instance":"/users","code":"insecure_password","request_id":"req-7"}`,
+			expectedLog: "request req-7 failed, insecure password",
+		},
+		{
+			name:         "Refers to the request",
+			err:          errors.New("boom"),
+			requestID:    "req-42",
+			expectedCode: http.StatusInternalServerError,
+			expectedBody: `{"type":"urn:cerebrum:problem:internal_server_error","title":"Internal Server Error","status":500,
+				"instance":"/users","code":"internal_server_error","request_id":"req-42"}`,
+			expectedLog: "request req-42 failed, boom",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			e := server.New(nil)
+			e.Debug = tt.debug
+			var logs bytes.Buffer
+			e.Logger.SetOutput(&logs)
+			req := httptest.NewRequest(http.MethodPost, "/users?page=2", nil)
+			if tt.requestID != "" {
+				req = req.WithContext(models.WithRequestID(req.Context(), tt.requestID))
+			}
+			rec := httptest.NewRecorder()
+			e.HTTPErrorHandler(tt.err, e.NewContext(req, rec))
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			assert.Equal(t, server.ProblemContentType, rec.Header().Get(echo.HeaderContentType))
+			assert.JSONEq(t, tt.expectedBody, rec.Body.String())
+			if tt.expectedLog != "" {
+				assert.Contains(t, logs.String(), tt.expectedLog)
+			}
+		})
+	}
+}
+
+func TestErrorHandlerRoutes(t *testing.T) {
+	e := server.New(nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing", strings.NewReader("")))
+	var p map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "not_found", p["code"], "errors of echo should be coded by status")
+	assert.Equal(t, rec.Header().Get(echo.HeaderXRequestID), p["request_id"])
+}
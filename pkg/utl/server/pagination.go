@@ -0,0 +1,43 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/labstack/echo"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+// HeaderLink is the RFC 8288 web linking header
+const HeaderLink = "Link"
+
+// SetPageLinks sets the Link header of a list response to the first, next
+// and previous pages of p, which are the request URL with the cursors of p
+func SetPageLinks(c echo.Context, p *models.Page) {
+	if p == nil {
+		return
+	}
+	var links []string
+	add := func(rel string, cursor *models.Cursor) {
+		u := *c.Request().URL
+		q := u.Query()
+		q.Del("page")
+		q.Del("cursor")
+		if cursor != nil {
+			q.Set("cursor", cursor.String())
+		}
+		u.RawQuery = q.Encode()
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, u.String(), rel))
+	}
+	if p.Next != nil {
+		add("next", p.Next)
+	}
+	if p.Prev != nil {
+		add("prev", p.Prev)
+		add("first", nil)
+	}
+	if len(links) > 0 {
+		c.Response().Header().Set(HeaderLink, strings.Join(links, ", "))
+	}
+}
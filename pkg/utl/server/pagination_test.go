@@ -0,0 +1,46 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+	"github.com/johncoleman83/cerebrum/pkg/utl/server"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetPageLinks(t *testing.T) {
+	next := &models.Cursor{Columns: []string{"id"}, Values: []string{"20"}}
+	prev := &models.Cursor{Columns: []string{"id"}, Values: []string{"11"}, Before: true}
+	cases := []struct {
+		name     string
+		page     *models.Page
+		expected string
+	}{
+		{name: "No page"},
+		{name: "Single page", page: &models.Page{}},
+		{
+			name:     "First page",
+			page:     &models.Page{Next: next},
+			expected: `</v1/users?cursor=` + next.String() + `&limit=10&sort=-id>; rel="next"`,
+		},
+		{
+			name: "Middle page",
+			page: &models.Page{Next: next, Prev: prev},
+			expected: `</v1/users?cursor=` + next.String() + `&limit=10&sort=-id>; rel="next", ` +
+				`</v1/users?cursor=` + prev.String() + `&limit=10&sort=-id>; rel="prev", ` +
+				`</v1/users?limit=10&sort=-id>; rel="first"`,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/users?limit=10&page=1&sort=-id", nil)
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			server.SetPageLinks(c, tt.page)
+			assert.Equal(t, tt.expected, rec.Header().Get(server.HeaderLink))
+		})
+	}
+}
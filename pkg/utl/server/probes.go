@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// defaultCheckTimeout is the timeout of a readiness check if none is set
+const defaultCheckTimeout = time.Second
+
+// Checker checks whether a dependency of the server is available
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc is a func checking a dependency of the server
+type CheckerFunc func(ctx context.Context) error
+
+// Check calls f
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Probes serves the liveness and readiness probes of the server, the server
+// is ready once every registered check passes and until it drains
+type Probes struct {
+	mu       sync.RWMutex
+	checks   []namedCheck
+	timeout  time.Duration
+	draining int32
+}
+
+type namedCheck struct {
+	name    string
+	checker Checker
+	timeout time.Duration
+}
+
+// CheckResult is the outcome of a readiness check
+type CheckResult struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_milliseconds"`
+}
+
+// Readiness is the body of the readiness probe
+type Readiness struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Statuses of the probes and of their checks
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+	StatusDraining    = "draining"
+)
+
+// NewProbes creates new probes whose checks time out after timeout unless
+// they are registered with their own
+func NewProbes(timeout time.Duration) *Probes {
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+	return &Probes{timeout: timeout}
+}
+
+// Register adds a readiness check of the dependency name, a zero timeout
+// uses the timeout of the probes
+func (p *Probes) Register(name string, c Checker, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = p.timeout
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.checks = append(p.checks, namedCheck{name: name, checker: c, timeout: timeout})
+}
+
+// Drain makes the readiness probe fail, so that load balancers stop routing
+// requests to the server before it shuts down
+func (p *Probes) Drain() {
+	atomic.StoreInt32(&p.draining, 1)
+}
+
+// Live handles the liveness probe, it passes as long as the server serves
+func (p *Probes) Live(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": StatusOK})
+}
+
+// Ready handles the readiness probe, it runs every check concurrently and
+// responds with 503 if the server drains or a check fails
+func (p *Probes) Ready(c echo.Context) error {
+	r := p.Check(c.Request().Context())
+	if r.Status != StatusOK {
+		return c.JSON(http.StatusServiceUnavailable, r)
+	}
+	return c.JSON(http.StatusOK, r)
+}
+
+// Check runs every check concurrently, each within its timeout
+func (p *Probes) Check(ctx context.Context) Readiness {
+	p.mu.RLock()
+	checks := append([]namedCheck(nil), p.checks...)
+	p.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, nc := range checks {
+		wg.Add(1)
+		go func(i int, nc namedCheck) {
+			defer wg.Done()
+			results[i] = run(ctx, nc)
+		}(i, nc)
+	}
+	wg.Wait()
+
+	r := Readiness{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks))}
+	for i, nc := range checks {
+		r.Checks[nc.name] = results[i]
+		if results[i].Status != StatusOK {
+			r.Status = StatusUnavailable
+		}
+	}
+	if atomic.LoadInt32(&p.draining) == 1 {
+		r.Status = StatusDraining
+	}
+	return r
+}
+
+// run runs a check, checks ignoring their context are abandoned once they
+// time out
+func run(ctx context.Context, nc namedCheck) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, nc.timeout)
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- nc.checker.Check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	res := CheckResult{Status: StatusOK, DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		res.Status, res.Error = StatusUnavailable, err.Error()
+	}
+	return res
+}
@@ -0,0 +1,106 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/server"
+)
+
+func TestProbes(t *testing.T) {
+	ok := server.CheckerFunc(func(context.Context) error { return nil })
+	down := server.CheckerFunc(func(context.Context) error { return errors.New("connection refused") })
+	hung := server.CheckerFunc(func(context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	cases := []struct {
+		name           string
+		checks         map[string]server.Checker
+		drain          bool
+		expectedStatus int
+		expectedBody   server.Readiness
+	}{
+		{
+			name:           "Ready without checks",
+			expectedStatus: http.StatusOK,
+			expectedBody:   server.Readiness{Status: "ok", Checks: map[string]server.CheckResult{}},
+		},
+		{
+			name:           "Ready once every check passes",
+			checks:         map[string]server.Checker{"database": ok, "cache": ok},
+			expectedStatus: http.StatusOK,
+			expectedBody: server.Readiness{Status: "ok", Checks: map[string]server.CheckResult{
+				"database": {Status: "ok"},
+				"cache":    {Status: "ok"},
+			}},
+		},
+		{
+			name:           "Not ready on failing check",
+			checks:         map[string]server.Checker{"database": ok, "cache": down},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody: server.Readiness{Status: "unavailable", Checks: map[string]server.CheckResult{
+				"database": {Status: "ok"},
+				"cache":    {Status: "unavailable", Error: "connection refused"},
+			}},
+		},
+		{
+			name:           "Not ready on timed out check",
+			checks:         map[string]server.Checker{"database": hung},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody: server.Readiness{Status: "unavailable", Checks: map[string]server.CheckResult{
+				"database": {Status: "unavailable", Error: "context deadline exceeded"},
+			}},
+		},
+		{
+			name:           "Not ready while draining",
+			checks:         map[string]server.Checker{"database": ok},
+			drain:          true,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody: server.Readiness{Status: "draining", Checks: map[string]server.CheckResult{
+				"database": {Status: "ok"},
+			}},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			p := server.NewProbes(50 * time.Millisecond)
+			for name, c := range tt.checks {
+				p.Register(name, c, 0)
+			}
+			if tt.drain {
+				p.Drain()
+			}
+			e := echo.New()
+			e.GET("/livez", p.Live)
+			e.GET("/readyz", p.Ready)
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+			assert.Equal(t, http.StatusOK, rec.Code, "the server should be live")
+
+			start := time.Now()
+			rec = httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			assert.True(t, time.Since(start) < 500*time.Millisecond, "checks should time out")
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			var body server.Readiness
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			for name, res := range body.Checks {
+				res.DurationMS = 0
+				body.Checks[name] = res
+			}
+			assert.Equal(t, tt.expectedBody, body)
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/labstack/echo"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+// maxRequestIDLen is the length above which the request ids of clients are
+// replaced
+const maxRequestIDLen = 128
+
+// RequestID returns a middleware which identifies every request by the
+// X-Request-ID header of the client or by a new random id. The id is
+// returned in the X-Request-ID header of the response and carried by the
+// request context, see models.RequestIDFrom.
+func RequestID() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			id := req.Header.Get(echo.HeaderXRequestID)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+			c.SetRequest(req.WithContext(models.WithRequestID(req.Context(), id)))
+			return next(c)
+		}
+	}
+}
+
+// validRequestID reports whether the request id of a client may be kept, ids
+// are logged so they are limited to a length and to a safe set of characters
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128 bit id in hex
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,72 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+	"github.com/johncoleman83/cerebrum/pkg/utl/server"
+)
+
+func TestRequestID(t *testing.T) {
+	generated := regexp.MustCompile("^[0-9a-f]{32}$")
+	cases := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "Generates an id"},
+		{name: "Keeps the id of the client", header: "client-7f3a.retry:2", want: "client-7f3a.retry:2"},
+		{name: "Replaces unsafe ids", header: "abc\ninjected log line"},
+		{name: "Replaces long ids", header: strings.Repeat("a", 129)},
+	}
+	e := echo.New()
+	e.Use(server.RequestID())
+	var fromCtx string
+	e.GET("/", func(c echo.Context) error {
+		fromCtx, _ = models.RequestIDFrom(c.Request().Context())
+		return c.NoContent(http.StatusOK)
+	})
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(echo.HeaderXRequestID, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			got := rec.Header().Get(echo.HeaderXRequestID)
+			if tt.want != "" {
+				assert.Equal(t, tt.want, got)
+			} else {
+				assert.Regexp(t, generated, got)
+			}
+			assert.Equal(t, got, fromCtx, "the request context should carry the id")
+		})
+	}
+}
+
+func TestRequestIDBeforePre(t *testing.T) {
+	e := server.New(nil)
+	var before, after string
+	e.Pre(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			before, _ = models.RequestIDFrom(c.Request().Context())
+			err := next(c)
+			after, _ = models.RequestIDFrom(c.Request().Context())
+			return err
+		}
+	})
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	id := rec.Header().Get(echo.HeaderXRequestID)
+	assert.NotEmpty(t, id)
+	assert.Equal(t, id, before, "middlewares added with Pre should see the request id before the next handler")
+	assert.Equal(t, id, after)
+}
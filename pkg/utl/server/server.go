@@ -2,33 +2,81 @@ package server
 
 import (
 	"context"
+	"crypto/subtle"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
-	"github.com/go-playground/validator"
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
 
+	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
 	"github.com/johncoleman83/cerebrum/pkg/utl/middleware/secure"
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
 )
 
-// New instantates new Echo server
-func New() *echo.Echo {
+// New instantates new Echo server, requests are identified but not logged.
+// Requests are identified by the first Echo.Pre middleware, so that the
+// access logs added with Echo.Pre afterwards wrap every other middleware
+// and always see the request id. GET /health serves health, which may be nil.
+func New(health *Health) *echo.Echo {
 	e := echo.New()
-	e.Use(middleware.Logger(), middleware.Recover(),
-		secure.CORS(), secure.Headers())
-	e.GET("/health", healthCheck)
-	e.Validator = &CustomValidator{V: validator.New()}
+	e.Pre(RequestID())
+	e.Use(middleware.Recover(), secure.CORS(), secure.Headers())
+	e.GET("/health", HealthCheck(health))
+	e.Validator = NewValidator()
 	custErr := &customErrHandler{e: e}
 	e.HTTPErrorHandler = custErr.handler
 	e.Binder = &CustomBinder{b: &echo.DefaultBinder{}}
 	return e
 }
 
-func healthCheck(c echo.Context) error {
-	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+// Health holds the reports of the health check, they are returned under their
+// name only to requests carrying Token as a bearer token, so that internal
+// details such as the db pools are opt-in and never public
+type Health struct {
+	Token   string
+	Reports map[string]func() interface{}
+}
+
+// authorized reports whether the reports of h may be sent for req
+func (h *Health) authorized(req *http.Request) bool {
+	if h == nil || h.Token == "" {
+		return false
+	}
+	got := []byte(req.Header.Get(echo.HeaderAuthorization))
+	return subtle.ConstantTimeCompare(got, []byte("Bearer "+h.Token)) == 1
+}
+
+// Authorize is a middleware rejecting the requests which do not carry the
+// token of h, as the health reports are not sent to them. Routes serving
+// internal details, such as /metrics, are unreachable without a token.
+func (h *Health) Authorize(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !h.authorized(c.Request()) {
+			return models.ErrUnauthorized
+		}
+		return next(c)
+	}
+}
+
+// HealthCheck returns the handler of GET /health, which reports the state
+// returned by every report of h to authorized requests
+func HealthCheck(h *Health) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		body := map[string]interface{}{"status": "ok"}
+		if h.authorized(c.Request()) {
+			for name, report := range h.Reports {
+				body[name] = report()
+			}
+		}
+		return c.JSON(http.StatusOK, body)
+	}
 }
 
 // Config represents server specific config
@@ -37,16 +85,36 @@ type Config struct {
 	ReadTimeoutSeconds  int
 	WriteTimeoutSeconds int
 	Debug               bool
+	Probes              *Probes
+	DrainSeconds        int
 }
 
-// Start starts echo server
+// Start starts echo server and blocks until an interrupt or terminate signal
+// is received, the server is then shut down as Serve does
 func Start(e *echo.Echo, cfg *Config) {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	Serve(e, cfg, quit)
+}
+
+// Serve serves e and blocks until quit receives a signal. The readiness
+// probe then fails for DrainSeconds while the server keeps serving, so that
+// load balancers stop routing to it. In-flight requests are then given 10
+// seconds to finish, after which the context of the requests still running
+// is canceled, which aborts their running SQL.
+func Serve(e *echo.Echo, cfg *Config, quit <-chan os.Signal) {
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
 	s := &http.Server{
 		Addr:         cfg.Port,
 		ReadTimeout:  time.Duration(cfg.ReadTimeoutSeconds) * time.Second,
 		WriteTimeout: time.Duration(cfg.WriteTimeoutSeconds) * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return baseCtx
+		},
 	}
 	e.Debug = cfg.Debug
+	e.Use(RequestTimeout(s.WriteTimeout))
 
 	// Start server
 	go func() {
@@ -55,14 +123,82 @@ func Start(e *echo.Echo, cfg *Config) {
 		}
 	}()
 
-	// Wait for interrupt signal to gracefully shutdown the server with
-	// a timeout of 10 seconds.
-	quit := make(chan os.Signal)
-	signal.Notify(quit, os.Interrupt)
 	<-quit
+	if cfg.Probes != nil {
+		cfg.Probes.Drain()
+		time.Sleep(time.Duration(cfg.DrainSeconds) * time.Second)
+	}
+	// s is not the server of e, so it is shut down itself: it stops accepting
+	// and waits for in-flight requests, whose contexts stay live until then
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	if err := e.Shutdown(ctx); err != nil {
-		e.Logger.Fatal(err)
+	if err := s.Shutdown(ctx); err != nil {
+		e.Logger.Error(err)
+	}
+}
+
+// RequestTimeout returns a middleware which sets a deadline of timeout on the
+// request context, so that work running past the server's write timeout is
+// canceled instead of writing to a closed connection
+func RequestTimeout(timeout time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if timeout <= 0 {
+				return next(c)
+			}
+			ctx, cancel := context.WithTimeout(c.Request().Context(), timeout)
+			defer cancel()
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	}
+}
+
+// PrimaryCookie holds the time, in unix milliseconds, until which the reads
+// of a client go to the primary database
+const PrimaryCookie = "primary_until"
+
+// ReadYourWrites returns a middleware which pins a request to the primary
+// database once it ran a unit of work, so that its later reads do not go to
+// replicas lagging behind its writes. The client is then pinned for window,
+// the max lag of the replicas, by the PrimaryCookie set on the response so
+// that its next requests also read its writes. Nothing is set if window is
+// zero, as there are no replicas.
+func ReadYourWrites(window time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var until time.Time
+			if ck, err := c.Cookie(PrimaryCookie); err == nil && window > 0 {
+				if ms, err := strconv.ParseInt(ck.Value, 10, 64); err == nil {
+					until = time.Unix(0, ms*int64(time.Millisecond))
+					// clients may only pin themselves for a window
+					if max := time.Now().Add(window); until.After(max) {
+						until = max
+					}
+				}
+			}
+			ctx := datastore.WithReadYourWrites(c.Request().Context(), until)
+			c.SetRequest(c.Request().WithContext(ctx))
+			if window > 0 {
+				c.Response().Before(func() {
+					if datastore.Wrote(ctx) {
+						c.SetCookie(primaryCookie(time.Now().Add(window), window))
+					}
+				})
+			}
+			return next(c)
+		}
+	}
+}
+
+// primaryCookie returns the cookie pinning a client to the primary until
+func primaryCookie(until time.Time, window time.Duration) *http.Cookie {
+	return &http.Cookie{
+		Name:     PrimaryCookie,
+		Value:    strconv.FormatInt(until.UnixNano()/int64(time.Millisecond), 10),
+		Path:     "/",
+		MaxAge:   int(math.Ceil(window.Seconds())),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
 	}
 }
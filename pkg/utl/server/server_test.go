@@ -1,15 +1,218 @@
 package server_test
 
 import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
+	"github.com/johncoleman83/cerebrum/pkg/utl/mock/mockstore"
 	"github.com/johncoleman83/cerebrum/pkg/utl/server"
 )
 
 // Improve tests
 func TestNew(t *testing.T) {
-	e := server.New()
+	e := server.New(nil)
 	if e == nil {
 		t.Errorf("Server should not be nil")
 	}
 }
+
+func TestRequestTimeout(t *testing.T) {
+	e := echo.New()
+	var deadline time.Time
+	var hasDeadline bool
+	h := server.RequestTimeout(time.Minute)(func(c echo.Context) error {
+		deadline, hasDeadline = c.Request().Context().Deadline()
+		return nil
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Nil(t, h(e.NewContext(req, httptest.NewRecorder())))
+	assert.True(t, hasDeadline, "the request context should have a deadline")
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+
+	h = server.RequestTimeout(0)(func(c echo.Context) error {
+		_, hasDeadline = c.Request().Context().Deadline()
+		return nil
+	})
+	assert.Nil(t, h(e.NewContext(req, httptest.NewRecorder())))
+	assert.False(t, hasDeadline, "a zero timeout should not set a deadline")
+}
+
+func TestHealthCheck(t *testing.T) {
+	health := &server.Health{
+		Token: "s3cret",
+		Reports: map[string]func() interface{}{
+			"database": func() interface{} { return map[string]int{"open_connections": 2} },
+		},
+	}
+	cases := []struct {
+		name         string
+		health       *server.Health
+		auth         string
+		expectedBody string
+	}{
+		{name: "Without reports", expectedBody: `{"status":"ok"}`},
+		{name: "Unauthorized requests are not sent the reports", health: health, expectedBody: `{"status":"ok"}`},
+		{name: "Wrong token", health: health, auth: "Bearer guess", expectedBody: `{"status":"ok"}`},
+		{name: "Reports are opt-in", health: &server.Health{Reports: health.Reports}, auth: "Bearer ", expectedBody: `{"status":"ok"}`},
+		{name: "Authorized requests are sent the reports", health: health, auth: "Bearer s3cret",
+			expectedBody: `{"status":"ok","database":{"open_connections":2}}`},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			e := server.New(tt.health)
+			req := httptest.NewRequest(http.MethodGet, "/health", nil)
+			if tt.auth != "" {
+				req.Header.Set(echo.HeaderAuthorization, tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.JSONEq(t, tt.expectedBody, rec.Body.String())
+		})
+	}
+}
+
+func TestHealthAuthorize(t *testing.T) {
+	cases := []struct {
+		name           string
+		health         *server.Health
+		auth           string
+		expectedStatus int
+	}{
+		{name: "Fail without health", auth: "Bearer ", expectedStatus: http.StatusUnauthorized},
+		{name: "Fail without token", health: &server.Health{}, auth: "Bearer ", expectedStatus: http.StatusUnauthorized},
+		{name: "Fail without authorization", health: &server.Health{Token: "s3cret"}, expectedStatus: http.StatusUnauthorized},
+		{name: "Fail on wrong token", health: &server.Health{Token: "s3cret"}, auth: "Bearer guess", expectedStatus: http.StatusUnauthorized},
+		{name: "Success", health: &server.Health{Token: "s3cret"}, auth: "Bearer s3cret", expectedStatus: http.StatusOK},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			e := server.New(tt.health)
+			e.GET("/metrics", func(c echo.Context) error {
+				return c.String(http.StatusOK, "metrics")
+			}, tt.health.Authorize)
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.auth != "" {
+				req.Header.Set(echo.HeaderAuthorization, tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestServeShutdown(t *testing.T) {
+	e := server.New(nil)
+	e.HideBanner, e.HidePort = true, true
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Listener = l
+	started, release := make(chan struct{}), make(chan struct{})
+	var ctxErr error
+	e.GET("/slow", func(c echo.Context) error {
+		close(started)
+		<-release
+		ctxErr = c.Request().Context().Err()
+		return c.String(http.StatusOK, "done")
+	})
+	quit := make(chan os.Signal, 1)
+	served := make(chan struct{})
+	go func() {
+		server.Serve(e, &server.Config{WriteTimeoutSeconds: 30}, quit)
+		close(served)
+	}()
+
+	type response struct {
+		code int
+		body string
+		err  error
+	}
+	responses := make(chan response, 1)
+	go func() {
+		res, err := http.Get("http://" + l.Addr().String() + "/slow")
+		if err != nil {
+			responses <- response{err: err}
+			return
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		responses <- response{code: res.StatusCode, body: string(body), err: err}
+	}()
+	<-started
+	quit <- syscall.SIGTERM
+
+	select {
+	case <-served:
+		t.Fatal("the server should wait for the in-flight request")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	res := <-responses
+	assert.Nil(t, res.err)
+	assert.Equal(t, http.StatusOK, res.code)
+	assert.Equal(t, "done", res.body)
+	assert.Nil(t, ctxErr, "the request context should not be canceled while shutting down")
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server should shut down once the request finished")
+	}
+}
+
+func TestReadYourWrites(t *testing.T) {
+	db, err := mockstore.NewDataBaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	tr := datastore.NewTransactor(db)
+	e := echo.New()
+	e.Use(server.ReadYourWrites(5 * time.Second))
+	e.GET("/read", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.POST("/write", func(c echo.Context) error {
+		if err := tr.Transaction(c.Request().Context(), func(*gorm.DB) error { return nil }); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/read", nil))
+	assert.Empty(t, rec.Header().Get("Set-Cookie"), "reads should not pin the client")
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/write", nil))
+	cookies := rec.Result().Cookies()
+	if !assert.Len(t, cookies, 1) {
+		return
+	}
+	assert.Equal(t, server.PrimaryCookie, cookies[0].Name)
+	assert.Equal(t, 5, cookies[0].MaxAge)
+	assert.True(t, cookies[0].HttpOnly)
+
+	e = echo.New()
+	e.Use(server.ReadYourWrites(0))
+	e.POST("/write", func(c echo.Context) error {
+		if err := tr.Transaction(c.Request().Context(), func(*gorm.DB) error { return nil }); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusOK)
+	})
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/write", nil))
+	assert.Empty(t, rec.Header().Get("Set-Cookie"), "clients should not be pinned without replicas")
+}
@@ -0,0 +1,40 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+
+	export "go.opentelemetry.io/otel/sdk/export/trace"
+)
+
+// InMemoryExporter keeps the exported spans in memory, it is meant for tests
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*export.SpanData
+}
+
+// NewInMemoryExporter creates a new empty in memory exporter
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+// ExportSpan keeps sd
+func (e *InMemoryExporter) ExportSpan(_ context.Context, sd *export.SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, sd)
+}
+
+// Spans returns the exported spans in the order they ended
+func (e *InMemoryExporter) Spans() []*export.SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*export.SpanData(nil), e.spans...)
+}
+
+// Reset drops the exported spans
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
@@ -0,0 +1,231 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/api/kv"
+	"go.opentelemetry.io/otel/api/kv/value"
+	export "go.opentelemetry.io/otel/sdk/export/trace"
+	"google.golang.org/grpc/codes"
+)
+
+// OTLPExporter exports batches of spans to an OpenTelemetry collector with
+// the JSON encoding of OTLP over HTTP
+type OTLPExporter struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+// NewOTLPExporter creates a new exporter posting spans to endpoint with
+// headers, each export is abandoned after timeout
+func NewOTLPExporter(endpoint string, headers map[string]string, timeout time.Duration) *OTLPExporter {
+	return &OTLPExporter{endpoint: endpoint, headers: headers, client: &http.Client{Timeout: timeout}}
+}
+
+// ExportSpans posts spans to the collector, failures are logged as spans
+// are not retried
+func (e *OTLPExporter) ExportSpans(ctx context.Context, spans []*export.SpanData) {
+	if len(spans) == 0 {
+		return
+	}
+	if err := e.export(ctx, spans); err != nil {
+		log.Printf("otlp export error %v", err)
+	}
+}
+
+func (e *OTLPExporter) export(ctx context.Context, spans []*export.SpanData) error {
+	body, err := json.Marshal(newOTLPRequest(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("collector responded %s", resp.Status)
+	}
+	return nil
+}
+
+// The types below are the JSON encoding of an OTLP trace export request,
+// see opentelemetry/proto/collector/trace/v1/trace_service.proto
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+// OTLP status codes
+const (
+	otlpStatusUnset = 0
+	otlpStatusError = 2
+)
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// newOTLPRequest groups spans by resource, all the spans of the api share
+// the resource of its tracer provider
+func newOTLPRequest(spans []*export.SpanData) *otlpRequest {
+	req := new(otlpRequest)
+	byResource := make(map[string]int)
+	for _, sd := range spans {
+		var key string
+		var attrs []kv.KeyValue
+		if sd.Resource != nil {
+			key = sd.Resource.String()
+			attrs = sd.Resource.Attributes()
+		}
+		i, ok := byResource[key]
+		if !ok {
+			i = len(req.ResourceSpans)
+			byResource[key] = i
+			req.ResourceSpans = append(req.ResourceSpans, otlpResourceSpans{
+				Resource:   otlpResource{Attributes: newOTLPKeyValues(attrs)},
+				ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: tracerName}}},
+			})
+		}
+		ss := &req.ResourceSpans[i].ScopeSpans[0]
+		ss.Spans = append(ss.Spans, newOTLPSpan(sd))
+	}
+	return req
+}
+
+func newOTLPSpan(sd *export.SpanData) otlpSpan {
+	s := otlpSpan{
+		TraceID:           sd.SpanContext.TraceID.String(),
+		SpanID:            sd.SpanContext.SpanID.String(),
+		Name:              sd.Name,
+		Kind:              int(sd.SpanKind),
+		StartTimeUnixNano: unixNano(sd.StartTime),
+		EndTimeUnixNano:   unixNano(sd.EndTime),
+		Attributes:        newOTLPKeyValues(sd.Attributes),
+		Status:            otlpStatus{Code: otlpStatusUnset},
+	}
+	if sd.ParentSpanID.IsValid() {
+		s.ParentSpanID = sd.ParentSpanID.String()
+	}
+	if sd.StatusCode != codes.OK {
+		s.Status = otlpStatus{Code: otlpStatusError, Message: sd.StatusMessage}
+	}
+	for _, e := range sd.MessageEvents {
+		s.Events = append(s.Events, otlpEvent{
+			TimeUnixNano: unixNano(e.Time),
+			Name:         e.Name,
+			Attributes:   newOTLPKeyValues(e.Attributes),
+		})
+	}
+	return s
+}
+
+func newOTLPKeyValues(attrs []kv.KeyValue) []otlpKeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		var v otlpAnyValue
+		switch a.Value.Type() {
+		case value.BOOL:
+			b := a.Value.AsBool()
+			v.BoolValue = &b
+		case value.INT32:
+			i := strconv.FormatInt(int64(a.Value.AsInt32()), 10)
+			v.IntValue = &i
+		case value.INT64:
+			i := strconv.FormatInt(a.Value.AsInt64(), 10)
+			v.IntValue = &i
+		case value.UINT32:
+			i := strconv.FormatUint(uint64(a.Value.AsUint32()), 10)
+			v.IntValue = &i
+		case value.UINT64:
+			i := strconv.FormatUint(a.Value.AsUint64(), 10)
+			v.IntValue = &i
+		case value.FLOAT32:
+			f := float64(a.Value.AsFloat32())
+			v.DoubleValue = &f
+		case value.FLOAT64:
+			f := a.Value.AsFloat64()
+			v.DoubleValue = &f
+		default:
+			s := a.Value.Emit()
+			v.StringValue = &s
+		}
+		kvs = append(kvs, otlpKeyValue{Key: string(a.Key), Value: v})
+	}
+	return kvs
+}
+
+// unixNano encodes t as the decimal string of a fixed64 in OTLP JSON
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
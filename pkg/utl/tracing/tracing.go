@@ -0,0 +1,175 @@
+// Package tracing traces requests with OpenTelemetry. Trace contexts are
+// propagated with the W3C traceparent header and sampled spans are exported
+// to an OTLP collector, to stdout or, in tests, kept in memory.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+	"go.opentelemetry.io/otel/api/propagation"
+	"go.opentelemetry.io/otel/api/standard"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/exporters/trace/stdout"
+	export "go.opentelemetry.io/otel/sdk/export/trace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/codes"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+)
+
+// Trace exporters
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+const (
+	defaultServiceName = "cerebrum"
+	defaultEndpoint    = "http://localhost:4318/v1/traces"
+	defaultTimeout     = 10 * time.Second
+
+	// tracerName is the name of the instrumentation tracing the api
+	tracerName = "github.com/johncoleman83/cerebrum"
+)
+
+// Tracing starts the spans of the api and propagates their trace context
+type Tracing struct {
+	tracer    trace.Tracer
+	props     propagation.Propagators
+	processor sdktrace.SpanProcessor
+}
+
+// New returns the tracing configured by cfg, spans are not recorded when
+// tracing is disabled
+func New(cfg *config.Tracing) (*Tracing, error) {
+	if cfg == nil || cfg.Exporter == "" {
+		return &Tracing{tracer: trace.NoopTracer{}}, nil
+	}
+	switch cfg.Exporter {
+	case ExporterOTLP:
+		timeout := defaultTimeout
+		if cfg.Timeout > 0 {
+			timeout = time.Duration(cfg.Timeout) * time.Millisecond
+		}
+		endpoint := cfg.Endpoint
+		if endpoint == "" {
+			endpoint = defaultEndpoint
+		}
+		p, err := sdktrace.NewBatchSpanProcessor(NewOTLPExporter(endpoint, cfg.Headers, timeout))
+		if err != nil {
+			return nil, err
+		}
+		return newTracing(cfg, p)
+	case ExporterStdout:
+		e, err := stdout.NewExporter(stdout.Options{})
+		if err != nil {
+			return nil, err
+		}
+		return newTracing(cfg, sdktrace.NewSimpleSpanProcessor(e))
+	}
+	return nil, fmt.Errorf("tracing: unknown exporter %q", cfg.Exporter)
+}
+
+// NewWithExporter returns a tracing sampling every trace and exporting the
+// spans to e as soon as they end, it is meant for tests
+func NewWithExporter(e export.SpanSyncer) (*Tracing, error) {
+	return newTracing(&config.Tracing{}, sdktrace.NewSimpleSpanProcessor(e))
+}
+
+// newTracing returns a tracing sampling the traces at the ratio of cfg and
+// handing their spans to p
+func newTracing(cfg *config.Tracing, p sdktrace.SpanProcessor) (*Tracing, error) {
+	name := cfg.ServiceName
+	if name == "" {
+		name = defaultServiceName
+	}
+	sampler := sdktrace.AlwaysSample()
+	if cfg.SampleRatio > 0 && cfg.SampleRatio < 1 {
+		// traces continued from a sampled parent are always sampled
+		sampler = sdktrace.ProbabilitySampler(cfg.SampleRatio)
+	}
+	provider, err := sdktrace.NewProvider(
+		sdktrace.WithConfig(sdktrace.Config{DefaultSampler: sampler}),
+		sdktrace.WithResource(resource.New(standard.ServiceNameKey.String(name))),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider.RegisterSpanProcessor(p)
+	tc := trace.TraceContext{}
+	return &Tracing{
+		tracer:    provider.Tracer(tracerName),
+		props:     propagation.New(propagation.WithExtractors(tc), propagation.WithInjectors(tc)),
+		processor: p,
+	}, nil
+}
+
+// Tracer returns the tracer starting the spans of the api
+func (t *Tracing) Tracer() trace.Tracer {
+	return t.tracer
+}
+
+// Enabled reports whether spans are recorded
+func (t *Tracing) Enabled() bool {
+	return t.processor != nil
+}
+
+// Shutdown flushes the spans still queued for export, it does not wait for
+// the export to complete
+func (t *Tracing) Shutdown() {
+	if t.processor != nil {
+		t.processor.Shutdown()
+	}
+}
+
+// Middleware starts a server span for every request, continuing the trace of
+// the traceparent header of the request if it has one. Spans are named after
+// the matched route and failed with the responses of server errors.
+func (t *Tracing) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if !t.Enabled() {
+			return next
+		}
+		return func(c echo.Context) error {
+			req := c.Request()
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			ctx := propagation.ExtractHTTP(req.Context(), t.props, req.Header)
+			ctx, span := t.tracer.Start(ctx, req.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					standard.HTTPMethodKey.String(req.Method),
+					standard.HTTPRouteKey.String(route),
+					standard.HTTPTargetKey.String(req.URL.Path),
+				),
+			)
+			defer span.End()
+			c.SetRequest(req.WithContext(ctx))
+
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+			status := c.Response().Status
+			span.SetAttributes(standard.HTTPStatusCodeKey.Int(status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Internal, http.StatusText(status))
+			}
+			return nil
+		}
+	}
+}
+
+// End ends span, failing it with err if it is not nil
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(context.Background(), err, trace.WithErrorStatus(codes.Unknown))
+	}
+	span.End()
+}
@@ -0,0 +1,212 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/api/kv"
+	"go.opentelemetry.io/otel/api/standard"
+	"go.opentelemetry.io/otel/api/trace"
+	"google.golang.org/grpc/codes"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+	"github.com/johncoleman83/cerebrum/pkg/utl/tracing"
+)
+
+func TestNew(t *testing.T) {
+	cases := []struct {
+		name    string
+		cfg     *config.Tracing
+		enabled bool
+		wantErr bool
+	}{
+		{name: "Disabled without config"},
+		{name: "Disabled without exporter", cfg: &config.Tracing{ServiceName: "cerebrum"}},
+		{name: "Unknown exporter", cfg: &config.Tracing{Exporter: "zipkin"}, wantErr: true},
+		{name: "Stdout exporter", cfg: &config.Tracing{Exporter: tracing.ExporterStdout}, enabled: true},
+		{name: "OTLP exporter", cfg: &config.Tracing{Exporter: tracing.ExporterOTLP, SampleRatio: 0.5}, enabled: true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := tracing.New(tt.cfg)
+			assert.Equal(t, tt.wantErr, err != nil)
+			if err != nil {
+				return
+			}
+			defer tr.Shutdown()
+			assert.Equal(t, tt.enabled, tr.Enabled())
+			_, span := tr.Tracer().Start(context.Background(), "test")
+			assert.Equal(t, tt.enabled, span.SpanContext().IsValid())
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	exp := tracing.NewInMemoryExporter()
+	tr, err := tracing.NewWithExporter(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.Use(tr.Middleware())
+	var handled trace.SpanContext
+	e.GET("/users/:id", func(c echo.Context) error {
+		handled = trace.SpanFromContext(c.Request().Context()).SpanContext()
+		if c.Param("id") == "0" {
+			return errors.New("db is down")
+		}
+		return c.NoContent(http.StatusOK)
+	})
+
+	cases := []struct {
+		name        string
+		path        string
+		traceparent string
+		wantStatus  int
+		wantCode    codes.Code
+		wantTraceID string
+		wantParent  string
+	}{
+		{
+			name:       "Starts a new trace",
+			path:       "/users/1",
+			wantStatus: http.StatusOK,
+			wantCode:   codes.OK,
+		},
+		{
+			name:        "Continues the trace of the traceparent header",
+			path:        "/users/1",
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			wantStatus:  http.StatusOK,
+			wantCode:    codes.OK,
+			wantTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+			wantParent:  "00f067aa0ba902b7",
+		},
+		{
+			name:       "Fails the span of server errors",
+			path:       "/users/0",
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   codes.Internal,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			exp.Reset()
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+
+			spans := exp.Spans()
+			if !assert.Len(t, spans, 1) {
+				return
+			}
+			span := spans[0]
+			assert.Equal(t, "GET /users/:id", span.Name)
+			assert.Equal(t, trace.SpanKindServer, span.SpanKind)
+			assert.Equal(t, tt.wantCode, span.StatusCode)
+			assert.Contains(t, span.Attributes, standard.HTTPStatusCodeKey.Int(tt.wantStatus))
+			assert.Equal(t, span.SpanContext, handled, "the handler should run in the span")
+			if tt.wantTraceID != "" {
+				assert.Equal(t, tt.wantTraceID, span.SpanContext.TraceID.String())
+				assert.Equal(t, tt.wantParent, span.ParentSpanID.String())
+				assert.True(t, span.HasRemoteParent)
+			} else {
+				assert.False(t, span.ParentSpanID.IsValid())
+			}
+		})
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	received := make(chan request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- request{header: r.Header, body: body}
+	}))
+	defer srv.Close()
+
+	tr, err := tracing.New(&config.Tracing{
+		Exporter:    tracing.ExporterOTLP,
+		Endpoint:    srv.URL,
+		Headers:     map[string]string{"Api-Key": "secret"},
+		ServiceName: "cerebrum-test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, parent := tr.Tracer().Start(context.Background(), "user.View")
+	_, child := tr.Tracer().Start(ctx, "gorm.query", trace.WithAttributes(kv.Int64("db.rows_affected", 1)))
+	tracing.End(child, errors.New("no rows"))
+	tracing.End(parent, nil)
+	tr.Shutdown()
+
+	var req request
+	select {
+	case req = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("spans were not exported")
+	}
+	assert.Equal(t, "secret", req.header.Get("Api-Key"))
+	assert.Equal(t, "application/json", req.header.Get("Content-Type"))
+
+	var export struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []map[string]interface{} `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID      string                   `json:"traceId"`
+					SpanID       string                   `json:"spanId"`
+					ParentSpanID string                   `json:"parentSpanId"`
+					Name         string                   `json:"name"`
+					Attributes   []map[string]interface{} `json:"attributes"`
+					Status       struct {
+						Code int `json:"code"`
+					} `json:"status"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(req.body, &export); err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Len(t, export.ResourceSpans, 1) || !assert.Len(t, export.ResourceSpans[0].ScopeSpans, 1) {
+		return
+	}
+	rs := export.ResourceSpans[0]
+	assert.Contains(t, rs.Resource.Attributes, map[string]interface{}{
+		"key": "service.name", "value": map[string]interface{}{"stringValue": "cerebrum-test"},
+	})
+	spans := rs.ScopeSpans[0].Spans
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+	gotChild, gotParent := spans[0], spans[1]
+	assert.Equal(t, "gorm.query", gotChild.Name)
+	assert.Equal(t, gotParent.TraceID, gotChild.TraceID)
+	assert.Equal(t, gotParent.SpanID, gotChild.ParentSpanID)
+	assert.Len(t, gotChild.TraceID, 32)
+	assert.Equal(t, 2, gotChild.Status.Code)
+	assert.Contains(t, gotChild.Attributes, map[string]interface{}{
+		"key": "db.rows_affected", "value": map[string]interface{}{"intValue": "1"},
+	})
+	assert.Equal(t, "", gotParent.ParentSpanID)
+	assert.Equal(t, 0, gotParent.Status.Code)
+}
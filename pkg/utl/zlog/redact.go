@@ -0,0 +1,189 @@
+package zlog
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Redacted replaces the values of the redacted params and fields
+const Redacted = "xxx-redacted-xxx"
+
+// maxDepth is the depth below which logged values are left out
+const maxDepth = 8
+
+var (
+	jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// redactor copies the params of a log line, replacing the struct fields
+// tagged log:"redact" and the values at the paths of its rules by Redacted.
+// Structs are copied into maps keyed by the json names of their fields.
+type redactor struct {
+	rules []rule
+}
+
+// rule is the path of a value to redact, such as resp.email, segments are
+// json names and * matches any name. Elements of slices share the path of
+// their slice. Rules prefixed by a source and a colon, such as auth:req,
+// only apply to the lines of that source.
+type rule struct {
+	source string
+	path   []string
+}
+
+// newRedactor creates a new redactor of the values at paths
+func newRedactor(paths []string) *redactor {
+	r := new(redactor)
+	for _, p := range paths {
+		var ru rule
+		if i := strings.Index(p, ":"); i >= 0 {
+			ru.source, p = p[:i], p[i+1:]
+		}
+		ru.path = strings.Split(p, ".")
+		r.rules = append(r.rules, ru)
+	}
+	return r
+}
+
+// params returns a redacted copy of the params of a line of source
+func (r *redactor) params(source string, params map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		out[k] = r.value(source, []string{k}, reflect.ValueOf(v), 0)
+	}
+	return out
+}
+
+// matches reports whether the value at path of a line of source is redacted
+func (r *redactor) matches(source string, path []string) bool {
+	for _, ru := range r.rules {
+		if ru.source != "" && ru.source != source || len(ru.path) != len(path) {
+			continue
+		}
+		matched := true
+		for i, seg := range ru.path {
+			if seg != "*" && seg != path[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// value returns a redacted copy of v, the value at path of a line of source,
+// values marshaling themselves, such as times, are kept as they are
+func (r *redactor) value(source string, path []string, v reflect.Value, depth int) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if r.matches(source, path) {
+		return Redacted
+	}
+	if depth > maxDepth {
+		return v.Type().String()
+	}
+	t := v.Type()
+	if t.Implements(jsonMarshaler) || t.Implements(textMarshaler) {
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return r.value(source, path, v.Elem(), depth+1)
+	case reflect.Struct:
+		out := make(map[string]interface{}, v.NumField())
+		r.fields(source, path, v, depth, out)
+		return out
+	case reflect.Map:
+		if v.IsNil() || t.Key().Kind() != reflect.String {
+			return v.Interface()
+		}
+		out := make(map[string]interface{}, v.Len())
+		for _, k := range v.MapKeys() {
+			out[k.String()] = r.value(source, append(path, k.String()), v.MapIndex(k), depth+1)
+		}
+		return out
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && (v.IsNil() || t.Elem().Kind() == reflect.Uint8) {
+			return v.Interface()
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = r.value(source, path, v.Index(i), depth+1)
+		}
+		return out
+	}
+	return v.Interface()
+}
+
+// fields copies the exported fields of the struct v into out, the fields
+// of embedded structs without a json name are copied inline as json does
+func (r *redactor) fields(source string, path []string, v reflect.Value, depth int, out map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, omitEmpty := jsonName(f)
+		if name == "-" {
+			continue
+		}
+		fv := v.Field(i)
+		if f.Anonymous && name == "" {
+			if fv.Kind() == reflect.Ptr && !fv.IsNil() {
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				r.fields(source, path, fv, depth+1, out)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if omitEmpty && isEmpty(fv) {
+			continue
+		}
+		if f.Tag.Get("log") == "redact" {
+			out[name] = Redacted
+			continue
+		}
+		out[name] = r.value(source, append(path, name), fv, depth+1)
+	}
+}
+
+// jsonName returns the name of f in its json tag and whether it is omitted
+// when empty
+func jsonName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("json")
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			return parts[0], true
+		}
+	}
+	return parts[0], false
+}
+
+// isEmpty reports whether v is omitted by json when its field is omitempty
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.Struct:
+		return false
+	}
+	return v.IsZero()
+}
@@ -2,44 +2,242 @@
 package zlog
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"sort"
+	"time"
 
 	"github.com/labstack/echo"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/api/trace"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+)
+
+// Log formats
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
 )
 
+// accessSource is the source of the access log lines
+const accessSource = "access"
+
 // Log represents zerolog logger
 type Log struct {
-	logger *zerolog.Logger
+	logger  *zerolog.Logger
+	sources map[string]*source
+	redact  *redactor
+	out     io.Closer
+}
+
+// source holds the loggers of the lines of a source whose level or sampling
+// is configured, the successes of a source may be sampled
+type source struct {
+	logger  zerolog.Logger
+	success zerolog.Logger
 }
 
-// New instantiates new zero logger
-func New() *Log {
-	z := zerolog.New(os.Stdout)
+// New instantiates new zero logger configured by cfg, it logs json lines
+// of every level to stdout by default
+func New(cfg *config.Logging) (*Log, error) {
+	if cfg == nil {
+		cfg = &config.Logging{}
+	}
+	var w io.Writer
+	var out io.Closer
+	switch cfg.Output {
+	case "", "stdout":
+		w = os.Stdout
+	case "stderr":
+		w = os.Stderr
+	default:
+		f, err := os.OpenFile(cfg.Output, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+		if err != nil {
+			return nil, err
+		}
+		w, out = f, f
+	}
+	z, err := NewTo(w, cfg)
+	if err != nil {
+		if out != nil {
+			out.Close()
+		}
+		return nil, err
+	}
+	z.out = out
+	return z, nil
+}
+
+// NewTo instantiates new zero logger writing to w with the format, levels,
+// sampling and redaction of cfg, the output of cfg is ignored
+func NewTo(w io.Writer, cfg *config.Logging) (*Log, error) {
+	if cfg == nil {
+		cfg = &config.Logging{}
+	}
+	switch cfg.Format {
+	case "", FormatJSON:
+	case FormatConsole:
+		w = zerolog.ConsoleWriter{Out: w, NoColor: w != os.Stdout && w != os.Stderr, TimeFormat: time.RFC3339}
+	default:
+		return nil, fmt.Errorf("zlog: unknown format %q", cfg.Format)
+	}
+	level, err := parseLevel(cfg.Level, zerolog.DebugLevel)
+	if err != nil {
+		return nil, err
+	}
+	z := zerolog.New(w).With().Timestamp().Logger().Level(level)
+
+	sources := make(map[string]*source)
+	for name := range cfg.Levels {
+		sources[name] = nil
+	}
+	for name := range cfg.Sampling {
+		sources[name] = nil
+	}
+	for name := range sources {
+		l, err := parseLevel(cfg.Levels[name], level)
+		if err != nil {
+			return nil, err
+		}
+		s := &source{logger: z.Level(l)}
+		s.success = s.logger
+		if n := cfg.Sampling[name]; n > 1 {
+			s.success = s.logger.Sample(&zerolog.BasicSampler{N: uint32(n)})
+		}
+		sources[name] = s
+	}
 	return &Log{
-		logger: &z,
+		logger:  &z,
+		sources: sources,
+		redact:  newRedactor(cfg.Redact),
+	}, nil
+}
+
+// parseLevel returns the level named s, or def if s is empty
+func parseLevel(s string, def zerolog.Level) (zerolog.Level, error) {
+	if s == "" {
+		return def, nil
+	}
+	l, err := zerolog.ParseLevel(s)
+	if err != nil {
+		return l, fmt.Errorf("zlog: unknown level %q", s)
+	}
+	return l, nil
+}
+
+// source returns the loggers of the failures and of the successes of name
+func (z *Log) source(name string) (*zerolog.Logger, *zerolog.Logger) {
+	if s, ok := z.sources[name]; ok {
+		return &s.logger, &s.success
 	}
+	return z.logger, z.logger
+}
+
+// Close closes the log file, if any
+func (z *Log) Close() error {
+	if z.out == nil {
+		return nil
+	}
+	return z.out.Close()
 }
 
 // Log logs using zerolog
-func (z *Log) Log(ctx echo.Context, source, msg string, err error, params map[string]interface{}) {
+func (z *Log) Log(ctx context.Context, source, msg string, err error, params map[string]interface{}) {
 
 	if params == nil {
 		params = make(map[string]interface{})
 	}
 
+	params = z.redact.params(source, params)
 	params["source"] = source
 
-	if id, ok := ctx.Get("id").(uint); ok {
-		params["id"] = id
-		params["user"] = ctx.Get("username").(string)
+	if u, ok := models.PrincipalFrom(ctx); ok {
+		params["id"] = u.ID
+		params["user"] = u.Username
 	}
 
+	addRequest(ctx, params)
+
+	logger, success := z.source(source)
 	if err != nil {
 		params["error"] = err
-		z.logger.Error().Fields(params).Msg(msg)
+		logger.Error().Fields(params).Msg(msg)
 		return
 	}
 
-	z.logger.Info().Fields(params).Msg(msg)
+	success.Info().Fields(params).Msg(msg)
+}
+
+// addRequest adds the ids of the request and of the trace of ctx to params
+func addRequest(ctx context.Context, params map[string]interface{}) {
+	if id, ok := models.RequestIDFrom(ctx); ok {
+		params["request_id"] = id
+	}
+	if sc := trace.SpanFromContext(ctx).SpanContext(); sc.IsValid() {
+		params["trace_id"] = sc.TraceID.String()
+		params["span_id"] = sc.SpanID.String()
+	}
+}
+
+// AccessLog returns a middleware logging every request once it is served
+// under the access source, server errors are logged at the error level and
+// client errors at the warn level. It is meant for Echo.Pre so that the
+// requests rejected by other middlewares are logged too, after the request
+// id middleware added with Echo.Pre by server.New.
+func (z *Log) AccessLog() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			begin := time.Now()
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+			req, res := c.Request(), c.Response()
+
+			logger, success := z.source(accessSource)
+			var e *zerolog.Event
+			switch {
+			case res.Status >= 500:
+				e = logger.Error()
+			case res.Status >= 400:
+				e = logger.Warn()
+			default:
+				e = success.Info()
+			}
+			params := map[string]interface{}{
+				"method":     req.Method,
+				"route":      c.Path(),
+				"path":       req.URL.Path,
+				"status":     res.Status,
+				"bytes_out":  res.Size,
+				"remote_ip":  c.RealIP(),
+				"user_agent": req.UserAgent(),
+				"took":       time.Since(begin),
+			}
+			// query values may hold personal data or credentials, such as
+			// search terms and cursors, only their keys are logged
+			if query := req.URL.Query(); len(query) > 0 {
+				params["query_keys"] = queryKeys(query)
+			}
+			params = z.redact.params(accessSource, params)
+			params["source"] = accessSource
+			addRequest(req.Context(), params)
+			e.Fields(params).Msg("request served")
+			return nil
+		}
+	}
+}
+
+// queryKeys returns the sorted keys of query
+func queryKeys(query url.Values) []string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
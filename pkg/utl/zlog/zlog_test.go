@@ -0,0 +1,290 @@
+package zlog_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johncoleman83/cerebrum/pkg/utl/config"
+	"github.com/johncoleman83/cerebrum/pkg/utl/models"
+	"github.com/johncoleman83/cerebrum/pkg/utl/server"
+	"github.com/johncoleman83/cerebrum/pkg/utl/tracing"
+	"github.com/johncoleman83/cerebrum/pkg/utl/zlog"
+)
+
+// lines decodes the json lines logged to buf
+func lines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var out []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		out = append(out, m)
+	}
+	buf.Reset()
+	return out
+}
+
+func TestNew(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "api.log")
+
+	cases := []struct {
+		name    string
+		cfg     *config.Logging
+		wantErr bool
+	}{
+		{name: "Defaults"},
+		{name: "Unknown level", cfg: &config.Logging{Level: "loud"}, wantErr: true},
+		{name: "Unknown format", cfg: &config.Logging{Format: "xml"}, wantErr: true},
+		{name: "Missing directory", cfg: &config.Logging{Output: filepath.Join(dir, "missing", "api.log")}, wantErr: true},
+		{name: "File output", cfg: &config.Logging{Level: "warn", Output: path}},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			log, err := zlog.New(tt.cfg)
+			assert.Equal(t, tt.wantErr, err != nil)
+			if err == nil {
+				assert.Nil(t, log.Close())
+			}
+		})
+	}
+
+	log, err := zlog.New(&config.Logging{Level: "warn", Output: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Log(context.Background(), "user", "View user request", nil, nil)
+	log.Log(context.Background(), "user", "View user request", errors.New("not found"), nil)
+	assert.Nil(t, log.Close())
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, strings.Count(string(data), "\n"), "only the lines at or above the level should be logged")
+	assert.Contains(t, string(data), `"level":"error"`)
+}
+
+func TestLog(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := zlog.NewTo(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := tracing.NewInMemoryExporter()
+	tr, err := tracing.NewWithExporter(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, span := tr.Tracer().Start(models.WithRequestID(context.Background(), "req-1"), "user.View")
+	log.Log(ctx, "user", "View user request", nil, map[string]interface{}{"req": 1})
+	span.End()
+
+	got := lines(t, &buf)
+	if !assert.Len(t, got, 1) {
+		return
+	}
+	assert.Equal(t, "req-1", got[0]["request_id"])
+	assert.Equal(t, span.SpanContext().TraceID.String(), got[0]["trace_id"])
+	assert.Equal(t, span.SpanContext().SpanID.String(), got[0]["span_id"])
+	assert.Equal(t, "user", got[0]["source"])
+	assert.NotEmpty(t, got[0]["time"])
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := zlog.NewTo(&buf, &config.Logging{Redact: []string{"access:user_agent"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := server.New(nil)
+	e.Pre(log.AccessLog())
+	e.GET("/users/:id", func(c echo.Context) error {
+		switch c.Param("id") {
+		case "0":
+			return echo.NewHTTPError(http.StatusNotFound)
+		case "panic":
+			panic("boom")
+		}
+		return c.NoContent(http.StatusOK)
+	})
+
+	cases := []struct {
+		name      string
+		path      string
+		wantLevel string
+		wantCode  float64
+		wantRoute string
+		wantPath  string
+		wantKeys  interface{}
+	}{
+		{name: "Success", path: "/users/1", wantLevel: "info", wantCode: 200, wantRoute: "/users/:id", wantPath: "/users/1"},
+		{name: "Client error", path: "/users/0", wantLevel: "warn", wantCode: 404, wantRoute: "/users/:id", wantPath: "/users/0"},
+		{name: "Recovered panic", path: "/users/panic", wantLevel: "error", wantCode: 500, wantRoute: "/users/:id", wantPath: "/users/panic"},
+		{name: "Query values left out", path: "/users/1?q=ada%40mail.com&limit=5", wantLevel: "info", wantCode: 200, wantRoute: "/users/:id", wantPath: "/users/1", wantKeys: []interface{}{"limit", "q"}},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set(echo.HeaderXRequestID, "req-2")
+			req.Header.Set("User-Agent", "ada@mail.com")
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			got := lines(t, &buf)
+			if !assert.Len(t, got, 1) {
+				return
+			}
+			assert.Equal(t, tt.wantLevel, got[0]["level"])
+			assert.Equal(t, tt.wantCode, got[0]["status"])
+			assert.Equal(t, tt.wantRoute, got[0]["route"])
+			assert.Equal(t, tt.wantPath, got[0]["path"])
+			assert.Equal(t, tt.wantKeys, got[0]["query_keys"])
+			assert.Nil(t, got[0]["uri"], "query values should not be logged")
+			assert.Equal(t, zlog.Redacted, got[0]["user_agent"], "access params should be redacted")
+			assert.Equal(t, "req-2", got[0]["request_id"])
+			assert.Equal(t, "access", got[0]["source"])
+		})
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	user := &models.User{
+		Base:      models.Base{ID: 7},
+		FirstName: "Ada",
+		Username:  "ada",
+		Password:  "hash",
+		Email:     "ada@example.com",
+		Phone:     "555-0100",
+		Token:     "refresh",
+	}
+	cases := []struct {
+		name   string
+		rules  []string
+		source string
+		params map[string]interface{}
+		want   map[string]interface{}
+	}{
+		{
+			name:   "Tagged fields",
+			source: "user",
+			params: map[string]interface{}{"resp": user},
+			want: map[string]interface{}{"resp": map[string]interface{}{
+				"id":                   7.0,
+				"created_at":           "0001-01-01T00:00:00Z",
+				"updated_at":           "0001-01-01T00:00:00Z",
+				"deleted_at":           nil,
+				"version":              0.0,
+				"first_name":           zlog.Redacted,
+				"last_name":            zlog.Redacted,
+				"username":             "ada",
+				"email":                zlog.Redacted,
+				"phone":                zlog.Redacted,
+				"account_id":           0.0,
+				"team_id":              0.0,
+				"role":                 map[string]interface{}{"id": 0.0, "access_level": 0.0, "name": ""},
+				"last_login":           "0001-01-01T00:00:00Z",
+				"last_password_change": "0001-01-01T00:00:00Z",
+			}},
+		},
+		{
+			name:   "Paths of slices",
+			rules:  []string{"resp.Username"},
+			source: "user",
+			params: map[string]interface{}{"resp": []models.AuthUser{{ID: 1, Username: "ada", Email: "ada@example.com"}}},
+			want: map[string]interface{}{"resp": []interface{}{map[string]interface{}{
+				"ID": 1.0, "AccountID": 0.0, "TeamID": 0.0, "Username": zlog.Redacted,
+				"Email": zlog.Redacted, "AccessLevel": 0.0,
+			}}},
+		},
+		{
+			name:   "Wildcards",
+			rules:  []string{"*.secret"},
+			source: "user",
+			params: map[string]interface{}{
+				"req":  map[string]string{"secret": "s3cr3t", "name": "ada"},
+				"resp": map[string]interface{}{"secret": 1},
+			},
+			want: map[string]interface{}{
+				"req":  map[string]interface{}{"secret": zlog.Redacted, "name": "ada"},
+				"resp": map[string]interface{}{"secret": zlog.Redacted},
+			},
+		},
+		{
+			name:   "Rules of the source",
+			rules:  []string{"auth:req"},
+			source: "auth",
+			params: map[string]interface{}{"req": "refresh-token"},
+			want:   map[string]interface{}{"req": zlog.Redacted},
+		},
+		{
+			name:   "Rules of other sources",
+			rules:  []string{"auth:req"},
+			source: "password",
+			params: map[string]interface{}{"req": 7},
+			want:   map[string]interface{}{"req": 7.0},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log, err := zlog.NewTo(&buf, &config.Logging{Redact: tt.rules})
+			if err != nil {
+				t.Fatal(err)
+			}
+			log.Log(context.Background(), tt.source, "request", nil, tt.params)
+			got := lines(t, &buf)
+			if !assert.Len(t, got, 1) {
+				return
+			}
+			for k, v := range tt.want {
+				assert.Equal(t, v, got[0][k], k)
+			}
+		})
+	}
+}
+
+func TestSources(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := zlog.NewTo(&buf, &config.Logging{
+		Level:    "info",
+		Levels:   map[string]string{"password": "error", "auth": "debug"},
+		Sampling: map[string]int{"user": 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := func(source string, err error, n int) int {
+		for i := 0; i < n; i++ {
+			log.Log(context.Background(), source, "request", err, nil)
+		}
+		return len(lines(t, &buf))
+	}
+	assert.Equal(t, 6, count("auth", nil, 6), "sources without sampling should log every line")
+	assert.Equal(t, 0, count("password", nil, 6), "successes below the level of the source should be dropped")
+	assert.Equal(t, 6, count("password", errors.New("boom"), 6))
+	assert.Equal(t, 2, count("user", nil, 6), "one in 3 successes should be logged")
+	assert.Equal(t, 6, count("user", errors.New("boom"), 6), "failures should never be sampled")
+
+	_, err = zlog.NewTo(&buf, &config.Logging{Levels: map[string]string{"user": "loud"}})
+	assert.NotNil(t, err, "unknown source levels should be rejected")
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/johncoleman83/cerebrum/pkg/api/migrations"
 	"github.com/johncoleman83/cerebrum/pkg/utl/config"
 	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
 	"github.com/johncoleman83/cerebrum/pkg/utl/models"
@@ -14,7 +15,6 @@ import (
 	"github.com/johncoleman83/cerebrum/pkg/utl/support"
 
 	"github.com/jinzhu/gorm"
-	_ "github.com/jinzhu/gorm/dialects/mysql" // for use with gorm
 )
 
 const (
@@ -46,7 +46,7 @@ func main() {
 	if cfg == nil {
 		log.Fatal("unknown error loading yaml file")
 	}
-	db, err := datastore.NewMySQLGormDb(cfg.DB)
+	db, err := datastore.NewGormDb(cfg.DB)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -97,22 +97,16 @@ func main() {
 	fmt.Println(fmt.Sprintf("bootstrap finished with %d db errors", len(db.GetErrors())))
 }
 
+// createSchema reverts all applied migrations and migrates the db up to the latest version
 func createSchema(db *gorm.DB) {
-	modelsList := []interface{}{
-		&models.Account{},
-		&models.Team{},
-		&models.Role{},
-		&models.User{},
-	}
-	for _, model := range modelsList {
-		if db.HasTable(model) {
-			log.Printf("dropping table for ")
-			if err := db.DropTable(model).Error; err != nil {
-				log.Fatal(err)
-			}
-		}
-		if err := db.CreateTable(model).Error; err != nil {
-			log.Fatal(err)
-		}
+	m, err := migrations.New(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := m.Reset(); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := m.Up(0); err != nil {
+		log.Fatal(err)
 	}
 }
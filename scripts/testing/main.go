@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/johncoleman83/cerebrum/pkg/api/migrations"
 	"github.com/johncoleman83/cerebrum/pkg/utl/config"
 	"github.com/johncoleman83/cerebrum/pkg/utl/datastore"
 	"github.com/johncoleman83/cerebrum/pkg/utl/models"
@@ -14,7 +15,6 @@ import (
 	"github.com/johncoleman83/cerebrum/pkg/utl/support"
 
 	"github.com/jinzhu/gorm"
-	_ "github.com/jinzhu/gorm/dialects/mysql" // for use with gorm
 )
 
 const (
@@ -40,16 +40,16 @@ func createUser(cfg *config.Configuration, sec *secure.Service, r uint, e, f, l,
 	return user
 }
 
-// buildQueries creates some SQL queries into a string slice
-func buildQueries() []string {
-	return []string{
-		"INSERT INTO accounts VALUES (1, now(), now(), NULL, 'admin_account', true);",
-		"INSERT INTO teams VALUES (1, now(), now(), NULL, 'admin_team', true, 'admin_description', 1);",
-		"INSERT INTO roles VALUES (1, 100, 'SUPER_ADMIN');",
-		"INSERT INTO roles VALUES (2, 110, 'ADMIN');",
-		"INSERT INTO roles VALUES (3, 120, 'ACCOUNT_ADMIN');",
-		"INSERT INTO roles VALUES (4, 130, 'TEAM_ADMIN');",
-		"INSERT INTO roles VALUES (5, 200, 'USER');",
+// buildRows creates the account, team and roles rows every user depends on
+func buildRows() []interface{} {
+	return []interface{}{
+		&models.Account{Base: models.Base{ID: 1}, Name: "admin_account", OwnerID: 1},
+		&models.Team{Base: models.Base{ID: 1}, Name: "admin_team", Description: "admin_description", AccountID: 1},
+		&models.Role{ID: 1, AccessLevel: models.SuperAdminRole, Name: "SUPER_ADMIN"},
+		&models.Role{ID: 2, AccessLevel: models.AdminRole, Name: "ADMIN"},
+		&models.Role{ID: 3, AccessLevel: models.AccountAdminRole, Name: "ACCOUNT_ADMIN"},
+		&models.Role{ID: 4, AccessLevel: models.TeamAdminRole, Name: "TEAM_ADMIN"},
+		&models.Role{ID: 5, AccessLevel: models.UserRole, Name: "USER"},
 	}
 }
 
@@ -66,15 +66,16 @@ func main() {
 	if cfg == nil {
 		log.Fatal("unknown error loading yaml file")
 	}
-	db, err := datastore.NewMySQLGormDb(cfg.DB)
+	db, err := datastore.NewGormDb(cfg.DB)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	queries := buildQueries()
-	createSchema(db, &models.Account{}, &models.Team{}, models.Role{}, &models.User{})
-	for _, v := range queries[0:len(queries)] {
-		db.Exec(v)
+	createSchema(db)
+	for _, v := range buildRows() {
+		if err := db.Create(v).Error; err != nil {
+			log.Fatal(err)
+		}
 	}
 	sec := secure.New(cfg.App.MinPasswordStr, sha1.New())
 	adminUser := createUser(
@@ -119,14 +120,16 @@ func main() {
 	log.Println("USER PASSWORD DOES MATCH!!")
 }
 
-func createSchema(db *gorm.DB, modelsList ...interface{}) {
-	for _, model := range modelsList {
-		if db.HasTable(model) {
-			log.Printf("dropping table for ")
-			db.DropTable(model)
-		}
-		if err := db.CreateTable(model).Error; err != nil {
-			log.Fatal(err)
-		}
+// createSchema reverts all applied migrations and migrates the db up to the latest version
+func createSchema(db *gorm.DB) {
+	m, err := migrations.New(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := m.Reset(); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := m.Up(0); err != nil {
+		log.Fatal(err)
 	}
 }